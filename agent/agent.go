@@ -0,0 +1,93 @@
+// Package agent provides local tools which a model may invoke through tool calls.
+package agent
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/go-errors/errors"
+	"github.com/jlcheng/jcllm/llm"
+)
+
+type (
+	// Tool is a local capability, such as reading a file, that can be offered to a model.
+	Tool interface {
+		// Definition describes the tool to the model.
+		Definition() llm.Tool
+		// Call runs the tool. The arguments are a JSON object matching the parameters schema of the Definition.
+		Call(ctx context.Context, arguments string) (string, error)
+	}
+
+	// ConfirmFunc asks the user to approve an action and reports whether it was approved.
+	ConfirmFunc func(question string) bool
+)
+
+var ErrToolNotFound = errors.New("tool not found")
+
+// Registry holds the tools available to a model, keyed by name.
+type Registry struct {
+	tools map[string]Tool
+	names []string
+}
+
+func NewRegistry(tools ...Tool) *Registry {
+	registry := &Registry{tools: make(map[string]Tool)}
+	for _, tool := range tools {
+		registry.Register(tool)
+	}
+	return registry
+}
+
+// Register adds a tool, replacing any existing tool of the same name.
+func (r *Registry) Register(tool Tool) {
+	name := tool.Definition().Name
+	if _, ok := r.tools[name]; !ok {
+		r.names = append(r.names, name)
+	}
+	r.tools[name] = tool
+}
+
+// Unregister removes the named tool, if present.
+func (r *Registry) Unregister(name string) {
+	delete(r.tools, name)
+	r.names = slices.DeleteFunc(r.names, func(elem string) bool {
+		return elem == name
+	})
+}
+
+// Definitions returns the definitions of all registered tools, in registration order.
+func (r *Registry) Definitions() []llm.Tool {
+	definitions := make([]llm.Tool, 0, len(r.names))
+	for _, name := range r.names {
+		definitions = append(definitions, r.tools[name].Definition())
+	}
+	return definitions
+}
+
+// Call runs the tool requested by the model.
+func (r *Registry) Call(ctx context.Context, call llm.ToolCall) (string, error) {
+	tool, ok := r.tools[call.Name]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrToolNotFound, call.Name)
+	}
+	arguments := call.Arguments
+	if arguments == "" {
+		arguments = "{}"
+	}
+	return tool.Call(ctx, arguments)
+}
+
+// ResultEntry creates the chat entry which reports the outcome of a tool call back to the model. Errors are reported
+// to the model as text, so it has a chance to correct its request.
+func ResultEntry(call llm.ToolCall, result string, err error) llm.ChatEntry {
+	if err != nil {
+		result = fmt.Sprintf("error: %v", err)
+	}
+	return llm.ChatEntry{
+		Role:       llm.RoleTool,
+		Parts:      []llm.Part{llm.TextPart(result)},
+		ToolCallID: call.ID,
+		ToolName:   call.Name,
+	}
+}
@@ -0,0 +1,107 @@
+package agent_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jlcheng/jcllm/agent"
+	"github.com/jlcheng/jcllm/llm"
+)
+
+func TestRegistry_Call(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	var questions []string
+	confirmAnswer := false
+	registry := agent.NewRegistry(agent.BuiltinTools(func(question string) bool {
+		questions = append(questions, question)
+		return confirmAnswer
+	})...)
+
+	tests := []struct {
+		name      string
+		call      llm.ToolCall
+		confirm   bool
+		want      string
+		wantError error
+	}{
+		{
+			name: "read file",
+			call: llm.ToolCall{Name: "read_file", Arguments: `{"path":"` + filepath.Join(dir, "notes.txt") + `"}`},
+			want: "hello",
+		},
+		{
+			name: "list directory",
+			call: llm.ToolCall{Name: "list_directory", Arguments: `{"path":"` + dir + `"}`},
+			want: "notes.txt\nsub/\n",
+		},
+		{
+			name:    "run approved shell command",
+			call:    llm.ToolCall{Name: "run_shell_command", Arguments: `{"command":"echo approved"}`},
+			confirm: true,
+			want:    "approved\n",
+		},
+		{
+			name:      "run declined shell command",
+			call:      llm.ToolCall{Name: "run_shell_command", Arguments: `{"command":"echo declined"}`},
+			wantError: agent.ErrNotConfirmed,
+		},
+		{
+			name:      "unknown tool",
+			call:      llm.ToolCall{Name: "delete_everything"},
+			wantError: agent.ErrToolNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			confirmAnswer = tt.confirm
+			got, err := registry.Call(context.Background(), tt.call)
+			if tt.wantError != nil {
+				if !errors.Is(err, tt.wantError) {
+					t.Errorf("Call() error = %v; want %v", err, tt.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Call() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Call() = %q; want %q", got, tt.want)
+			}
+		})
+	}
+
+	if len(questions) != 2 || !strings.Contains(questions[0], "echo approved") {
+		t.Errorf("confirmation questions = %q; want one per shell command", questions)
+	}
+}
+
+func TestRegistry_Definitions(t *testing.T) {
+	registry := agent.NewRegistry(agent.BuiltinTools(nil)...)
+	registry.Unregister("list_directory")
+	var names []string
+	for _, definition := range registry.Definitions() {
+		names = append(names, definition.Name)
+	}
+	if got := strings.Join(names, ","); got != "read_file,run_shell_command" {
+		t.Errorf("Definitions() = %s; want read_file,run_shell_command", got)
+	}
+}
+
+func TestResultEntry(t *testing.T) {
+	call := llm.ToolCall{ID: "call_1", Name: "read_file"}
+	entry := agent.ResultEntry(call, "", errors.New("no such file"))
+	if entry.Role != llm.RoleTool || entry.ToolCallID != "call_1" || entry.ToolName != "read_file" || entry.Text() != "error: no such file" {
+		t.Errorf("ResultEntry() = %+v; want a tool entry reporting the error", entry)
+	}
+}
@@ -0,0 +1,158 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/go-errors/errors"
+	"github.com/jlcheng/jcllm/llm"
+)
+
+// MaxOutputBytes limits how much of a file or command output is returned to the model.
+const MaxOutputBytes = 64 * 1024
+
+var ErrNotConfirmed = errors.New("the user declined to run the command")
+
+// BuiltinTools returns the tools jcllm offers in agent mode. Shell commands only run after confirm approves them.
+func BuiltinTools(confirm ConfirmFunc) []Tool {
+	return []Tool{
+		NewReadFileTool(),
+		NewListDirectoryTool(),
+		NewShellTool(confirm),
+	}
+}
+
+// NewReadFileTool creates a tool which returns the contents of a file.
+func NewReadFileTool() Tool {
+	return &funcTool{
+		definition: llm.Tool{
+			Name:        "read_file",
+			Description: "Reads a text file and returns its contents. Relative paths are resolved from the current working directory.",
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"path": map[string]any{"type": "string", "description": "The path of the file to read."},
+				},
+				"required": []string{"path"},
+			},
+		},
+		call: func(_ context.Context, arguments string) (string, error) {
+			var args struct {
+				Path string `json:"path"`
+			}
+			if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+				return "", errors.WrapPrefix(err, "invalid arguments", 0)
+			}
+			file, err := os.Open(args.Path)
+			if err != nil {
+				return "", err
+			}
+			defer file.Close()
+			content, err := io.ReadAll(io.LimitReader(file, MaxOutputBytes+1))
+			if err != nil {
+				return "", err
+			}
+			return truncate(string(content)), nil
+		},
+	}
+}
+
+// NewListDirectoryTool creates a tool which lists the entries of a directory.
+func NewListDirectoryTool() Tool {
+	return &funcTool{
+		definition: llm.Tool{
+			Name:        "list_directory",
+			Description: "Lists the entries of a directory. Directories are suffixed with a slash.",
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"path": map[string]any{"type": "string", "description": "The directory to list. Defaults to the current working directory."},
+				},
+			},
+		},
+		call: func(_ context.Context, arguments string) (string, error) {
+			var args struct {
+				Path string `json:"path"`
+			}
+			if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+				return "", errors.WrapPrefix(err, "invalid arguments", 0)
+			}
+			if args.Path == "" {
+				args.Path = "."
+			}
+			entries, err := os.ReadDir(args.Path)
+			if err != nil {
+				return "", err
+			}
+			var buf strings.Builder
+			for _, entry := range entries {
+				buf.WriteString(entry.Name())
+				if entry.IsDir() {
+					buf.WriteRune('/')
+				}
+				buf.WriteRune('\n')
+			}
+			return truncate(buf.String()), nil
+		},
+	}
+}
+
+// NewShellTool creates a tool which runs a shell command, once confirm approves it.
+func NewShellTool(confirm ConfirmFunc) Tool {
+	return &funcTool{
+		definition: llm.Tool{
+			Name:        "run_shell_command",
+			Description: "Runs a command with `sh -c` in the current working directory and returns its combined stdout and stderr. The user must approve every command.",
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"command": map[string]any{"type": "string", "description": "The command line to run."},
+				},
+				"required": []string{"command"},
+			},
+		},
+		call: func(ctx context.Context, arguments string) (string, error) {
+			var args struct {
+				Command string `json:"command"`
+			}
+			if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+				return "", errors.WrapPrefix(err, "invalid arguments", 0)
+			}
+			if confirm == nil || !confirm(fmt.Sprintf("Run `%s`?", args.Command)) {
+				return "", ErrNotConfirmed
+			}
+			output, err := exec.CommandContext(ctx, "sh", "-c", args.Command).CombinedOutput()
+			result := truncate(string(output))
+			if err != nil {
+				// The output of a failed command is usually the most useful part of the result
+				return fmt.Sprintf("%s\n(%v)", result, err), nil
+			}
+			return result, nil
+		},
+	}
+}
+
+type funcTool struct {
+	definition llm.Tool
+	call       func(ctx context.Context, arguments string) (string, error)
+}
+
+func (t *funcTool) Definition() llm.Tool {
+	return t.definition
+}
+
+func (t *funcTool) Call(ctx context.Context, arguments string) (string, error) {
+	return t.call(ctx, arguments)
+}
+
+func truncate(s string) string {
+	if len(s) <= MaxOutputBytes {
+		return s
+	}
+	return s[:MaxOutputBytes] + "\n...(truncated)"
+}
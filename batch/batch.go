@@ -0,0 +1,274 @@
+// Package batch runs a JSONL file of requests against the model providers concurrently.
+package batch
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/jlcheng/jcllm/llm"
+)
+
+// maxLineBytes bounds the size of a single line of the input or output file.
+const maxLineBytes = 64 * 1024 * 1024
+
+type (
+	// Request is a line of the input file. Provider and Model default to the configured ones. ID defaults to the line
+	// number and must be unique, as it is used to resume a partially completed batch. Args are generation settings,
+	// keyed by name, e.g., {"temperature": 0.2}.
+	Request struct {
+		ID           string           `json:"id,omitempty"`
+		Provider     string           `json:"provider,omitempty"`
+		Model        string           `json:"model,omitempty"`
+		Conversation llm.Conversation `json:"conversation"`
+		Args         map[string]any   `json:"args,omitempty"`
+	}
+
+	// Result is a line of the output file. Error is set when the request failed. Cost is in dollars, and only set for
+	// models with a price.
+	Result struct {
+		ID       string `json:"id"`
+		Provider string `json:"provider"`
+		Model    string `json:"model"`
+		Text     string `json:"text"`
+		llm.Usage
+		Cost           *float64 `json:"cost,omitempty"`
+		ElapsedSeconds float64  `json:"elapsed_seconds"`
+		Error          string   `json:"error,omitempty"`
+	}
+
+	// ProviderFactory creates the provider of the given name.
+	ProviderFactory func(name string) (llm.ProviderIfc, error)
+
+	// Summary counts the outcome of a batch run.
+	Summary struct {
+		Succeeded int
+		Failed    int
+		Skipped   int
+	}
+)
+
+// Runner sends requests to providers, with at most Concurrency requests in flight and at most RequestsPerMinute
+// requests started per provider.
+type Runner struct {
+	NewProvider     ProviderFactory
+	DefaultProvider string
+	DefaultModel    string
+	Concurrency     int
+	// RequestsPerMinute is the rate limit of each provider. A provider missing from the map, or with a limit of zero,
+	// is not rate limited.
+	RequestsPerMinute map[string]int
+	// Settings returns the generation settings of a model, which the args of a request override. If nil, only the args
+	// apply.
+	Settings func(modelName string) (llm.GenerationSettings, error)
+	// ResponseSchema is the JSON schema every response must conform to. A response which does not is a failure, so it
+	// is retried when the batch resumes.
+	ResponseSchema map[string]any
+	// RecordUsage records the usage of a response, and returns its cost, or nil if the model has no price. If nil, the
+	// usage is not recorded.
+	RecordUsage func(provider string, model string, usage llm.Usage) *float64
+
+	mu        sync.Mutex
+	providers map[string]llm.ProviderIfc
+	limiters  map[string]*rateLimiter
+}
+
+// CompletedIDs reads a previous output file and returns the ids of the requests which succeeded. Failed requests are
+// not included, so they are retried when the batch is resumed.
+func CompletedIDs(output io.Reader) (map[string]bool, error) {
+	completed := make(map[string]bool)
+	scanner := bufio.NewScanner(output)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineBytes)
+	for scanner.Scan() {
+		var result Result
+		// A crash may leave a truncated last line behind, which is simply treated as not completed
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			continue
+		}
+		completed[result.ID] = result.Error == ""
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.WrapPrefix(err, "cannot read previous output", 0)
+	}
+	return completed, nil
+}
+
+// Run reads requests from input and writes a result for each of them to output, as soon as it completes. Requests
+// whose id is marked in completed are skipped.
+func (r *Runner) Run(ctx context.Context, input io.Reader, output io.Writer, completed map[string]bool) (Summary, error) {
+	var (
+		summary   Summary
+		outputMu  sync.Mutex
+		outputErr error
+		wg        sync.WaitGroup
+	)
+	writeResult := func(result Result) {
+		outputMu.Lock()
+		defer outputMu.Unlock()
+		if result.Error == "" {
+			summary.Succeeded++
+		} else {
+			summary.Failed++
+		}
+		line, err := json.Marshal(result)
+		if err == nil {
+			_, err = output.Write(append(line, '\n'))
+		}
+		if err != nil && outputErr == nil {
+			outputErr = errors.WrapPrefix(err, "cannot write result", 0)
+		}
+	}
+
+	concurrency := max(r.Concurrency, 1)
+	semaphore := make(chan struct{}, concurrency)
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineBytes)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var request Request
+		if err := json.Unmarshal([]byte(line), &request); err != nil {
+			writeResult(Result{ID: strconv.Itoa(lineNumber), Error: fmt.Sprintf("invalid request: %v", err)})
+			continue
+		}
+		if request.ID == "" {
+			request.ID = strconv.Itoa(lineNumber)
+		}
+		if completed[request.ID] {
+			summary.Skipped++
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return summary, ctx.Err()
+		case semaphore <- struct{}{}:
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			writeResult(r.solicit(ctx, request))
+		}()
+	}
+	wg.Wait()
+	if err := scanner.Err(); err != nil {
+		return summary, errors.WrapPrefix(err, "cannot read input", 0)
+	}
+	return summary, outputErr
+}
+
+func (r *Runner) solicit(ctx context.Context, request Request) Result {
+	result := Result{
+		ID:       request.ID,
+		Provider: request.Provider,
+		Model:    request.Model,
+	}
+	if result.Provider == "" {
+		result.Provider = r.DefaultProvider
+	}
+	if result.Model == "" {
+		result.Model = r.DefaultModel
+	}
+	provider, limiter, err := r.provider(result.Provider)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if err := limiter.Wait(ctx); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	settings, overrides, err := r.settings(result.Model, request.Args)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	startTime := time.Now()
+	resp, err := provider.SolicitResponse(ctx, llm.SolicitResponseInput{
+		ModelName:      result.Model,
+		Conversation:   request.Conversation,
+		Settings:       settings,
+		Overrides:      overrides,
+		ResponseSchema: r.ResponseSchema,
+	})
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if resp.Model != "" {
+		result.Provider, result.Model = resp.Provider, resp.Model
+	}
+	var text strings.Builder
+	for message, err := range resp.Messages {
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			result.Error = err.Error()
+			break
+		}
+		text.WriteString(message.Text)
+		result.Usage.Add(message.Usage())
+	}
+	result.Text = text.String()
+	result.ElapsedSeconds = time.Since(startTime).Seconds()
+	if r.RecordUsage != nil {
+		result.Cost = r.RecordUsage(result.Provider, result.Model, result.Usage)
+	}
+	if r.ResponseSchema != nil && result.Error == "" {
+		if err := llm.ValidateResponse(r.ResponseSchema, result.Text); err != nil {
+			result.Error = err.Error()
+		}
+	}
+	return result
+}
+
+// settings returns the settings of a request, and the settings which its args override.
+func (r *Runner) settings(modelName string, args map[string]any) (settings llm.GenerationSettings, overrides llm.GenerationSettings, err error) {
+	if r.Settings != nil {
+		if settings, err = r.Settings(modelName); err != nil {
+			return settings, overrides, err
+		}
+	}
+	for name, value := range args {
+		if err := settings.SetValue(name, value); err != nil {
+			return settings, overrides, errors.WrapPrefix(err, "invalid args", 0)
+		}
+		_ = overrides.SetValue(name, value)
+	}
+	return settings, overrides, nil
+}
+
+// provider returns the provider of the given name, and its rate limiter, creating them on first use.
+func (r *Runner) provider(name string) (llm.ProviderIfc, *rateLimiter, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.providers == nil {
+		r.providers = make(map[string]llm.ProviderIfc)
+		r.limiters = make(map[string]*rateLimiter)
+	}
+	if provider, ok := r.providers[name]; ok {
+		return provider, r.limiters[name], nil
+	}
+	provider, err := r.NewProvider(name)
+	if err != nil {
+		return nil, nil, errors.WrapPrefix(err, fmt.Sprintf("cannot instantiate provider [%s]", name), 0)
+	}
+	r.providers[name] = provider
+	r.limiters[name] = newRateLimiter(r.RequestsPerMinute[name])
+	return provider, r.limiters[name], nil
+}
@@ -0,0 +1,189 @@
+package batch_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/jlcheng/jcllm/batch"
+	"github.com/jlcheng/jcllm/llm"
+)
+
+// echoProvider answers with the model name and the last entry of the conversation.
+type echoProvider struct {
+	inFlight    atomic.Int32
+	maxInFlight atomic.Int32
+	calls       atomic.Int32
+}
+
+func (p *echoProvider) ToProviderRole(role string) string                   { return role }
+func (p *echoProvider) ToGenericRole(role string) string                    { return role }
+func (p *echoProvider) ListModels(context.Context) ([]llm.ModelInfo, error) { return nil, nil }
+
+func (p *echoProvider) SolicitResponse(ctx context.Context, input llm.SolicitResponseInput) (llm.ResponseStream, error) {
+	p.calls.Add(1)
+	n := p.inFlight.Add(1)
+	defer p.inFlight.Add(-1)
+	for {
+		current := p.maxInFlight.Load()
+		if n <= current || p.maxInFlight.CompareAndSwap(current, n) {
+			break
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	text := input.Conversation.Entries[len(input.Conversation.Entries)-1].Text()
+	if text == "fail" {
+		return llm.ResponseStream{}, errors.Errorf("request failed")
+	}
+	return llm.ResponseStream{
+		Role: llm.RoleAssistant,
+		Messages: func(yield func(llm.Message, error) bool) {
+			yield(llm.Message{Text: input.ModelName + ": " + text, InputTokenCount: 3, TokenCount: 2}, nil)
+		},
+	}, nil
+}
+
+var _ llm.ProviderIfc = (*echoProvider)(nil)
+
+func requestLine(id, text string) string {
+	line, _ := json.Marshal(batch.Request{
+		ID:           id,
+		Conversation: llm.Conversation{Entries: []llm.ChatEntry{llm.NewTextEntry(llm.RoleUser, text)}},
+	})
+	return string(line)
+}
+
+func results(t *testing.T, output string) map[string]batch.Result {
+	t.Helper()
+	byID := make(map[string]batch.Result)
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		var result batch.Result
+		if err := json.Unmarshal([]byte(line), &result); err != nil {
+			t.Fatalf("invalid output line %q: %v", line, err)
+		}
+		byID[result.ID] = result
+	}
+	return byID
+}
+
+func newRunner(provider llm.ProviderIfc, concurrency int) *batch.Runner {
+	return &batch.Runner{
+		NewProvider: func(name string) (llm.ProviderIfc, error) {
+			if name != "echo" {
+				return nil, llm.ErrProviderNotFound
+			}
+			return provider, nil
+		},
+		DefaultProvider: "echo",
+		DefaultModel:    "m1",
+		Concurrency:     concurrency,
+	}
+}
+
+func TestRun(t *testing.T) {
+	provider := &echoProvider{}
+	lines := []string{
+		requestLine("a", "hello"),
+		requestLine("b", "fail"),
+		`{"provider": "missing", "conversation": {"entries": [{"role": "RoleUser", "text": "hi"}]}}`,
+		`not json`,
+		"",
+		requestLine("", "no id"),
+	}
+	var output bytes.Buffer
+	summary, err := newRunner(provider, 2).Run(context.Background(), strings.NewReader(strings.Join(lines, "\n")), &output, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary != (batch.Summary{Succeeded: 2, Failed: 3}) {
+		t.Errorf("unexpected summary: %+v", summary)
+	}
+
+	got := results(t, output.String())
+	if r := got["a"]; r.Text != "m1: hello" || r.Model != "m1" || r.Provider != "echo" || r.InputTokens != 3 || r.OutputTokens != 2 || r.Error != "" {
+		t.Errorf("unexpected result a: %+v", r)
+	}
+	if r := got["b"]; r.Error == "" {
+		t.Errorf("expected an error for b: %+v", r)
+	}
+	if r := got["3"]; !strings.Contains(r.Error, "missing") {
+		t.Errorf("expected an unknown provider error for line 3: %+v", r)
+	}
+	if r := got["4"]; !strings.Contains(r.Error, "invalid request") {
+		t.Errorf("expected an invalid request error for line 4: %+v", r)
+	}
+	if r := got["6"]; r.Text != "m1: no id" {
+		t.Errorf("expected the line number as the default id: %+v", r)
+	}
+}
+
+func TestRunConcurrency(t *testing.T) {
+	provider := &echoProvider{}
+	var input strings.Builder
+	for i := range 10 {
+		input.WriteString(requestLine(string(rune('a'+i)), "hello") + "\n")
+	}
+	var output bytes.Buffer
+	if _, err := newRunner(provider, 3).Run(context.Background(), strings.NewReader(input.String()), &output, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := provider.maxInFlight.Load(); got > 3 || got < 2 {
+		t.Errorf("expected up to 3 requests in flight, got %d", got)
+	}
+	if got := len(results(t, output.String())); got != 10 {
+		t.Errorf("expected 10 results, got %d", got)
+	}
+}
+
+func TestResume(t *testing.T) {
+	previous := strings.Join([]string{
+		`{"id": "a", "text": "done"}`,
+		`{"id": "b", "error": "request failed"}`,
+		`{"id": "c", "te`,
+	}, "\n")
+	completed, err := batch.CompletedIDs(strings.NewReader(previous))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provider := &echoProvider{}
+	input := strings.Join([]string{requestLine("a", "hello"), requestLine("b", "hello"), requestLine("c", "hello")}, "\n")
+	var output bytes.Buffer
+	summary, err := newRunner(provider, 1).Run(context.Background(), strings.NewReader(input), &output, completed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary != (batch.Summary{Succeeded: 2, Skipped: 1}) {
+		t.Errorf("unexpected summary: %+v", summary)
+	}
+	got := results(t, output.String())
+	if _, ok := got["a"]; ok {
+		t.Errorf("completed request a should have been skipped")
+	}
+	if provider.calls.Load() != 2 {
+		t.Errorf("expected 2 calls, got %d", provider.calls.Load())
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	provider := &echoProvider{}
+	runner := newRunner(provider, 4)
+	// 600 requests per minute is one every 100ms
+	runner.RequestsPerMinute = map[string]int{"echo": 600}
+	input := strings.Join([]string{requestLine("a", "x"), requestLine("b", "x"), requestLine("c", "x")}, "\n")
+
+	var output bytes.Buffer
+	startTime := time.Now()
+	if _, err := runner.Run(context.Background(), strings.NewReader(input), &output, nil); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(startTime); elapsed < 200*time.Millisecond {
+		t.Errorf("expected the rate limit to space out requests, took %v", elapsed)
+	}
+}
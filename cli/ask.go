@@ -0,0 +1,164 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/jlcheng/jcllm/configuration"
+	"github.com/jlcheng/jcllm/configuration/keys"
+	"github.com/jlcheng/jcllm/extract"
+	"github.com/jlcheng/jcllm/llm"
+	"github.com/jlcheng/jcllm/llm/providers/registry"
+	"github.com/jlcheng/jcllm/usage"
+)
+
+// AskResult is the output of the ask command in json mode. Cost is in dollars, and only set for models with a price.
+type AskResult struct {
+	Provider string `json:"provider"`
+	Model    string `json:"model"`
+	Text     string `json:"text"`
+	llm.Usage
+	Cost           *float64 `json:"cost,omitempty"`
+	ElapsedSeconds float64  `json:"elapsed_seconds"`
+}
+
+// Ask sends a single prompt to the configured model and writes the answer to stdout. The prompt is made of the
+// positional arguments followed by stdin, when stdin is not a terminal, e.g., `git diff | jcllm --command ask "review this"`.
+func (cli *CLI) Ask() error {
+	prompt, err := readPrompt(cli.config.Strings(configuration.ArgsKey), os.Stdin)
+	if err != nil {
+		return err
+	}
+	name := cli.config.String(keys.OptionProvider)
+	provider, err := registry.NewProvider(context.Background(), cli.config, name)
+	if err != nil {
+		return errors.WrapPrefix(err, fmt.Sprintf("cannot instantiate provider [%s]", name), 0)
+	}
+	return cli.ask(context.Background(), provider, prompt, os.Stdout)
+}
+
+func (cli *CLI) ask(ctx context.Context, provider llm.ProviderIfc, prompt string, stdout io.Writer) error {
+	output := cli.config.String(keys.OptionOutput)
+	switch output {
+	case keys.OutputText, keys.OutputJSON, keys.OutputCode:
+	default:
+		return errors.Errorf("unknown output format: %s", output)
+	}
+
+	startTime := time.Now()
+	result := AskResult{
+		Provider: cli.config.String(keys.OptionProvider),
+		Model:    cli.config.String(keys.OptionModel),
+	}
+	settings, err := llm.SettingsFromConfig(cli.config, result.Model)
+	if err != nil {
+		return err
+	}
+	schema, err := cli.responseSchema()
+	if err != nil {
+		return err
+	}
+	meter, err := usage.NewMeter(cli.config)
+	if err != nil {
+		return err
+	}
+	resp, err := provider.SolicitResponse(ctx, llm.SolicitResponseInput{
+		ModelName: result.Model,
+		Conversation: llm.Conversation{
+			Entries: []llm.ChatEntry{llm.NewTextEntry(llm.RoleUser, prompt)},
+		},
+		Settings:       settings,
+		ResponseSchema: schema,
+	})
+	if err != nil {
+		return errors.WrapPrefix(err, "request to llm failed", 0)
+	}
+	if resp.Model != "" {
+		result.Provider, result.Model = resp.Provider, resp.Model
+	}
+	var responseBuffer strings.Builder
+	for message, err := range resp.Messages {
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return errors.WrapPrefix(err, "error read from llm stream", 0)
+		}
+		// Text is streamed as it arrives, the other formats need the complete response
+		if output == keys.OutputText {
+			if _, err := fmt.Fprint(stdout, message.Text); err != nil {
+				return err
+			}
+		}
+		responseBuffer.WriteString(message.Text)
+		result.Usage.Add(message.Usage())
+	}
+	result.Text = responseBuffer.String()
+	result.ElapsedSeconds = time.Since(startTime).Seconds()
+	// The ledger is bookkeeping, which must not fail the command
+	record, recordErr := meter.Record(result.Provider, result.Model, result.Usage)
+	if recordErr != nil {
+		cli.logger.Errorf("cannot record usage: %v", recordErr)
+	}
+	result.Cost = record.Cost
+
+	switch output {
+	case keys.OutputText:
+		if !strings.HasSuffix(result.Text, "\n") {
+			_, err = fmt.Fprintln(stdout)
+		}
+	case keys.OutputJSON:
+		err = json.NewEncoder(stdout).Encode(result)
+	case keys.OutputCode:
+		for _, block := range extract.CodeBlocks(result.Text) {
+			if _, err = fmt.Fprint(stdout, block); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+	// The response is printed even when it does not match the schema, which helps to fix the schema or the prompt
+	if schema != nil {
+		return llm.ValidateResponse(schema, result.Text)
+	}
+	return nil
+}
+
+// responseSchema loads the JSON schema set by --schema, or returns nil if there is none.
+func (cli *CLI) responseSchema() (map[string]any, error) {
+	path := cli.config.String(keys.OptionSchema)
+	if path == "" {
+		return nil, nil
+	}
+	return llm.LoadSchema(path)
+}
+
+// readPrompt combines the positional arguments with the piped stdin, if any.
+func readPrompt(args []string, stdin *os.File) (string, error) {
+	parts := make([]string, 0, 2)
+	if prompt := strings.TrimSpace(strings.Join(args, " ")); prompt != "" {
+		parts = append(parts, prompt)
+	}
+	// Only pipes and redirected files are read. A terminal or other device as stdin means nothing was piped in.
+	if stat, err := stdin.Stat(); err == nil && (stat.Mode()&os.ModeNamedPipe != 0 || stat.Mode().IsRegular()) {
+		piped, err := io.ReadAll(stdin)
+		if err != nil {
+			return "", errors.WrapPrefix(err, "cannot read stdin", 0)
+		}
+		if text := strings.TrimSpace(string(piped)); text != "" {
+			parts = append(parts, text)
+		}
+	}
+	if len(parts) == 0 {
+		return "", errors.Errorf("no prompt: pass it as arguments or pipe it to stdin")
+	}
+	return strings.Join(parts, "\n\n"), nil
+}
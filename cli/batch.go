@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/go-errors/errors"
+	"github.com/jlcheng/jcllm/batch"
+	"github.com/jlcheng/jcllm/configuration/keys"
+	"github.com/jlcheng/jcllm/llm"
+	"github.com/jlcheng/jcllm/llm/providers/registry"
+	"github.com/jlcheng/jcllm/usage"
+)
+
+// Batch runs every request of the batch input file and appends the results to the batch output file. When the output
+// file already exists, the requests which succeeded in a previous run are skipped.
+func (cli *CLI) Batch() error {
+	inputPath := cli.config.String(keys.OptionBatchInput)
+	outputPath := cli.config.String(keys.OptionBatchOutput)
+	if inputPath == "" || outputPath == "" {
+		return errors.Errorf("both --%s and --%s are required", keys.OptionBatchInput, keys.OptionBatchOutput)
+	}
+
+	var input io.Reader = os.Stdin
+	if inputPath != "-" {
+		file, err := os.Open(inputPath)
+		if err != nil {
+			return errors.WrapPrefix(err, "cannot open batch input", 0)
+		}
+		defer file.Close()
+		input = file
+	}
+
+	output, err := os.OpenFile(outputPath, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return errors.WrapPrefix(err, "cannot open batch output", 0)
+	}
+	defer output.Close()
+	completed, err := batch.CompletedIDs(output)
+	if err != nil {
+		return err
+	}
+	if len(completed) > 0 {
+		fmt.Fprintf(os.Stderr, "Resuming batch from %s\n", outputPath)
+	}
+	// A crash may have left a partial last line, which must not swallow the first new result
+	if stat, err := output.Stat(); err == nil && stat.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := output.ReadAt(last, stat.Size()-1); err == nil && last[0] != '\n' {
+			if _, err := output.WriteString("\n"); err != nil {
+				return errors.WrapPrefix(err, "cannot write batch output", 0)
+			}
+		}
+	}
+
+	rateLimit := cli.config.Int(keys.OptionBatchRateLimit)
+	requestsPerMinute := make(map[string]int)
+	for _, name := range []string{keys.ProviderAnthropic, keys.ProviderGemini, keys.ProviderOllama, keys.ProviderOpenAI} {
+		requestsPerMinute[name] = rateLimit
+	}
+	for name, limit := range cli.config.IntMap(keys.OptionBatchRateLimits) {
+		requestsPerMinute[name] = limit
+	}
+	schema, err := cli.responseSchema()
+	if err != nil {
+		return err
+	}
+	meter, err := usage.NewMeter(cli.config)
+	if err != nil {
+		return err
+	}
+	runner := &batch.Runner{
+		NewProvider: func(name string) (llm.ProviderIfc, error) {
+			return registry.NewProvider(context.Background(), cli.config, name)
+		},
+		DefaultProvider:   cli.config.String(keys.OptionProvider),
+		DefaultModel:      cli.config.String(keys.OptionModel),
+		Concurrency:       cli.config.Int(keys.OptionBatchConcurrency),
+		RequestsPerMinute: requestsPerMinute,
+		Settings: func(modelName string) (llm.GenerationSettings, error) {
+			return llm.SettingsFromConfig(cli.config, modelName)
+		},
+		ResponseSchema: schema,
+		RecordUsage: func(provider string, model string, tokens llm.Usage) *float64 {
+			record, err := meter.Record(provider, model, tokens)
+			if err != nil {
+				cli.logger.Errorf("cannot record usage: %v", err)
+			}
+			return record.Cost
+		},
+	}
+	summary, err := runner.Run(context.Background(), input, output, completed)
+	fmt.Fprintf(os.Stderr, "%d succeeded, %d failed, %d skipped\n", summary.Succeeded, summary.Failed, summary.Skipped)
+	if err != nil {
+		return err
+	}
+	if summary.Failed > 0 {
+		return errors.Errorf("%d batch requests failed, run the batch again to retry them", summary.Failed)
+	}
+	return nil
+}
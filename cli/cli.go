@@ -7,6 +7,7 @@ import (
 	"github.com/go-errors/errors"
 	"github.com/jlcheng/jcllm/configuration"
 	"github.com/jlcheng/jcllm/configuration/keys"
+	"github.com/jlcheng/jcllm/dye"
 	"github.com/jlcheng/jcllm/llm"
 	"github.com/jlcheng/jcllm/llm/providers/registry"
 	"github.com/jlcheng/jcllm/log"
@@ -30,7 +31,7 @@ func New(version string, commit string, config configuration.Configuration) *CLI
 }
 
 func (cli *CLI) ListProviders() error {
-	providers := []string{keys.ProviderGemini, keys.ProviderOpenAI}
+	providers := []string{keys.ProviderAnthropic, keys.ProviderGemini, keys.ProviderOllama, keys.ProviderOpenAI, keys.ProviderReplay, keys.ProviderRouter}
 	fmt.Println("Supported providers:")
 	for _, provider := range providers {
 		fmt.Println(provider)
@@ -38,13 +39,30 @@ func (cli *CLI) ListProviders() error {
 	return nil
 }
 
+func (cli *CLI) ListProfiles() error {
+	profiles, ok := cli.config.(configuration.Profiles)
+	if !ok || len(profiles.ProfileNames()) == 0 {
+		fmt.Println("No profiles. Add [profiles.<name>] tables to the configuration file.")
+		return nil
+	}
+	fmt.Println("Profiles:")
+	for _, name := range profiles.ProfileNames() {
+		if name == profiles.Profile() {
+			fmt.Println(dye.Strf("%s (current)", name).As(dye.RoleModel))
+			continue
+		}
+		fmt.Println(name)
+	}
+	return nil
+}
+
 func (cli *CLI) ListModels() error {
 	name := cli.config.String(keys.OptionProvider)
 	provider, err := registry.NewProvider(context.Background(), cli.config, name)
 	if err != nil {
 		cli.logger.Errorf("cannot instantiate provider [%s]: %v", name, err)
 		if errors.Is(err, llm.ErrProviderNotFound) {
-			fmt.Printf("provider not found: %v\n", name)
+			fmt.Println(dye.Strf("provider not found: %v", name).As(dye.RoleError))
 			return nil
 		}
 		return errors.WrapPrefix(err, fmt.Sprintf("cannot instantiate provider [%s]", name), 0)
@@ -55,11 +73,52 @@ func (cli *CLI) ListModels() error {
 		return errors.Errorf("cannot list models: %v", err)
 	}
 	for _, model := range models {
-		fmt.Printf("=== %s ===\n", model.Name)
+		fmt.Println(dye.Strf("=== %s ===", model.Name).As(dye.RoleModel))
 		fmt.Printf("    Description: %s\n", model.Description)
 		fmt.Printf("    Max tokens: %d\n", model.MaxTokens)
 		fmt.Printf("    Version: %s\n", model.Version)
+		if model.Size != 0 {
+			fmt.Printf("    Size: %.2f GB\n", float64(model.Size)/1e9)
+		}
+		if model.Quantization != "" {
+			fmt.Printf("    Quantization: %s\n", model.Quantization)
+		}
+	}
+	return nil
+}
+
+func (cli *CLI) PullModel() error {
+	name := cli.config.String(keys.OptionProvider)
+	provider, err := registry.NewProvider(context.Background(), cli.config, name)
+	if err != nil {
+		return errors.WrapPrefix(err, fmt.Sprintf("cannot instantiate provider [%s]", name), 0)
+	}
+	puller, ok := provider.(llm.ModelPuller)
+	if !ok {
+		return errors.Errorf("provider [%s] does not support pulling models", name)
+	}
+	modelName := cli.config.String(keys.OptionModel)
+	progress, err := puller.PullModel(context.Background(), modelName)
+	if err != nil {
+		return errors.WrapPrefix(err, fmt.Sprintf("cannot pull model [%s]", modelName), 0)
+	}
+	lastStatus := ""
+	for update, err := range progress {
+		if err != nil {
+			fmt.Println()
+			return errors.WrapPrefix(err, fmt.Sprintf("cannot pull model [%s]", modelName), 0)
+		}
+		if update.Status != lastStatus && lastStatus != "" {
+			fmt.Println()
+		}
+		lastStatus = update.Status
+		if update.Total > 0 {
+			fmt.Printf("\r%s: %.1f%%", update.Status, 100*float64(update.Completed)/float64(update.Total))
+		} else {
+			fmt.Printf("\r%s", update.Status)
+		}
 	}
+	fmt.Println()
 	return nil
 }
 
@@ -71,7 +130,7 @@ func (cli *CLI) Repl() error {
 		return errors.WrapPrefix(err, "provider error", 0)
 	}
 
-	if err := repl.Run(cli.config, provider); err != nil {
+	if err := repl.Run(context.Background(), cli.config, ConfigRules, provider); err != nil {
 		return errors.WrapPrefix(err, "repl error", 0)
 	}
 	return nil
@@ -83,24 +142,73 @@ func (cli *CLI) Do() error {
 		fmt.Printf("commit: %s\n", cli.commit)
 		return nil
 	}
-
 	command := cli.config.String(keys.OptionCommand)
+	// The doctor command reports the problems instead
+	if command != "doctor" {
+		if problems := configuration.Validate(cli.config, ConfigRules); len(problems) != 0 {
+			return problemsError(problems)
+		}
+		if err := cli.configureColors(); err != nil {
+			return err
+		}
+	}
+
 	switch command {
+	case "ask":
+		if err := cli.Ask(); err != nil {
+			cli.logger.Errorf("cannot ask: %v", err)
+			return err
+		}
+	case "batch":
+		if err := cli.Batch(); err != nil {
+			cli.logger.Errorf("cannot run batch: %v", err)
+			return err
+		}
+	case "doctor":
+		if err := cli.Doctor(); err != nil {
+			cli.logger.Errorf("cannot run doctor: %v", err)
+			return err
+		}
+	case "embed":
+		if err := cli.Embed(); err != nil {
+			cli.logger.Errorf("cannot embed: %v", err)
+			return err
+		}
 	case "list-models":
 		if err := cli.ListModels(); err != nil {
 			cli.logger.Errorf("cannot list models: %v", err)
 			return err
 		}
+	case "list-profiles":
+		if err := cli.ListProfiles(); err != nil {
+			cli.logger.Errorf("cannot list profiles: %v", err)
+			return err
+		}
 	case "list-providers":
 		if err := cli.ListProviders(); err != nil {
 			cli.logger.Errorf("cannot list providers: %v", err)
 			return err
 		}
+	case "pull-model":
+		if err := cli.PullModel(); err != nil {
+			cli.logger.Errorf("cannot pull model: %v", err)
+			return err
+		}
 	case "repl":
 		if err := cli.Repl(); err != nil {
 			cli.logger.Errorf("cannot start repl: %v", err)
 			return err
 		}
+	case "serve":
+		if err := cli.Serve(); err != nil {
+			cli.logger.Errorf("cannot serve: %v", err)
+			return err
+		}
+	case "usage":
+		if err := cli.Usage(); err != nil {
+			cli.logger.Errorf("cannot summarize usage: %v", err)
+			return err
+		}
 	case "":
 		return fmt.Errorf("no command specified")
 	default:
@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/go-errors/errors"
+
+	"github.com/jlcheng/jcllm/configuration/keys"
+	"github.com/jlcheng/jcllm/dye"
+)
+
+// configureColors applies the color and theme options to the dye package.
+//
+// A theme is either built in, or defined by a table of the configuration file which maps roles to styles. The table
+// starts from the built-in theme of the same name, if any, or from the default theme:
+//
+//	[themes.solarized]
+//	prompt="cyan"
+//	error="bold magenta"
+func (cli *CLI) configureColors() error {
+	switch color := cli.config.String(keys.OptionColor); color {
+	case "always":
+		dye.SetEnabled(true)
+	case "never":
+		dye.SetEnabled(false)
+	case "auto", "":
+	default:
+		return errors.Errorf("invalid %s %q, expected auto, always, or never", keys.OptionColor, color)
+	}
+
+	name := cli.config.String(keys.OptionTheme)
+	if name == "" {
+		name = "default"
+	}
+	base, builtin := dye.Themes[name]
+	custom := cli.config.StringMap(keys.OptionThemes + "." + name)
+	if !builtin && len(custom) == 0 {
+		return errors.Errorf("unknown theme %q, expected one of %v or a [%s.%s] table in the configuration file",
+			name, slices.Sorted(maps.Keys(dye.Themes)), keys.OptionThemes, name)
+	}
+	if !builtin {
+		base = dye.Themes["default"]
+	}
+	theme := maps.Clone(base)
+	for role, spec := range custom {
+		if !slices.Contains(dye.Roles, dye.Role(role)) {
+			return errors.Errorf("unknown role %q in theme %q, expected one of %v", role, name, dye.Roles)
+		}
+		style, err := dye.ParseStyle(spec)
+		if err != nil {
+			return errors.WrapPrefix(err, fmt.Sprintf("invalid theme %q", name), 0)
+		}
+		theme[dye.Role(role)] = style
+	}
+	dye.SetTheme(theme)
+	return nil
+}
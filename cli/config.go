@@ -1,22 +1,171 @@
 package cli
 
 import (
+	"strings"
+
+	"github.com/go-errors/errors"
+
 	"github.com/jlcheng/jcllm/configuration"
 	"github.com/jlcheng/jcllm/configuration/keys"
+	"github.com/jlcheng/jcllm/configuration/secrets"
+	"github.com/jlcheng/jcllm/llm"
 )
 
 var ConfigMetadata = []configuration.Metadata{
-	{keys.OptionCommand, "repl", "Supported commands are: list-models, list-providers, repl"},
+	{keys.OptionAgentMaxSteps, "10", "In agent mode, the maximum number of tool-calling rounds per question"},
+	{keys.OptionAnthropicApiKey, "", "Anthropic API key"},
+	{keys.OptionAnthropicApiKeyCmd, "", "A command which prints the Anthropic API key, e.g., pass show anthropic. It runs once per process"},
+	{keys.OptionAnthropicApiKeyFile, "", "A file, only readable by the user, which contains the Anthropic API key"},
+	{keys.OptionAnthropicBaseURL, "https://api.anthropic.com/v1", "Anthropic base url"},
+	{keys.OptionAnthropicMaxTokens, "4096", "The maximum number of tokens Anthropic models may generate per response"},
+	{keys.OptionBatchConcurrency, "4", "The maximum number of batch requests in flight at once"},
+	{keys.OptionBatchInput, "", "The JSONL file of batch requests, or - for stdin"},
+	{keys.OptionBatchOutput, "", "The JSONL file batch results are appended to. An existing file resumes the batch, skipping the requests which succeeded"},
+	{keys.OptionBatchRateLimit, "0", "The maximum number of batch requests per minute sent to each provider, or 0 for no limit. Override it per provider in a [batch-rate-limits] table"},
+	{keys.OptionCassette, "", "A JSONL file which every response is recorded to, or which --provider replay answers from"},
+	{keys.OptionColor, "auto", "When to color the output: auto (when stdout is a terminal, and neither NO_COLOR nor TERM=dumb is set), always, or never"},
+	{keys.OptionCommand, "repl", "Supported commands are: ask, batch, doctor, embed, list-models, list-profiles, list-providers, pull-model, repl, serve, usage"},
+	{keys.OptionEmbedBatchSize, "100", "The maximum number of texts the embed command sends per request"},
+	{keys.OptionEmbedInput, "-", "The file of texts the embed command reads, or - for stdin"},
+	{keys.OptionEmbedInputFormat, "", "The format of the embed input: lines (a text per line) or jsonl (an object with a text and an optional id per line). Defaults to jsonl for .jsonl files, and lines otherwise"},
+	{keys.OptionEmbedModel, "", "The embedding model of the embed command. Defaults to text-embedding-3-small for OpenAI, and text-embedding-004 for Gemini"},
+	{keys.OptionEmbedOutput, "-", "The file the embed command writes the vectors to, or - for stdout"},
+	{keys.OptionEmbedOutputFormat, "", "The format of the embed output: jsonl (an id and an embedding per line) or npy (a NumPy array with a row per text). Defaults to npy for .npy files, and jsonl otherwise"},
 	{keys.OptionGeminiApiKey, "", "Gemini API Key"},
+	{keys.OptionGeminiApiKeyCmd, "", "A command which prints the Gemini API key, e.g., pass show gemini. It runs once per process"},
+	{keys.OptionGeminiApiKeyFile, "", "A file, only readable by the user, which contains the Gemini API key"},
+	{keys.OptionGeminiBaseURL, "https://generativelanguage.googleapis.com", "Gemini base url"},
 	{keys.OptionHttpTimeout, "30", "The http timeout, in seconds"},
 	{keys.OptionLogFile, "", "If specified, log to this diagnostic log file"},
+	{keys.OptionMaxOutputTokens, "", "The maximum number of tokens the model may generate per response"},
 	{keys.OptionModel, "gemini-1.5-flash-8b", "model name"},
+	{keys.OptionOllamaBaseURL, "http://localhost:11434", "Ollama base url"},
+	{keys.OptionOllamaKeepAlive, "5m", "How long Ollama keeps a model loaded after a request, e.g., 10m, or -1 to keep it loaded indefinitely"},
 	{keys.OptionOpenAIApiKey, "", "OpenAI API key"},
+	{keys.OptionOpenAIApiKeyCmd, "", "A command which prints the OpenAI API key, e.g., pass show openai. It runs once per process"},
+	{keys.OptionOpenAIApiKeyFile, "", "A file, only readable by the user, which contains the OpenAI API key"},
 	{keys.OptionOpenAIBaseURL, "https://api.openai.com/v1", "OpenAI base url, which could be replaced with an OpenAI-compatible base url, such as https://generativelanguage.googleapis.com/v1beta/openai"},
-	{keys.OptionProvider, keys.ProviderOpenAI, "The LLM provider. Examples are: gemini and openai"},
+	{keys.OptionOutput, keys.OutputText, "Output format of the ask command: text, json (with usage metadata), or code (fenced code blocks only)"},
+	{keys.OptionProfile, "", "The [profiles.<name>] table of the configuration file whose settings override the base ones"},
+	{keys.OptionProvider, keys.ProviderOpenAI, "The LLM provider. Examples are: anthropic, gemini, ollama and openai, or router to route requests by the [[router-routes]] and [[router-fallbacks]] tables of the configuration file, or replay to answer from the --cassette"},
+	{keys.OptionReasoningEffort, "", "How much reasoning models think before they answer: low, medium, or high"},
+	{keys.OptionReplaySpeed, "0", "How fast --provider replay streams the recorded responses, relative to their recorded pace, e.g., 1 for the original pace. 0 streams them without delays"},
+	{keys.OptionRetryMaxAttempts, "4", "The maximum number of attempts of a request which fails with a rate limit, a server error, or a network error. 1 disables retries"},
+	{keys.OptionSchema, "", "Path to a JSON schema which every response must conform to"},
+	{keys.OptionSeed, "", "The seed for sampling, which makes responses more repeatable"},
+	{keys.OptionServeApiKeys, "", "Comma-separated API keys which clients of the serve command must send as bearer tokens. If empty, no key is required"},
+	{keys.OptionServeListen, "127.0.0.1:8080", "The address the serve command listens on"},
+	{keys.OptionSessionsDir, "$HOME/.jcllm.d/sessions", "The directory where REPL sessions are saved"},
+	{keys.OptionStopSequences, "", "Comma-separated sequences which stop the generation"},
 	{keys.OptionSystemPrompt, "You are an AI assistant. Be concise.", "If specified, use this system prompt"},
+	{keys.OptionTemperature, "", "The sampling temperature, from 0 to 2. Lower values give more focused responses"},
+	{keys.OptionTheme, "default", "The color theme: default, light, mono, or the name of a [themes.<name>] table of the configuration file"},
+	{keys.OptionTopP, "", "The nucleus sampling probability, from 0 to 1"},
+	{keys.OptionUsageLedger, "$HOME/.jcllm.d/usage.jsonl", "The file where the token usage and cost of every response is recorded, or empty to record nothing"},
+	{keys.OptionUsageSince, "", "The usage command only sums the usage from this day on, e.g., 2025-01-01"},
 }
 
 var ConfigBools = []configuration.Metadata{
+	{keys.OptionAgent, "", "Start the REPL in agent mode, which lets the model read files, list directories, and run commands."},
+	{keys.OptionRaw, "", "Print responses in the REPL as raw markdown instead of rendering them."},
+	{keys.OptionResume, "", "Continue the most recently saved REPL session."},
 	{keys.OptionVersion, "", "Show version information."},
 }
+
+// providerCommands are the commands which send requests to the provider, and need its API key.
+var providerCommands = []string{"ask", "batch", "embed", "list-models", "repl", "serve"}
+
+// apiKeyRule requires the API key of a provider when it is used with its default base URL.
+func apiKeyRule(provider string, apiKey string, baseURLOption string, baseURL string) configuration.Rule {
+	rule := configuration.Rule{
+		RequiredWhen: []configuration.Condition{
+			{Key: keys.OptionProvider, Values: []string{provider}},
+			{Key: keys.OptionCommand, Values: providerCommands},
+		},
+		Alternatives: []string{apiKey + secrets.CmdSuffix, apiKey + secrets.FileSuffix},
+	}
+	// Other base URLs may be compatible servers which need no key
+	if baseURLOption != "" {
+		rule.RequiredWhen = append(rule.RequiredWhen, configuration.Condition{Key: baseURLOption, Values: []string{baseURL}})
+	}
+	return rule
+}
+
+// ConfigRules validate every option of ConfigMetadata and ConfigBools at startup. The options without constraints have
+// the zero Rule.
+var ConfigRules = map[string]configuration.Rule{
+	keys.OptionAgent:               {Type: configuration.TypeBool},
+	keys.OptionAgentMaxSteps:       {Type: configuration.TypeInt, Min: configuration.Bound(1)},
+	keys.OptionAnthropicApiKey:     apiKeyRule(keys.ProviderAnthropic, keys.OptionAnthropicApiKey, "", ""),
+	keys.OptionAnthropicApiKeyCmd:  {},
+	keys.OptionAnthropicApiKeyFile: {},
+	keys.OptionAnthropicBaseURL:    {Type: configuration.TypeURL},
+	keys.OptionAnthropicMaxTokens:  {Type: configuration.TypeInt, Min: configuration.Bound(1)},
+	keys.OptionBatchConcurrency:    {Type: configuration.TypeInt, Min: configuration.Bound(1)},
+	keys.OptionBatchInput: {RequiredWhen: []configuration.Condition{
+		{Key: keys.OptionCommand, Values: []string{"batch"}},
+	}},
+	keys.OptionBatchOutput: {RequiredWhen: []configuration.Condition{
+		{Key: keys.OptionCommand, Values: []string{"batch"}},
+	}},
+	keys.OptionBatchRateLimit: {Type: configuration.TypeInt, Min: configuration.Bound(0)},
+	keys.OptionCassette:       {RequiredWhen: []configuration.Condition{{Key: keys.OptionProvider, Values: []string{keys.ProviderReplay}}}},
+	keys.OptionColor:          {Enum: []string{"auto", "always", "never"}},
+	keys.OptionCommand: {Enum: []string{"ask", "batch", "doctor", "embed", "list-models", "list-profiles",
+		"list-providers", "pull-model", "repl", "serve", "usage"}},
+	keys.OptionEmbedBatchSize:    {Type: configuration.TypeInt, Min: configuration.Bound(1)},
+	keys.OptionEmbedInput:        {},
+	keys.OptionEmbedInputFormat:  {Enum: []string{keys.EmbedFormatLines, keys.EmbedFormatJSONL}},
+	keys.OptionEmbedModel:        {},
+	keys.OptionEmbedOutput:       {},
+	keys.OptionEmbedOutputFormat: {Enum: []string{keys.EmbedFormatJSONL, keys.EmbedFormatNPY}},
+	keys.OptionGeminiApiKey: apiKeyRule(keys.ProviderGemini, keys.OptionGeminiApiKey,
+		keys.OptionGeminiBaseURL, "https://generativelanguage.googleapis.com"),
+	keys.OptionGeminiApiKeyCmd:  {},
+	keys.OptionGeminiApiKeyFile: {},
+	keys.OptionGeminiBaseURL:    {Type: configuration.TypeURL},
+	keys.OptionHttpTimeout:      {Type: configuration.TypeInt, Min: configuration.Bound(1)},
+	keys.OptionLogFile:          {},
+	keys.OptionMaxOutputTokens:  {Type: configuration.TypeInt, Min: configuration.Bound(1)},
+	keys.OptionModel:            {},
+	keys.OptionOllamaBaseURL:    {Type: configuration.TypeURL},
+	keys.OptionOllamaKeepAlive:  {},
+	keys.OptionOpenAIApiKey: apiKeyRule(keys.ProviderOpenAI, keys.OptionOpenAIApiKey,
+		keys.OptionOpenAIBaseURL, "https://api.openai.com/v1"),
+	keys.OptionOpenAIApiKeyCmd:  {},
+	keys.OptionOpenAIApiKeyFile: {},
+	keys.OptionOpenAIBaseURL:    {Type: configuration.TypeURL},
+	keys.OptionOutput:           {Enum: []string{keys.OutputText, keys.OutputJSON, keys.OutputCode}},
+	keys.OptionProfile:          {},
+	keys.OptionProvider: {Enum: []string{keys.ProviderAnthropic, keys.ProviderGemini, keys.ProviderOllama,
+		keys.ProviderOpenAI, keys.ProviderReplay, keys.ProviderRouter}},
+	keys.OptionRaw:              {Type: configuration.TypeBool},
+	keys.OptionReasoningEffort:  {Enum: llm.ReasoningEfforts},
+	keys.OptionReplaySpeed:      {Type: configuration.TypeFloat, Min: configuration.Bound(0)},
+	keys.OptionResume:           {Type: configuration.TypeBool},
+	keys.OptionRetryMaxAttempts: {Type: configuration.TypeInt, Min: configuration.Bound(1)},
+	keys.OptionSchema:           {},
+	keys.OptionSeed:             {Type: configuration.TypeInt},
+	keys.OptionServeApiKeys:     {},
+	keys.OptionServeListen:      {},
+	keys.OptionSessionsDir:      {},
+	keys.OptionStopSequences:    {},
+	keys.OptionSystemPrompt:     {},
+	keys.OptionTemperature:      {Type: configuration.TypeFloat, Min: configuration.Bound(0), Max: configuration.Bound(2)},
+	keys.OptionTheme:            {},
+	keys.OptionTopP:             {Type: configuration.TypeFloat, Min: configuration.Bound(0), Max: configuration.Bound(1)},
+	keys.OptionUsageLedger:      {},
+	keys.OptionUsageSince:       {Type: configuration.TypeDate},
+	keys.OptionVersion:          {Type: configuration.TypeBool},
+}
+
+// problemsError reports every problem of the configuration at once.
+func problemsError(problems []configuration.Problem) error {
+	var message strings.Builder
+	message.WriteString("invalid configuration, run with --command doctor for details:")
+	for _, problem := range problems {
+		message.WriteString("\n    ")
+		message.WriteString(problem.String())
+	}
+	return errors.New(message.String())
+}
@@ -0,0 +1,74 @@
+package cli
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/jlcheng/jcllm/configuration"
+	"github.com/jlcheng/jcllm/configuration/keys"
+	"github.com/knadh/koanf/v2"
+)
+
+func TestConfigRules(t *testing.T) {
+	for _, meta := range slices.Concat(ConfigMetadata, ConfigBools) {
+		rule, ok := ConfigRules[meta.Name]
+		if !ok {
+			t.Errorf("ConfigRules has no rule for %s", meta.Name)
+			continue
+		}
+		if meta.DefaultValue != "" && len(rule.Enum) != 0 && !slices.Contains(rule.Enum, meta.DefaultValue) {
+			t.Errorf("the default %s %q is not one of %v", meta.Name, meta.DefaultValue, rule.Enum)
+		}
+	}
+	if len(ConfigRules) != len(ConfigMetadata)+len(ConfigBools) {
+		t.Errorf("ConfigRules has %d rules for %d options", len(ConfigRules), len(ConfigMetadata)+len(ConfigBools))
+	}
+}
+
+func TestConfigRules_APIKeys(t *testing.T) {
+	tests := []struct {
+		name         string
+		values       map[string]string
+		wantProblems []string
+	}{
+		{
+			name:         "gemini needs a key",
+			values:       map[string]string{keys.OptionProvider: keys.ProviderGemini, keys.OptionGeminiBaseURL: "https://generativelanguage.googleapis.com"},
+			wantProblems: []string{keys.OptionGeminiApiKey},
+		},
+		{
+			name:         "embed needs a key",
+			values:       map[string]string{keys.OptionCommand: "embed", keys.OptionProvider: keys.ProviderOpenAI, keys.OptionOpenAIBaseURL: "https://api.openai.com/v1"},
+			wantProblems: []string{keys.OptionOpenAIApiKey},
+		},
+		{
+			name:   "a gemini stand-in needs no key",
+			values: map[string]string{keys.OptionProvider: keys.ProviderGemini, keys.OptionGeminiBaseURL: "http://localhost:8080"},
+		},
+		{
+			name:         "openai needs a key",
+			values:       map[string]string{keys.OptionProvider: keys.ProviderOpenAI, keys.OptionOpenAIBaseURL: "https://api.openai.com/v1"},
+			wantProblems: []string{keys.OptionOpenAIApiKey},
+		},
+		{
+			name:   "an openai-compatible server needs no key",
+			values: map[string]string{keys.OptionProvider: keys.ProviderOpenAI, keys.OptionOpenAIBaseURL: "http://localhost:11434/v1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := koanf.New(".")
+			_ = config.Set(keys.OptionCommand, "repl")
+			for key, value := range tt.values {
+				_ = config.Set(key, value)
+			}
+			var problems []string
+			for _, problem := range configuration.Validate(config, ConfigRules) {
+				problems = append(problems, problem.Key)
+			}
+			if !slices.Equal(problems, tt.wantProblems) {
+				t.Errorf("problems of %v; want %v", problems, tt.wantProblems)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-errors/errors"
+
+	"github.com/jlcheng/jcllm/configuration"
+	"github.com/jlcheng/jcllm/configuration/keys"
+	"github.com/jlcheng/jcllm/configuration/secrets"
+	"github.com/jlcheng/jcllm/dye"
+	"github.com/jlcheng/jcllm/llm/providers/registry"
+)
+
+// doctorTimeout bounds the connectivity check of each provider.
+const doctorTimeout = 15 * time.Second
+
+// Doctor shows the configuration file, the effective configuration with its secrets masked, the problems of the
+// configuration, and whether each configured provider can be reached.
+func (cli *CLI) Doctor() error {
+	colorsErr := cli.configureColors()
+	fmt.Printf("jcllm version: %s\n", cli.version)
+	sources, _ := cli.config.(configuration.Sources)
+	if sources != nil && sources.File() != "" {
+		fmt.Printf("Configuration file: %s\n", sources.File())
+	} else {
+		fmt.Println("Configuration file: none, looked for .jcllm.toml from the current directory up, and ~/.jcllm.d/jcllm.toml")
+	}
+	if profile := cli.config.String(keys.OptionProfile); profile != "" {
+		fmt.Printf("Profile: %s\n", profile)
+	}
+
+	fmt.Println(dye.Str("=== Effective configuration ===").As(dye.RoleModel))
+	names := make([]string, 0, len(ConfigMetadata)+len(ConfigBools))
+	for _, meta := range slices.Concat(ConfigMetadata, ConfigBools) {
+		names = append(names, meta.Name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		value := fmt.Sprint(cli.config.Get(name))
+		if secrets.IsSecret(name) {
+			value = maskSecrets(value)
+		}
+		value = strings.ReplaceAll(strings.TrimSpace(value), "\n", "¶ ")
+		source := "default"
+		if sources != nil {
+			source = sources.Source(name)
+		}
+		fmt.Printf("    %s = %q %s\n", name, value, dye.Strf("(%s)", source).As(dye.RoleUsage))
+	}
+
+	fmt.Println(dye.Str("=== Problems ===").As(dye.RoleModel))
+	problems := configuration.Validate(cli.config, ConfigRules)
+	if colorsErr != nil {
+		problems = append(problems, configuration.Problem{Key: keys.OptionTheme, Message: colorsErr.Error()})
+	}
+	if len(problems) == 0 {
+		fmt.Println("    none")
+	}
+	for _, problem := range problems {
+		fmt.Println(dye.Strf("    %s", problem).As(dye.RoleError))
+	}
+
+	fmt.Println(dye.Str("=== Providers ===").As(dye.RoleModel))
+	if len(problems) != 0 {
+		fmt.Println("    Fix the problems above to check the providers")
+		return errors.Errorf("found %d configuration problem(s)", len(problems))
+	}
+	failures := 0
+	for _, name := range cli.configuredProviders() {
+		if err := cli.checkProvider(name); err != nil {
+			failures++
+			fmt.Println(dye.Strf("    %s: %s", name, err).As(dye.RoleError))
+		}
+	}
+	if failures != 0 {
+		return errors.Errorf("cannot reach %d provider(s)", failures)
+	}
+	return nil
+}
+
+// configuredProviders are the selected provider, unless it is the router, and the providers with an API key or a
+// base URL set, which the router may use.
+func (cli *CLI) configuredProviders() []string {
+	sources, _ := cli.config.(configuration.Sources)
+	isSet := func(option string) bool {
+		if sources != nil {
+			return sources.Source(option) != "default"
+		}
+		return cli.config.String(option) != ""
+	}
+	options := map[string][]string{
+		keys.ProviderAnthropic: {keys.OptionAnthropicApiKey, keys.OptionAnthropicApiKeyCmd, keys.OptionAnthropicApiKeyFile, keys.OptionAnthropicBaseURL},
+		keys.ProviderGemini:    {keys.OptionGeminiApiKey, keys.OptionGeminiApiKeyCmd, keys.OptionGeminiApiKeyFile, keys.OptionGeminiBaseURL},
+		keys.ProviderOllama:    {keys.OptionOllamaBaseURL},
+		keys.ProviderOpenAI:    {keys.OptionOpenAIApiKey, keys.OptionOpenAIApiKeyCmd, keys.OptionOpenAIApiKeyFile, keys.OptionOpenAIBaseURL},
+	}
+	selected := cli.config.String(keys.OptionProvider)
+	var providers []string
+	for _, name := range []string{keys.ProviderAnthropic, keys.ProviderGemini, keys.ProviderOllama, keys.ProviderOpenAI} {
+		if name == selected || slices.ContainsFunc(options[name], isSet) {
+			providers = append(providers, name)
+		}
+	}
+	return providers
+}
+
+// checkProvider lists the models of a provider, which needs a valid API key and a reachable server.
+func (cli *CLI) checkProvider(name string) error {
+	provider, err := registry.NewProvider(context.Background(), cli.config, name)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), doctorTimeout)
+	defer cancel()
+	start := time.Now()
+	models, err := provider.ListModels(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("    %s: ok, %d models, %s\n", name, len(models), time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// maskSecrets masks each of the comma-separated secrets of value.
+func maskSecrets(value string) string {
+	if value == "" || value == "<nil>" {
+		return value
+	}
+	masked := strings.Split(value, ",")
+	for i, secret := range masked {
+		masked[i] = secrets.Mask(secret)
+	}
+	return strings.Join(masked, ",")
+}
@@ -0,0 +1,99 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/go-errors/errors"
+	"github.com/jlcheng/jcllm/configuration/keys"
+	"github.com/jlcheng/jcllm/embeddings"
+	"github.com/jlcheng/jcllm/llm"
+	"github.com/jlcheng/jcllm/llm/providers/registry"
+)
+
+// Embed embeds every text of the embed input with the configured provider, and writes the vectors to the embed output.
+func (cli *CLI) Embed() error {
+	name := cli.config.String(keys.OptionProvider)
+	provider, err := registry.NewProvider(context.Background(), cli.config, name)
+	if err != nil {
+		return errors.WrapPrefix(err, fmt.Sprintf("cannot instantiate provider [%s]", name), 0)
+	}
+	embedder, ok := provider.(llm.Embedder)
+	if !ok {
+		return errors.Errorf("provider [%s] does not support embeddings", name)
+	}
+
+	inputPath := cli.config.String(keys.OptionEmbedInput)
+	var input io.Reader = os.Stdin
+	if inputPath != "-" {
+		file, err := os.Open(inputPath)
+		if err != nil {
+			return errors.WrapPrefix(err, "cannot open embed input", 0)
+		}
+		defer file.Close()
+		input = file
+	}
+	read := embeddings.ReadLines
+	if embedFormat(cli.config.String(keys.OptionEmbedInputFormat), inputPath, ".jsonl", keys.EmbedFormatLines) == keys.EmbedFormatJSONL {
+		read = embeddings.ReadJSONL
+	}
+	inputs, err := read(input)
+	if err != nil {
+		return err
+	}
+	if len(inputs) == 0 {
+		return errors.Errorf("no texts to embed")
+	}
+
+	vectors, err := embeddings.Embed(context.Background(), embedder, inputs, cli.config.String(keys.OptionEmbedModel),
+		cli.config.Int(keys.OptionEmbedBatchSize))
+	if err != nil {
+		return err
+	}
+
+	outputPath := cli.config.String(keys.OptionEmbedOutput)
+	write := func(output io.Writer) error {
+		return embeddings.WriteJSONL(output, inputs, vectors)
+	}
+	if embedFormat(cli.config.String(keys.OptionEmbedOutputFormat), outputPath, ".npy", keys.EmbedFormatJSONL) == keys.EmbedFormatNPY {
+		write = func(output io.Writer) error {
+			return embeddings.WriteNPY(output, vectors)
+		}
+	}
+	if outputPath == "-" {
+		if err := write(os.Stdout); err != nil {
+			return err
+		}
+	} else {
+		// The output is only created once the vectors are ready, so that a failure does not truncate a previous one
+		file, err := os.Create(outputPath)
+		if err != nil {
+			return errors.WrapPrefix(err, "cannot create embed output", 0)
+		}
+		if err := write(file); err != nil {
+			_ = file.Close()
+			return err
+		}
+		// Some file systems, such as NFS, only report a failed write when the file is closed
+		if err := file.Close(); err != nil {
+			return errors.WrapPrefix(err, "cannot write embed output", 0)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Embedded %d texts\n", len(vectors))
+	return nil
+}
+
+// embedFormat returns the configured format, or else the format named by the extension of the path, such as npy for
+// .npy, or else the fallback.
+func embedFormat(format string, path string, extension string, fallback string) string {
+	if format != "" {
+		return format
+	}
+	if filepath.Ext(path) == extension {
+		return extension[1:]
+	}
+	return fallback
+}
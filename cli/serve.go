@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/jlcheng/jcllm/configuration/keys"
+	"github.com/jlcheng/jcllm/llm/providers/registry"
+	"github.com/jlcheng/jcllm/server"
+	"github.com/jlcheng/jcllm/usage"
+)
+
+// Serve exposes the configured provider as an OpenAI-compatible HTTP API until interrupted.
+func (cli *CLI) Serve() error {
+	name := cli.config.String(keys.OptionProvider)
+	provider, err := registry.NewProvider(context.Background(), cli.config, name)
+	if err != nil {
+		return errors.WrapPrefix(err, fmt.Sprintf("cannot instantiate provider [%s]", name), 0)
+	}
+	meter, err := usage.NewMeter(cli.config)
+	if err != nil {
+		return err
+	}
+	address := cli.config.String(keys.OptionServeListen)
+	gateway := server.New(cli.config, provider, meter, cli.logger, os.Stderr)
+	httpServer := &http.Server{
+		Addr:              address,
+		Handler:           gateway.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = httpServer.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Fprintf(os.Stderr, "Serving %s models on http://%s/v1\n", name, address)
+	if !gateway.RequiresAPIKey() {
+		fmt.Fprintln(os.Stderr, "Warning: no API keys are configured, any client may use this server")
+	}
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return errors.WrapPrefix(err, "server failed", 0)
+	}
+	return nil
+}
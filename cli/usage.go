@@ -0,0 +1,69 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-errors/errors"
+
+	"github.com/jlcheng/jcllm/configuration/keys"
+	"github.com/jlcheng/jcllm/usage"
+)
+
+// Usage sums the usage ledger by day, provider, and model. With --output json, the rows are printed as JSON lines.
+func (cli *CLI) Usage() error {
+	var since time.Time
+	if value := cli.config.String(keys.OptionUsageSince); value != "" {
+		var err error
+		if since, err = time.ParseInLocation(time.DateOnly, value, time.Local); err != nil {
+			return errors.Errorf("invalid %s %q, expected a day such as 2025-01-31", keys.OptionUsageSince, value)
+		}
+	}
+	ledger := usage.NewLedger(cli.config.String(keys.OptionUsageLedger))
+	records, err := ledger.Read(since)
+	if err != nil {
+		return err
+	}
+	rows := usage.Summarize(records)
+
+	if cli.config.String(keys.OptionOutput) == keys.OutputJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		for _, row := range rows {
+			if err := encoder.Encode(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var total usage.Total
+	for _, record := range records {
+		total.Add(record)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DAY\tPROVIDER\tMODEL\tREQUESTS\tINPUT\tCACHED\tOUTPUT\tREASONING\tCOST\t")
+	for _, row := range rows {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", row.Day, row.Provider, row.Model, formatTotal(row.Total))
+	}
+	fmt.Fprintf(w, "TOTAL\t\t\t%s\n", formatTotal(total))
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if total.Unpriced > 0 {
+		fmt.Printf("* %d responses are not included in the cost, since their model has no price in [[%s]]\n", total.Unpriced, keys.OptionPrices)
+	}
+	return nil
+}
+
+// formatTotal formats the columns of a total, from REQUESTS to COST. The cost is marked when some responses have no
+// price.
+func formatTotal(total usage.Total) string {
+	cost := fmt.Sprintf("$%.4f", total.Cost)
+	if total.Unpriced > 0 {
+		cost += "*"
+	}
+	return fmt.Sprintf("%d\t%d\t%d\t%d\t%d\t%s\t", total.Requests, total.InputTokens, total.CachedTokens, total.OutputTokens, total.ReasoningTokens, cost)
+}
@@ -202,6 +202,9 @@ type Configuration interface {
 	MustTime(path, layout string) time.Time
 }
 
+// ArgsKey is the key under which a ConfigProvider stores the positional command-line arguments, as a []string.
+const ArgsKey = "args"
+
 // ErrHelp may be returned by ConfigProvider invocation to indicate that the user specified `--help` when invoking the program.
 var ErrHelp = errors.New("flags: help requested")
 
@@ -213,8 +216,49 @@ type Metadata struct {
 	Usage        string
 }
 
+// Profiles is implemented by a Configuration which supports named profiles, i.e., the `[profiles.<name>]` tables of the
+// configuration file, which override the base settings of the file.
+type Profiles interface {
+	// Profile returns the name of the applied profile, or "" if none is.
+	Profile() string
+
+	// ProfileNames returns the sorted names of the profiles of the configuration file.
+	ProfileNames() []string
+
+	// WithProfile returns a copy of the Configuration with the named profile applied instead of the current one. An
+	// empty name applies no profile.
+	WithProfile(name string) (Configuration, error)
+}
+
+// Sources is implemented by a Configuration which knows where its values come from.
+type Sources interface {
+	// File returns the path of the configuration file, or "" if none was found.
+	File() string
+
+	// Source describes where the value of a key was set, e.g., "flag --model", "env JCLLM_MODEL", or "default".
+	Source(key string) string
+}
+
 // ConfigProvider is a function that accepts a list of configuration metadata--definition of parameters that will be used by the program--
 // and returns a Configuration instance.
 //
 // ErrHelp may be returned if the user specified `--help` when invoking the program.
 type ConfigProvider func(stringConfigs []Metadata, boolConfigs []Metadata) (Configuration, error)
+
+// Tables returns the array of tables at the given key path, e.g., the `[[prices]]` tables of the configuration file.
+// Elements which are not tables are skipped.
+func Tables(config Configuration, key string) []map[string]any {
+	switch tables := config.Get(key).(type) {
+	case []map[string]any:
+		return tables
+	case []any:
+		result := make([]map[string]any, 0, len(tables))
+		for _, table := range tables {
+			if m, ok := table.(map[string]any); ok {
+				result = append(result, m)
+			}
+		}
+		return result
+	}
+	return nil
+}
@@ -1,17 +1,80 @@
 package keys
 
 const (
-	OptionCommand       = "command"
-	OptionGeminiApiKey  = "gemini-api-key"
-	OptionHttpTimeout   = "http-timeout"
-	OptionLogFile       = "log-file"
-	OptionModel         = "model"
-	OptionModelsList    = "models-list"
-	OptionOpenAIApiKey  = "openai-api-key"
-	OptionOpenAIBaseURL = "openai-base-url"
-	OptionProvider      = "provider"
-	OptionSystemPrompt  = "system-prompt"
-	OptionVersion       = "version"
-	ProviderGemini      = "gemini"
-	ProviderOpenAI      = "openai"
+	EmbedFormatJSONL          = "jsonl"
+	EmbedFormatLines          = "lines"
+	EmbedFormatNPY            = "npy"
+	OptionAgent               = "agent"
+	OptionAgentMaxSteps       = "agent-max-steps"
+	OptionAnthropicApiKey     = "anthropic-api-key"
+	OptionAnthropicApiKeyCmd  = "anthropic-api-key-cmd"
+	OptionAnthropicApiKeyFile = "anthropic-api-key-file"
+	OptionAnthropicBaseURL    = "anthropic-base-url"
+	OptionAnthropicMaxTokens  = "anthropic-max-tokens"
+	OptionBatchConcurrency    = "batch-concurrency"
+	OptionBatchInput          = "batch-input"
+	OptionBatchOutput         = "batch-output"
+	OptionBatchRateLimit      = "batch-rate-limit"
+	OptionBatchRateLimits     = "batch-rate-limits"
+	OptionCassette            = "cassette"
+	OptionColor               = "color"
+	OptionCommand             = "command"
+	OptionEmbedBatchSize      = "embed-batch-size"
+	OptionEmbedInput          = "embed-input"
+	OptionEmbedInputFormat    = "embed-input-format"
+	OptionEmbedModel          = "embed-model"
+	OptionEmbedOutput         = "embed-output"
+	OptionEmbedOutputFormat   = "embed-output-format"
+	OptionGeminiApiKey        = "gemini-api-key"
+	OptionGeminiApiKeyCmd     = "gemini-api-key-cmd"
+	OptionGeminiApiKeyFile    = "gemini-api-key-file"
+	OptionGeminiBaseURL       = "gemini-base-url"
+	OptionHttpTimeout         = "http-timeout"
+	OptionLogFile             = "log-file"
+	OptionMCPServers          = "mcp-servers"
+	OptionMaxOutputTokens     = "max-output-tokens"
+	OptionModel               = "model"
+	OptionModelSettings       = "model-settings"
+	OptionModelsList          = "models-list"
+	OptionOllamaBaseURL       = "ollama-base-url"
+	OptionOllamaKeepAlive     = "ollama-keep-alive"
+	OptionOpenAIApiKey        = "openai-api-key"
+	OptionOpenAIApiKeyCmd     = "openai-api-key-cmd"
+	OptionOpenAIApiKeyFile    = "openai-api-key-file"
+	OptionOpenAIBaseURL       = "openai-base-url"
+	OptionOutput              = "output"
+	OptionPrices              = "prices"
+	OptionProfile             = "profile"
+	OptionProfiles            = "profiles"
+	OptionProvider            = "provider"
+	OptionRaw                 = "raw"
+	OptionReasoningEffort     = "reasoning-effort"
+	OptionReplaySpeed         = "replay-speed"
+	OptionResume              = "resume"
+	OptionRetryMaxAttempts    = "retry-max-attempts"
+	OptionRouterFallbacks     = "router-fallbacks"
+	OptionRouterRoutes        = "router-routes"
+	OptionSchema              = "schema"
+	OptionSeed                = "seed"
+	OptionServeApiKeys        = "serve-api-keys"
+	OptionServeListen         = "serve-listen"
+	OptionSessionsDir         = "sessions-dir"
+	OptionStopSequences       = "stop-sequences"
+	OptionSystemPrompt        = "system-prompt"
+	OptionTemperature         = "temperature"
+	OptionTheme               = "theme"
+	OptionThemes              = "themes"
+	OptionTopP                = "top-p"
+	OptionUsageLedger         = "usage-ledger"
+	OptionUsageSince          = "usage-since"
+	OptionVersion             = "version"
+	OutputCode                = "code"
+	OutputJSON                = "json"
+	OutputText                = "text"
+	ProviderAnthropic         = "anthropic"
+	ProviderGemini            = "gemini"
+	ProviderOllama            = "ollama"
+	ProviderOpenAI            = "openai"
+	ProviderReplay            = "replay"
+	ProviderRouter            = "router"
 )
@@ -1,7 +0,0 @@
-package keys
-
-const (
-	ArgNameSuppress = "suppress"
-	True            = "true"
-	False           = ""
-)
@@ -1,6 +1,7 @@
 package defaultconfig
 
 import (
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
@@ -8,6 +9,7 @@ import (
 
 	"github.com/go-errors/errors"
 	"github.com/jlcheng/jcllm/configuration"
+	"github.com/jlcheng/jcllm/configuration/keys"
 
 	"github.com/knadh/koanf/parsers/toml"
 	"github.com/knadh/koanf/providers/env"
@@ -17,49 +19,150 @@ import (
 	flag "github.com/spf13/pflag"
 )
 
+// Config is a Configuration which keeps its sources, so that a different profile can be applied to them.
+type Config struct {
+	*koanf.Koanf
+	// path is the path of the configuration file, or "" if none was found.
+	path    string
+	file    *koanf.Koanf
+	env     *koanf.Koanf
+	flags   *flag.FlagSet
+	profile string
+}
+
 // New returns a Configuration which looks for configurations with the following precedence:
 //
 //  1. Command-line arguments.
 //  2. Environment variables.
-//  3. Entries from a configuration file.
+//  3. Entries from the `[profiles.<name>]` table of the configuration file, selected by the profile option.
+//  4. Entries from a configuration file.
 func New(stringConfigs []configuration.Metadata, boolConfigs []configuration.Metadata) (configuration.Configuration, error) {
-	k := koanf.New(".")
+	config, err := load(findConfigFile(), os.Args[1:], stringConfigs, boolConfigs)
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
 
-	configFile := findConfigFile()
+func load(configFile string, args []string, stringConfigs []configuration.Metadata, boolConfigs []configuration.Metadata) (*Config, error) {
+	c := &Config{path: configFile, file: koanf.New("."), env: koanf.New(".")}
 	if configFile != "" {
-		if err := k.Load(file.Provider(configFile), toml.Parser()); err != nil {
+		if err := c.file.Load(file.Provider(configFile), toml.Parser()); err != nil {
 			return nil, errors.Errorf("config file error (%s): %s", configFile, err)
 		}
 	}
 
-	if err := k.Load(env.Provider("JCLLM_", ".", func(s string) string {
+	if err := c.env.Load(env.Provider("JCLLM_", ".", func(s string) string {
 		return strings.Replace(strings.ToLower(
 			strings.TrimPrefix(s, "JCLLM_")), "_", "-", -1)
 	}), nil); err != nil {
 		return nil, err
 	}
 
-	f := flag.NewFlagSet("config", flag.ContinueOnError)
+	c.flags = flag.NewFlagSet("config", flag.ContinueOnError)
 	for _, meta := range stringConfigs {
-		f.String(meta.Name, meta.DefaultValue, meta.Usage)
+		c.flags.String(meta.Name, meta.DefaultValue, meta.Usage)
 	}
 	for _, meta := range boolConfigs {
-		f.Bool(meta.Name, false, meta.Usage)
+		c.flags.Bool(meta.Name, false, meta.Usage)
 	}
 
-	if err := f.Parse(os.Args[1:]); err != nil {
+	if err := c.flags.Parse(args); err != nil {
 		if errors.Is(err, flag.ErrHelp) {
 			return nil, configuration.ErrHelp
 		}
 	}
 
-	if err := k.Load(posflag.Provider(f, ".", k), nil); err != nil {
-		log.Fatalf("Error loading config: %v", err)
+	// The profile option itself follows the usual precedence, so find it before applying the profile
+	k, err := c.layer("")
+	if err != nil {
+		return nil, err
+	}
+	if err := c.apply(k.String(keys.OptionProfile)); err != nil {
+		return nil, err
 	}
+	return c, nil
+}
 
+// layer merges the sources by their precedence, with the named profile on top of the configuration file.
+func (c *Config) layer(profile string) (*koanf.Koanf, error) {
+	k := koanf.New(".")
+	if err := k.Merge(c.file); err != nil {
+		return nil, errors.WrapPrefix(err, "cannot load the configuration file", 0)
+	}
+	if profile != "" {
+		path := keys.OptionProfiles + "." + profile
+		if _, ok := c.file.Get(path).(map[string]any); !ok {
+			return nil, errors.Errorf("unknown profile %q, the profiles are: %s", profile, strings.Join(c.ProfileNames(), ", "))
+		}
+		if err := k.Merge(c.file.Cut(path)); err != nil {
+			return nil, errors.WrapPrefix(err, "cannot load profile "+profile, 0)
+		}
+	}
+	if err := k.Merge(c.env); err != nil {
+		return nil, errors.WrapPrefix(err, "cannot load the environment variables", 0)
+	}
+
+	if err := k.Load(posflag.Provider(c.flags, ".", k), nil); err != nil {
+		log.Fatalf("Error loading config: %v", err)
+	}
+	if err := k.Set(configuration.ArgsKey, c.flags.Args()); err != nil {
+		return nil, errors.WrapPrefix(err, "cannot store positional arguments", 0)
+	}
 	return k, nil
 }
 
+// apply replaces the settings with those of the named profile.
+func (c *Config) apply(profile string) error {
+	k, err := c.layer(profile)
+	if err != nil {
+		return err
+	}
+	// The profile which is applied, rather than the one which was asked for on the command-line
+	if err := k.Set(keys.OptionProfile, profile); err != nil {
+		return errors.WrapPrefix(err, "cannot store the profile", 0)
+	}
+	c.Koanf = k
+	c.profile = profile
+	return nil
+}
+
+func (c *Config) Profile() string {
+	return c.profile
+}
+
+func (c *Config) ProfileNames() []string {
+	return c.file.MapKeys(keys.OptionProfiles)
+}
+
+func (c *Config) File() string {
+	return c.path
+}
+
+func (c *Config) Source(key string) string {
+	if f := c.flags.Lookup(key); f != nil && f.Changed {
+		return "flag --" + key
+	}
+	if c.env.Exists(key) {
+		return "env JCLLM_" + strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+	}
+	if c.profile != "" && c.file.Exists(keys.OptionProfiles+"."+c.profile+"."+key) {
+		return fmt.Sprintf("profile %s of %s", c.profile, c.path)
+	}
+	if c.file.Exists(key) {
+		return "file " + c.path
+	}
+	return "default"
+}
+
+func (c *Config) WithProfile(name string) (configuration.Configuration, error) {
+	copied := *c
+	if err := copied.apply(name); err != nil {
+		return nil, err
+	}
+	return &copied, nil
+}
+
 // findConfigFile finds the config file by recursively searching up from the cwd
 // and if not found checks in ~/.jcllm.d/jcllm.toml
 func findConfigFile() string {
@@ -94,3 +197,5 @@ func findConfigFile() string {
 }
 
 var _ configuration.ConfigProvider = New
+var _ configuration.Profiles = (*Config)(nil)
+var _ configuration.Sources = (*Config)(nil)
@@ -0,0 +1,172 @@
+package defaultconfig
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/jlcheng/jcllm/configuration"
+	"github.com/jlcheng/jcllm/configuration/keys"
+)
+
+const profilesConfig = `
+provider = "gemini"
+model = "gemini-flash"
+system-prompt = "Be concise."
+
+[profiles.work]
+provider = "openai"
+model = "gpt-4o"
+openai-api-key = "work-key"
+
+[profiles.home]
+system-prompt = "Talk like a pirate."
+`
+
+var testMetadata = []configuration.Metadata{
+	{Name: keys.OptionModel, DefaultValue: "default-model"},
+	{Name: keys.OptionProfile},
+	{Name: keys.OptionProvider, DefaultValue: keys.ProviderOpenAI},
+	{Name: keys.OptionSystemPrompt},
+}
+
+func loadTestConfig(t *testing.T, args ...string) (*Config, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "jcllm.toml")
+	if err := os.WriteFile(path, []byte(profilesConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return load(path, args, testMetadata, nil)
+}
+
+func TestLoad_Profiles(t *testing.T) {
+	tests := []struct {
+		name         string
+		env          string
+		args         []string
+		wantProfile  string
+		wantProvider string
+		wantModel    string
+		wantPrompt   string
+	}{
+		{
+			name:         "base settings without a profile",
+			wantProvider: "gemini",
+			wantModel:    "gemini-flash",
+			wantPrompt:   "Be concise.",
+		},
+		{
+			name:         "profile from the command-line",
+			args:         []string{"--profile", "work"},
+			wantProfile:  "work",
+			wantProvider: "openai",
+			wantModel:    "gpt-4o",
+			wantPrompt:   "Be concise.",
+		},
+		{
+			name:         "profile from the environment",
+			env:          "home",
+			wantProfile:  "home",
+			wantProvider: "gemini",
+			wantModel:    "gemini-flash",
+			wantPrompt:   "Talk like a pirate.",
+		},
+		{
+			name:         "command-line arguments override the profile",
+			env:          "work",
+			args:         []string{"--model", "o1-mini"},
+			wantProfile:  "work",
+			wantProvider: "openai",
+			wantModel:    "o1-mini",
+			wantPrompt:   "Be concise.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("JCLLM_PROFILE", tt.env)
+			config, err := loadTestConfig(t, tt.args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := config.Profile(); got != tt.wantProfile {
+				t.Errorf("Profile() = %q; want %q", got, tt.wantProfile)
+			}
+			if got := config.String(keys.OptionProvider); got != tt.wantProvider {
+				t.Errorf("provider = %q; want %q", got, tt.wantProvider)
+			}
+			if got := config.String(keys.OptionModel); got != tt.wantModel {
+				t.Errorf("model = %q; want %q", got, tt.wantModel)
+			}
+			if got := config.String(keys.OptionSystemPrompt); got != tt.wantPrompt {
+				t.Errorf("system prompt = %q; want %q", got, tt.wantPrompt)
+			}
+		})
+	}
+}
+
+func TestConfig_WithProfile(t *testing.T) {
+	t.Setenv("JCLLM_PROFILE", "")
+	config, err := loadTestConfig(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := config.ProfileNames(), []string{"home", "work"}; !slices.Equal(got, want) {
+		t.Errorf("ProfileNames() = %v; want %v", got, want)
+	}
+
+	work, err := config.WithProfile("work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := work.String(keys.OptionOpenAIApiKey); got != "work-key" {
+		t.Errorf("openai-api-key = %q; want the key of the profile", got)
+	}
+	if got := work.String(keys.OptionProfile); got != "work" {
+		t.Errorf("profile = %q; want work", got)
+	}
+	if got := config.String(keys.OptionProvider); got != "gemini" {
+		t.Errorf("provider of the original = %q; want it unchanged", got)
+	}
+
+	base, err := work.(configuration.Profiles).WithProfile("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if base.Exists(keys.OptionOpenAIApiKey) {
+		t.Errorf("openai-api-key = %q; want the key of the profile removed", base.String(keys.OptionOpenAIApiKey))
+	}
+
+	if _, err := config.WithProfile("missing"); err == nil {
+		t.Error("WithProfile(missing) = nil; want an error")
+	}
+}
+
+func TestConfig_Source(t *testing.T) {
+	t.Setenv("JCLLM_PROFILE", "")
+	t.Setenv("JCLLM_SYSTEM_PROMPT", "Be brief.")
+	config, err := loadTestConfig(t, "--model", "o1-mini")
+	if err != nil {
+		t.Fatal(err)
+	}
+	work, err := config.WithProfile("work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		config configuration.Configuration
+		key    string
+		want   string
+	}{
+		{config, keys.OptionModel, "flag --model"},
+		{config, keys.OptionSystemPrompt, "env JCLLM_SYSTEM_PROMPT"},
+		{config, keys.OptionProvider, "file " + config.File()},
+		{work, keys.OptionProvider, "profile work of " + config.File()},
+		{config, keys.OptionOpenAIApiKey, "default"},
+	}
+	for _, tt := range tests {
+		if got := tt.config.(configuration.Sources).Source(tt.key); got != tt.want {
+			t.Errorf("Source(%s) = %q; want %q", tt.key, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+// Package secrets resolves API keys which are not written in plaintext in the configuration, but printed by a command,
+// such as `pass show openai`, or stored in a file only readable by the user.
+//
+// Resolved keys are never stored in the Configuration, so neither Configuration.All nor the logs can print them.
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/jlcheng/jcllm/configuration"
+)
+
+const (
+	// CmdSuffix is appended to the name of an API key option, e.g., openai-api-key-cmd, to name the option of the
+	// command which prints the key.
+	CmdSuffix = "-cmd"
+	// FileSuffix is appended to the name of an API key option, e.g., openai-api-key-file, to name the option of the
+	// file which contains the key.
+	FileSuffix = "-file"
+)
+
+// commandTimeout bounds how long a command may take to print a key, e.g., while a password manager asks to unlock.
+const commandTimeout = 2 * time.Minute
+
+var (
+	// cache holds the keys printed by commands for the lifetime of the process, keyed by command.
+	cache = make(map[string]string)
+	mutex sync.Mutex
+)
+
+// APIKey returns the API key of an option, such as openai-api-key. The key is the value of the option itself if it is
+// set, or else the output of the command of the `-cmd` option, or else the content of the file of the `-file` option.
+// An empty key is returned if none of them is set.
+func APIKey(config configuration.Configuration, option string) (string, error) {
+	if key := config.String(option); key != "" {
+		return key, nil
+	}
+	if command := config.String(option + CmdSuffix); command != "" {
+		key, err := fromCommand(command)
+		if err != nil {
+			return "", errors.WrapPrefix(err, fmt.Sprintf("cannot get %s from %s", option, option+CmdSuffix), 0)
+		}
+		return key, nil
+	}
+	if path := config.String(option + FileSuffix); path != "" {
+		key, err := fromFile(path)
+		if err != nil {
+			return "", errors.WrapPrefix(err, fmt.Sprintf("cannot get %s from %s", option, option+FileSuffix), 0)
+		}
+		return key, nil
+	}
+	return "", nil
+}
+
+// fromCommand runs the command with the shell and returns the first line of its output. The output is cached, so that
+// the command, which may prompt the user, runs once per process.
+func fromCommand(command string) (string, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if key, ok := cache[command]; ok {
+		return key, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// The output is the secret, so only stderr is reported
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", errors.Errorf("%q failed: %v: %s", command, err, message)
+		}
+		return "", errors.Errorf("%q failed: %v", command, err)
+	}
+	key := firstLine(stdout.String())
+	if key == "" {
+		return "", errors.Errorf("%q printed no key", command)
+	}
+	cache[command] = key
+	return key, nil
+}
+
+// fromFile reads the first line of a file, which must not be readable by other users.
+func fromFile(path string) (string, error) {
+	path = os.ExpandEnv(path)
+	stat, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	// Windows does not have Unix permissions
+	if runtime.GOOS != "windows" && stat.Mode().Perm()&0o077 != 0 {
+		return "", errors.Errorf("%s is accessible by other users, run: chmod 600 %s", path, path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	key := firstLine(string(data))
+	if key == "" {
+		return "", errors.Errorf("%s is empty", path)
+	}
+	return key, nil
+}
+
+// firstLine returns the first line of s without surrounding whitespace, as password managers such as pass print
+// other fields on the following lines.
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(line)
+}
+
+// IsSecret reports whether the option holds secrets, such as openai-api-key or serve-api-keys.
+func IsSecret(option string) bool {
+	return strings.HasSuffix(option, "-api-key") || strings.HasSuffix(option, "-api-keys")
+}
+
+// Mask hides a secret, only showing its last 4 characters if it is long enough that they do not give it away.
+func Mask(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	if len(secret) < 16 {
+		return "****"
+	}
+	return "****" + secret[len(secret)-4:]
+}
@@ -0,0 +1,125 @@
+package secrets_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/jlcheng/jcllm/configuration/keys"
+	"github.com/jlcheng/jcllm/configuration/secrets"
+	"github.com/knadh/koanf/v2"
+)
+
+func newConfig(t *testing.T, values map[string]string) *koanf.Koanf {
+	t.Helper()
+	config := koanf.New(".")
+	for key, value := range values {
+		if err := config.Set(key, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return config
+}
+
+func TestAPIKey(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the key commands and file permissions are those of Unix")
+	}
+	dir := t.TempDir()
+	privateFile := filepath.Join(dir, "private")
+	if err := os.WriteFile(privateFile, []byte("file-key\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	sharedFile := filepath.Join(dir, "shared")
+	if err := os.WriteFile(sharedFile, []byte("file-key\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	const option = keys.OptionOpenAIApiKey
+	tests := []struct {
+		name    string
+		values  map[string]string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "plaintext key",
+			values: map[string]string{option: "plain-key", keys.OptionOpenAIApiKeyCmd: "echo cmd-key"},
+			want:   "plain-key",
+		},
+		{
+			name:   "first line printed by the command",
+			values: map[string]string{keys.OptionOpenAIApiKeyCmd: "printf 'cmd-key\\nurl: example.com\\n' | tr a-z A-Z"},
+			want:   "CMD-KEY",
+		},
+		{
+			name:    "failing command",
+			values:  map[string]string{keys.OptionOpenAIApiKeyCmd: "echo leaked-key | tr a-z A-Z; exit 1"},
+			wantErr: true,
+		},
+		{
+			name:   "private file",
+			values: map[string]string{keys.OptionOpenAIApiKeyFile: privateFile},
+			want:   "file-key",
+		},
+		{
+			name:    "file readable by other users",
+			values:  map[string]string{keys.OptionOpenAIApiKeyFile: sharedFile},
+			wantErr: true,
+		},
+		{
+			name: "no key",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := newConfig(t, tt.values)
+			got, err := secrets.APIKey(config, option)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("APIKey() = %q; want an error", got)
+				}
+				if strings.Contains(err.Error(), "LEAKED-KEY") {
+					t.Errorf("error = %v; want it without the output of the command", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("APIKey() = %q; want %q", got, tt.want)
+			}
+			if all := fmt.Sprint(config.All()); tt.want != "" && tt.want != "plain-key" && strings.Contains(all, tt.want) {
+				t.Errorf("All() = %s; want it without the resolved key", all)
+			}
+		})
+	}
+}
+
+func TestAPIKey_CachesCommandOutput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the key command is a Unix shell command")
+	}
+	counter := filepath.Join(t.TempDir(), "runs")
+	command := fmt.Sprintf("echo run >> %s; echo cached-key", counter)
+	config := newConfig(t, map[string]string{keys.OptionGeminiApiKeyCmd: command})
+	for range 3 {
+		got, err := secrets.APIKey(config, keys.OptionGeminiApiKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != "cached-key" {
+			t.Errorf("APIKey() = %q; want cached-key", got)
+		}
+	}
+	runs, err := os.ReadFile(counter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(runs), "run"); n != 1 {
+		t.Errorf("the command ran %d times; want 1", n)
+	}
+}
@@ -0,0 +1,192 @@
+package configuration
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Type is the type of the value of an option.
+type Type int
+
+const (
+	TypeString Type = iota
+	TypeBool
+	TypeInt
+	TypeFloat
+	// TypeURL is an absolute http or https URL.
+	TypeURL
+	// TypeDate is a day such as 2025-01-31.
+	TypeDate
+)
+
+// Condition holds when the option named Key has one of Values.
+type Condition struct {
+	Key    string
+	Values []string
+}
+
+// Rule constrains the value of an option. The zero Rule accepts any value.
+type Rule struct {
+	Type Type
+	// Enum lists the allowed values. A blank value is always allowed, unless the option is required.
+	Enum []string
+	// Min is the lowest number allowed, and Max the highest. A nil bound allows any number, such as a negative seed.
+	Min *float64
+	Max *float64
+	// RequiredWhen makes the option required when all of its conditions hold.
+	RequiredWhen []Condition
+	// Alternatives are the options which fulfill the requirement instead, such as openai-api-key-cmd for
+	// openai-api-key.
+	Alternatives []string
+}
+
+// Bound returns a bound of a Rule, e.g., Rule{Type: TypeInt, Min: Bound(1)}.
+func Bound(number float64) *float64 {
+	return &number
+}
+
+// Problem is an option whose value breaks its rule.
+type Problem struct {
+	Key string
+	// Source describes where the value was set, as reported by Sources, or is blank if unknown or unset.
+	Source  string
+	Message string
+}
+
+func (p Problem) String() string {
+	if p.Source == "" {
+		return fmt.Sprintf("%s: %s", p.Key, p.Message)
+	}
+	return fmt.Sprintf("%s: %s (set by %s)", p.Key, p.Message, p.Source)
+}
+
+// Validate checks every option of rules against its rule and returns all the problems, sorted by option.
+func Validate(config Configuration, rules map[string]Rule) []Problem {
+	var problems []Problem
+	sources, _ := config.(Sources)
+	for key, rule := range rules {
+		message := rule.check(config, key)
+		if message == "" {
+			continue
+		}
+		problem := Problem{Key: key, Message: message}
+		// A missing option was not set anywhere
+		if sources != nil && valueString(config.Get(key)) != "" {
+			problem.Source = sources.Source(key)
+		}
+		problems = append(problems, problem)
+	}
+	slices.SortFunc(problems, func(a, b Problem) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+	return problems
+}
+
+// check returns why the value of the option breaks the rule, or "" if it does not.
+func (rule Rule) check(config Configuration, key string) string {
+	value := valueString(config.Get(key))
+	if value == "" {
+		if rule.required(config) {
+			return rule.requirement()
+		}
+		return ""
+	}
+	if len(rule.Enum) != 0 && !slices.Contains(rule.Enum, value) {
+		return fmt.Sprintf("%q is not one of %s", value, strings.Join(rule.Enum, ", "))
+	}
+	switch rule.Type {
+	case TypeBool:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Sprintf("%q is not true or false", value)
+		}
+	case TypeInt:
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Sprintf("%q is not an integer", value)
+		}
+		return rule.checkRange(float64(number))
+	case TypeFloat:
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Sprintf("%q is not a number", value)
+		}
+		return rule.checkRange(number)
+	case TypeURL:
+		u, err := url.Parse(value)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Sprintf("%q is not an http or https URL", value)
+		}
+	case TypeDate:
+		if _, err := time.Parse(time.DateOnly, value); err != nil {
+			return fmt.Sprintf("%q is not a day such as 2025-01-31", value)
+		}
+	}
+	return ""
+}
+
+func (rule Rule) checkRange(number float64) string {
+	if rule.Min != nil && number < *rule.Min {
+		return fmt.Sprintf("%v is less than %v", number, *rule.Min)
+	}
+	if rule.Max != nil && number > *rule.Max {
+		return fmt.Sprintf("%v is more than %v", number, *rule.Max)
+	}
+	return ""
+}
+
+func (rule Rule) required(config Configuration) bool {
+	if len(rule.RequiredWhen) == 0 {
+		return false
+	}
+	for _, condition := range rule.RequiredWhen {
+		if !slices.Contains(condition.Values, valueString(config.Get(condition.Key))) {
+			return false
+		}
+	}
+	for _, alternative := range rule.Alternatives {
+		if valueString(config.Get(alternative)) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func (rule Rule) requirement() string {
+	var conditions []string
+	for _, condition := range rule.RequiredWhen {
+		if len(condition.Values) == 1 {
+			conditions = append(conditions, fmt.Sprintf("%s is %s", condition.Key, condition.Values[0]))
+			continue
+		}
+		conditions = append(conditions, fmt.Sprintf("%s is one of %s", condition.Key, strings.Join(condition.Values, ", ")))
+	}
+	message := "required when " + strings.Join(conditions, " and ")
+	if len(rule.Alternatives) != 0 {
+		message += ", unless " + strings.Join(rule.Alternatives, " or ") + " is set"
+	}
+	return message
+}
+
+// valueString formats the values of the configuration file, environment variables, and flags alike. Lists, such as
+// stop-sequences in the configuration file, are joined with commas.
+func valueString(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.TrimSpace(v)
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			values = append(values, fmt.Sprint(item))
+		}
+		return strings.Join(values, ",")
+	case []string:
+		return strings.Join(v, ",")
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,101 @@
+package configuration_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/jlcheng/jcllm/configuration"
+	"github.com/knadh/koanf/v2"
+)
+
+var testRules = map[string]configuration.Rule{
+	"api-key": {
+		RequiredWhen: []configuration.Condition{{Key: "provider", Values: []string{"openai"}}},
+		Alternatives: []string{"api-key-cmd"},
+	},
+	"api-key-cmd":  {},
+	"color":        {Enum: []string{"auto", "always", "never"}},
+	"http-timeout": {Type: configuration.TypeInt, Min: configuration.Bound(1)},
+	"provider":     {Enum: []string{"gemini", "openai"}},
+	"seed":         {Type: configuration.TypeInt},
+	"raw":          {Type: configuration.TypeBool},
+	"since":        {Type: configuration.TypeDate},
+	"temperature":  {Type: configuration.TypeFloat, Min: configuration.Bound(0), Max: configuration.Bound(2)},
+	"url":          {Type: configuration.TypeURL},
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		values map[string]any
+		want   []string
+	}{
+		{
+			name: "valid values of every source",
+			values: map[string]any{
+				"color":        "always",
+				"http-timeout": int64(30),
+				"provider":     "gemini",
+				"raw":          true,
+				"since":        "2025-01-31",
+				"temperature":  "0.7",
+				"url":          "http://localhost:11434",
+			},
+		},
+		{
+			name:   "blank values are unset",
+			values: map[string]any{"color": "", "http-timeout": "", "temperature": ""},
+		},
+		{
+			name: "every problem",
+			values: map[string]any{
+				"color":        "sometimes",
+				"http-timeout": "abc",
+				"provider":     "openai",
+				"raw":          "maybe",
+				"since":        "yesterday",
+				"temperature":  2.5,
+				"url":          "localhost:11434",
+			},
+			want: []string{
+				"api-key: required when provider is openai, unless api-key-cmd is set",
+				`color: "sometimes" is not one of auto, always, never`,
+				`http-timeout: "abc" is not an integer`,
+				`raw: "maybe" is not true or false`,
+				`since: "yesterday" is not a day such as 2025-01-31`,
+				"temperature: 2.5 is more than 2",
+				`url: "localhost:11434" is not an http or https URL`,
+			},
+		},
+		{
+			name:   "below the minimum",
+			values: map[string]any{"http-timeout": "0", "temperature": "-0.5"},
+			want:   []string{"http-timeout: 0 is less than 1", "temperature: -0.5 is less than 0"},
+		},
+		{
+			name:   "without a minimum",
+			values: map[string]any{"seed": "-42"},
+		},
+		{
+			name:   "requirement fulfilled by an alternative",
+			values: map[string]any{"provider": "openai", "api-key-cmd": "pass show openai"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := koanf.New(".")
+			for key, value := range tt.values {
+				if err := config.Set(key, value); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var got []string
+			for _, problem := range configuration.Validate(config, testRules) {
+				got = append(got, problem.String())
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Validate() = %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,8 +2,33 @@ package dye
 
 import (
 	"fmt"
+	"os"
 )
 
+// enabled is whether escape codes are emitted. Colors are disabled when stdout is not a terminal, e.g., when the output
+// is piped, unless SetEnabled overrides it.
+var enabled = Detect(os.Stdout)
+
+// Detect reports whether f supports colors: it is a terminal, NO_COLOR is not set (see https://no-color.org), and TERM
+// is not dumb.
+func Detect(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// SetEnabled turns escape codes on or off, overriding the detection.
+func SetEnabled(on bool) {
+	enabled = on
+}
+
+// Enabled reports whether escape codes are emitted.
+func Enabled() bool {
+	return enabled
+}
+
 var (
 	escapeCodeReset   = "\033[0m"
 	escapeCodeRed     = "\033[31m"
@@ -13,12 +38,15 @@ var (
 	escapeCodeMagenta = "\033[35m"
 	escapeCodeCyan    = "\033[36m"
 	escapeCodeWhite   = "\033[37m"
+	escapeCodeGray    = "\033[90m"
 )
 
 type ColorString struct {
-	text  string
-	color string
-	bold  bool
+	text      string
+	color     string
+	bold      bool
+	italic    bool
+	underline bool
 }
 
 func Str(s string) *ColorString {
@@ -39,6 +67,16 @@ func (c *ColorString) Bold() *ColorString {
 	return c
 }
 
+func (c *ColorString) Italic() *ColorString {
+	c.italic = true
+	return c
+}
+
+func (c *ColorString) Underline() *ColorString {
+	c.underline = true
+	return c
+}
+
 func (c *ColorString) Red() string {
 	c.Apply(escapeCodeRed)
 	return c.Get()
@@ -74,10 +112,27 @@ func (c *ColorString) White() string {
 	return c.Get()
 }
 
+func (c *ColorString) Gray() string {
+	c.Apply(escapeCodeGray)
+	return c.Get()
+}
+
 func (c *ColorString) Get() string {
+	if !enabled {
+		return c.text
+	}
 	prefix := ""
 	if c.bold {
 		prefix = "\033[1m"
 	}
+	if c.italic {
+		prefix += "\033[3m"
+	}
+	if c.underline {
+		prefix += "\033[4m"
+	}
+	if prefix == "" && c.color == "" {
+		return c.text
+	}
 	return fmt.Sprintf("%s%s%s%s", prefix, c.color, c.text, escapeCodeReset)
 }
@@ -0,0 +1,191 @@
+package dye
+
+import (
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/go-errors/errors"
+)
+
+// Role is what a piece of text means to the user. A Theme decides how each role looks.
+type Role string
+
+const (
+	// RolePrompt styles the prompt of the REPL, and the questions it asks.
+	RolePrompt Role = "prompt"
+	// RoleModel styles model names, such as the one before each response.
+	RoleModel Role = "model"
+	// RoleStatus styles the notices of the REPL, such as "[Session saved as ...]".
+	RoleStatus Role = "status"
+	RoleError  Role = "error"
+	// RoleUsage styles the token usage and speed printed after each response.
+	RoleUsage Role = "usage"
+	// RoleCitation styles the sources of a response, such as the URLs of its links.
+	RoleCitation Role = "citation"
+	// RoleTool styles the tool calls of agent mode.
+	RoleTool Role = "tool"
+
+	// RoleHeading styles the top two levels of markdown headings, and RoleSubheading the others.
+	RoleHeading    Role = "heading"
+	RoleSubheading Role = "subheading"
+	// RoleCode styles markdown code spans.
+	RoleCode Role = "code"
+	// RoleMarker styles the bullets and numbers of markdown lists.
+	RoleMarker Role = "marker"
+	// RoleBorder styles the lines drawn around markdown: code fences, rules, quote bars, and table borders.
+	RoleBorder Role = "border"
+
+	// RoleKeyword, RoleString, RoleNumber, and RoleComment style the tokens of highlighted code blocks.
+	RoleKeyword Role = "keyword"
+	RoleString  Role = "string"
+	RoleNumber  Role = "number"
+	RoleComment Role = "comment"
+)
+
+// Roles are all the roles a theme may style.
+var Roles = []Role{
+	RolePrompt, RoleModel, RoleStatus, RoleError, RoleUsage, RoleCitation, RoleTool,
+	RoleHeading, RoleSubheading, RoleCode, RoleMarker, RoleBorder,
+	RoleKeyword, RoleString, RoleNumber, RoleComment,
+}
+
+// Style is a color and text attributes. The zero value is plain text.
+type Style struct {
+	color     string
+	bold      bool
+	italic    bool
+	underline bool
+}
+
+// Theme maps roles to styles. Roles missing from a theme are plain text.
+type Theme map[Role]Style
+
+var colorCodes = map[string]string{
+	"red":     escapeCodeRed,
+	"green":   escapeCodeGreen,
+	"yellow":  escapeCodeYellow,
+	"blue":    escapeCodeBlue,
+	"magenta": escapeCodeMagenta,
+	"cyan":    escapeCodeCyan,
+	"white":   escapeCodeWhite,
+	"gray":    escapeCodeGray,
+}
+
+// ParseStyle parses a style such as "bold yellow": at most one color, and any of bold, italic, and underline. "plain"
+// or an empty string is plain text.
+func ParseStyle(spec string) (Style, error) {
+	var style Style
+	for _, word := range strings.Fields(strings.ToLower(spec)) {
+		switch word {
+		case "bold":
+			style.bold = true
+		case "italic":
+			style.italic = true
+		case "underline":
+			style.underline = true
+		case "plain":
+		default:
+			code, ok := colorCodes[word]
+			if !ok {
+				return Style{}, errors.Errorf("unknown color or attribute %q in style %q, expected one of %s, bold, italic, underline, or plain",
+					word, spec, strings.Join(slices.Sorted(maps.Keys(colorCodes)), ", "))
+			}
+			style.color = code
+		}
+	}
+	return style, nil
+}
+
+func mustParseTheme(specs map[Role]string) Theme {
+	theme := make(Theme)
+	for role, spec := range specs {
+		style, err := ParseStyle(spec)
+		if err != nil {
+			panic(err)
+		}
+		theme[role] = style
+	}
+	return theme
+}
+
+// Themes are the built-in themes. "default" is used unless another theme is chosen.
+var Themes = map[string]Theme{
+	"default": mustParseTheme(map[Role]string{
+		RolePrompt:   "green",
+		RoleModel:    "bold yellow",
+		RoleStatus:   "bold yellow",
+		RoleError:    "bold red",
+		RoleUsage:    "gray",
+		RoleCitation: "gray",
+		RoleTool:     "cyan",
+
+		RoleHeading:    "bold magenta",
+		RoleSubheading: "bold blue",
+		RoleCode:       "cyan",
+		RoleMarker:     "yellow",
+		RoleBorder:     "gray",
+
+		RoleKeyword: "magenta",
+		RoleString:  "green",
+		RoleNumber:  "yellow",
+		RoleComment: "gray",
+	}),
+	"light": mustParseTheme(map[Role]string{
+		RolePrompt:   "blue",
+		RoleModel:    "bold magenta",
+		RoleStatus:   "bold blue",
+		RoleError:    "bold red",
+		RoleUsage:    "gray",
+		RoleCitation: "gray",
+		RoleTool:     "magenta",
+
+		RoleHeading:    "bold magenta",
+		RoleSubheading: "bold blue",
+		RoleCode:       "magenta",
+		RoleMarker:     "blue",
+		RoleBorder:     "gray",
+
+		RoleKeyword: "blue",
+		RoleString:  "green",
+		RoleNumber:  "magenta",
+		RoleComment: "gray",
+	}),
+	"mono": mustParseTheme(map[Role]string{
+		RolePrompt:   "bold",
+		RoleModel:    "bold",
+		RoleStatus:   "bold",
+		RoleError:    "bold underline",
+		RoleUsage:    "italic",
+		RoleCitation: "underline",
+		RoleTool:     "italic",
+
+		RoleHeading:    "bold underline",
+		RoleSubheading: "bold",
+		RoleCode:       "italic",
+		RoleMarker:     "bold",
+		RoleBorder:     "plain",
+
+		RoleKeyword: "bold",
+		RoleString:  "plain",
+		RoleNumber:  "plain",
+		RoleComment: "italic",
+	}),
+}
+
+var theme = Themes["default"]
+
+// SetTheme makes t the theme of the roles.
+func SetTheme(t Theme) {
+	theme = t
+}
+
+// As styles the string according to its role in the current theme.
+func (c *ColorString) As(role Role) string {
+	style := theme[role]
+	c.color = style.color
+	c.bold = c.bold || style.bold
+	c.italic = c.italic || style.italic
+	c.underline = c.underline || style.underline
+	return c.Get()
+}
@@ -0,0 +1,41 @@
+package dye_test
+
+import (
+	"testing"
+
+	"github.com/jlcheng/jcllm/dye"
+)
+
+func TestColorString_As(t *testing.T) {
+	style, err := dye.ParseStyle("Bold magenta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dye.SetTheme(dye.Theme{dye.RoleError: style})
+	defer dye.SetTheme(dye.Themes["default"])
+	defer dye.SetEnabled(dye.Enabled())
+
+	dye.SetEnabled(true)
+	if got, want := dye.Str("oops").As(dye.RoleError), "\033[1m\033[35moops\033[0m"; got != want {
+		t.Errorf("As(RoleError) = %q; want %q", got, want)
+	}
+	if got, want := dye.Str("42 tokens").As(dye.RoleUsage), "42 tokens"; got != want {
+		t.Errorf("As(RoleUsage) = %q; want %q for a role missing from the theme", got, want)
+	}
+
+	dye.SetEnabled(false)
+	if got := dye.Str("oops").As(dye.RoleError); got != "oops" {
+		t.Errorf("As(RoleError) = %q; want plain text when colors are disabled", got)
+	}
+}
+
+func TestParseStyle(t *testing.T) {
+	for _, spec := range []string{"", "plain", "gray", "italic underline cyan"} {
+		if _, err := dye.ParseStyle(spec); err != nil {
+			t.Errorf("ParseStyle(%q) = %v; want no error", spec, err)
+		}
+	}
+	if _, err := dye.ParseStyle("bold purple"); err == nil {
+		t.Error("ParseStyle(bold purple) = nil; want an error for the unknown color")
+	}
+}
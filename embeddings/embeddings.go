@@ -0,0 +1,149 @@
+// Package embeddings reads the texts to embed, has a provider embed them, and writes their vectors as JSONL or as a
+// NumPy .npy file.
+package embeddings
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-errors/errors"
+	"github.com/jlcheng/jcllm/llm"
+)
+
+// maxLineBytes bounds the size of a single line of the input.
+const maxLineBytes = 64 * 1024 * 1024
+
+type (
+	// Input is a text to embed. ID defaults to the line number of the text.
+	Input struct {
+		ID   string `json:"id,omitempty"`
+		Text string `json:"text"`
+	}
+
+	// Vector is a line of the JSONL output.
+	Vector struct {
+		ID        string    `json:"id"`
+		Embedding []float32 `json:"embedding"`
+	}
+)
+
+// ReadLines reads a text from every line of r. Blank lines are skipped.
+func ReadLines(r io.Reader) ([]Input, error) {
+	var inputs []Input
+	err := scanLines(r, func(lineNumber int, line string) error {
+		inputs = append(inputs, Input{ID: strconv.Itoa(lineNumber), Text: line})
+		return nil
+	})
+	return inputs, err
+}
+
+// ReadJSONL reads an Input from every line of r, e.g., {"id": "doc-1", "text": "..."}. Blank lines are skipped.
+func ReadJSONL(r io.Reader) ([]Input, error) {
+	var inputs []Input
+	err := scanLines(r, func(lineNumber int, line string) error {
+		var input Input
+		if err := json.Unmarshal([]byte(line), &input); err != nil {
+			return errors.WrapPrefix(err, fmt.Sprintf("invalid input on line %d", lineNumber), 0)
+		}
+		if strings.TrimSpace(input.Text) == "" {
+			return errors.Errorf("no text on line %d", lineNumber)
+		}
+		if input.ID == "" {
+			input.ID = strconv.Itoa(lineNumber)
+		}
+		inputs = append(inputs, input)
+		return nil
+	})
+	return inputs, err
+}
+
+func scanLines(r io.Reader, handle func(lineNumber int, line string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineBytes)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if err := handle(lineNumber, line); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.WrapPrefix(err, "cannot read input", 0)
+	}
+	return nil
+}
+
+// Embed embeds the texts of inputs, in batches of at most batchSize texts, and returns their vectors in order. A blank
+// model name selects the default embedding model of the provider.
+func Embed(ctx context.Context, embedder llm.Embedder, inputs []Input, modelName string, batchSize int) ([][]float32, error) {
+	vectors := make([][]float32, 0, len(inputs))
+	for batch := range slices.Chunk(inputs, max(batchSize, 1)) {
+		texts := make([]string, 0, len(batch))
+		for _, input := range batch {
+			texts = append(texts, input.Text)
+		}
+		batchVectors, err := embedder.Embed(ctx, texts, modelName)
+		if err != nil {
+			return vectors, errors.WrapPrefix(err, fmt.Sprintf("cannot embed the texts %s to %s", batch[0].ID, batch[len(batch)-1].ID), 0)
+		}
+		vectors = append(vectors, batchVectors...)
+	}
+	return vectors, nil
+}
+
+// WriteJSONL writes a Vector for each input to w.
+func WriteJSONL(w io.Writer, inputs []Input, vectors [][]float32) error {
+	output := bufio.NewWriter(w)
+	encoder := json.NewEncoder(output)
+	for i, vector := range vectors {
+		if err := encoder.Encode(Vector{ID: inputs[i].ID, Embedding: vector}); err != nil {
+			return errors.WrapPrefix(err, "cannot write vectors", 0)
+		}
+	}
+	if err := output.Flush(); err != nil {
+		return errors.WrapPrefix(err, "cannot write vectors", 0)
+	}
+	return nil
+}
+
+// WriteNPY writes the vectors to w as a two-dimensional float32 array, in version 1.0 of the NumPy format, which
+// numpy.load reads. Each row is the vector of an input. The vectors must have the same dimensions.
+func WriteNPY(w io.Writer, vectors [][]float32) error {
+	dimensions := 0
+	if len(vectors) != 0 {
+		dimensions = len(vectors[0])
+	}
+	for i, vector := range vectors {
+		if len(vector) != dimensions {
+			return errors.Errorf("vector %d has %d dimensions, the first one has %d", i+1, len(vector), dimensions)
+		}
+	}
+	header := fmt.Sprintf("{'descr': '<f4', 'fortran_order': False, 'shape': (%d, %d), }", len(vectors), dimensions)
+	// The header is padded with spaces and a newline, so that the data starts at a multiple of 64 bytes
+	const preambleBytes = 10
+	padding := (64 - (preambleBytes+len(header)+1)%64) % 64
+	header += strings.Repeat(" ", padding) + "\n"
+
+	output := bufio.NewWriter(w)
+	output.WriteString("\x93NUMPY\x01\x00")
+	_ = binary.Write(output, binary.LittleEndian, uint16(len(header)))
+	output.WriteString(header)
+	for _, vector := range vectors {
+		if err := binary.Write(output, binary.LittleEndian, vector); err != nil {
+			return errors.WrapPrefix(err, "cannot write vectors", 0)
+		}
+	}
+	if err := output.Flush(); err != nil {
+		return errors.WrapPrefix(err, "cannot write vectors", 0)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package embeddings_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jlcheng/jcllm/embeddings"
+)
+
+// stubEmbedder embeds a text as its length, and records the size of each batch.
+type stubEmbedder struct {
+	batches []int
+}
+
+func (e *stubEmbedder) Embed(_ context.Context, texts []string, _ string) ([][]float32, error) {
+	e.batches = append(e.batches, len(texts))
+	vectors := make([][]float32, 0, len(texts))
+	for _, text := range texts {
+		vectors = append(vectors, []float32{float32(len(text))})
+	}
+	return vectors, nil
+}
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		name    string
+		read    func(string) ([]embeddings.Input, error)
+		input   string
+		want    []embeddings.Input
+		wantErr bool
+	}{
+		{
+			name:  "lines",
+			read:  func(s string) ([]embeddings.Input, error) { return embeddings.ReadLines(strings.NewReader(s)) },
+			input: "first\n\n  second  \n",
+			want:  []embeddings.Input{{ID: "1", Text: "first"}, {ID: "3", Text: "second"}},
+		},
+		{
+			name:  "jsonl",
+			read:  func(s string) ([]embeddings.Input, error) { return embeddings.ReadJSONL(strings.NewReader(s)) },
+			input: `{"id": "doc-1", "text": "first"}` + "\n\n" + `{"text": "second"}`,
+			want:  []embeddings.Input{{ID: "doc-1", Text: "first"}, {ID: "3", Text: "second"}},
+		},
+		{
+			name:    "jsonl without text",
+			read:    func(s string) ([]embeddings.Input, error) { return embeddings.ReadJSONL(strings.NewReader(s)) },
+			input:   `{"id": "doc-1"}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid jsonl",
+			read:    func(s string) ([]embeddings.Input, error) { return embeddings.ReadJSONL(strings.NewReader(s)) },
+			input:   "first",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.read(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v; wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("inputs = %+v; want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmbed(t *testing.T) {
+	inputs := []embeddings.Input{{ID: "1", Text: "a"}, {ID: "2", Text: "bb"}, {ID: "3", Text: "ccc"}, {ID: "4", Text: "dddd"}, {ID: "5", Text: "eeeee"}}
+	embedder := &stubEmbedder{}
+	vectors, err := embeddings.Embed(context.Background(), embedder, inputs, "", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]float32{{1}, {2}, {3}, {4}, {5}}; !reflect.DeepEqual(vectors, want) {
+		t.Errorf("vectors = %v; want %v", vectors, want)
+	}
+	if want := []int{2, 2, 1}; !reflect.DeepEqual(embedder.batches, want) {
+		t.Errorf("batches = %v; want %v", embedder.batches, want)
+	}
+
+	var output bytes.Buffer
+	if err := embeddings.WriteJSONL(&output, inputs[:2], vectors[:2]); err != nil {
+		t.Fatal(err)
+	}
+	if want := "{\"id\":\"1\",\"embedding\":[1]}\n{\"id\":\"2\",\"embedding\":[2]}\n"; output.String() != want {
+		t.Errorf("output = %q; want %q", output.String(), want)
+	}
+}
+
+func TestWriteNPY(t *testing.T) {
+	var output bytes.Buffer
+	if err := embeddings.WriteNPY(&output, [][]float32{{1, 2, 3}, {4, 5, 6}}); err != nil {
+		t.Fatal(err)
+	}
+	data := output.Bytes()
+	if !bytes.HasPrefix(data, []byte("\x93NUMPY\x01\x00")) {
+		t.Fatalf("output = %q; want the magic string of version 1.0", data[:8])
+	}
+	headerLength := int(binary.LittleEndian.Uint16(data[8:10]))
+	header := string(data[10 : 10+headerLength])
+	if (10+headerLength)%64 != 0 || !strings.HasSuffix(header, "\n") {
+		t.Errorf("header %q is not padded to a multiple of 64 bytes", header)
+	}
+	if !strings.Contains(header, "'descr': '<f4'") || !strings.Contains(header, "'shape': (2, 3)") {
+		t.Errorf("header = %q; want a 2x3 float32 array", header)
+	}
+	body := data[10+headerLength:]
+	if len(body) != 6*4 {
+		t.Fatalf("got %d bytes of data; want %d", len(body), 6*4)
+	}
+	for i := range 6 {
+		if got := math.Float32frombits(binary.LittleEndian.Uint32(body[i*4:])); got != float32(i+1) {
+			t.Errorf("element %d = %v; want %v", i, got, i+1)
+		}
+	}
+
+	if err := embeddings.WriteNPY(&bytes.Buffer{}, [][]float32{{1, 2}, {3}}); err == nil {
+		t.Error("WriteNPY() = nil; want an error for vectors of different dimensions")
+	}
+}
@@ -0,0 +1,61 @@
+package extract
+
+import (
+	"strings"
+)
+
+// CodeBlocks returns the contents of the fenced code blocks in a markdown text, without the fences. A fence is a line
+// starting with three or more backticks or tildes; the block ends at a line with a fence of the same character that is
+// at least as long. An unterminated block runs to the end of the text.
+//
+// Input:
+//
+//	"Run this:\n```sh\nls -l\n```\nDone."
+//
+// Output:
+//
+//	["ls -l\n"]
+func CodeBlocks(text string) []string {
+	blocks := make([]string, 0)
+	var (
+		inBlock bool
+		fence   string
+		current strings.Builder
+	)
+	for _, line := range strings.SplitAfter(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if !inBlock {
+			if marker := fenceMarker(trimmed); marker != "" {
+				inBlock = true
+				fence = marker
+				current.Reset()
+			}
+			continue
+		}
+		if marker := fenceMarker(trimmed); marker != "" && strings.HasPrefix(marker, fence) && marker == trimmed {
+			blocks = append(blocks, current.String())
+			inBlock = false
+			continue
+		}
+		current.WriteString(line)
+	}
+	if inBlock {
+		blocks = append(blocks, current.String())
+	}
+	return blocks
+}
+
+// fenceMarker returns the run of backticks or tildes which starts line, if it is long enough to be a code fence.
+func fenceMarker(line string) string {
+	if len(line) < 3 || (line[0] != '`' && line[0] != '~') {
+		return ""
+	}
+	end := 0
+	for end < len(line) && line[end] == line[0] {
+		end++
+	}
+	if end < 3 {
+		return ""
+	}
+	return line[:end]
+}
@@ -0,0 +1,56 @@
+package extract_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jlcheng/jcllm/extract"
+)
+
+func TestCodeBlocks(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{
+			name:  "No code blocks",
+			input: "Hello world",
+			want:  []string{},
+		},
+		{
+			name:  "One block with a language",
+			input: "Run this:\n```sh\nls -l\n```\nDone.",
+			want:  []string{"ls -l\n"},
+		},
+		{
+			name:  "Multiple blocks",
+			input: "```go\nfmt.Println(1)\n```\nand\n~~~\nprint(2)\n~~~\n",
+			want:  []string{"fmt.Println(1)\n", "print(2)\n"},
+		},
+		{
+			name:  "Longer fence contains a shorter one",
+			input: "````md\n```go\nx := 1\n```\n````",
+			want:  []string{"```go\nx := 1\n```\n"},
+		},
+		{
+			name:  "Unterminated block",
+			input: "```python\nprint('partial')\n",
+			want:  []string{"print('partial')\n"},
+		},
+		{
+			name:  "Inline backticks are not fences",
+			input: "Use `go test` or ``go vet``.",
+			want:  []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := extract.CodeBlocks(tt.input)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CodeBlocks(%q) = %q; want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+// Package anthropicmodels provides json object definitions for objects described in the Anthropic Messages API documentation.
+package anthropicmodels
+
+type ListModelsResponse struct {
+	Data    []Model `json:"data"`
+	HasMore bool    `json:"has_more"`
+	FirstID string  `json:"first_id"`
+	LastID  string  `json:"last_id"`
+}
+
+type Model struct {
+	ID          string `json:"id"`
+	Type        string `json:"type"`
+	DisplayName string `json:"display_name"`
+	CreatedAt   string `json:"created_at"`
+}
+
+// CreateMessageRequest represents the request body for the "Messages" API.
+type CreateMessageRequest struct {
+	Model         string    `json:"model"`
+	Messages      []Message `json:"messages"`
+	MaxTokens     int       `json:"max_tokens"`
+	System        string    `json:"system,omitempty"`
+	Stream        *bool     `json:"stream,omitempty"`
+	StopSequences []string  `json:"stop_sequences,omitempty"`
+	Temperature   *float64  `json:"temperature,omitempty"`
+	TopP          *float64  `json:"top_p,omitempty"`
+}
+
+// Message represents a message in the messages array.
+type Message struct {
+	Content string `json:"content"`
+	Role    string `json:"role"`
+}
+
+// StreamEvent is the payload of a single server-sent event. Only the fields relevant to the event Type are populated.
+type StreamEvent struct {
+	Type    string        `json:"type"`
+	Index   int           `json:"index"`
+	Message *MessageStart `json:"message,omitempty"`
+	Delta   *StreamDelta  `json:"delta,omitempty"`
+	Usage   *Usage        `json:"usage,omitempty"`
+	Error   *APIError     `json:"error,omitempty"`
+	Content *ContentBlock `json:"content_block,omitempty"`
+}
+
+type MessageStart struct {
+	ID    string `json:"id"`
+	Model string `json:"model"`
+	Role  string `json:"role"`
+	Usage Usage  `json:"usage"`
+}
+
+type ContentBlock struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// StreamDelta is either a content delta (Type is set) or a message delta (StopReason is set).
+type StreamDelta struct {
+	Type       string `json:"type"`
+	Text       string `json:"text"`
+	StopReason string `json:"stop_reason"`
+}
+
+// Usage reports the prompt tokens in three parts: InputTokens are the tokens which were not cached, CacheReadInputTokens
+// were read from the cache, and CacheCreationInputTokens were written to it.
+type Usage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+type APIErrorResponse struct {
+	Type  string   `json:"type"`
+	Error APIError `json:"error"`
+}
+
+type APIError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
@@ -0,0 +1,60 @@
+package llm
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// APIError is an error response of a provider's API. RetryAfter is how long the provider asked to wait before trying
+// again, or 0 if it did not say.
+type APIError struct {
+	StatusCode int
+	Message    string
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("status code: %d, message: %s", e.StatusCode, e.Message)
+}
+
+// rateLimitResetHeaders tell when the rate limits of OpenAI and Anthropic reset.
+var rateLimitResetHeaders = []string{
+	"x-ratelimit-reset-requests",
+	"x-ratelimit-reset-tokens",
+	"anthropic-ratelimit-requests-reset",
+	"anthropic-ratelimit-tokens-reset",
+	"anthropic-ratelimit-input-tokens-reset",
+	"anthropic-ratelimit-output-tokens-reset",
+}
+
+// RetryAfter reads how long to wait before retrying a request from the headers of its response: retry-after-ms,
+// Retry-After, or else the latest reset of the rate limits. It returns 0 if the headers do not say.
+func RetryAfter(header http.Header, now time.Time) time.Duration {
+	if ms, err := strconv.ParseFloat(header.Get("retry-after-ms"), 64); err == nil && ms >= 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+	if value := header.Get("Retry-After"); value != "" {
+		if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds >= 0 {
+			return time.Duration(seconds * float64(time.Second))
+		}
+		if date, err := http.ParseTime(value); err == nil {
+			return max(date.Sub(now), 0)
+		}
+	}
+	var wait time.Duration
+	for _, name := range rateLimitResetHeaders {
+		value := header.Get(name)
+		if value == "" {
+			continue
+		}
+		// OpenAI sends durations such as "6m0s", Anthropic sends timestamps
+		if d, err := time.ParseDuration(value); err == nil {
+			wait = max(wait, d)
+		} else if t, err := time.Parse(time.RFC3339, value); err == nil {
+			wait = max(wait, t.Sub(now))
+		}
+	}
+	return wait
+}
@@ -0,0 +1,33 @@
+package llm_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jlcheng/jcllm/llm"
+)
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 31, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		header map[string]string
+		want   time.Duration
+	}{
+		{map[string]string{"retry-after-ms": "250", "Retry-After": "1"}, 250 * time.Millisecond},
+		{map[string]string{"Retry-After": "3"}, 3 * time.Second},
+		{map[string]string{"Retry-After": now.Add(5 * time.Second).Format(http.TimeFormat)}, 5 * time.Second},
+		{map[string]string{"x-ratelimit-reset-requests": "1s", "x-ratelimit-reset-tokens": "6m0s"}, 6 * time.Minute},
+		{map[string]string{"anthropic-ratelimit-tokens-reset": now.Add(20 * time.Second).Format(time.RFC3339)}, 20 * time.Second},
+		{map[string]string{"Retry-After": "soon"}, 0},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		for name, value := range tt.header {
+			header.Set(name, value)
+		}
+		if got := llm.RetryAfter(header, now); got != tt.want {
+			t.Errorf("RetryAfter(%v) = %v; want %v", tt.header, got, tt.want)
+		}
+	}
+}
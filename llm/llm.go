@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"iter"
+	"slices"
 )
 
 //go:generate go run github.com/maxbrunsfeld/counterfeiter/v6 -generate
@@ -18,6 +19,18 @@ type (
 		SolicitResponse(ctx context.Context, input SolicitResponseInput) (ResponseStream, error)
 	}
 
+	// ModelPuller is implemented by providers which can download models on demand, such as a local Ollama server.
+	ModelPuller interface {
+		PullModel(ctx context.Context, modelName string) (iter.Seq2[PullProgress, error], error)
+	}
+
+	// Embedder is implemented by providers which can turn texts into embedding vectors, e.g., for a search index.
+	Embedder interface {
+		// Embed returns the vector of each text, in order. A blank model name selects the default embedding model of
+		// the provider.
+		Embed(ctx context.Context, texts []string, modelName string) ([][]float32, error)
+	}
+
 	// RoleMapper maps the generic role to a provider-specific role and vice versa.
 	RoleMapper interface {
 		ToProviderRole(genericRole string) (providerRole string)
@@ -32,13 +45,48 @@ type (
 
 	ChatEntry struct {
 		Role string `json:"role"`
-		Text string `json:"text"`
+		// Parts are the content of the entry, in order. Use Text to read the text content.
+		Parts []Part `json:"parts,omitempty"`
+		// ToolCalls are the tools the assistant asked to invoke in this turn.
+		ToolCalls []ToolCall `json:"toolCalls,omitempty"`
+		// ToolCallID identifies the ToolCall answered by a RoleTool entry.
+		ToolCallID string `json:"toolCallId,omitempty"`
+		// ToolName is the name of the tool which produced a RoleTool entry.
+		ToolName string `json:"toolName,omitempty"`
+		// Truncated is set on a response which was interrupted before the model finished it.
+		Truncated bool `json:"truncated,omitempty"`
 	}
 
 	SolicitResponseInput struct {
 		Conversation Conversation
 		ModelName    string
-		Args         map[string]string
+		Settings     GenerationSettings
+		// Overrides are the settings which the caller chose for this request, such as with /c set, on top of the
+		// configured settings of ModelName. They are already merged into Settings, and only matter to providers which
+		// choose the model themselves, such as the router.
+		Overrides GenerationSettings
+		// SuppressMentions sends the last entry verbatim, instead of interpreting mentions such as @ground at its end.
+		SuppressMentions bool
+		// Tools are the tools the model may ask the caller to invoke.
+		Tools []Tool
+		// ResponseSchema is a JSON schema which the response must conform to. The response is free-form text when nil.
+		ResponseSchema map[string]any
+	}
+
+	// Tool declares a function which the model may call.
+	Tool struct {
+		Name        string
+		Description string
+		// Parameters is a JSON schema describing the arguments object, e.g., {"type": "object", "properties": {...}}.
+		Parameters map[string]any
+	}
+
+	// ToolCall is a request from the model to invoke a tool.
+	ToolCall struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+		// Arguments is a JSON object matching the parameters schema of the tool.
+		Arguments string `json:"arguments"`
 	}
 
 	ModelInfo struct {
@@ -47,16 +95,39 @@ type (
 		Description string
 		MaxTokens   int
 		Version     string
+		// Size is the size of the model on disk, in bytes. It is only reported for locally hosted models.
+		Size int64
+		// Quantization is the quantization level, e.g., Q4_K_M. It is only reported for locally hosted models.
+		Quantization string
 	}
 
 	ResponseStream struct {
 		Role     string
 		Messages iter.Seq2[Message, error]
+		// Provider and Model name the model which answered, when the provider chose it, such as the router. They are
+		// empty otherwise.
+		Provider string
+		Model    string
+	}
+
+	PullProgress struct {
+		Status    string
+		Completed int64
+		Total     int64
 	}
 
 	Message struct {
+		// TokenCount is the number of output tokens reported for this chunk.
 		TokenCount int
-		Text       string
+		// InputTokenCount is the number of prompt tokens, reported by providers which include it in the stream.
+		InputTokenCount int
+		// CachedTokenCount is the part of InputTokenCount which was read from the prompt cache of the provider.
+		CachedTokenCount int
+		// ReasoningTokenCount is the part of TokenCount which the model spent reasoning before it answered.
+		ReasoningTokenCount int
+		Text                string
+		// ToolCalls are only set on the message which completes a tool call, never on partial chunks.
+		ToolCalls []ToolCall
 	}
 )
 
@@ -64,7 +135,26 @@ const (
 	RoleSystem    = "RoleSystem"
 	RoleUser      = "RoleUser"
 	RoleAssistant = "RoleAssistant"
+	// RoleTool is the role of an entry which carries the result of a ToolCall back to the model.
+	RoleTool = "RoleTool"
 )
 
 var ErrProviderNotFound = errors.New("provider not found")
 var ErrBlankInput = errors.New("no input")
+
+// ErrUnsupportedResponseSchema is returned by providers which cannot constrain their output to a JSON schema.
+var ErrUnsupportedResponseSchema = errors.New("response schema not supported by provider")
+
+// ErrUnsupportedTools is returned by providers which cannot offer tools to the model, or send it the results of tool
+// calls.
+var ErrUnsupportedTools = errors.New("tools not supported by provider")
+
+// UsesTools reports whether the input offers tools to the model, or holds tool calls or their results.
+func (input SolicitResponseInput) UsesTools() bool {
+	if len(input.Tools) > 0 {
+		return true
+	}
+	return slices.ContainsFunc(input.Conversation.Entries, func(entry ChatEntry) bool {
+		return entry.Role == RoleTool || len(entry.ToolCalls) > 0
+	})
+}
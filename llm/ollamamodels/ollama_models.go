@@ -0,0 +1,84 @@
+// Package ollamamodels provides json object definitions for objects described in the Ollama API documentation.
+package ollamamodels
+
+type ListModelsResponse struct {
+	Models []Model `json:"models"`
+}
+
+type Model struct {
+	Name       string       `json:"name"`
+	Model      string       `json:"model"`
+	ModifiedAt string       `json:"modified_at"`
+	Size       int64        `json:"size"`
+	Digest     string       `json:"digest"`
+	Details    ModelDetails `json:"details"`
+}
+
+type ModelDetails struct {
+	ParentModel       string   `json:"parent_model"`
+	Format            string   `json:"format"`
+	Family            string   `json:"family"`
+	Families          []string `json:"families"`
+	ParameterSize     string   `json:"parameter_size"`
+	QuantizationLevel string   `json:"quantization_level"`
+}
+
+// ChatRequest represents the request body for the "Generate a chat completion" API.
+type ChatRequest struct {
+	Model    string    `json:"model"`
+	Messages []Message `json:"messages"`
+	Stream   *bool     `json:"stream,omitempty"`
+	// KeepAlive is either a duration string, such as "5m", or a number of seconds. A negative number keeps the model
+	// loaded indefinitely.
+	KeepAlive any      `json:"keep_alive,omitempty"`
+	Options   *Options `json:"options,omitempty"`
+	// Format is either "json", or a JSON schema which the response must conform to.
+	Format any `json:"format,omitempty"`
+}
+
+// Options are the model parameters of a request.
+type Options struct {
+	NumPredict  *int     `json:"num_predict,omitempty"`
+	Seed        *int     `json:"seed,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+}
+
+// Message represents a message in the messages array.
+type Message struct {
+	Content string `json:"content"`
+	Role    string `json:"role"`
+}
+
+// ChatResponse is a single line of the NDJSON stream returned by the chat API. The final line has Done set and carries
+// the usage counters.
+type ChatResponse struct {
+	Model           string  `json:"model"`
+	CreatedAt       string  `json:"created_at"`
+	Message         Message `json:"message"`
+	Done            bool    `json:"done"`
+	DoneReason      string  `json:"done_reason"`
+	PromptEvalCount int     `json:"prompt_eval_count"`
+	EvalCount       int     `json:"eval_count"`
+	Error           string  `json:"error"`
+}
+
+// PullRequest represents the request body for the "Pull a model" API.
+type PullRequest struct {
+	Model  string `json:"model"`
+	Stream *bool  `json:"stream,omitempty"`
+}
+
+// PullResponse is a single line of the NDJSON stream returned by the pull API.
+type PullResponse struct {
+	Status    string `json:"status"`
+	Digest    string `json:"digest"`
+	Total     int64  `json:"total"`
+	Completed int64  `json:"completed"`
+	Error     string `json:"error"`
+}
+
+type APIErrorResponse struct {
+	Error string `json:"error"`
+}
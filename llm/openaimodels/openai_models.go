@@ -1,6 +1,8 @@
 // Package openaimodels provides json object definitions for objects described in OpenAI documentations.
 package openaimodels
 
+import "encoding/json"
+
 type ListModelsResponse struct {
 	Object string  `json:"object"`
 	Data   []Model `json:"data"`
@@ -15,18 +17,124 @@ type Model struct {
 
 // CreateChatCompletionRequest represents the request body for the "Create chat completion" API.
 type CreateChatCompletionRequest struct {
-	Model           string          `json:"model"`
-	Messages        []Message       `json:"messages"`
+	Model               string    `json:"model"`
+	Messages            []Message `json:"messages"`
+	MaxCompletionTokens *int      `json:"max_completion_tokens,omitempty"`
+	// MaxTokens is the deprecated name of MaxCompletionTokens, which some clients still send.
+	MaxTokens       *int            `json:"max_tokens,omitempty"`
 	ReasoningEffort *string         `json:"reasoning_effort,omitempty"`
 	ResponseFormat  *ResponseFormat `json:"response_format,omitempty"`
+	Seed            *int            `json:"seed,omitempty"`
+	Stop            StopSequences   `json:"stop,omitempty"`
 	Stream          *bool           `json:"stream,omitempty"`
 	StreamOptions   *StreamOptions  `json:"stream_options,omitempty"`
+	Temperature     *float64        `json:"temperature,omitempty"`
+	Tools           []Tool          `json:"tools,omitempty"`
+	TopP            *float64        `json:"top_p,omitempty"`
+}
+
+// StopSequences are the sequences which stop the generation. Clients send either a single string or an array.
+type StopSequences []string
+
+// UnmarshalJSON decodes a single stop sequence as well as an array of them.
+func (s *StopSequences) UnmarshalJSON(data []byte) error {
+	var stop string
+	if err := json.Unmarshal(data, &stop); err == nil {
+		*s = StopSequences{stop}
+		return nil
+	}
+	var stops []string
+	if err := json.Unmarshal(data, &stops); err != nil {
+		return err
+	}
+	*s = stops
+	return nil
+}
+
+// Message represents a message in the messages array. Content is either a string, or a []ContentPart when the message
+// includes images or files.
+type Message struct {
+	Content    interface{} `json:"content,omitempty"`
+	Role       string      `json:"role"`
+	ToolCalls  []ToolCall  `json:"tool_calls,omitempty"`
+	ToolCallID string      `json:"tool_call_id,omitempty"`
+}
+
+// UnmarshalJSON decodes the content of a message as either a string or a []ContentPart.
+func (m *Message) UnmarshalJSON(data []byte) error {
+	type plainMessage Message
+	var message struct {
+		plainMessage
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(data, &message); err != nil {
+		return err
+	}
+	*m = Message(message.plainMessage)
+	switch {
+	case len(message.Content) == 0 || string(message.Content) == "null":
+		m.Content = nil
+	case message.Content[0] == '[':
+		var parts []ContentPart
+		if err := json.Unmarshal(message.Content, &parts); err != nil {
+			return err
+		}
+		m.Content = parts
+	default:
+		var text string
+		if err := json.Unmarshal(message.Content, &text); err != nil {
+			return err
+		}
+		m.Content = text
+	}
+	return nil
+}
+
+// ContentPart is an element of the content array of a message.
+type ContentPart struct {
+	Type     string    `json:"type"`
+	Text     string    `json:"text,omitempty"`
+	ImageURL *ImageURL `json:"image_url,omitempty"`
+	File     *File     `json:"file,omitempty"`
+}
+
+// ImageURL is either the URL of an image, or the image itself as a data URI.
+type ImageURL struct {
+	URL string `json:"url"`
+}
+
+// File is a file, such as a PDF, given either as a data URI or as the id of an uploaded file.
+type File struct {
+	FileData string `json:"file_data,omitempty"`
+	FileID   string `json:"file_id,omitempty"`
+	Filename string `json:"filename,omitempty"`
+}
+
+// Tool is a tool the model may call. Currently, only functions are supported as a tool.
+type Tool struct {
+	Type     string             `json:"type"`
+	Function FunctionDefinition `json:"function"`
+}
+
+type FunctionDefinition struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Parameters  interface{} `json:"parameters,omitempty"` // A JSON schema object
+	Strict      *bool       `json:"strict,omitempty"`
 }
 
-// Message represents a message in the messages array.
-type Message struct {
-	Content string `json:"content"`
-	Role    string `json:"role"`
+// ToolCall is a tool call generated by the model. In a streamed response, the fields arrive in fragments which are
+// associated with each other by Index.
+type ToolCall struct {
+	Index    *int         `json:"index,omitempty"`
+	ID       string       `json:"id,omitempty"`
+	Type     string       `json:"type,omitempty"`
+	Function FunctionCall `json:"function"`
+}
+
+type FunctionCall struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments"`
 }
 
 // ResponseFormat specifies the format that the model must output.
@@ -67,17 +175,23 @@ type ChatChoice struct {
 }
 
 type ChatMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role      string     `json:"role"`
+	Content   string     `json:"content"`
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
 }
 
 type ChatUsage struct {
 	PromptTokens            int                    `json:"prompt_tokens"`
 	CompletionTokens        int                    `json:"completion_tokens"`
 	TotalTokens             int                    `json:"total_tokens"`
+	PromptTokensDetails     PromptTokenDetails     `json:"prompt_tokens_details"`
 	CompletionTokensDetails CompletionTokenDetails `json:"completion_tokens_details"`
 }
 
+type PromptTokenDetails struct {
+	CachedTokens int `json:"cached_tokens"`
+}
+
 type CompletionTokenDetails struct {
 	ReasoningTokens          int `json:"reasoning_tokens"`
 	AcceptedPredictionTokens int `json:"accepted_prediction_tokens"`
@@ -102,8 +216,9 @@ type ChatChunkChoice struct {
 }
 
 type ChatDelta struct {
-	Role    string `json:"role,omitempty"`
-	Content string `json:"content,omitempty"`
+	Role      string     `json:"role,omitempty"`
+	Content   string     `json:"content,omitempty"`
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
 }
 
 type APIErrorResponse struct {
@@ -115,3 +230,23 @@ type APIError struct {
 	Param   string `json:"param"`
 	Code    string `json:"code"`
 }
+
+// CreateEmbeddingRequest represents the request body for the "Create embeddings" API.
+type CreateEmbeddingRequest struct {
+	Model          string   `json:"model"`
+	Input          []string `json:"input"`
+	EncodingFormat string   `json:"encoding_format,omitempty"`
+}
+
+type CreateEmbeddingResponse struct {
+	Object string      `json:"object"`
+	Data   []Embedding `json:"data"`
+	Model  string      `json:"model"`
+}
+
+type Embedding struct {
+	Object string `json:"object"`
+	// Index is the position of the input this embedding was made from.
+	Index     int       `json:"index"`
+	Embedding []float32 `json:"embedding"`
+}
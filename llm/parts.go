@@ -0,0 +1,124 @@
+package llm
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// PartType is the kind of content held by a Part.
+type PartType string
+
+const (
+	// PartText is plain text.
+	PartText PartType = "text"
+	// PartInline is binary content sent along with the request, such as an image or a PDF.
+	PartInline PartType = "inline"
+	// PartFile references content by URI, such as an uploaded file or an image URL.
+	PartFile PartType = "file"
+)
+
+// MIMETypeImage is the MIME type of an image whose format is unknown, such as an image URL without an extension.
+const MIMETypeImage = "image/*"
+
+// ErrUnsupportedPart is returned by providers which cannot send a part of the conversation, such as an attachment.
+var ErrUnsupportedPart = errors.New("content part not supported by provider")
+
+// Part is a piece of the content of a chat entry.
+type Part struct {
+	Type PartType `json:"type"`
+	Text string   `json:"text,omitempty"`
+	// MIMEType is the media type of inline and file parts, e.g., image/png.
+	MIMEType string `json:"mimeType,omitempty"`
+	// Data is the content of an inline part. It is base64 encoded in JSON.
+	Data []byte `json:"data,omitempty"`
+	// URI locates the content of a file part.
+	URI string `json:"uri,omitempty"`
+	// Name is the file name of an attachment, for display only.
+	Name string `json:"name,omitempty"`
+}
+
+// TextPart creates a text part.
+func TextPart(text string) Part {
+	return Part{Type: PartText, Text: text}
+}
+
+// InlinePart creates a part holding binary content.
+func InlinePart(mimeType string, data []byte, name string) Part {
+	return Part{Type: PartInline, MIMEType: mimeType, Data: data, Name: name}
+}
+
+// FilePart creates a part referencing content by URI.
+func FilePart(mimeType string, uri string) Part {
+	return Part{Type: PartFile, MIMEType: mimeType, URI: uri}
+}
+
+// ImageURLPart creates a file part for an image at a URL. Its MIME type is that of the extension of the URL, or
+// MIMETypeImage, so that the part is known to be an image either way.
+func ImageURLPart(uri string) Part {
+	mimeType := MIMETypeImage
+	if parsed, err := url.Parse(uri); err == nil {
+		if extensionType, _, _ := strings.Cut(mime.TypeByExtension(path.Ext(parsed.Path)), ";"); strings.HasPrefix(extensionType, "image/") {
+			mimeType = extensionType
+		}
+	}
+	return FilePart(mimeType, uri)
+}
+
+// NewTextEntry creates a chat entry holding a single text part.
+func NewTextEntry(role string, text string) ChatEntry {
+	return ChatEntry{Role: role, Parts: []Part{TextPart(text)}}
+}
+
+// Text returns the concatenation of the text parts of the entry.
+func (entry ChatEntry) Text() string {
+	var text strings.Builder
+	for _, part := range entry.Parts {
+		if part.Type == PartText {
+			text.WriteString(part.Text)
+		}
+	}
+	return text.String()
+}
+
+// SetText replaces the text parts of the entry with a single text part, keeping the other parts after it.
+func (entry *ChatEntry) SetText(text string) {
+	parts := []Part{TextPart(text)}
+	for _, part := range entry.Parts {
+		if part.Type != PartText {
+			parts = append(parts, part)
+		}
+	}
+	entry.Parts = parts
+}
+
+// Attachments returns the parts of the entry which are not text.
+func (entry ChatEntry) Attachments() []Part {
+	var attachments []Part
+	for _, part := range entry.Parts {
+		if part.Type != PartText {
+			attachments = append(attachments, part)
+		}
+	}
+	return attachments
+}
+
+// UnmarshalJSON reads an entry, including entries saved before parts existed, which hold their content in "text".
+func (entry *ChatEntry) UnmarshalJSON(data []byte) error {
+	type plainEntry ChatEntry
+	var legacy struct {
+		plainEntry
+		Text *string `json:"text"`
+	}
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return err
+	}
+	*entry = ChatEntry(legacy.plainEntry)
+	if legacy.Text != nil && len(entry.Parts) == 0 {
+		entry.Parts = []Part{TextPart(*legacy.Text)}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package llm_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/jlcheng/jcllm/llm"
+)
+
+func TestChatEntry_JSON(t *testing.T) {
+	entry := llm.NewTextEntry(llm.RoleUser, "Describe")
+	entry.Parts = append(entry.Parts, llm.InlinePart("image/png", []byte{0x89, 'P', 'N', 'G'}, "cat.png"))
+	data, err := json.Marshal(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded llm.ChatEntry
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, entry) {
+		t.Errorf("decoded = %+v; want %+v", decoded, entry)
+	}
+	if got := decoded.Text(); got != "Describe" {
+		t.Errorf("Text() = %q; want Describe", got)
+	}
+	if got := decoded.Attachments(); len(got) != 1 || got[0].Name != "cat.png" {
+		t.Errorf("Attachments() = %+v; want cat.png", got)
+	}
+
+	// Sessions saved before parts existed hold the content in "text"
+	var legacy llm.ChatEntry
+	if err := json.Unmarshal([]byte(`{"role": "RoleAssistant", "text": "Hi!", "truncated": true}`), &legacy); err != nil {
+		t.Fatal(err)
+	}
+	if legacy.Text() != "Hi!" || legacy.Role != llm.RoleAssistant || !legacy.Truncated {
+		t.Errorf("legacy entry = %+v; want the text Hi!", legacy)
+	}
+}
+
+func TestImageURLPart(t *testing.T) {
+	tests := []struct {
+		uri  string
+		want string
+	}{
+		{"https://example.com/cat.png", "image/png"},
+		{"https://example.com/cat.jpg?size=large", "image/jpeg"},
+		{"https://example.com/render?id=cat", llm.MIMETypeImage},
+		{"https://example.com/cat.pdf", llm.MIMETypeImage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.uri, func(t *testing.T) {
+			if got := llm.ImageURLPart(tt.uri); !reflect.DeepEqual(got, llm.FilePart(tt.want, tt.uri)) {
+				t.Errorf("ImageURLPart() = %+v; want the MIME type %s", got, tt.want)
+			}
+		})
+	}
+}
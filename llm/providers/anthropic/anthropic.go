@@ -0,0 +1,274 @@
+package anthropic
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/BooleanCat/go-functional/v2/it"
+	"github.com/go-errors/errors"
+	"github.com/jlcheng/jcllm/configuration"
+	"github.com/jlcheng/jcllm/configuration/keys"
+	"github.com/jlcheng/jcllm/configuration/secrets"
+	"github.com/jlcheng/jcllm/llm"
+	"github.com/jlcheng/jcllm/llm/anthropicmodels"
+)
+
+const (
+	// RoleUser is 'user'
+	RoleUser = "user"
+	// RoleAssistant is 'assistant'
+	RoleAssistant = "assistant"
+
+	// HeaderAPIKey is where Anthropic looks for the Anthropic API Key
+	HeaderAPIKey = "x-api-key"
+	// HeaderVersion selects the version of the Messages API
+	HeaderVersion = "anthropic-version"
+	// APIVersion is the Messages API version this provider is written against
+	APIVersion = "2023-06-01"
+)
+
+type Provider struct {
+	config     configuration.Configuration
+	httpClient *http.Client
+}
+
+// NewProvider creates a provider to models served by the Anthropic Messages API.
+func NewProvider(config configuration.Configuration) *Provider {
+	timeout := time.Duration(config.MustInt(keys.OptionHttpTimeout)) * time.Second
+	return &Provider{
+		config: config,
+		httpClient: &http.Client{
+			Timeout: timeout,
+		},
+	}
+}
+
+func (p *Provider) ToProviderRole(genericRole string) (providerRole string) {
+	switch genericRole {
+	case llm.RoleAssistant:
+		return RoleAssistant
+	case llm.RoleUser:
+		return RoleUser
+	}
+	return RoleUser
+}
+
+func (p *Provider) ToGenericRole(providerRole string) (genericRole string) {
+	switch providerRole {
+	case RoleAssistant:
+		return llm.RoleAssistant
+	case RoleUser:
+		return llm.RoleUser
+	}
+	return llm.RoleUser
+}
+
+func (p *Provider) ListModels(ctx context.Context) ([]llm.ModelInfo, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, p.endpointURL("/models"), nil)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "list model request creation failed", 0)
+	}
+	body, err := p.submitRequest(request)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "list models request submission failed", 0)
+	}
+	defer body.Close()
+	var models anthropicmodels.ListModelsResponse
+	if err := json.NewDecoder(body).Decode(&models); err != nil {
+		return nil, errors.WrapPrefix(err, "list model response read failed", 0)
+	}
+	return slices.SortedFunc(
+		it.Map(slices.Values(models.Data), func(model anthropicmodels.Model) llm.ModelInfo {
+			return llm.ModelInfo{
+				DisplayName: model.DisplayName,
+				Name:        model.ID,
+				Description: model.DisplayName,
+				Version:     model.CreatedAt,
+			}
+		}),
+		func(a llm.ModelInfo, b llm.ModelInfo) int {
+			return strings.Compare(a.Name, b.Name)
+		},
+	), nil
+}
+
+func (p *Provider) SolicitResponse(ctx context.Context, input llm.SolicitResponseInput) (llm.ResponseStream, error) {
+	response := llm.ResponseStream{
+		Role: p.ToGenericRole(RoleAssistant),
+	}
+	if input.ResponseSchema != nil {
+		return response, errors.WrapPrefix(llm.ErrUnsupportedResponseSchema, "anthropic cannot constrain responses to a schema", 0)
+	}
+	if input.UsesTools() {
+		return response, errors.WrapPrefix(llm.ErrUnsupportedTools, "anthropic does not support tools yet", 0)
+	}
+	// The Messages API has no system role. System instructions go into the top-level system field instead.
+	systemPrompt, entries := llm.SystemPrompt(p.config, input.Conversation)
+	messages := make([]anthropicmodels.Message, 0, len(entries))
+	for _, entry := range entries {
+		if len(entry.Attachments()) > 0 {
+			return response, errors.WrapPrefix(llm.ErrUnsupportedPart, "anthropic does not support attachments yet", 0)
+		}
+		messages = append(messages, anthropicmodels.Message{
+			Content: entry.Text(),
+			Role:    p.ToProviderRole(entry.Role),
+		})
+	}
+	// The Messages API requires max_tokens, so the provider-specific default applies unless it is overridden.
+	// Anthropic has no equivalent of the seed and the reasoning effort.
+	maxTokens := p.config.Int(keys.OptionAnthropicMaxTokens)
+	if input.Settings.MaxOutputTokens != nil {
+		maxTokens = *input.Settings.MaxOutputTokens
+	}
+	messageRequest := anthropicmodels.CreateMessageRequest{
+		Model:         input.ModelName,
+		Messages:      messages,
+		MaxTokens:     maxTokens,
+		System:        systemPrompt,
+		Stream:        ptr(true),
+		StopSequences: input.Settings.StopSequences,
+		Temperature:   input.Settings.Temperature,
+		TopP:          input.Settings.TopP,
+	}
+	requestBytes, err := json.Marshal(messageRequest)
+	if err != nil {
+		return response, errors.WrapPrefix(err, "message request stringify failed", 0)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpointURL("/messages"), bytes.NewReader(requestBytes))
+	if err != nil {
+		return response, errors.WrapPrefix(err, "messages request creation failed", 0)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	body, err := p.submitRequest(request)
+	if err != nil {
+		return response, errors.WrapPrefix(err, "messages request submission failed", 0)
+	}
+
+	response.Messages = func(yield func(llm.Message, error) bool) {
+		defer body.Close()
+		scanner := bufio.NewScanner(body)
+		for scanner.Scan() {
+			if err := ctx.Err(); err != nil {
+				yield(llm.Message{}, errors.WrapPrefix(err, "response stream cancelled", 0))
+				return
+			}
+			// Each event is an "event: <type>" line followed by a "data: <json>" line. The json payload repeats the event
+			// type, so only the data lines are of interest.
+			line := scanner.Text()
+			if !strings.HasPrefix(line, "data:") {
+				continue
+			}
+			var event anthropicmodels.StreamEvent
+			if err := json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(line, "data:"))), &event); err != nil {
+				yield(llm.Message{}, errors.WrapPrefix(err, "unmarshal response failed", 0))
+				return
+			}
+			switch event.Type {
+			case "message_start":
+				if event.Message != nil {
+					usage := event.Message.Usage
+					message := llm.Message{
+						InputTokenCount:  usage.InputTokens + usage.CacheCreationInputTokens + usage.CacheReadInputTokens,
+						CachedTokenCount: usage.CacheReadInputTokens,
+					}
+					if !yield(message, nil) {
+						return
+					}
+				}
+			case "content_block_delta":
+				if event.Delta != nil && event.Delta.Text != "" {
+					if !yield(llm.Message{Text: event.Delta.Text}, nil) {
+						return
+					}
+				}
+			case "message_delta":
+				if event.Usage != nil {
+					if !yield(llm.Message{TokenCount: event.Usage.OutputTokens}, nil) {
+						return
+					}
+				}
+			case "message_stop":
+				return
+			case "error":
+				message := "unknown error"
+				if event.Error != nil {
+					message = fmt.Sprintf("%s: %s", event.Error.Type, event.Error.Message)
+				}
+				yield(llm.Message{}, errors.Errorf("stream error: %s", message))
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			yield(llm.Message{}, errors.WrapPrefix(err, "read response stream failed", 0))
+		}
+	}
+	return response, nil
+}
+
+func (p *Provider) baseURL() string {
+	return p.config.String(keys.OptionAnthropicBaseURL)
+}
+
+func (p *Provider) endpointURL(suffix string) string {
+	base, err := url.Parse(p.baseURL())
+	if err != nil {
+		return ""
+	}
+	return base.JoinPath(suffix).String()
+}
+
+func (p *Provider) submitRequest(request *http.Request) (io.ReadCloser, error) {
+	var (
+		response *http.Response
+		body     []byte
+		err      error
+	)
+	if request.Header.Get(HeaderAPIKey) == "" {
+		apiKey, err := secrets.APIKey(p.config, keys.OptionAnthropicApiKey)
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Set(HeaderAPIKey, apiKey)
+	}
+	request.Header.Set(HeaderVersion, APIVersion)
+	response, err = p.httpClient.Do(request)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "submit request failed", 0)
+	}
+	if response.StatusCode != http.StatusOK {
+		defer response.Body.Close()
+		body, err = io.ReadAll(response.Body)
+		if err != nil {
+			body = []byte("cannot read response body")
+		}
+		var errResponse anthropicmodels.APIErrorResponse
+		_ = json.Unmarshal(body, &errResponse)
+		errorMessage := errResponse.Error.Message
+		if errorMessage == "" {
+			errorMessage = fmt.Sprintf("%q", body)
+		}
+		apiErr := &llm.APIError{
+			StatusCode: response.StatusCode,
+			Message:    errorMessage,
+			RetryAfter: llm.RetryAfter(response.Header, time.Now()),
+		}
+		return nil, errors.WrapPrefix(apiErr, "submit request failed", 0)
+	}
+	return response.Body, nil
+}
+
+func ptr[T any](obj T) *T {
+	return &obj
+}
+
+var _ llm.ProviderIfc = (*Provider)(nil)
@@ -0,0 +1,184 @@
+package anthropic_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jlcheng/jcllm/configuration/keys"
+	"github.com/jlcheng/jcllm/llm"
+	"github.com/jlcheng/jcllm/llm/anthropicmodels"
+	"github.com/jlcheng/jcllm/llm/providers/anthropic"
+	"github.com/knadh/koanf/v2"
+)
+
+func newProvider(t *testing.T, handler http.HandlerFunc) *anthropic.Provider {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	config := koanf.New(".")
+	_ = config.Set(keys.OptionHttpTimeout, 5)
+	_ = config.Set(keys.OptionAnthropicApiKey, "test-key")
+	_ = config.Set(keys.OptionAnthropicBaseURL, server.URL+"/v1")
+	_ = config.Set(keys.OptionAnthropicMaxTokens, 1024)
+	_ = config.Set(keys.OptionSystemPrompt, "Be concise.")
+	return anthropic.NewProvider(config)
+}
+
+func TestProvider_SolicitResponse(t *testing.T) {
+	var captured anthropicmodels.CreateMessageRequest
+	provider := newProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		if got := r.Header.Get(anthropic.HeaderAPIKey); got != "test-key" {
+			t.Errorf("api key header = %q; want %q", got, "test-key")
+		}
+		if got := r.Header.Get(anthropic.HeaderVersion); got != anthropic.APIVersion {
+			t.Errorf("version header = %q; want %q", got, anthropic.APIVersion)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&captured); err != nil {
+			t.Errorf("cannot decode request: %v", err)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		events := []string{
+			`{"type":"message_start","message":{"id":"msg_1","role":"assistant","usage":{"input_tokens":25,"output_tokens":1}}}`,
+			`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+			`{"type":"ping"}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello"}}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":", world"}}`,
+			`{"type":"content_block_stop","index":0}`,
+			`{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":7}}`,
+			`{"type":"message_stop"}`,
+		}
+		for _, event := range events {
+			var typed struct{ Type string }
+			_ = json.Unmarshal([]byte(event), &typed)
+			_, _ = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", typed.Type, event)
+		}
+	})
+
+	stream, err := provider.SolicitResponse(context.Background(), llm.SolicitResponseInput{
+		ModelName: "claude-test",
+		Conversation: llm.Conversation{Entries: []llm.ChatEntry{
+			llm.NewTextEntry(llm.RoleSystem, "Answer in English."),
+			llm.NewTextEntry(llm.RoleUser, "Say hello"),
+		}},
+	})
+	if err != nil {
+		t.Fatalf("SolicitResponse() error = %v", err)
+	}
+	var text strings.Builder
+	inputTokens, outputTokens := 0, 0
+	for message, err := range stream.Messages {
+		if err != nil {
+			t.Fatalf("stream error = %v", err)
+		}
+		text.WriteString(message.Text)
+		inputTokens += message.InputTokenCount
+		outputTokens += message.TokenCount
+	}
+
+	if got := text.String(); got != "Hello, world" {
+		t.Errorf("text = %q; want %q", got, "Hello, world")
+	}
+	if inputTokens != 25 || outputTokens != 7 {
+		t.Errorf("usage = (%d, %d); want (25, 7)", inputTokens, outputTokens)
+	}
+	// The system entries replace the configured system prompt
+	if captured.System != "Answer in English." {
+		t.Errorf("system = %q; want the system entry", captured.System)
+	}
+	wantMessages := []anthropicmodels.Message{{Role: anthropic.RoleUser, Content: "Say hello"}}
+	if !reflect.DeepEqual(captured.Messages, wantMessages) {
+		t.Errorf("messages = %v; want %v", captured.Messages, wantMessages)
+	}
+	if captured.MaxTokens != 1024 || captured.Model != "claude-test" {
+		t.Errorf("request = %+v; want model claude-test with 1024 max tokens", captured)
+	}
+}
+
+func TestProvider_SolicitResponse_Errors(t *testing.T) {
+	t.Run("error status", func(t *testing.T) {
+		provider := newProvider(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = fmt.Fprint(w, `{"type":"error","error":{"type":"authentication_error","message":"invalid x-api-key"}}`)
+		})
+		_, err := provider.SolicitResponse(context.Background(), llm.SolicitResponseInput{ModelName: "claude-test"})
+		if err == nil || !strings.Contains(err.Error(), "invalid x-api-key") {
+			t.Errorf("SolicitResponse() error = %v; want the API error message", err)
+		}
+	})
+
+	t.Run("error event", func(t *testing.T) {
+		provider := newProvider(t, func(w http.ResponseWriter, r *http.Request) {
+			_, _ = fmt.Fprint(w, "event: error\ndata: {\"type\":\"error\",\"error\":{\"type\":\"overloaded_error\",\"message\":\"Overloaded\"}}\n\n")
+		})
+		stream, err := provider.SolicitResponse(context.Background(), llm.SolicitResponseInput{ModelName: "claude-test"})
+		if err != nil {
+			t.Fatalf("SolicitResponse() error = %v", err)
+		}
+		var streamErr error
+		for _, err := range stream.Messages {
+			streamErr = err
+		}
+		if streamErr == nil || !strings.Contains(streamErr.Error(), "overloaded_error") {
+			t.Errorf("stream error = %v; want overloaded_error", streamErr)
+		}
+	})
+}
+
+func TestProvider_ListModels(t *testing.T) {
+	provider := newProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/models" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		_, _ = fmt.Fprint(w, `{"data":[
+			{"type":"model","id":"claude-b","display_name":"Claude B","created_at":"2024-10-22T00:00:00Z"},
+			{"type":"model","id":"claude-a","display_name":"Claude A","created_at":"2024-06-20T00:00:00Z"}
+		],"has_more":false}`)
+	})
+	models, err := provider.ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("ListModels() error = %v", err)
+	}
+	if len(models) != 2 || models[0].Name != "claude-a" || models[1].DisplayName != "Claude B" {
+		t.Errorf("ListModels() = %+v; want claude-a, claude-b in order", models)
+	}
+}
+
+func TestProvider_SolicitResponse_Tools(t *testing.T) {
+	tests := []struct {
+		name  string
+		input llm.SolicitResponseInput
+	}{
+		{"offered tools", llm.SolicitResponseInput{
+			Conversation: llm.Conversation{Entries: []llm.ChatEntry{llm.NewTextEntry(llm.RoleUser, "What time is it?")}},
+			Tools:        []llm.Tool{{Name: "get_time", Parameters: map[string]any{"type": "object"}}},
+		}},
+		{"tool calls in the history", llm.SolicitResponseInput{
+			Conversation: llm.Conversation{Entries: []llm.ChatEntry{
+				llm.NewTextEntry(llm.RoleUser, "What time is it?"),
+				{Role: llm.RoleAssistant, ToolCalls: []llm.ToolCall{{ID: "c1", Name: "get_time", Arguments: "{}"}}},
+				{Role: llm.RoleTool, ToolCallID: "c1", ToolName: "get_time", Parts: []llm.Part{llm.TextPart("noon")}},
+			}},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newProvider(t, func(w http.ResponseWriter, r *http.Request) {
+				t.Error("the request was sent without its tools")
+			})
+			tt.input.ModelName = "claude-test"
+			if _, err := provider.SolicitResponse(context.Background(), tt.input); !errors.Is(err, llm.ErrUnsupportedTools) {
+				t.Errorf("SolicitResponse() error = %v; want ErrUnsupportedTools", err)
+			}
+		})
+	}
+}
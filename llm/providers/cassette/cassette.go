@@ -0,0 +1,260 @@
+// Package cassette records the responses of a provider to a cassette file, and replays them without the provider, for
+// reproducible demos and tests without API keys.
+package cassette
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/jlcheng/jcllm/configuration"
+	"github.com/jlcheng/jcllm/configuration/keys"
+	"github.com/jlcheng/jcllm/llm"
+	"github.com/jlcheng/jcllm/log"
+)
+
+// Interaction is a recorded exchange with a provider, which is a line of the cassette.
+type Interaction struct {
+	Time time.Time `json:"time"`
+	// Provider and Model name the model which answered.
+	Provider string  `json:"provider"`
+	Model    string  `json:"model"`
+	Request  Request `json:"request"`
+	Role     string  `json:"role,omitempty"`
+	Chunks   []Chunk `json:"chunks,omitempty"`
+	// Usage is the sum of the usage of the chunks.
+	Usage llm.Usage `json:"usage"`
+	// Error is the error of the request, if it failed before its response was streamed.
+	Error string `json:"error,omitempty"`
+}
+
+// Request is what was sent to the provider.
+type Request struct {
+	Model          string                 `json:"model"`
+	Conversation   llm.Conversation       `json:"conversation"`
+	Settings       llm.GenerationSettings `json:"settings"`
+	Tools          []llm.Tool             `json:"tools,omitempty"`
+	ResponseSchema map[string]any         `json:"response_schema,omitempty"`
+}
+
+// Chunk is a message, or an error, of a response stream.
+type Chunk struct {
+	// DelayMs is the time since the previous chunk, or since the request for the first chunk, in milliseconds.
+	DelayMs   int64          `json:"delay_ms"`
+	Text      string         `json:"text,omitempty"`
+	ToolCalls []llm.ToolCall `json:"tool_calls,omitempty"`
+	Usage     *llm.Usage     `json:"usage,omitempty"`
+	Error     string         `json:"error,omitempty"`
+}
+
+func newChunk(delay time.Duration, message llm.Message, err error) Chunk {
+	chunk := Chunk{
+		DelayMs:   delay.Milliseconds(),
+		Text:      message.Text,
+		ToolCalls: message.ToolCalls,
+	}
+	if usage := message.Usage(); usage != (llm.Usage{}) {
+		chunk.Usage = &usage
+	}
+	if err != nil {
+		chunk.Error = err.Error()
+	}
+	return chunk
+}
+
+// Message returns the message of the chunk, or its error.
+func (c Chunk) Message() (llm.Message, error) {
+	if c.Error != "" {
+		return llm.Message{}, errors.New(c.Error)
+	}
+	message := llm.Message{Text: c.Text, ToolCalls: c.ToolCalls}
+	if c.Usage != nil {
+		message.InputTokenCount = c.Usage.InputTokens
+		message.TokenCount = c.Usage.OutputTokens
+		message.CachedTokenCount = c.Usage.CachedTokens
+		message.ReasoningTokenCount = c.Usage.ReasoningTokens
+	}
+	return message, nil
+}
+
+// Cassette is a JSONL file of interactions. It is safe for concurrent use.
+type Cassette struct {
+	path string
+	mu   sync.Mutex
+}
+
+func New(path string) *Cassette {
+	return &Cassette{path: os.ExpandEnv(path)}
+}
+
+func (c *Cassette) Path() string {
+	return c.path
+}
+
+// Append adds an interaction at the end of the cassette.
+func (c *Cassette) Append(interaction Interaction) error {
+	line, err := json.Marshal(interaction)
+	if err != nil {
+		return errors.WrapPrefix(err, "cannot encode interaction", 0)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o700); err != nil {
+		return errors.WrapPrefix(err, "cannot create cassette directory", 0)
+	}
+	// Recordings contain the conversations, so they are only readable by the user
+	file, err := os.OpenFile(c.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return errors.WrapPrefix(err, "cannot open cassette", 0)
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		_ = file.Close()
+		return errors.WrapPrefix(err, "cannot write cassette", 0)
+	}
+	if err := file.Close(); err != nil {
+		return errors.WrapPrefix(err, "cannot write cassette", 0)
+	}
+	return nil
+}
+
+// Read returns the interactions of the cassette, in the order they were recorded.
+func (c *Cassette) Read() ([]Interaction, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	file, err := os.Open(c.path)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "cannot open cassette", 0)
+	}
+	defer file.Close()
+	var interactions []Interaction
+	scanner := bufio.NewScanner(file)
+	// A chunk of an interaction may be as long as the response, which exceeds the default buffer
+	scanner.Buffer(nil, 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var interaction Interaction
+		if err := json.Unmarshal(scanner.Bytes(), &interaction); err != nil {
+			return nil, errors.WrapPrefix(err, fmt.Sprintf("invalid interaction on line %d of %s", line, c.path), 0)
+		}
+		interactions = append(interactions, interaction)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.WrapPrefix(err, "cannot read cassette", 0)
+	}
+	return interactions, nil
+}
+
+// Recorder appends every exchange of another provider to a cassette. A response is recorded once it ends, or once the
+// caller stops reading it, so that it can be replayed up to where it stopped.
+type Recorder struct {
+	llm.ProviderIfc
+	// name is the name of the provider, which is recorded unless the response names the provider which answered.
+	name     string
+	cassette *Cassette
+	logger   *log.Logger
+}
+
+// pullingRecorder keeps the llm.ModelPuller of the wrapped provider visible to type assertions.
+type pullingRecorder struct {
+	*Recorder
+	llm.ModelPuller
+}
+
+// embeddingRecorder keeps the llm.Embedder of the wrapped provider visible to type assertions. Embeddings are not
+// recorded.
+type embeddingRecorder struct {
+	*Recorder
+	llm.Embedder
+}
+
+// pullingEmbeddingRecorder keeps both the llm.ModelPuller and the llm.Embedder of the wrapped provider visible, for
+// providers such as ollama which implement both.
+type pullingEmbeddingRecorder struct {
+	*Recorder
+	llm.ModelPuller
+	llm.Embedder
+}
+
+// Record returns the provider of the given name, whose exchanges are appended to the cassette of the configuration.
+func Record(config configuration.Configuration, provider llm.ProviderIfc, name string) llm.ProviderIfc {
+	recorder := &Recorder{
+		ProviderIfc: provider,
+		name:        name,
+		cassette:    New(config.String(keys.OptionCassette)),
+		logger:      log.New(config.String(keys.OptionLogFile)),
+	}
+	puller, pulls := provider.(llm.ModelPuller)
+	embedder, embeds := provider.(llm.Embedder)
+	switch {
+	case pulls && embeds:
+		return &pullingEmbeddingRecorder{Recorder: recorder, ModelPuller: puller, Embedder: embedder}
+	case pulls:
+		return &pullingRecorder{Recorder: recorder, ModelPuller: puller}
+	case embeds:
+		return &embeddingRecorder{Recorder: recorder, Embedder: embedder}
+	}
+	return recorder
+}
+
+func (r *Recorder) SolicitResponse(ctx context.Context, input llm.SolicitResponseInput) (llm.ResponseStream, error) {
+	start := time.Now()
+	interaction := Interaction{
+		Time:     start,
+		Provider: r.name,
+		Model:    input.ModelName,
+		Request: Request{
+			Model:          input.ModelName,
+			Conversation:   input.Conversation,
+			Settings:       input.Settings,
+			Tools:          input.Tools,
+			ResponseSchema: input.ResponseSchema,
+		},
+	}
+	response, err := r.ProviderIfc.SolicitResponse(ctx, input)
+	if err != nil {
+		interaction.Error = err.Error()
+		if appendErr := r.cassette.Append(interaction); appendErr != nil {
+			r.logger.Errorf("%v\n", appendErr)
+		}
+		return response, err
+	}
+	if response.Model != "" {
+		interaction.Provider, interaction.Model = response.Provider, response.Model
+	}
+	interaction.Role = response.Role
+	messages := response.Messages
+	response.Messages = func(yield func(llm.Message, error) bool) {
+		last := start
+		stopped := false
+		for message, err := range messages {
+			now := time.Now()
+			// The error of a cancelled response is not recorded, since the replay is cancelled on its own
+			if err == nil || ctx.Err() == nil {
+				interaction.Chunks = append(interaction.Chunks, newChunk(now.Sub(last), message, err))
+				interaction.Usage.Add(message.Usage())
+			}
+			last = now
+			if !yield(message, err) {
+				stopped = true
+				break
+			}
+		}
+		if err := r.cassette.Append(interaction); err != nil {
+			// A caller which stopped reading the response cannot be told
+			if stopped {
+				r.logger.Errorf("%v\n", err)
+				return
+			}
+			yield(llm.Message{}, err)
+		}
+	}
+	return response, nil
+}
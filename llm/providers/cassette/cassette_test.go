@@ -0,0 +1,193 @@
+package cassette_test
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jlcheng/jcllm/configuration/keys"
+	"github.com/jlcheng/jcllm/llm"
+	"github.com/jlcheng/jcllm/llm/providers/cassette"
+	"github.com/knadh/koanf/v2"
+)
+
+// stubProvider streams the words of the prompt in upper case, followed by their usage, or fails with err.
+type stubProvider struct {
+	llm.ProviderIfc
+	err error
+}
+
+func (p *stubProvider) SolicitResponse(_ context.Context, input llm.SolicitResponseInput) (llm.ResponseStream, error) {
+	if p.err != nil {
+		return llm.ResponseStream{}, p.err
+	}
+	entries := input.Conversation.Entries
+	words := strings.Fields(strings.ToUpper(entries[len(entries)-1].Text()))
+	return llm.ResponseStream{Role: llm.RoleAssistant, Messages: func(yield func(llm.Message, error) bool) {
+		for _, word := range words {
+			time.Sleep(10 * time.Millisecond)
+			if !yield(llm.Message{Text: word + " "}, nil) {
+				return
+			}
+		}
+		yield(llm.Message{InputTokenCount: 3, TokenCount: len(words)}, nil)
+	}}, nil
+}
+
+func newConfig(t *testing.T) *koanf.Koanf {
+	t.Helper()
+	config := koanf.New(".")
+	_ = config.Set(keys.OptionCassette, filepath.Join(t.TempDir(), "cassette.jsonl"))
+	return config
+}
+
+func solicit(t *testing.T, ctx context.Context, provider llm.ProviderIfc, prompt string) (llm.ResponseStream, []string, llm.Usage, error) {
+	t.Helper()
+	input := llm.SolicitResponseInput{
+		ModelName:    "stub-model",
+		Conversation: llm.Conversation{Entries: []llm.ChatEntry{llm.NewTextEntry(llm.RoleUser, prompt)}},
+	}
+	response, err := provider.SolicitResponse(ctx, input)
+	if err != nil {
+		return response, nil, llm.Usage{}, err
+	}
+	var texts []string
+	var usage llm.Usage
+	for message, err := range response.Messages {
+		if err != nil {
+			return response, texts, usage, err
+		}
+		if message.Text != "" {
+			texts = append(texts, message.Text)
+		}
+		usage.Add(message.Usage())
+	}
+	return response, texts, usage, nil
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	config := newConfig(t)
+	recorder := cassette.Record(config, &stubProvider{}, "stub")
+	for _, prompt := range []string{"hello world", "the quick brown fox", "hello world"} {
+		if _, _, _, err := solicit(t, context.Background(), recorder, prompt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	failing := cassette.Record(config, &stubProvider{err: errors.New("quota exceeded")}, "stub")
+	if _, _, _, err := solicit(t, context.Background(), failing, "fail"); err == nil {
+		t.Fatal("SolicitResponse() = nil; want the error of the provider")
+	}
+
+	interactions, err := cassette.New(config.String(keys.OptionCassette)).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(interactions) != 4 {
+		t.Fatalf("recorded %d interactions; want 4", len(interactions))
+	}
+	if got := interactions[1]; got.Provider != "stub" || got.Model != "stub-model" || len(got.Chunks) != 5 ||
+		got.Usage != (llm.Usage{InputTokens: 3, OutputTokens: 4}) || got.Chunks[0].DelayMs < 10 {
+		t.Errorf("interaction = %+v; want the chunks, usage, and timing of the response", got)
+	}
+
+	player := mustPlayer(t, config)
+	response, texts, usage, err := solicit(t, context.Background(), player, "the quick brown fox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"THE ", "QUICK ", "BROWN ", "FOX "}; !slices.Equal(texts, want) {
+		t.Errorf("texts = %q; want %q", texts, want)
+	}
+	if usage != (llm.Usage{InputTokens: 3, OutputTokens: 4}) {
+		t.Errorf("usage = %+v; want the recorded usage", usage)
+	}
+	if response.Provider != "stub" || response.Model != "stub-model" || response.Role != llm.RoleAssistant {
+		t.Errorf("response = %+v; want the recorded provider, model, and role", response)
+	}
+	// A conversation recorded twice is answered with both recordings, and then with the last one again
+	for range 3 {
+		if _, texts, _, err := solicit(t, context.Background(), player, "hello world"); err != nil || len(texts) != 2 {
+			t.Errorf("texts = %q, error = %v; want the recorded response", texts, err)
+		}
+	}
+	if _, _, _, err := solicit(t, context.Background(), player, "fail"); err == nil || err.Error() != "quota exceeded" {
+		t.Errorf("error = %v; want the recorded error", err)
+	}
+	if _, _, _, err := solicit(t, context.Background(), player, "never recorded"); err == nil {
+		t.Error("error = nil; want an error for a conversation which was not recorded")
+	}
+	models, err := player.ListModels(context.Background())
+	if err != nil || len(models) != 1 || models[0].Name != "stub-model" {
+		t.Errorf("ListModels() = %+v, %v; want the recorded model", models, err)
+	}
+}
+
+func TestPlayer_Pace(t *testing.T) {
+	config := newConfig(t)
+	recorder := cassette.Record(config, &stubProvider{}, "stub")
+	if _, _, _, err := solicit(t, context.Background(), recorder, "one two three four five"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		speed   float64
+		minimum time.Duration
+		maximum time.Duration
+	}{
+		{speed: 0, maximum: 40 * time.Millisecond},
+		{speed: 1, minimum: 50 * time.Millisecond, maximum: time.Second},
+	}
+	for _, tt := range tests {
+		_ = config.Set(keys.OptionReplaySpeed, tt.speed)
+		start := time.Now()
+		if _, _, _, err := solicit(t, context.Background(), mustPlayer(t, config), "one two three four five"); err != nil {
+			t.Fatal(err)
+		}
+		if elapsed := time.Since(start); elapsed < tt.minimum || elapsed > tt.maximum {
+			t.Errorf("speed %v replayed in %v; want between %v and %v", tt.speed, elapsed, tt.minimum, tt.maximum)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, _, err := solicit(t, ctx, mustPlayer(t, config), "one two three four five"); !errors.Is(err, context.Canceled) {
+		t.Errorf("error = %v; want %v", err, context.Canceled)
+	}
+}
+
+func mustPlayer(t *testing.T, config *koanf.Koanf) *cassette.Player {
+	t.Helper()
+	player, err := cassette.NewPlayer(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return player
+}
+
+// pullingEmbedder implements both optional interfaces, as ollama does.
+type pullingEmbedder struct {
+	stubProvider
+}
+
+func (*pullingEmbedder) PullModel(context.Context, string) (iter.Seq2[llm.PullProgress, error], error) {
+	return nil, nil
+}
+
+func (*pullingEmbedder) Embed(context.Context, []string, string) ([][]float32, error) {
+	return nil, nil
+}
+
+func TestRecord_OptionalInterfaces(t *testing.T) {
+	recorder := cassette.Record(newConfig(t), &pullingEmbedder{}, "stub")
+	if _, ok := recorder.(llm.ModelPuller); !ok {
+		t.Error("Record() hides the ModelPuller of the provider")
+	}
+	if _, ok := recorder.(llm.Embedder); !ok {
+		t.Error("Record() hides the Embedder of the provider")
+	}
+}
@@ -0,0 +1,147 @@
+package cassette
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/jlcheng/jcllm/configuration"
+	"github.com/jlcheng/jcllm/configuration/keys"
+	"github.com/jlcheng/jcllm/llm"
+)
+
+// Player answers each request with the recorded response to the same conversation, so that a session can be replayed
+// by typing the same prompts. A conversation recorded several times is answered with its recordings in order, and then
+// with the last one again.
+type Player struct {
+	cassette     *Cassette
+	interactions []Interaction
+	// speed divides the recorded delays between chunks. 0 replays without delays.
+	speed float64
+	// played counts the replays of each interaction.
+	played []int
+	mutex  sync.Mutex
+}
+
+// NewPlayer loads the cassette of the configuration.
+func NewPlayer(config configuration.Configuration) (*Player, error) {
+	cassette := New(config.String(keys.OptionCassette))
+	if cassette.Path() == "" {
+		return nil, errors.Errorf("the %s provider needs --%s", keys.ProviderReplay, keys.OptionCassette)
+	}
+	interactions, err := cassette.Read()
+	if err != nil {
+		return nil, err
+	}
+	return &Player{
+		cassette:     cassette,
+		interactions: interactions,
+		speed:        config.Float64(keys.OptionReplaySpeed),
+		played:       make([]int, len(interactions)),
+	}, nil
+}
+
+func (p *Player) ToProviderRole(genericRole string) (providerRole string) {
+	return genericRole
+}
+
+func (p *Player) ToGenericRole(providerRole string) (genericRole string) {
+	return providerRole
+}
+
+// ListModels lists the recorded models.
+func (p *Player) ListModels(_ context.Context) ([]llm.ModelInfo, error) {
+	var models []llm.ModelInfo
+	for _, interaction := range p.interactions {
+		if slices.ContainsFunc(models, func(model llm.ModelInfo) bool { return model.Name == interaction.Model }) {
+			continue
+		}
+		models = append(models, llm.ModelInfo{
+			Name:        interaction.Model,
+			DisplayName: interaction.Provider + "/" + interaction.Model,
+			Description: "recorded from " + interaction.Provider,
+		})
+	}
+	slices.SortFunc(models, func(a, b llm.ModelInfo) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+	return models, nil
+}
+
+// SolicitResponse ignores the model name of the input. The provider and model which were recorded are set on the
+// response.
+func (p *Player) SolicitResponse(ctx context.Context, input llm.SolicitResponseInput) (llm.ResponseStream, error) {
+	interaction, err := p.find(input.Conversation)
+	if err != nil {
+		return llm.ResponseStream{}, err
+	}
+	if interaction.Error != "" {
+		return llm.ResponseStream{}, errors.New(interaction.Error)
+	}
+	response := llm.ResponseStream{
+		Role:     cmp.Or(interaction.Role, llm.RoleAssistant),
+		Provider: interaction.Provider,
+		Model:    interaction.Model,
+	}
+	response.Messages = func(yield func(llm.Message, error) bool) {
+		for _, chunk := range interaction.Chunks {
+			if err := p.wait(ctx, chunk); err != nil {
+				yield(llm.Message{}, errors.WrapPrefix(err, "response stream cancelled", 0))
+				return
+			}
+			if !yield(chunk.Message()) {
+				return
+			}
+		}
+	}
+	return response, nil
+}
+
+// find returns the next recording of the conversation.
+func (p *Player) find(conversation llm.Conversation) (Interaction, error) {
+	want, err := json.Marshal(conversation)
+	if err != nil {
+		return Interaction{}, errors.WrapPrefix(err, "cannot encode conversation", 0)
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	found := -1
+	for i, interaction := range p.interactions {
+		// The recorded conversation is compared as JSON, which is how it went through the cassette
+		got, err := json.Marshal(interaction.Request.Conversation)
+		if err != nil || !bytes.Equal(got, want) {
+			continue
+		}
+		found = i
+		if p.played[i] == 0 {
+			break
+		}
+	}
+	if found == -1 {
+		return Interaction{}, errors.Errorf("%s has no recording of this conversation", p.cassette.Path())
+	}
+	p.played[found]++
+	return p.interactions[found], nil
+}
+
+// wait waits for the recorded delay of the chunk, divided by the speed.
+func (p *Player) wait(ctx context.Context, chunk Chunk) error {
+	if p.speed <= 0 || chunk.DelayMs <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(time.Duration(float64(chunk.DelayMs) * float64(time.Millisecond) / p.speed))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+var _ llm.ProviderIfc = (*Player)(nil)
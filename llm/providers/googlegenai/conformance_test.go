@@ -0,0 +1,22 @@
+package googlegenai_test
+
+import (
+	"testing"
+
+	"github.com/jlcheng/jcllm/configuration/keys"
+	"github.com/jlcheng/jcllm/llm"
+	"github.com/jlcheng/jcllm/llm/providers/googlegenai"
+	"github.com/jlcheng/jcllm/llm/providers/providertest"
+	"github.com/knadh/koanf/v2"
+)
+
+// Gemini fails on SSE lines which carry no data, so there is no ignored-lines fixture.
+func TestProvider_Conformance(t *testing.T) {
+	providertest.Run(t, "testdata/conformance", func(t *testing.T, baseURL string) llm.ProviderIfc {
+		config := koanf.New(".")
+		_ = config.Set(keys.OptionGeminiApiKey, "test-key")
+		_ = config.Set(keys.OptionGeminiBaseURL, baseURL)
+		_ = config.Set(keys.OptionHttpTimeout, 5)
+		return googlegenai.NewProvider(config)
+	})
+}
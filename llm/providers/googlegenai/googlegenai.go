@@ -1,18 +1,22 @@
 package googlegenai
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/BooleanCat/go-functional/v2/it"
 	"github.com/go-errors/errors"
 	"github.com/jlcheng/jcllm/configuration"
 	"github.com/jlcheng/jcllm/configuration/keys"
+	"github.com/jlcheng/jcllm/configuration/secrets"
 	"github.com/jlcheng/jcllm/extract"
 	"github.com/jlcheng/jcllm/llm"
 	"github.com/jlcheng/jcllm/log"
@@ -24,36 +28,45 @@ const (
 	RoleUser = "user"
 	// RoleModel is  'model', as Gemini only recognize 'user' or 'model'.
 	RoleModel = "model"
+
+	// DefaultBaseURL is the base url of the Gemini API, unless gemini-base-url is set
+	DefaultBaseURL = "https://generativelanguage.googleapis.com"
+
+	// DefaultEmbeddingModel embeds texts when no embedding model is configured
+	DefaultEmbeddingModel = "text-embedding-004"
+
+	// maxEmbedBatch is the maximum number of texts of a batchEmbedContents request
+	maxEmbedBatch = 100
 )
 
 type Provider struct {
-	config configuration.Configuration
-	logger *log.Logger
+	config     configuration.Configuration
+	logger     *log.Logger
+	httpClient *http.Client
 }
 
 // NewProvider creates a provider to models powered by https://pkg.go.dev/google.golang.org/genai.
 func NewProvider(config configuration.Configuration) *Provider {
+	timeout := time.Duration(config.MustInt(keys.OptionHttpTimeout)) * time.Second
 	return &Provider{
 		config: config,
 		logger: log.New(config.String(keys.OptionLogFile)),
+		httpClient: &http.Client{
+			Timeout: timeout,
+		},
 	}
 }
 
-func (p *Provider) ListModels(_ context.Context) ([]llm.ModelInfo, error) {
-	listModelURL := "https://generativelanguage.googleapis.com/v1beta/models"
-	resp, err := http.Get(fmt.Sprintf("%s?key=%s", listModelURL, p.config.String(keys.OptionGeminiApiKey)))
+func (p *Provider) ListModels(ctx context.Context) ([]llm.ModelInfo, error) {
+	body, err := p.call(ctx, http.MethodGet, "v1beta/models", nil)
 	if err != nil {
 		return nil, errors.WrapPrefix(err, "error getting model list", 0)
 	}
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, errors.WrapPrefix(err, "error reading list-models response", 0)
-	}
 	var listModelsOutput ListModelsOutput
 	if err := json.Unmarshal(body, &listModelsOutput); err != nil {
 		return nil, errors.WrapPrefix(err, "json parse error", 0)
 	}
-	modelsList := slices.Collect(
+	return slices.SortedFunc(
 		it.Map(slices.Values(listModelsOutput.Models), func(model ModelInfo) llm.ModelInfo {
 			return llm.ModelInfo{
 				DisplayName: model.DisplayName,
@@ -63,8 +76,97 @@ func (p *Provider) ListModels(_ context.Context) ([]llm.ModelInfo, error) {
 				Version:     model.Version,
 			}
 		}),
-	)
-	return modelsList, nil
+		func(a llm.ModelInfo, b llm.ModelInfo) int {
+			return strings.Compare(a.Name, b.Name)
+		},
+	), nil
+}
+
+// Embed sends the texts in batches of at most maxEmbedBatch, the limit of the batchEmbedContents API, which the SDK does
+// not support yet.
+func (p *Provider) Embed(ctx context.Context, texts []string, modelName string) ([][]float32, error) {
+	if modelName == "" {
+		modelName = DefaultEmbeddingModel
+	}
+	modelName = "models/" + strings.TrimPrefix(modelName, "models/")
+	vectors := make([][]float32, 0, len(texts))
+	for batch := range slices.Chunk(texts, maxEmbedBatch) {
+		var request BatchEmbedContentsRequest
+		for _, text := range batch {
+			request.Requests = append(request.Requests, EmbedContentRequest{
+				Model:   modelName,
+				Content: genai.Text(text)[0],
+			})
+		}
+		body, err := p.call(ctx, http.MethodPost, "v1beta/"+modelName+":batchEmbedContents", request)
+		if err != nil {
+			return nil, errors.WrapPrefix(err, "embed content failed", 0)
+		}
+		var response BatchEmbedContentsResponse
+		if err := json.Unmarshal(body, &response); err != nil {
+			return nil, errors.WrapPrefix(err, "json parse error", 0)
+		}
+		if len(response.Embeddings) != len(batch) {
+			return nil, errors.Errorf("got %d embeddings for %d texts", len(response.Embeddings), len(batch))
+		}
+		for _, embedding := range response.Embeddings {
+			vectors = append(vectors, embedding.Values)
+		}
+	}
+	return vectors, nil
+}
+
+// call sends a request to the REST API, for the methods which the SDK lacks, and returns the body of its response. A
+// response which failed is returned as an llm.APIError.
+func (p *Provider) call(ctx context.Context, method string, path string, payload any) ([]byte, error) {
+	endpoint, err := url.JoinPath(p.baseURL(), path)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "invalid gemini base url", 0)
+	}
+	apiKey, err := secrets.APIKey(p.config, keys.OptionGeminiApiKey)
+	if err != nil {
+		return nil, err
+	}
+	var requestBody io.Reader
+	if payload != nil {
+		payloadBytes, err := json.Marshal(payload)
+		if err != nil {
+			return nil, errors.WrapPrefix(err, "request stringify failed", 0)
+		}
+		requestBody = bytes.NewReader(payloadBytes)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, endpoint, requestBody)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "request creation failed", 0)
+	}
+	// The key is sent as a header rather than a query parameter, which errors would print as part of the URL
+	request.Header.Set("x-goog-api-key", apiKey)
+	if payload != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := p.httpClient.Do(request)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "submit request failed", 0)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "read response failed", 0)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var errResponse ErrorResponse
+		_ = json.Unmarshal(body, &errResponse)
+		apiErr := &llm.APIError{
+			StatusCode: resp.StatusCode,
+			Message:    errResponse.Error.Message,
+			RetryAfter: llm.RetryAfter(resp.Header, time.Now()),
+		}
+		if apiErr.Message == "" {
+			apiErr.Message = fmt.Sprintf("%q", body)
+		}
+		return nil, apiErr
+	}
+	return body, nil
 }
 
 func (p *Provider) ToProviderRole(genericRole string) (providerRole string) {
@@ -75,6 +177,8 @@ func (p *Provider) ToProviderRole(genericRole string) (providerRole string) {
 		return RoleUser
 	case llm.RoleSystem:
 		return RoleUser
+	case llm.RoleTool:
+		return RoleUser
 	}
 	return genericRole
 
@@ -92,9 +196,19 @@ func (p *Provider) ToGenericRole(providerRole string) (genericRole string) {
 
 func (p *Provider) SolicitResponse(ctx context.Context, input llm.SolicitResponseInput) (llm.ResponseStream, error) {
 	conversation := input.Conversation
+	apiKey, err := secrets.APIKey(p.config, keys.OptionGeminiApiKey)
+	if err != nil {
+		return llm.ResponseStream{}, err
+	}
+	// The SDK requires a key, which the keyless stand-ins of the API ignore
+	if apiKey == "" && p.baseURL() != DefaultBaseURL {
+		apiKey = "none"
+	}
 	sdkClient, err := genai.NewClient(ctx, &genai.ClientConfig{
-		APIKey:  p.config.String(keys.OptionGeminiApiKey),
-		Backend: genai.BackendGeminiAPI,
+		APIKey:      apiKey,
+		Backend:     genai.BackendGeminiAPI,
+		HTTPClient:  &http.Client{Timeout: p.httpClient.Timeout, Transport: contextTransport{ctx}},
+		HTTPOptions: genai.HTTPOptions{BaseURL: p.baseURL()},
 	})
 	if err != nil {
 		return llm.ResponseStream{}, errors.WrapPrefix(err, "gemini client creation failed", 0)
@@ -103,34 +217,53 @@ func (p *Provider) SolicitResponse(ctx context.Context, input llm.SolicitRespons
 		Role: p.ToGenericRole(RoleModel),
 	}
 	tools, conversationModified := p.handleGroundingSupport(input, make([]*genai.Tool, 0))
-	if conversationModified && input.Conversation.Entries[len(input.Conversation.Entries)-1].Text == "" {
+	if conversationModified && input.Conversation.Entries[len(input.Conversation.Entries)-1].Text() == "" {
 		return llm.ResponseStream{}, llm.ErrBlankInput
 	}
-	contents := slices.Collect(it.Map(slices.Values(conversation.Entries), func(v llm.ChatEntry) *genai.Content {
-		return &genai.Content{
-			Parts: []*genai.Part{{Text: v.Text}},
-			Role:  p.ToProviderRole(v.Role),
-		}
-	}))
-	sdkResponse := sdkClient.Models.GenerateContentStream(ctx, input.ModelName, contents, &genai.GenerateContentConfig{
-		SystemInstruction: genai.Text(p.config.String(keys.OptionSystemPrompt))[0],
+	if declarations := toFunctionDeclarations(input.Tools); len(declarations) != 0 {
+		tools = append(tools, &genai.Tool{FunctionDeclarations: declarations})
+	}
+	systemPrompt, entries := llm.SystemPrompt(p.config, conversation)
+	contents := p.toContents(entries)
+	generateConfig := &genai.GenerateContentConfig{
+		SystemInstruction: genai.Text(systemPrompt)[0],
 		Tools:             tools,
 		SafetySettings:    harmBlockNone(),
-	})
-	response.Messages = it.Map2(sdkResponse, func(chunk *genai.GenerateContentResponse, err error) (llm.Message, error) {
+	}
+	applySettings(generateConfig, input.Settings)
+	if input.ResponseSchema != nil {
+		generateConfig.ResponseMIMEType = "application/json"
+		generateConfig.ResponseSchema = toSchema(input.ResponseSchema)
+	}
+	sdkResponse := sdkClient.Models.GenerateContentStream(ctx, input.ModelName, contents, generateConfig)
+	// Gemini does not always assign ids to function calls, so ids are generated from a per-response counter instead.
+	toolCallCount := 0
+	messages := it.Map2(sdkResponse, func(chunk *genai.GenerateContentResponse, err error) (llm.Message, error) {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return llm.Message{}, errors.WrapPrefix(ctxErr, "response stream cancelled", 0)
+		}
 		if err != nil {
-			return llm.Message{}, errors.WrapPrefix(err, "generate content failed", 0)
+			return llm.Message{}, errors.WrapPrefix(toAPIError(err), "generate content failed", 0)
 		}
 		if chunk == nil || chunk.Candidates == nil || len(chunk.Candidates) == 0 {
-			return llm.Message{}, nil
+			return usageMessage(chunk), nil
 		}
 		resp := chunk.Candidates[0]
-		if resp.FinishReason != "" && resp.FinishReason != genai.FinishReasonStop {
+		// A response cut short by max-output-tokens is complete as far as the caller is concerned, as with OpenAI
+		switch resp.FinishReason {
+		case "", genai.FinishReasonStop, genai.FinishReasonMaxTokens:
+		default:
 			return llm.Message{}, errors.Errorf("model stopped: %s", resp.FinishReason)
 		}
 
 		buf := new(strings.Builder)
+		var toolCalls []llm.ToolCall
 		for _, part := range resp.Content.Parts {
+			if part.FunctionCall != nil {
+				toolCalls = append(toolCalls, toToolCall(part.FunctionCall, toolCallCount))
+				toolCallCount++
+				continue
+			}
 			buf.WriteString(mapToText(part))
 		}
 
@@ -143,23 +276,100 @@ func (p *Provider) SolicitResponse(ctx context.Context, input llm.SolicitRespons
 			}
 		}
 
-		return llm.Message{
-			TokenCount: getTokenCount(chunk),
-			Text:       buf.String(),
-		}, nil
+		message := llm.Message{
+			Text:      buf.String(),
+			ToolCalls: toolCalls,
+		}
+		// Each chunk reports the usage of the response so far, so only the last one, which has a finish reason, counts
+		if resp.FinishReason != "" {
+			usage := usageMessage(chunk)
+			message.TokenCount = usage.TokenCount
+			message.InputTokenCount = usage.InputTokenCount
+			message.CachedTokenCount = usage.CachedTokenCount
+			message.ReasoningTokenCount = usage.ReasoningTokenCount
+		}
+		return message, nil
 	})
+	response.Messages = func(yield func(llm.Message, error) bool) {
+		for message, err := range messages {
+			if !yield(message, err) {
+				return
+			}
+		}
+		// The SDK ends the stream without an error when the response can no longer be read, such as after a cancellation
+		if err := ctx.Err(); err != nil {
+			yield(llm.Message{}, errors.WrapPrefix(err, "response stream cancelled", 0))
+		}
+	}
 	return response, nil
 }
 
+func (p *Provider) baseURL() string {
+	if baseURL := p.config.String(keys.OptionGeminiBaseURL); baseURL != "" {
+		return baseURL
+	}
+	return DefaultBaseURL
+}
+
+// contextTransport binds the requests of the SDK to the context of the response, which the SDK does not do itself, so
+// that a cancelled response stops reading its stream. The request keeps its own context, which carries the timeout of
+// the client.
+type contextTransport struct {
+	ctx context.Context
+}
+
+func (t contextTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(request.Context())
+	stop := context.AfterFunc(t.ctx, cancel)
+	release := func() {
+		stop()
+		cancel()
+	}
+	response, err := http.DefaultTransport.RoundTrip(request.WithContext(ctx))
+	if err != nil {
+		release()
+		return nil, err
+	}
+	response.Body = releasingBody{ReadCloser: response.Body, release: release}
+	return response, nil
+}
+
+// releasingBody releases the context of its request once it is closed.
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b releasingBody) Close() error {
+	defer b.release()
+	return b.ReadCloser.Close()
+}
+
+// applySettings maps the generation settings onto the Gemini config. Gemini has no equivalent of the reasoning effort.
+func applySettings(generateConfig *genai.GenerateContentConfig, settings llm.GenerationSettings) {
+	generateConfig.Temperature = settings.Temperature
+	generateConfig.TopP = settings.TopP
+	generateConfig.StopSequences = settings.StopSequences
+	if settings.MaxOutputTokens != nil {
+		generateConfig.MaxOutputTokens = ptr(int64(*settings.MaxOutputTokens))
+	}
+	if settings.Seed != nil {
+		generateConfig.Seed = ptr(int64(*settings.Seed))
+	}
+}
+
 func (p *Provider) handleGroundingSupport(input llm.SolicitResponseInput, tools []*genai.Tool) ([]*genai.Tool, bool) {
 	conversation := input.Conversation
-	if len(conversation.Entries) == 0 || input.Args[keys.ArgNameSuppress] == keys.True {
+	if len(conversation.Entries) == 0 || input.SuppressMentions {
 		return tools, false
 	}
 	groundWithSearch := false
 	lastEntry := &conversation.Entries[len(conversation.Entries)-1]
-	newText, mentions := extract.MentionsFromEnd(lastEntry.Text)
-	if newText == lastEntry.Text {
+	if lastEntry.Role != llm.RoleUser {
+		return tools, false
+	}
+	newText, mentions := extract.MentionsFromEnd(lastEntry.Text())
+	if newText == lastEntry.Text() {
 		return tools, false
 	}
 	for _, mention := range mentions {
@@ -168,7 +378,7 @@ func (p *Provider) handleGroundingSupport(input llm.SolicitResponseInput, tools
 			break
 		}
 	}
-	lastEntry.Text = newText
+	lastEntry.SetText(newText)
 	if groundWithSearch {
 		if tools == nil {
 			tools = make([]*genai.Tool, 0)
@@ -184,11 +394,142 @@ func (p *Provider) handleGroundingSupport(input llm.SolicitResponseInput, tools
 	return tools, true
 }
 
-func getTokenCount(chunk *genai.GenerateContentResponse) int {
-	if chunk == nil || chunk.UsageMetadata == nil || chunk.UsageMetadata.CandidatesTokenCount == nil {
-		return 0
+// toContents maps the chat entries to Gemini contents. The results of parallel tool calls are merged into a single
+// content, with a function response part per call, as Gemini expects the responses of a turn together.
+func (p *Provider) toContents(entries []llm.ChatEntry) []*genai.Content {
+	contents := make([]*genai.Content, 0, len(entries))
+	for i, entry := range entries {
+		content := p.toContent(entry)
+		if entry.Role == llm.RoleTool && i > 0 && entries[i-1].Role == llm.RoleTool {
+			last := contents[len(contents)-1]
+			last.Parts = append(last.Parts, content.Parts...)
+			continue
+		}
+		contents = append(contents, content)
+	}
+	return contents
+}
+
+// toContent maps a chat entry to Gemini content. Attachments are sent as inline data or file data parts. Tool calls and
+// tool results are sent as function call and function response parts, respectively. Ids are omitted as they may have
+// been generated by toToolCall; Gemini matches function responses to calls by name and order.
+func (p *Provider) toContent(entry llm.ChatEntry) *genai.Content {
+	content := &genai.Content{
+		Role: p.ToProviderRole(entry.Role),
+	}
+	if entry.Role == llm.RoleTool {
+		content.Parts = append(content.Parts, &genai.Part{FunctionResponse: &genai.FunctionResponse{
+			Name:     entry.ToolName,
+			Response: map[string]any{"output": entry.Text()},
+		}})
+		return content
+	}
+	for _, part := range entry.Parts {
+		switch part.Type {
+		case llm.PartInline:
+			content.Parts = append(content.Parts, &genai.Part{InlineData: &genai.Blob{MIMEType: part.MIMEType, Data: part.Data}})
+		case llm.PartFile:
+			mimeType := part.MIMEType
+			// Gemini requires the format of the image, which is unknown for a URL without an extension
+			if mimeType == llm.MIMETypeImage {
+				mimeType = "image/jpeg"
+			}
+			content.Parts = append(content.Parts, &genai.Part{FileData: &genai.FileData{FileURI: part.URI, MIMEType: mimeType}})
+		default:
+			if part.Text != "" {
+				content.Parts = append(content.Parts, &genai.Part{Text: part.Text})
+			}
+		}
+	}
+	if len(content.Parts) == 0 && len(entry.ToolCalls) == 0 {
+		content.Parts = append(content.Parts, &genai.Part{Text: ""})
+	}
+	for _, call := range entry.ToolCalls {
+		args := make(map[string]any)
+		if call.Arguments != "" {
+			_ = json.Unmarshal([]byte(call.Arguments), &args)
+		}
+		content.Parts = append(content.Parts, &genai.Part{FunctionCall: &genai.FunctionCall{
+			Name: call.Name,
+			Args: args,
+		}})
+	}
+	return content
+}
+
+func toFunctionDeclarations(tools []llm.Tool) []*genai.FunctionDeclaration {
+	return slices.Collect(it.Map(slices.Values(tools), func(tool llm.Tool) *genai.FunctionDeclaration {
+		return &genai.FunctionDeclaration{
+			Name:        tool.Name,
+			Description: tool.Description,
+			Parameters:  toSchema(tool.Parameters),
+		}
+	}))
+}
+
+func toToolCall(call *genai.FunctionCall, idx int) llm.ToolCall {
+	id := call.ID
+	if id == "" {
+		id = fmt.Sprintf("%s-%d", call.Name, idx)
+	}
+	args, err := json.Marshal(call.Args)
+	if err != nil || call.Args == nil {
+		args = []byte("{}")
+	}
+	return llm.ToolCall{
+		ID:        id,
+		Name:      call.Name,
+		Arguments: string(args),
+	}
+}
+
+// toAPIError converts the error responses of the SDK to llm.APIError, so that they can be retried like those of the
+// other providers. The delay of a rate limited request is in its google.rpc.RetryInfo detail.
+func toAPIError(err error) error {
+	var apiErr *llm.APIError
+	var clientErr genai.ClientError
+	var serverErr genai.ServerError
+	switch {
+	case errors.As(err, &clientErr):
+		apiErr = &llm.APIError{StatusCode: clientErr.Code, Message: clientErr.Message}
+		for _, detail := range clientErr.Details {
+			if delay, ok := detail["retryDelay"].(string); ok {
+				apiErr.RetryAfter, _ = time.ParseDuration(delay)
+			}
+		}
+	case errors.As(err, &serverErr):
+		apiErr = &llm.APIError{StatusCode: serverErr.Code, Message: serverErr.Message}
+	default:
+		return err
+	}
+	if apiErr.Message == "" {
+		apiErr.Message = err.Error()
+	}
+	return apiErr
+}
+
+// usageMessage returns a message with the token counts of the chunk, and no content.
+func usageMessage(chunk *genai.GenerateContentResponse) llm.Message {
+	if chunk == nil || chunk.UsageMetadata == nil {
+		return llm.Message{}
+	}
+	usage := chunk.UsageMetadata
+	var message llm.Message
+	if usage.CandidatesTokenCount != nil {
+		message.TokenCount = int(*usage.CandidatesTokenCount)
 	}
-	return int(*chunk.UsageMetadata.CandidatesTokenCount)
+	if usage.PromptTokenCount != nil {
+		message.InputTokenCount = int(*usage.PromptTokenCount)
+	}
+	if usage.CachedContentTokenCount != nil {
+		message.CachedTokenCount = int(*usage.CachedContentTokenCount)
+	}
+	// The thoughts of thinking models are only counted in the total, and are billed as output
+	if reasoning := int(usage.TotalTokenCount) - message.InputTokenCount - message.TokenCount; reasoning > 0 {
+		message.ReasoningTokenCount = reasoning
+		message.TokenCount += reasoning
+	}
+	return message
 }
 
 func mapToText(part *genai.Part) string {
@@ -197,9 +538,6 @@ func mapToText(part *genai.Part) string {
 	} else if part.FunctionResponse != nil {
 		return fmt.Sprintf("(function-response name: %s id: %s)\n",
 			part.FunctionResponse.Name, part.FunctionResponse.ID)
-	} else if part.FunctionCall != nil {
-		return fmt.Sprintf("(function-call name: %s id: %s)\n",
-			part.FunctionCall.Name, part.FunctionCall.ID)
 	} else if part.FileData != nil {
 		return fmt.Sprintf("(file-data uri: %s)\n", part.FileData.FileURI)
 	} else if part.ExecutableCode != nil {
@@ -236,6 +574,10 @@ func mustFprintf(w io.Writer, format string, args ...interface{}) {
 	}
 }
 
+func ptr[T any](obj T) *T {
+	return &obj
+}
+
 type ModelInfo struct {
 	Name        string `json:"name"`
 	BaseModelID string `json:"baseModelId"`
@@ -249,4 +591,32 @@ type ListModelsOutput struct {
 	Models []ModelInfo `json:"models"`
 }
 
+// BatchEmbedContentsRequest is the body of a batchEmbedContents request, whose model must match the one of the URL.
+type BatchEmbedContentsRequest struct {
+	Requests []EmbedContentRequest `json:"requests"`
+}
+
+type EmbedContentRequest struct {
+	Model   string         `json:"model"`
+	Content *genai.Content `json:"content"`
+}
+
+type BatchEmbedContentsResponse struct {
+	Embeddings []ContentEmbedding `json:"embeddings"`
+}
+
+type ContentEmbedding struct {
+	Values []float32 `json:"values"`
+}
+
+// ErrorResponse is the body of the responses of the Gemini REST API which failed.
+type ErrorResponse struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+	} `json:"error"`
+}
+
 var _ llm.ProviderIfc = (*Provider)(nil)
+var _ llm.Embedder = (*Provider)(nil)
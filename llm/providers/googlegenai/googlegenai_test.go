@@ -0,0 +1,386 @@
+package googlegenai_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jlcheng/jcllm/configuration/keys"
+	"github.com/jlcheng/jcllm/llm"
+	"github.com/jlcheng/jcllm/llm/providers/googlegenai"
+	"github.com/knadh/koanf/v2"
+	"google.golang.org/genai"
+)
+
+func newProvider(t *testing.T, handler http.HandlerFunc) *googlegenai.Provider {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	config := koanf.New(".")
+	_ = config.Set(keys.OptionGeminiApiKey, "test-key")
+	_ = config.Set(keys.OptionGeminiBaseURL, server.URL)
+	_ = config.Set(keys.OptionHttpTimeout, 1)
+	return googlegenai.NewProvider(config)
+}
+
+func TestProvider_SolicitResponse_ToolCalls(t *testing.T) {
+	tests := []struct {
+		name string
+		// calls are the function calls of the response, and the previous turn of the conversation
+		calls []llm.ToolCall
+	}{
+		{
+			name:  "one call",
+			calls: []llm.ToolCall{{ID: "read_file-0", Name: "read_file", Arguments: `{"path":"go.mod"}`}},
+		},
+		{
+			name: "parallel calls",
+			calls: []llm.ToolCall{
+				{ID: "read_file-0", Name: "read_file", Arguments: `{"path":"go.mod"}`},
+				{ID: "list_directory-1", Name: "list_directory", Arguments: "{}"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var captured struct {
+				Contents []*genai.Content `json:"contents"`
+			}
+			provider := newProvider(t, func(w http.ResponseWriter, r *http.Request) {
+				if err := json.NewDecoder(r.Body).Decode(&captured); err != nil {
+					t.Errorf("cannot decode request: %v", err)
+				}
+				var parts []*genai.Part
+				for _, call := range tt.calls {
+					var args map[string]any
+					_ = json.Unmarshal([]byte(call.Arguments), &args)
+					parts = append(parts, &genai.Part{FunctionCall: &genai.FunctionCall{Name: call.Name, Args: args}})
+				}
+				chunk, _ := json.Marshal(map[string]any{"candidates": []map[string]any{{
+					"content":      genai.Content{Role: googlegenai.RoleModel, Parts: parts},
+					"finishReason": "STOP",
+				}}})
+				_, _ = fmt.Fprintf(w, "data: %s\n\n", chunk)
+			})
+
+			entries := []llm.ChatEntry{
+				llm.NewTextEntry(llm.RoleUser, "What is in go.mod?"),
+				{Role: llm.RoleAssistant, ToolCalls: tt.calls},
+			}
+			for _, call := range tt.calls {
+				entries = append(entries, llm.ChatEntry{Role: llm.RoleTool, ToolCallID: call.ID, ToolName: call.Name,
+					Parts: []llm.Part{llm.TextPart("output of " + call.Name)}})
+			}
+			stream, err := provider.SolicitResponse(context.Background(), llm.SolicitResponseInput{
+				ModelName:    "gemini-test",
+				Conversation: llm.Conversation{Entries: entries},
+				Tools:        []llm.Tool{{Name: "read_file"}, {Name: "list_directory"}},
+			})
+			if err != nil {
+				t.Fatalf("SolicitResponse() error = %v", err)
+			}
+			var toolCalls []llm.ToolCall
+			for message, err := range stream.Messages {
+				if err != nil {
+					t.Fatalf("stream error = %v", err)
+				}
+				toolCalls = append(toolCalls, message.ToolCalls...)
+			}
+
+			if !reflect.DeepEqual(toolCalls, tt.calls) {
+				t.Errorf("tool calls = %+v; want %+v", toolCalls, tt.calls)
+			}
+			// The results of the calls of a turn are sent together, in a single content
+			if len(captured.Contents) != 3 {
+				t.Fatalf("got %d contents; want 3", len(captured.Contents))
+			}
+			if got := captured.Contents[1].Parts; len(got) != len(tt.calls) || got[0].FunctionCall == nil {
+				t.Errorf("model parts = %+v; want a function call per call", got)
+			}
+			responses := captured.Contents[2]
+			if responses.Role != googlegenai.RoleUser || len(responses.Parts) != len(tt.calls) {
+				t.Fatalf("function responses = %+v; want a part per call", responses)
+			}
+			for i, part := range responses.Parts {
+				if part.FunctionResponse == nil || part.FunctionResponse.Name != tt.calls[i].Name ||
+					part.FunctionResponse.Response["output"] != "output of "+tt.calls[i].Name {
+					t.Errorf("part %d = %+v; want the response of %s", i, part, tt.calls[i].Name)
+				}
+			}
+		})
+	}
+}
+
+func TestProvider_SolicitResponse_SystemPrompt(t *testing.T) {
+	var captured struct {
+		Contents          []*genai.Content `json:"contents"`
+		SystemInstruction *genai.Content   `json:"systemInstruction"`
+	}
+	provider := newProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&captured); err != nil {
+			t.Errorf("cannot decode request: %v", err)
+		}
+		_, _ = fmt.Fprint(w, `data: {"candidates": [{"content": {"parts": [{"text": "Arr"}],"role": "model"},"finishReason": "STOP"}]}`+"\n\n")
+	})
+	stream, err := provider.SolicitResponse(context.Background(), llm.SolicitResponseInput{
+		ModelName: "gemini-test",
+		Conversation: llm.Conversation{Entries: []llm.ChatEntry{
+			llm.NewTextEntry(llm.RoleSystem, "Talk like a pirate."),
+			llm.NewTextEntry(llm.RoleUser, "Hi"),
+		}},
+	})
+	if err != nil {
+		t.Fatalf("SolicitResponse() error = %v", err)
+	}
+	for range stream.Messages {
+	}
+	// The system entry is the system instruction, rather than a user turn
+	if got := captured.SystemInstruction; got == nil || len(got.Parts) != 1 || got.Parts[0].Text != "Talk like a pirate." {
+		t.Errorf("system instruction = %+v; want the system entry", got)
+	}
+	if len(captured.Contents) != 1 || captured.Contents[0].Parts[0].Text != "Hi" {
+		t.Errorf("contents = %+v; want the user entry only", captured.Contents)
+	}
+}
+
+func TestProvider_SolicitResponse_ImageURL(t *testing.T) {
+	var captured struct {
+		Contents []*genai.Content `json:"contents"`
+	}
+	provider := newProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&captured); err != nil {
+			t.Errorf("cannot decode request: %v", err)
+		}
+		_, _ = fmt.Fprint(w, `data: {"candidates": [{"content": {"parts": [{"text": "A cat"}],"role": "model"},"finishReason": "STOP"}]}`+"\n\n")
+	})
+	entry := llm.NewTextEntry(llm.RoleUser, "What is this?")
+	entry.Parts = append(entry.Parts, llm.ImageURLPart("https://example.com/cat.png"), llm.ImageURLPart("https://example.com/render?id=cat"))
+	stream, err := provider.SolicitResponse(context.Background(), llm.SolicitResponseInput{
+		ModelName:    "gemini-test",
+		Conversation: llm.Conversation{Entries: []llm.ChatEntry{entry}},
+	})
+	if err != nil {
+		t.Fatalf("SolicitResponse() error = %v", err)
+	}
+	for range stream.Messages {
+	}
+	if len(captured.Contents) != 1 || len(captured.Contents[0].Parts) != 3 {
+		t.Fatalf("contents = %+v; want the text and the images", captured.Contents)
+	}
+	// Gemini requires a concrete MIME type, which is guessed for an image URL without an extension
+	for i, want := range []string{"image/png", "image/jpeg"} {
+		if got := captured.Contents[0].Parts[i+1].FileData; got == nil || got.MIMEType != want {
+			t.Errorf("part %d = %+v; want file data of type %s", i+1, got, want)
+		}
+	}
+}
+
+func TestProvider_SolicitResponse_WithoutAPIKey(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, `data: {"candidates": [{"content": {"parts": [{"text": "Hi"}],"role": "model"},"finishReason": "STOP"}]}`+"\n\n")
+	}))
+	defer server.Close()
+	config := koanf.New(".")
+	_ = config.Set(keys.OptionGeminiBaseURL, server.URL)
+	_ = config.Set(keys.OptionHttpTimeout, 1)
+	t.Setenv("GOOGLE_API_KEY", "")
+
+	stream, err := googlegenai.NewProvider(config).SolicitResponse(context.Background(), llm.SolicitResponseInput{
+		ModelName:    "gemini-test",
+		Conversation: llm.Conversation{Entries: []llm.ChatEntry{llm.NewTextEntry(llm.RoleUser, "Hello")}},
+	})
+	if err != nil {
+		t.Fatalf("SolicitResponse() error = %v; want a stand-in of the API to need no key", err)
+	}
+	for _, err := range stream.Messages {
+		if err != nil {
+			t.Fatalf("stream error = %v", err)
+		}
+	}
+}
+
+func TestProvider_HttpTimeout(t *testing.T) {
+	tests := []struct {
+		name string
+		call func(provider *googlegenai.Provider) error
+	}{
+		{"list models", func(provider *googlegenai.Provider) error {
+			_, err := provider.ListModels(context.Background())
+			return err
+		}},
+		{"solicit response", func(provider *googlegenai.Provider) error {
+			stream, err := provider.SolicitResponse(context.Background(), llm.SolicitResponseInput{
+				ModelName:    "gemini-test",
+				Conversation: llm.Conversation{Entries: []llm.ChatEntry{llm.NewTextEntry(llm.RoleUser, "Hello")}},
+			})
+			if err != nil {
+				return err
+			}
+			for _, err := range stream.Messages {
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The server never answers, until the client gives up
+			provider := newProvider(t, func(w http.ResponseWriter, r *http.Request) {
+				// The server notices that the client gave up once it read the request
+				_, _ = io.Copy(io.Discard, r.Body)
+				select {
+				case <-r.Context().Done():
+				case <-time.After(10 * time.Second):
+				}
+			})
+			start := time.Now()
+			if err := tt.call(provider); err == nil {
+				t.Fatal("error = nil; want the request to time out")
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("the request gave up after %v; want the http-timeout of 1s", elapsed)
+			}
+		})
+	}
+}
+
+func TestProvider_SolicitResponse_ReasoningTokens(t *testing.T) {
+	provider := newProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, `data: {"candidates": [{"content": {"parts": [{"text": "42"}],"role": "model"},"finishReason": "STOP"}],`+
+			`"usageMetadata": {"promptTokenCount": 12,"candidatesTokenCount": 10,"totalTokenCount": 30}}`+"\n\n")
+	})
+	stream, err := provider.SolicitResponse(context.Background(), llm.SolicitResponseInput{
+		ModelName:    "gemini-test",
+		Conversation: llm.Conversation{Entries: []llm.ChatEntry{llm.NewTextEntry(llm.RoleUser, "Think")}},
+	})
+	if err != nil {
+		t.Fatalf("SolicitResponse() error = %v", err)
+	}
+	var usage llm.Usage
+	for message, err := range stream.Messages {
+		if err != nil {
+			t.Fatalf("stream error = %v", err)
+		}
+		usage.Add(message.Usage())
+	}
+	// The thoughts are the tokens of the total which are neither in the prompt nor in the candidates
+	if want := (llm.Usage{InputTokens: 12, OutputTokens: 18, ReasoningTokens: 8}); usage != want {
+		t.Errorf("usage = %+v; want %+v", usage, want)
+	}
+}
+
+func TestProvider_SolicitResponse_FinishReason(t *testing.T) {
+	tests := []struct {
+		finishReason string
+		wantText     string
+		wantUsage    llm.Usage
+		wantErr      bool
+	}{
+		{finishReason: "MAX_TOKENS", wantText: "The answer is", wantUsage: llm.Usage{InputTokens: 5, OutputTokens: 3}},
+		{finishReason: "SAFETY", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.finishReason, func(t *testing.T) {
+			var captured struct {
+				GenerationConfig struct {
+					MaxOutputTokens int `json:"maxOutputTokens"`
+				} `json:"generationConfig"`
+			}
+			provider := newProvider(t, func(w http.ResponseWriter, r *http.Request) {
+				if err := json.NewDecoder(r.Body).Decode(&captured); err != nil {
+					t.Errorf("cannot decode request: %v", err)
+				}
+				_, _ = fmt.Fprint(w, `data: {"candidates": [{"content": {"parts": [{"text": "The answer"}],"role": "model"}}]}`+"\n\n")
+				_, _ = fmt.Fprintf(w, `data: {"candidates": [{"content": {"parts": [{"text": " is"}],"role": "model"},"finishReason": %q}],`+
+					`"usageMetadata": {"promptTokenCount": 5,"candidatesTokenCount": 3,"totalTokenCount": 8}}`+"\n\n", tt.finishReason)
+			})
+			maxOutputTokens := 3
+			stream, err := provider.SolicitResponse(context.Background(), llm.SolicitResponseInput{
+				ModelName:    "gemini-test",
+				Conversation: llm.Conversation{Entries: []llm.ChatEntry{llm.NewTextEntry(llm.RoleUser, "What is the answer?")}},
+				Settings:     llm.GenerationSettings{MaxOutputTokens: &maxOutputTokens},
+			})
+			if err != nil {
+				t.Fatalf("SolicitResponse() error = %v", err)
+			}
+			var text strings.Builder
+			var usage llm.Usage
+			var streamErr error
+			for message, err := range stream.Messages {
+				if err != nil {
+					streamErr = err
+					break
+				}
+				text.WriteString(message.Text)
+				usage.Add(message.Usage())
+			}
+			if captured.GenerationConfig.MaxOutputTokens != maxOutputTokens {
+				t.Errorf("maxOutputTokens = %d; want %d", captured.GenerationConfig.MaxOutputTokens, maxOutputTokens)
+			}
+			if (streamErr != nil) != tt.wantErr {
+				t.Fatalf("stream error = %v; want error %v", streamErr, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if text.String() != tt.wantText || usage != tt.wantUsage {
+				t.Errorf("response = %q with %+v; want %q with %+v", text.String(), usage, tt.wantText, tt.wantUsage)
+			}
+		})
+	}
+}
+
+func TestProvider_Embed(t *testing.T) {
+	var paths []string
+	provider := newProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if got := r.Header.Get("x-goog-api-key"); got != "test-key" {
+			t.Errorf("api key = %q; want test-key", got)
+		}
+		var request googlegenai.BatchEmbedContentsRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("cannot decode request: %v", err)
+		}
+		// Each vector is the number of the text
+		var response googlegenai.BatchEmbedContentsResponse
+		for _, embedRequest := range request.Requests {
+			if embedRequest.Model != "models/text-embedding-004" {
+				t.Errorf("model = %q; want models/text-embedding-004", embedRequest.Model)
+			}
+			var number float32
+			_, _ = fmt.Sscanf(embedRequest.Content.Parts[0].Text, "text %f", &number)
+			response.Embeddings = append(response.Embeddings, googlegenai.ContentEmbedding{Values: []float32{number}})
+		}
+		_ = json.NewEncoder(w).Encode(response)
+	})
+
+	texts := make([]string, 150)
+	for i := range texts {
+		texts[i] = fmt.Sprintf("text %d", i)
+	}
+	vectors, err := provider.Embed(context.Background(), texts, "")
+	if err != nil {
+		t.Fatalf("Embed() error = %v", err)
+	}
+	if len(vectors) != len(texts) {
+		t.Fatalf("got %d vectors; want %d", len(vectors), len(texts))
+	}
+	for i, vector := range vectors {
+		if len(vector) != 1 || vector[0] != float32(i) {
+			t.Fatalf("vector %d = %v; want [%d]", i, vector, i)
+		}
+	}
+	want := "/v1beta/models/text-embedding-004:batchEmbedContents"
+	if len(paths) != 2 || paths[0] != want || paths[1] != want {
+		t.Errorf("paths = %q; want 2 requests to %s, as a request embeds at most 100 texts", paths, want)
+	}
+}
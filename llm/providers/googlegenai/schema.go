@@ -0,0 +1,109 @@
+package googlegenai
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/genai"
+)
+
+// toSchema converts a JSON schema into the OpenAPI 3.0 subset understood by Gemini. Keywords without a Gemini
+// equivalent, such as additionalProperties, are dropped.
+func toSchema(jsonSchema map[string]any) *genai.Schema {
+	if jsonSchema == nil {
+		return nil
+	}
+	schema := &genai.Schema{
+		Description: stringValue(jsonSchema["description"]),
+		Format:      stringValue(jsonSchema["format"]),
+		Pattern:     stringValue(jsonSchema["pattern"]),
+		Title:       stringValue(jsonSchema["title"]),
+		Minimum:     floatValue(jsonSchema["minimum"]),
+		Maximum:     floatValue(jsonSchema["maximum"]),
+		MinItems:    intValue(jsonSchema["minItems"]),
+		MaxItems:    intValue(jsonSchema["maxItems"]),
+		MinLength:   intValue(jsonSchema["minLength"]),
+		MaxLength:   intValue(jsonSchema["maxLength"]),
+	}
+	switch schemaType := jsonSchema["type"].(type) {
+	case string:
+		schema.Type = toType(schemaType)
+	case []any:
+		// A JSON schema type may be a list such as ["string", "null"], which Gemini expresses as a nullable string.
+		for _, elem := range schemaType {
+			if name := stringValue(elem); name == "null" {
+				schema.Nullable = true
+			} else if name != "" {
+				schema.Type = toType(name)
+			}
+		}
+	}
+	if enum, ok := jsonSchema["enum"].([]any); ok {
+		for _, value := range enum {
+			schema.Enum = append(schema.Enum, fmt.Sprint(value))
+		}
+		if schema.Type == "" || schema.Type == genai.TypeString {
+			schema.Type = genai.TypeString
+			schema.Format = "enum"
+		}
+	}
+	if properties, ok := jsonSchema["properties"].(map[string]any); ok {
+		schema.Properties = make(map[string]*genai.Schema, len(properties))
+		for name, property := range properties {
+			if propertySchema, ok := property.(map[string]any); ok {
+				schema.Properties[name] = toSchema(propertySchema)
+			}
+		}
+	}
+	if required, ok := jsonSchema["required"].([]any); ok {
+		for _, name := range required {
+			schema.Required = append(schema.Required, stringValue(name))
+		}
+	} else if required, ok := jsonSchema["required"].([]string); ok {
+		schema.Required = append(schema.Required, required...)
+	}
+	if items, ok := jsonSchema["items"].(map[string]any); ok {
+		schema.Items = toSchema(items)
+	}
+	if anyOf, ok := jsonSchema["anyOf"].([]any); ok {
+		for _, elem := range anyOf {
+			if elemSchema, ok := elem.(map[string]any); ok {
+				schema.AnyOf = append(schema.AnyOf, toSchema(elemSchema))
+			}
+		}
+	}
+	return schema
+}
+
+func toType(jsonType string) genai.Type {
+	return genai.Type(strings.ToUpper(jsonType))
+}
+
+func stringValue(value any) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	return ""
+}
+
+func floatValue(value any) *float64 {
+	switch number := value.(type) {
+	case float64:
+		return &number
+	case int:
+		f := float64(number)
+		return &f
+	case int64:
+		f := float64(number)
+		return &f
+	}
+	return nil
+}
+
+func intValue(value any) *int64 {
+	if f := floatValue(value); f != nil {
+		i := int64(*f)
+		return &i
+	}
+	return nil
+}
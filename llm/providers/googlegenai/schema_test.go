@@ -0,0 +1,54 @@
+package googlegenai
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"google.golang.org/genai"
+)
+
+func TestToSchema(t *testing.T) {
+	var jsonSchema map[string]any
+	err := json.Unmarshal([]byte(`{
+		"type": "object",
+		"description": "A file listing request",
+		"properties": {
+			"path": {"type": "string", "description": "The directory"},
+			"depth": {"type": ["integer", "null"], "minimum": 0},
+			"sort": {"enum": ["name", "size"]},
+			"globs": {"type": "array", "items": {"type": "string"}}
+		},
+		"required": ["path"],
+		"additionalProperties": false
+	}`), &jsonSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := toSchema(jsonSchema)
+
+	zero := 0.0
+	want := &genai.Schema{
+		Type:        genai.TypeObject,
+		Description: "A file listing request",
+		Properties: map[string]*genai.Schema{
+			"path":  {Type: genai.TypeString, Description: "The directory"},
+			"depth": {Type: genai.TypeInteger, Nullable: true, Minimum: &zero},
+			"sort":  {Type: genai.TypeString, Format: "enum", Enum: []string{"name", "size"}},
+			"globs": {Type: genai.TypeArray, Items: &genai.Schema{Type: genai.TypeString}},
+		},
+		Required: []string{"path"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		gotJSON, _ := json.Marshal(got)
+		wantJSON, _ := json.Marshal(want)
+		t.Errorf("toSchema() = %s; want %s", gotJSON, wantJSON)
+	}
+}
+
+func TestToSchema_Nil(t *testing.T) {
+	if got := toSchema(nil); got != nil {
+		t.Errorf("toSchema(nil) = %+v; want nil", got)
+	}
+}
@@ -0,0 +1,322 @@
+package ollama
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BooleanCat/go-functional/v2/it"
+	"github.com/go-errors/errors"
+	"github.com/jlcheng/jcllm/configuration"
+	"github.com/jlcheng/jcllm/configuration/keys"
+	"github.com/jlcheng/jcllm/llm"
+	"github.com/jlcheng/jcllm/llm/ollamamodels"
+)
+
+const (
+	// RoleUser is 'user'
+	RoleUser = "user"
+	// RoleAssistant is 'assistant'
+	RoleAssistant = "assistant"
+	// RoleSystem is 'system'
+	RoleSystem = "system"
+)
+
+type Provider struct {
+	config     configuration.Configuration
+	httpClient *http.Client
+	// pullClient has no timeout, as downloading a model can take much longer than a chat completion.
+	pullClient *http.Client
+}
+
+// NewProvider creates a provider to models served by a local Ollama server, see https://github.com/ollama/ollama/blob/main/docs/api.md.
+func NewProvider(config configuration.Configuration) *Provider {
+	timeout := time.Duration(config.MustInt(keys.OptionHttpTimeout)) * time.Second
+	return &Provider{
+		config: config,
+		httpClient: &http.Client{
+			Timeout: timeout,
+		},
+		pullClient: &http.Client{},
+	}
+}
+
+func (p *Provider) ToProviderRole(genericRole string) (providerRole string) {
+	switch genericRole {
+	case llm.RoleAssistant:
+		return RoleAssistant
+	case llm.RoleUser:
+		return RoleUser
+	case llm.RoleSystem:
+		return RoleSystem
+	}
+	return RoleUser
+}
+
+func (p *Provider) ToGenericRole(providerRole string) (genericRole string) {
+	switch providerRole {
+	case RoleAssistant:
+		return llm.RoleAssistant
+	case RoleUser:
+		return llm.RoleUser
+	case RoleSystem:
+		return llm.RoleSystem
+	}
+	return llm.RoleUser
+}
+
+func (p *Provider) ListModels(ctx context.Context) ([]llm.ModelInfo, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, p.endpointURL("/api/tags"), nil)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "list model request creation failed", 0)
+	}
+	body, err := p.submitRequest(p.httpClient, request)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "list models request submission failed", 0)
+	}
+	defer body.Close()
+	var models ollamamodels.ListModelsResponse
+	if err := json.NewDecoder(body).Decode(&models); err != nil {
+		return nil, errors.WrapPrefix(err, "list model response read failed", 0)
+	}
+	return slices.SortedFunc(
+		it.Map(slices.Values(models.Models), func(model ollamamodels.Model) llm.ModelInfo {
+			description := strings.TrimSpace(fmt.Sprintf("%s %s %s",
+				model.Details.Family, model.Details.ParameterSize, model.Details.Format))
+			return llm.ModelInfo{
+				DisplayName:  model.Name,
+				Name:         model.Name,
+				Description:  description,
+				Version:      model.Digest,
+				Size:         model.Size,
+				Quantization: model.Details.QuantizationLevel,
+			}
+		}),
+		func(a llm.ModelInfo, b llm.ModelInfo) int {
+			return strings.Compare(a.Name, b.Name)
+		},
+	), nil
+}
+
+func (p *Provider) SolicitResponse(ctx context.Context, input llm.SolicitResponseInput) (llm.ResponseStream, error) {
+	response := llm.ResponseStream{
+		Role: p.ToGenericRole(RoleAssistant),
+	}
+	if input.UsesTools() {
+		return response, errors.WrapPrefix(llm.ErrUnsupportedTools, "ollama does not support tools yet", 0)
+	}
+	for _, entry := range input.Conversation.Entries {
+		if len(entry.Attachments()) > 0 {
+			return response, errors.WrapPrefix(llm.ErrUnsupportedPart, "ollama does not support attachments yet", 0)
+		}
+	}
+	systemPrompt, entries := llm.SystemPrompt(p.config, input.Conversation)
+	messages := slices.Collect(it.Map(slices.Values(entries), func(v llm.ChatEntry) ollamamodels.Message {
+		return ollamamodels.Message{
+			Content: v.Text(),
+			Role:    p.ToProviderRole(v.Role),
+		}
+	}))
+	if systemPrompt != "" {
+		messages = append([]ollamamodels.Message{{
+			Content: systemPrompt,
+			Role:    RoleSystem,
+		}}, messages...)
+	}
+	chatRequest := ollamamodels.ChatRequest{
+		Model:     input.ModelName,
+		Messages:  messages,
+		Stream:    ptr(true),
+		KeepAlive: p.keepAlive(),
+		Options:   toOptions(input.Settings),
+	}
+	if input.ResponseSchema != nil {
+		chatRequest.Format = input.ResponseSchema
+	}
+	requestBytes, err := json.Marshal(chatRequest)
+	if err != nil {
+		return response, errors.WrapPrefix(err, "chat request stringify failed", 0)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpointURL("/api/chat"), bytes.NewReader(requestBytes))
+	if err != nil {
+		return response, errors.WrapPrefix(err, "chat request creation failed", 0)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	body, err := p.submitRequest(p.httpClient, request)
+	if err != nil {
+		return response, errors.WrapPrefix(err, "chat request submission failed", 0)
+	}
+
+	response.Messages = func(yield func(llm.Message, error) bool) {
+		defer body.Close()
+		// Each line of the response body is a complete json object
+		scanner := bufio.NewScanner(body)
+		for scanner.Scan() {
+			if err := ctx.Err(); err != nil {
+				yield(llm.Message{}, errors.WrapPrefix(err, "response stream cancelled", 0))
+				return
+			}
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			var chunk ollamamodels.ChatResponse
+			if err := json.Unmarshal(line, &chunk); err != nil {
+				yield(llm.Message{}, errors.WrapPrefix(err, "unmarshal response failed", 0))
+				return
+			}
+			if chunk.Error != "" {
+				yield(llm.Message{}, errors.Errorf("stream error: %s", chunk.Error))
+				return
+			}
+			if chunk.Message.Content != "" {
+				if !yield(llm.Message{Text: chunk.Message.Content}, nil) {
+					return
+				}
+			}
+			if chunk.Done {
+				yield(llm.Message{TokenCount: chunk.EvalCount, InputTokenCount: chunk.PromptEvalCount}, nil)
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			yield(llm.Message{}, errors.WrapPrefix(err, "read response stream failed", 0))
+		}
+	}
+	return response, nil
+}
+
+// PullModel asks the Ollama server to download modelName, reporting progress as the download proceeds.
+func (p *Provider) PullModel(ctx context.Context, modelName string) (iter.Seq2[llm.PullProgress, error], error) {
+	requestBytes, err := json.Marshal(ollamamodels.PullRequest{Model: modelName, Stream: ptr(true)})
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "pull request stringify failed", 0)
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpointURL("/api/pull"), bytes.NewReader(requestBytes))
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "pull request creation failed", 0)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	body, err := p.submitRequest(p.pullClient, request)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "pull request submission failed", 0)
+	}
+	return func(yield func(llm.PullProgress, error) bool) {
+		defer body.Close()
+		scanner := bufio.NewScanner(body)
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			var progress ollamamodels.PullResponse
+			if err := json.Unmarshal(line, &progress); err != nil {
+				yield(llm.PullProgress{}, errors.WrapPrefix(err, "unmarshal pull response failed", 0))
+				return
+			}
+			if progress.Error != "" {
+				yield(llm.PullProgress{}, errors.Errorf("pull error: %s", progress.Error))
+				return
+			}
+			if !yield(llm.PullProgress{
+				Status:    progress.Status,
+				Completed: progress.Completed,
+				Total:     progress.Total,
+			}, nil) {
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			yield(llm.PullProgress{}, errors.WrapPrefix(err, "read pull stream failed", 0))
+		}
+	}, nil
+}
+
+// keepAlive returns the configured keep-alive as a number of seconds if it is numeric, as Ollama does not accept
+// numeric strings such as "-1". Otherwise, it is passed through as a duration string.
+func (p *Provider) keepAlive() any {
+	keepAlive := p.config.String(keys.OptionOllamaKeepAlive)
+	if keepAlive == "" {
+		return nil
+	}
+	if seconds, err := strconv.Atoi(keepAlive); err == nil {
+		return seconds
+	}
+	return keepAlive
+}
+
+func (p *Provider) baseURL() string {
+	return p.config.String(keys.OptionOllamaBaseURL)
+}
+
+func (p *Provider) endpointURL(suffix string) string {
+	base, err := url.Parse(p.baseURL())
+	if err != nil {
+		return ""
+	}
+	return base.JoinPath(suffix).String()
+}
+
+func (p *Provider) submitRequest(client *http.Client, request *http.Request) (io.ReadCloser, error) {
+	var (
+		response *http.Response
+		body     []byte
+		err      error
+	)
+	response, err = client.Do(request)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "submit request failed", 0)
+	}
+	if response.StatusCode != http.StatusOK {
+		defer response.Body.Close()
+		body, err = io.ReadAll(response.Body)
+		if err != nil {
+			body = []byte("cannot read response body")
+		}
+		var errResponse ollamamodels.APIErrorResponse
+		_ = json.Unmarshal(body, &errResponse)
+		errorMessage := errResponse.Error
+		if errorMessage == "" {
+			errorMessage = fmt.Sprintf("%q", body)
+		}
+		apiErr := &llm.APIError{
+			StatusCode: response.StatusCode,
+			Message:    errorMessage,
+			RetryAfter: llm.RetryAfter(response.Header, time.Now()),
+		}
+		return nil, errors.WrapPrefix(apiErr, "submit request failed", 0)
+	}
+	return response.Body, nil
+}
+
+// toOptions maps the generation settings onto Ollama model parameters. Ollama has no equivalent of the reasoning effort.
+func toOptions(settings llm.GenerationSettings) *ollamamodels.Options {
+	if settings.String() == "" {
+		return nil
+	}
+	return &ollamamodels.Options{
+		NumPredict:  settings.MaxOutputTokens,
+		Seed:        settings.Seed,
+		Stop:        settings.StopSequences,
+		Temperature: settings.Temperature,
+		TopP:        settings.TopP,
+	}
+}
+
+func ptr[T any](obj T) *T {
+	return &obj
+}
+
+var _ llm.ProviderIfc = (*Provider)(nil)
+var _ llm.ModelPuller = (*Provider)(nil)
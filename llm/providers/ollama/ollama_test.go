@@ -0,0 +1,183 @@
+package ollama_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jlcheng/jcllm/configuration/keys"
+	"github.com/jlcheng/jcllm/llm"
+	"github.com/jlcheng/jcllm/llm/ollamamodels"
+	"github.com/jlcheng/jcllm/llm/providers/ollama"
+	"github.com/knadh/koanf/v2"
+)
+
+func newProvider(t *testing.T, keepAlive string, handler http.HandlerFunc) *ollama.Provider {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	config := koanf.New(".")
+	_ = config.Set(keys.OptionHttpTimeout, 5)
+	_ = config.Set(keys.OptionOllamaBaseURL, server.URL)
+	_ = config.Set(keys.OptionOllamaKeepAlive, keepAlive)
+	_ = config.Set(keys.OptionSystemPrompt, "Be concise.")
+	return ollama.NewProvider(config)
+}
+
+func TestProvider_SolicitResponse(t *testing.T) {
+	tests := []struct {
+		name          string
+		keepAlive     string
+		wantKeepAlive any
+	}{
+		{name: "duration keep-alive", keepAlive: "10m", wantKeepAlive: "10m"},
+		{name: "numeric keep-alive", keepAlive: "-1", wantKeepAlive: float64(-1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var captured map[string]any
+			provider := newProvider(t, tt.keepAlive, func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/chat" {
+					t.Errorf("unexpected path: %s", r.URL.Path)
+				}
+				if err := json.NewDecoder(r.Body).Decode(&captured); err != nil {
+					t.Errorf("cannot decode request: %v", err)
+				}
+				w.Header().Set("Content-Type", "application/x-ndjson")
+				_, _ = fmt.Fprintln(w, `{"model":"llama3.2","message":{"role":"assistant","content":"Hello"},"done":false}`)
+				_, _ = fmt.Fprintln(w, `{"model":"llama3.2","message":{"role":"assistant","content":" there"},"done":false}`)
+				_, _ = fmt.Fprintln(w, `{"model":"llama3.2","message":{"role":"assistant","content":""},"done":true,"done_reason":"stop","prompt_eval_count":12,"eval_count":3}`)
+			})
+			stream, err := provider.SolicitResponse(context.Background(), llm.SolicitResponseInput{
+				ModelName:    "llama3.2",
+				Conversation: llm.Conversation{Entries: []llm.ChatEntry{llm.NewTextEntry(llm.RoleUser, "Hi")}},
+			})
+			if err != nil {
+				t.Fatalf("SolicitResponse() error = %v", err)
+			}
+			var text strings.Builder
+			inputTokens, outputTokens := 0, 0
+			for message, err := range stream.Messages {
+				if err != nil {
+					t.Fatalf("stream error = %v", err)
+				}
+				text.WriteString(message.Text)
+				inputTokens += message.InputTokenCount
+				outputTokens += message.TokenCount
+			}
+			if got := text.String(); got != "Hello there" {
+				t.Errorf("text = %q; want %q", got, "Hello there")
+			}
+			if inputTokens != 12 || outputTokens != 3 {
+				t.Errorf("usage = (%d, %d); want (12, 3)", inputTokens, outputTokens)
+			}
+			if captured["keep_alive"] != tt.wantKeepAlive {
+				t.Errorf("keep_alive = %#v; want %#v", captured["keep_alive"], tt.wantKeepAlive)
+			}
+			messages, _ := captured["messages"].([]any)
+			if len(messages) != 2 || messages[0].(map[string]any)["role"] != ollama.RoleSystem {
+				t.Errorf("messages = %v; want the system prompt followed by the user message", messages)
+			}
+		})
+	}
+}
+
+func TestProvider_SolicitResponse_StreamError(t *testing.T) {
+	provider := newProvider(t, "5m", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintln(w, `{"error":"model requires more system memory"}`)
+	})
+	stream, err := provider.SolicitResponse(context.Background(), llm.SolicitResponseInput{ModelName: "llama3.2"})
+	if err != nil {
+		t.Fatalf("SolicitResponse() error = %v", err)
+	}
+	var streamErr error
+	for _, err := range stream.Messages {
+		streamErr = err
+	}
+	if streamErr == nil || !strings.Contains(streamErr.Error(), "more system memory") {
+		t.Errorf("stream error = %v; want the server error", streamErr)
+	}
+}
+
+func TestProvider_ListModels(t *testing.T) {
+	provider := newProvider(t, "5m", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/tags" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		_ = json.NewEncoder(w).Encode(ollamamodels.ListModelsResponse{Models: []ollamamodels.Model{
+			{Name: "qwen2.5:7b", Size: 4683087332, Details: ollamamodels.ModelDetails{Family: "qwen2", ParameterSize: "7.6B", QuantizationLevel: "Q4_K_M"}},
+			{Name: "llama3.2:latest", Size: 2019393189, Details: ollamamodels.ModelDetails{Family: "llama", ParameterSize: "3.2B", QuantizationLevel: "Q4_0"}},
+		}})
+	})
+	models, err := provider.ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("ListModels() error = %v", err)
+	}
+	if len(models) != 2 {
+		t.Fatalf("ListModels() = %+v; want 2 models", models)
+	}
+	if models[0].Name != "llama3.2:latest" || models[0].Size != 2019393189 || models[0].Quantization != "Q4_0" {
+		t.Errorf("models[0] = %+v; want llama3.2:latest with size and quantization", models[0])
+	}
+}
+
+func TestProvider_PullModel(t *testing.T) {
+	provider := newProvider(t, "5m", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/pull" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		_, _ = fmt.Fprintln(w, `{"status":"pulling manifest"}`)
+		_, _ = fmt.Fprintln(w, `{"status":"downloading","digest":"sha256:abc","total":100,"completed":50}`)
+		_, _ = fmt.Fprintln(w, `{"status":"success"}`)
+	})
+	progress, err := provider.PullModel(context.Background(), "llama3.2")
+	if err != nil {
+		t.Fatalf("PullModel() error = %v", err)
+	}
+	var statuses []string
+	for update, err := range progress {
+		if err != nil {
+			t.Fatalf("progress error = %v", err)
+		}
+		statuses = append(statuses, fmt.Sprintf("%s %d/%d", update.Status, update.Completed, update.Total))
+	}
+	want := "pulling manifest 0/0,downloading 50/100,success 0/0"
+	if got := strings.Join(statuses, ","); got != want {
+		t.Errorf("progress = %q; want %q", got, want)
+	}
+}
+
+func TestProvider_SolicitResponse_Tools(t *testing.T) {
+	tests := []struct {
+		name  string
+		input llm.SolicitResponseInput
+	}{
+		{"offered tools", llm.SolicitResponseInput{
+			Conversation: llm.Conversation{Entries: []llm.ChatEntry{llm.NewTextEntry(llm.RoleUser, "What time is it?")}},
+			Tools:        []llm.Tool{{Name: "get_time", Parameters: map[string]any{"type": "object"}}},
+		}},
+		{"tool calls in the history", llm.SolicitResponseInput{
+			Conversation: llm.Conversation{Entries: []llm.ChatEntry{
+				llm.NewTextEntry(llm.RoleUser, "What time is it?"),
+				{Role: llm.RoleAssistant, ToolCalls: []llm.ToolCall{{ID: "c1", Name: "get_time", Arguments: "{}"}}},
+				{Role: llm.RoleTool, ToolCallID: "c1", ToolName: "get_time", Parts: []llm.Part{llm.TextPart("noon")}},
+			}},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newProvider(t, "5m", func(w http.ResponseWriter, r *http.Request) {
+				t.Error("the request was sent without its tools")
+			})
+			tt.input.ModelName = "llama3.2"
+			if _, err := provider.SolicitResponse(context.Background(), tt.input); !errors.Is(err, llm.ErrUnsupportedTools) {
+				t.Errorf("SolicitResponse() error = %v; want ErrUnsupportedTools", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+package openai_test
+
+import (
+	"testing"
+
+	"github.com/jlcheng/jcllm/configuration/keys"
+	"github.com/jlcheng/jcllm/llm"
+	"github.com/jlcheng/jcllm/llm/providers/openai"
+	"github.com/jlcheng/jcllm/llm/providers/providertest"
+	"github.com/knadh/koanf/v2"
+)
+
+func TestProvider_Conformance(t *testing.T) {
+	providertest.Run(t, "testdata/conformance", func(t *testing.T, baseURL string) llm.ProviderIfc {
+		config := koanf.New(".")
+		_ = config.Set(keys.OptionHttpTimeout, 5)
+		_ = config.Set(keys.OptionOpenAIApiKey, "test-key")
+		_ = config.Set(keys.OptionOpenAIBaseURL, baseURL+"/v1")
+		return openai.NewProvider(config)
+	})
+}
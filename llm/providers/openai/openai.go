@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -17,6 +18,7 @@ import (
 	"github.com/go-errors/errors"
 	"github.com/jlcheng/jcllm/configuration"
 	"github.com/jlcheng/jcllm/configuration/keys"
+	"github.com/jlcheng/jcllm/configuration/secrets"
 	"github.com/jlcheng/jcllm/llm"
 	"github.com/jlcheng/jcllm/llm/openaimodels"
 )
@@ -28,9 +30,27 @@ const (
 	RoleAssistant = "assistant"
 	// RoleDeveloper is 'developer
 	RoleDeveloper = "developer"
+	// RoleTool is 'tool'
+	RoleTool = "tool"
+
+	// ToolTypeFunction is the only type of tool supported by OpenAI
+	ToolTypeFunction = "function"
+
+	// ContentTypeText is a text part of the content array
+	ContentTypeText = "text"
+	// ContentTypeImageURL is an image part of the content array
+	ContentTypeImageURL = "image_url"
+	// ContentTypeFile is a file part of the content array, such as a PDF
+	ContentTypeFile = "file"
+
+	// ResponseFormatJSONSchema constrains the response to a JSON schema
+	ResponseFormatJSONSchema = "json_schema"
 
 	// HeaderAuthorization is where OpenAI looks for the OpenAI API Key
 	HeaderAuthorization = "Authorization"
+
+	// DefaultEmbeddingModel embeds texts when no embedding model is configured
+	DefaultEmbeddingModel = "text-embedding-3-small"
 )
 
 type Provider struct {
@@ -56,6 +76,8 @@ func (p *Provider) ToProviderRole(genericRole string) (providerRole string) {
 		return RoleUser
 	case llm.RoleSystem:
 		return RoleUser
+	case llm.RoleTool:
+		return RoleTool
 	}
 	return RoleUser
 }
@@ -66,6 +88,8 @@ func (p *Provider) ToGenericRole(providerRole string) (genericRole string) {
 		return llm.RoleAssistant
 	case RoleUser:
 		return llm.RoleUser
+	case RoleTool:
+		return llm.RoleTool
 	}
 	return llm.RoleUser
 
@@ -100,27 +124,69 @@ func (p *Provider) ListModels(ctx context.Context) ([]llm.ModelInfo, error) {
 
 func (p *Provider) SolicitResponse(ctx context.Context, input llm.SolicitResponseInput) (llm.ResponseStream, error) {
 	response := llm.ResponseStream{
-		Role: RoleAssistant,
+		Role: p.ToGenericRole(RoleAssistant),
 	}
-	messages := slices.Collect(it.Map(slices.Values(input.Conversation.Entries), func(v llm.ChatEntry) openaimodels.Message {
+	systemPrompt, entries := llm.SystemPrompt(p.config, input.Conversation)
+	messages := slices.Collect(it.Map(slices.Values(entries), func(v llm.ChatEntry) openaimodels.Message {
 		return openaimodels.Message{
-			Content: v.Text,
+			Content: toContent(v),
 			Role:    p.ToProviderRole(v.Role),
+			ToolCalls: slices.Collect(it.Map(slices.Values(v.ToolCalls), func(call llm.ToolCall) openaimodels.ToolCall {
+				return openaimodels.ToolCall{
+					ID:   call.ID,
+					Type: ToolTypeFunction,
+					Function: openaimodels.FunctionCall{
+						Name:      call.Name,
+						Arguments: call.Arguments,
+					},
+				}
+			})),
+			ToolCallID: v.ToolCallID,
 		}
 	}))
-	if developerMessage := p.config.String(keys.OptionSystemPrompt); developerMessage != "" {
+	if systemPrompt != "" {
 		messages = append([]openaimodels.Message{{
-			Content: developerMessage,
+			Content: systemPrompt,
 			Role:    RoleDeveloper,
 		}}, messages...)
 	}
 	chatCompletionRequest := openaimodels.CreateChatCompletionRequest{
-		Model:    input.ModelName,
-		Messages: messages,
-		Stream:   ptr(true),
+		Model:               input.ModelName,
+		Messages:            messages,
+		MaxCompletionTokens: input.Settings.MaxOutputTokens,
+		Seed:                input.Settings.Seed,
+		Stop:                input.Settings.StopSequences,
+		Stream:              ptr(true),
+		Temperature:         input.Settings.Temperature,
+		TopP:                input.Settings.TopP,
 		StreamOptions: &openaimodels.StreamOptions{
 			IncludeUsage: ptr(true),
 		},
+		Tools: slices.Collect(it.Map(slices.Values(input.Tools), func(tool llm.Tool) openaimodels.Tool {
+			return openaimodels.Tool{
+				Type: ToolTypeFunction,
+				Function: openaimodels.FunctionDefinition{
+					Name:        tool.Name,
+					Description: tool.Description,
+					Parameters:  tool.Parameters,
+				},
+			}
+		})),
+	}
+	if input.Settings.ReasoningEffort != "" {
+		chatCompletionRequest.ReasoningEffort = ptr(input.Settings.ReasoningEffort)
+	}
+	if input.ResponseSchema != nil {
+		// Strict mode is the only one where OpenAI guarantees the response matches the schema, but OpenAI rejects the
+		// schemas which do not meet its requirements. The responses to those are only validated by the caller.
+		chatCompletionRequest.ResponseFormat = &openaimodels.ResponseFormat{
+			Type: ResponseFormatJSONSchema,
+			JSONSchema: &openaimodels.JSONSchema{
+				Name:   ptr(schemaName(input.ResponseSchema)),
+				Schema: input.ResponseSchema,
+				Strict: ptr(strictSchema(input.ResponseSchema)),
+			},
+		}
 	}
 	requestBytes, err := json.Marshal(chatCompletionRequest)
 	if err != nil {
@@ -139,38 +205,109 @@ func (p *Provider) SolicitResponse(ctx context.Context, input llm.SolicitRespons
 	}
 
 	response.Messages = func(yield func(llm.Message, error) bool) {
+		defer body.Close()
+		// Tool calls are streamed as fragments, so they are assembled here and yielded once the choice is finished.
+		toolCalls := new(toolCallAccumulator)
 		scanner := bufio.NewScanner(body)
 		for scanner.Scan() {
-			line := scanner.Text()
-			if line == "" {
+			// The scanner may have buffered several chunks, which must not be yielded once the caller gave up
+			if err := ctx.Err(); err != nil {
+				yield(llm.Message{}, errors.WrapPrefix(err, "response stream cancelled", 0))
+				return
+			}
+			// Only data lines carry chunks. Comments, such as keep-alive pings, and event names are skipped.
+			line, isData := strings.CutPrefix(scanner.Text(), "data:")
+			if !isData {
 				continue
 			}
-			lineMessage := strings.TrimSpace(strings.TrimPrefix(line, "data: "))
+			lineMessage := strings.TrimSpace(line)
 			if lineMessage == "[DONE]" {
 				break
 			}
 			var chunk openaimodels.ChatCompletionChunkResponse
 			if err := json.Unmarshal([]byte(lineMessage), &chunk); err != nil {
-				if !yield(llm.Message{}, errors.WrapPrefix(err, "unmarshal response failed", 0)) {
-					return
-				}
-				break
+				yield(llm.Message{}, errors.WrapPrefix(err, "unmarshal response failed", 0))
+				return
 			}
 			if len(chunk.Choices) != 0 {
-				if !yield(llm.Message{Text: chunk.Choices[0].Delta.Content}, nil) {
-					return
+				choice := chunk.Choices[0]
+				toolCalls.Add(choice.Delta.ToolCalls)
+				if choice.Delta.Content != "" {
+					if !yield(llm.Message{Text: choice.Delta.Content}, nil) {
+						return
+					}
+				}
+				if choice.FinishReason != nil {
+					if calls := toolCalls.Flush(); len(calls) != 0 {
+						if !yield(llm.Message{ToolCalls: calls}, nil) {
+							return
+						}
+					}
 				}
 			}
 			if chunk.Usage != nil {
-				if !yield(llm.Message{TokenCount: chunk.Usage.CompletionTokens}, nil) {
+				usage := llm.Message{
+					TokenCount:          chunk.Usage.CompletionTokens,
+					InputTokenCount:     chunk.Usage.PromptTokens,
+					CachedTokenCount:    chunk.Usage.PromptTokensDetails.CachedTokens,
+					ReasoningTokenCount: chunk.Usage.CompletionTokensDetails.ReasoningTokens,
+				}
+				if !yield(usage, nil) {
 					return
 				}
 			}
 		}
+		if err := scanner.Err(); err != nil {
+			yield(llm.Message{}, errors.WrapPrefix(err, "read response stream failed", 0))
+			return
+		}
+		if calls := toolCalls.Flush(); len(calls) != 0 {
+			yield(llm.Message{ToolCalls: calls}, nil)
+		}
 	}
 	return response, nil
 }
 
+// Embed sends all the texts in a single request, as the embeddings API accepts up to 2048 of them.
+func (p *Provider) Embed(ctx context.Context, texts []string, modelName string) ([][]float32, error) {
+	if modelName == "" {
+		modelName = DefaultEmbeddingModel
+	}
+	requestBytes, err := json.Marshal(openaimodels.CreateEmbeddingRequest{
+		Model:          modelName,
+		Input:          texts,
+		EncodingFormat: "float",
+	})
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "embeddings request stringify failed", 0)
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpointURL("/embeddings"), bytes.NewReader(requestBytes))
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "embeddings request creation failed", 0)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	body, err := p.submitRequest(request)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "embeddings request submission failed", 0)
+	}
+	defer body.Close()
+	var embeddings openaimodels.CreateEmbeddingResponse
+	if err := json.NewDecoder(body).Decode(&embeddings); err != nil {
+		return nil, errors.WrapPrefix(err, "embeddings response read failed", 0)
+	}
+	if len(embeddings.Data) != len(texts) {
+		return nil, errors.Errorf("got %d embeddings for %d texts", len(embeddings.Data), len(texts))
+	}
+	vectors := make([][]float32, len(texts))
+	for _, embedding := range embeddings.Data {
+		if embedding.Index < 0 || embedding.Index >= len(texts) {
+			return nil, errors.Errorf("embedding index %d out of range", embedding.Index)
+		}
+		vectors[embedding.Index] = embedding.Embedding
+	}
+	return vectors, nil
+}
+
 func (p *Provider) baseURL() string {
 	return p.config.String(keys.OptionOpenAIBaseURL)
 }
@@ -190,7 +327,11 @@ func (p *Provider) submitRequest(request *http.Request) (io.ReadCloser, error) {
 		err      error
 	)
 	if request.Header.Get(HeaderAuthorization) == "" {
-		request.Header.Set("Authorization", "Bearer "+p.config.String(keys.OptionOpenAIApiKey))
+		apiKey, err := secrets.APIKey(p.config, keys.OptionOpenAIApiKey)
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Set("Authorization", "Bearer "+apiKey)
 	}
 	response, err = p.httpClient.Do(request)
 	if err != nil {
@@ -208,13 +349,141 @@ func (p *Provider) submitRequest(request *http.Request) (io.ReadCloser, error) {
 		if errorMessage == "" {
 			errorMessage = fmt.Sprintf("%q", body)
 		}
-		return nil, errors.Errorf("submit request failed, status code: %d, message: %s", response.StatusCode, errorMessage)
+		apiErr := &llm.APIError{
+			StatusCode: response.StatusCode,
+			Message:    errorMessage,
+			RetryAfter: llm.RetryAfter(response.Header, time.Now()),
+		}
+		return nil, errors.WrapPrefix(apiErr, "submit request failed", 0)
 	}
 	return response.Body, nil
 }
 
+// toolCallAccumulator assembles the tool call fragments of a streamed response.
+type toolCallAccumulator struct {
+	calls []llm.ToolCall
+}
+
+func (acc *toolCallAccumulator) Add(fragments []openaimodels.ToolCall) {
+	for _, fragment := range fragments {
+		idx := max(len(acc.calls)-1, 0)
+		if fragment.Index != nil {
+			idx = *fragment.Index
+		}
+		for idx >= len(acc.calls) {
+			acc.calls = append(acc.calls, llm.ToolCall{})
+		}
+		call := &acc.calls[idx]
+		if fragment.ID != "" {
+			call.ID = fragment.ID
+		}
+		call.Name += fragment.Function.Name
+		call.Arguments += fragment.Function.Arguments
+	}
+}
+
+// Flush returns the assembled tool calls and resets the accumulator.
+func (acc *toolCallAccumulator) Flush() []llm.ToolCall {
+	calls := acc.calls
+	acc.calls = nil
+	return calls
+}
+
+// toContent returns the text of the entry, or an array of content parts when the entry has attachments. Images become
+// image_url parts and other files, such as PDFs, become file parts. Inline content is sent as a data URI.
+func toContent(entry llm.ChatEntry) interface{} {
+	if len(entry.Attachments()) == 0 {
+		return entry.Text()
+	}
+	parts := make([]openaimodels.ContentPart, 0, len(entry.Parts))
+	for _, part := range entry.Parts {
+		uri := part.URI
+		if part.Type == llm.PartInline {
+			uri = fmt.Sprintf("data:%s;base64,%s", part.MIMEType, base64.StdEncoding.EncodeToString(part.Data))
+		}
+		switch {
+		case part.Type == llm.PartText:
+			parts = append(parts, openaimodels.ContentPart{Type: ContentTypeText, Text: part.Text})
+		case strings.HasPrefix(part.MIMEType, "image/"):
+			parts = append(parts, openaimodels.ContentPart{
+				Type:     ContentTypeImageURL,
+				ImageURL: &openaimodels.ImageURL{URL: uri},
+			})
+		case part.Type == llm.PartInline:
+			parts = append(parts, openaimodels.ContentPart{
+				Type: ContentTypeFile,
+				File: &openaimodels.File{FileData: uri, Filename: part.Name},
+			})
+		default:
+			parts = append(parts, openaimodels.ContentPart{
+				Type: ContentTypeFile,
+				File: &openaimodels.File{FileID: part.URI},
+			})
+		}
+	}
+	return parts
+}
+
+// strictSchema reports whether a schema meets the requirements of the strict mode of OpenAI: every object forbids
+// additional properties and requires all of its properties, including the objects nested in it.
+func strictSchema(schema map[string]any) bool {
+	properties, _ := schema["properties"].(map[string]any)
+	if schema["type"] == "object" || properties != nil {
+		if schema["additionalProperties"] != false {
+			return false
+		}
+		required, _ := schema["required"].([]any)
+		for name, property := range properties {
+			if !slices.Contains(required, any(name)) || !strictSubschema(property) {
+				return false
+			}
+		}
+	}
+	if items, ok := schema["items"]; ok && !strictSubschema(items) {
+		return false
+	}
+	for _, key := range []string{"anyOf", "allOf", "oneOf"} {
+		subschemas, _ := schema[key].([]any)
+		for _, subschema := range subschemas {
+			if !strictSubschema(subschema) {
+				return false
+			}
+		}
+	}
+	for _, key := range []string{"$defs", "definitions"} {
+		definitions, _ := schema[key].(map[string]any)
+		for _, definition := range definitions {
+			if !strictSubschema(definition) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func strictSubschema(schema any) bool {
+	subschema, ok := schema.(map[string]any)
+	return !ok || strictSchema(subschema)
+}
+
+// schemaName returns a name for the schema, which OpenAI requires. The name is made of the characters allowed by OpenAI.
+func schemaName(schema map[string]any) string {
+	title, _ := schema["title"].(string)
+	name := strings.Map(func(r rune) rune {
+		if r == '_' || r == '-' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') {
+			return r
+		}
+		return '_'
+	}, title)
+	if name == "" {
+		return "response"
+	}
+	return name
+}
+
 func ptr[T any](obj T) *T {
 	return &obj
 }
 
 var _ llm.ProviderIfc = (*Provider)(nil)
+var _ llm.Embedder = (*Provider)(nil)
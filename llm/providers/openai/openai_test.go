@@ -0,0 +1,371 @@
+package openai_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jlcheng/jcllm/configuration/keys"
+	"github.com/jlcheng/jcllm/llm"
+	"github.com/jlcheng/jcllm/llm/openaimodels"
+	"github.com/jlcheng/jcllm/llm/providers/openai"
+	"github.com/knadh/koanf/v2"
+)
+
+func newProvider(t *testing.T, handler http.HandlerFunc) *openai.Provider {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	config := koanf.New(".")
+	_ = config.Set(keys.OptionHttpTimeout, 5)
+	_ = config.Set(keys.OptionOpenAIApiKey, "test-key")
+	_ = config.Set(keys.OptionOpenAIBaseURL, server.URL+"/v1")
+	return openai.NewProvider(config)
+}
+
+func TestProvider_SolicitResponse_ToolCalls(t *testing.T) {
+	var captured openaimodels.CreateChatCompletionRequest
+	provider := newProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&captured); err != nil {
+			t.Errorf("cannot decode request: %v", err)
+		}
+		chunks := []string{
+			`{"choices":[{"index":0,"delta":{"role":"assistant","tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"read_file","arguments":""}}]}}]}`,
+			`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"path\":"}}]}}]}`,
+			`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"go.mod\"}"}}]}}]}`,
+			`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"id":"call_2","type":"function","function":{"name":"list_directory","arguments":"{}"}}]}}]}`,
+			`{"choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+			`{"choices":[],"usage":{"prompt_tokens":40,"completion_tokens":12,"prompt_tokens_details":{"cached_tokens":32},"completion_tokens_details":{"reasoning_tokens":8}}}`,
+		}
+		for _, chunk := range chunks {
+			_, _ = fmt.Fprintf(w, "data: %s\n\n", chunk)
+		}
+		_, _ = fmt.Fprint(w, "data: [DONE]\n\n")
+	})
+
+	stream, err := provider.SolicitResponse(context.Background(), llm.SolicitResponseInput{
+		ModelName: "gpt-test",
+		Conversation: llm.Conversation{Entries: []llm.ChatEntry{
+			llm.NewTextEntry(llm.RoleUser, "What is in go.mod?"),
+			{Role: llm.RoleAssistant, ToolCalls: []llm.ToolCall{{ID: "call_0", Name: "list_directory", Arguments: "{}"}}},
+			{Role: llm.RoleTool, ToolCallID: "call_0", ToolName: "list_directory", Parts: []llm.Part{llm.TextPart("go.mod")}},
+		}},
+		Tools: []llm.Tool{{
+			Name:        "read_file",
+			Description: "Reads a file",
+			Parameters:  map[string]any{"type": "object", "properties": map[string]any{"path": map[string]any{"type": "string"}}},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("SolicitResponse() error = %v", err)
+	}
+	var toolCalls []llm.ToolCall
+	var usage llm.Usage
+	for message, err := range stream.Messages {
+		if err != nil {
+			t.Fatalf("stream error = %v", err)
+		}
+		toolCalls = append(toolCalls, message.ToolCalls...)
+		usage.Add(message.Usage())
+	}
+
+	wantCalls := []llm.ToolCall{
+		{ID: "call_1", Name: "read_file", Arguments: `{"path":"go.mod"}`},
+		{ID: "call_2", Name: "list_directory", Arguments: "{}"},
+	}
+	if !reflect.DeepEqual(toolCalls, wantCalls) {
+		t.Errorf("tool calls = %+v; want %+v", toolCalls, wantCalls)
+	}
+	if want := (llm.Usage{InputTokens: 40, OutputTokens: 12, CachedTokens: 32, ReasoningTokens: 8}); usage != want {
+		t.Errorf("usage = %+v; want %+v", usage, want)
+	}
+	if len(captured.Tools) != 1 || captured.Tools[0].Type != openai.ToolTypeFunction || captured.Tools[0].Function.Name != "read_file" {
+		t.Errorf("tools = %+v; want the read_file function", captured.Tools)
+	}
+	if len(captured.Messages) != 3 {
+		t.Fatalf("messages = %+v; want 3 messages", captured.Messages)
+	}
+	if got := captured.Messages[1].ToolCalls; len(got) != 1 || got[0].ID != "call_0" || got[0].Function.Name != "list_directory" {
+		t.Errorf("assistant tool calls = %+v; want call_0", got)
+	}
+	if got := captured.Messages[2]; got.Role != openai.RoleTool || got.ToolCallID != "call_0" || got.Content != "go.mod" {
+		t.Errorf("tool message = %+v; want the result of call_0", got)
+	}
+}
+
+func TestProvider_SolicitResponse_Settings(t *testing.T) {
+	var captured map[string]any
+	provider := newProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&captured); err != nil {
+			t.Errorf("cannot decode request: %v", err)
+		}
+		_, _ = fmt.Fprint(w, "data: [DONE]\n\n")
+	})
+
+	var settings llm.GenerationSettings
+	_ = settings.Set(keys.OptionTemperature, "0.2")
+	_ = settings.Set(keys.OptionMaxOutputTokens, "256")
+	_ = settings.Set(keys.OptionStopSequences, "END")
+	_ = settings.Set(keys.OptionReasoningEffort, "low")
+	stream, err := provider.SolicitResponse(context.Background(), llm.SolicitResponseInput{
+		ModelName:    "gpt-test",
+		Conversation: llm.Conversation{Entries: []llm.ChatEntry{llm.NewTextEntry(llm.RoleUser, "Hi")}},
+		Settings:     settings,
+	})
+	if err != nil {
+		t.Fatalf("SolicitResponse() error = %v", err)
+	}
+	for range stream.Messages {
+	}
+
+	want := map[string]any{
+		"temperature":           0.2,
+		"max_completion_tokens": float64(256),
+		"stop":                  []any{"END"},
+		"reasoning_effort":      "low",
+	}
+	for name, value := range want {
+		if !reflect.DeepEqual(captured[name], value) {
+			t.Errorf("%s = %v; want %v", name, captured[name], value)
+		}
+	}
+	for _, name := range []string{"top_p", "seed"} {
+		if _, ok := captured[name]; ok {
+			t.Errorf("unset setting %s should be omitted", name)
+		}
+	}
+}
+
+func TestProvider_SolicitResponse_Attachments(t *testing.T) {
+	var captured openaimodels.CreateChatCompletionRequest
+	provider := newProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&captured); err != nil {
+			t.Errorf("cannot decode request: %v", err)
+		}
+		_, _ = fmt.Fprint(w, "data: [DONE]\n\n")
+	})
+
+	entry := llm.NewTextEntry(llm.RoleUser, "What is this?")
+	entry.Parts = append(entry.Parts,
+		llm.InlinePart("image/png", []byte("png"), "cat.png"),
+		llm.InlinePart("application/pdf", []byte("pdf"), "paper.pdf"))
+	stream, err := provider.SolicitResponse(context.Background(), llm.SolicitResponseInput{
+		ModelName:    "gpt-test",
+		Conversation: llm.Conversation{Entries: []llm.ChatEntry{entry}},
+	})
+	if err != nil {
+		t.Fatalf("SolicitResponse() error = %v", err)
+	}
+	for range stream.Messages {
+	}
+
+	if len(captured.Messages) != 1 {
+		t.Fatalf("got %d messages; want 1", len(captured.Messages))
+	}
+	want := []openaimodels.ContentPart{
+		{Type: "text", Text: "What is this?"},
+		{Type: "image_url", ImageURL: &openaimodels.ImageURL{URL: "data:image/png;base64,cG5n"}},
+		{Type: "file", File: &openaimodels.File{FileData: "data:application/pdf;base64,cGRm", Filename: "paper.pdf"}},
+	}
+	if got := captured.Messages[0].Content; !reflect.DeepEqual(got, want) {
+		t.Errorf("content = %+v; want %+v", got, want)
+	}
+}
+
+func TestProvider_SolicitResponse_ResponseSchema(t *testing.T) {
+	var captured map[string]any
+	provider := newProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&captured); err != nil {
+			t.Errorf("cannot decode request: %v", err)
+		}
+		_, _ = fmt.Fprint(w, "data: [DONE]\n\n")
+	})
+
+	object := func(required []any, properties map[string]any) map[string]any {
+		return map[string]any{"type": "object", "properties": properties, "required": required, "additionalProperties": false}
+	}
+	tests := []struct {
+		name       string
+		schema     map[string]any
+		wantStrict bool
+	}{
+		{
+			name:       "strict",
+			schema:     object([]any{"level", "tags"}, map[string]any{"level": map[string]any{"type": "string"}, "tags": map[string]any{"type": "array", "items": object([]any{"name"}, map[string]any{"name": map[string]any{"type": "string"}})}}),
+			wantStrict: true,
+		},
+		{
+			name:   "optional property",
+			schema: object([]any{"level"}, map[string]any{"level": map[string]any{"type": "string"}, "message": map[string]any{"type": "string"}}),
+		},
+		{
+			name:   "additional properties",
+			schema: map[string]any{"type": "object", "properties": map[string]any{"level": map[string]any{"type": "string"}}, "required": []any{"level"}},
+		},
+		{
+			name:   "nested object with additional properties",
+			schema: object([]any{"tags"}, map[string]any{"tags": map[string]any{"type": "array", "items": map[string]any{"type": "object"}}}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.schema["title"] = "log entry"
+			stream, err := provider.SolicitResponse(context.Background(), llm.SolicitResponseInput{
+				ModelName:      "gpt-test",
+				Conversation:   llm.Conversation{Entries: []llm.ChatEntry{llm.NewTextEntry(llm.RoleUser, "Parse this log")}},
+				ResponseSchema: tt.schema,
+			})
+			if err != nil {
+				t.Fatalf("SolicitResponse() error = %v", err)
+			}
+			for range stream.Messages {
+			}
+
+			// The schema is sent as JSON, so it is compared once decoded like the captured one
+			var schema any
+			data, _ := json.Marshal(tt.schema)
+			_ = json.Unmarshal(data, &schema)
+			want := map[string]any{
+				"type": "json_schema",
+				"json_schema": map[string]any{
+					"name":   "log_entry",
+					"schema": schema,
+					"strict": tt.wantStrict,
+				},
+			}
+			if got := captured["response_format"]; !reflect.DeepEqual(got, want) {
+				t.Errorf("response_format = %v; want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestProvider_SolicitResponse_Cancel(t *testing.T) {
+	provider := newProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, `data: {"choices":[{"index":0,"delta":{"content":"Once upon"}}]}`+"\n\n")
+		w.(http.Flusher).Flush()
+		// Never finish the answer, as a runaway generation would
+		<-r.Context().Done()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := provider.SolicitResponse(ctx, llm.SolicitResponseInput{
+		ModelName:    "gpt-test",
+		Conversation: llm.Conversation{Entries: []llm.ChatEntry{llm.NewTextEntry(llm.RoleUser, "Tell me a story")}},
+	})
+	if err != nil {
+		t.Fatalf("SolicitResponse() error = %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		var streamErr error
+		for message, err := range stream.Messages {
+			if err != nil {
+				streamErr = err
+				break
+			}
+			if message.Text == "Once upon" {
+				cancel()
+			}
+		}
+		done <- streamErr
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("stream error = %v; want %v", err, context.Canceled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream did not stop after the context was cancelled")
+	}
+}
+
+func TestProvider_Embed(t *testing.T) {
+	var captured openaimodels.CreateEmbeddingRequest
+	provider := newProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/embeddings" {
+			t.Errorf("path = %s; want /v1/embeddings", r.URL.Path)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&captured); err != nil {
+			t.Errorf("cannot decode request: %v", err)
+		}
+		// The embeddings are not necessarily in the order of the inputs
+		_, _ = fmt.Fprint(w, `{"object":"list","data":[`+
+			`{"object":"embedding","index":1,"embedding":[0.3,0.4]},`+
+			`{"object":"embedding","index":0,"embedding":[0.1,0.2]}`+
+			`],"model":"text-embedding-3-small"}`)
+	})
+
+	vectors, err := provider.Embed(context.Background(), []string{"first", "second"}, "")
+	if err != nil {
+		t.Fatalf("Embed() error = %v", err)
+	}
+	if want := [][]float32{{0.1, 0.2}, {0.3, 0.4}}; !reflect.DeepEqual(vectors, want) {
+		t.Errorf("vectors = %v; want %v", vectors, want)
+	}
+	want := openaimodels.CreateEmbeddingRequest{
+		Model:          openai.DefaultEmbeddingModel,
+		Input:          []string{"first", "second"},
+		EncodingFormat: "float",
+	}
+	if !reflect.DeepEqual(captured, want) {
+		t.Errorf("request = %+v; want %+v", captured, want)
+	}
+}
+
+func TestProvider_SolicitResponse_SystemPrompt(t *testing.T) {
+	var captured openaimodels.CreateChatCompletionRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&captured); err != nil {
+			t.Errorf("cannot decode request: %v", err)
+		}
+		_, _ = fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(server.Close)
+	config := koanf.New(".")
+	_ = config.Set(keys.OptionHttpTimeout, 5)
+	_ = config.Set(keys.OptionOpenAIApiKey, "test-key")
+	_ = config.Set(keys.OptionOpenAIBaseURL, server.URL+"/v1")
+	_ = config.Set(keys.OptionSystemPrompt, "Be concise.")
+	provider := openai.NewProvider(config)
+
+	tests := []struct {
+		name    string
+		entries []llm.ChatEntry
+		want    string
+	}{
+		{"configured", []llm.ChatEntry{llm.NewTextEntry(llm.RoleUser, "Hi")}, "Be concise."},
+		{"system entry", []llm.ChatEntry{llm.NewTextEntry(llm.RoleSystem, "Talk like a pirate."), llm.NewTextEntry(llm.RoleUser, "Hi")}, "Talk like a pirate."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream, err := provider.SolicitResponse(context.Background(), llm.SolicitResponseInput{
+				ModelName:    "gpt-test",
+				Conversation: llm.Conversation{Entries: tt.entries},
+			})
+			if err != nil {
+				t.Fatalf("SolicitResponse() error = %v", err)
+			}
+			for range stream.Messages {
+			}
+			// The system prompt is the developer message, never a user message
+			want := []openaimodels.Message{{Role: openai.RoleDeveloper, Content: tt.want}, {Role: openai.RoleUser, Content: "Hi"}}
+			if len(captured.Messages) != len(want) {
+				t.Fatalf("messages = %+v; want %+v", captured.Messages, want)
+			}
+			for i, message := range captured.Messages {
+				if message.Role != want[i].Role || message.Content != want[i].Content {
+					t.Errorf("message %d = %+v; want %+v", i, message, want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,277 @@
+// Package providertest is a conformance suite which any llm.ProviderIfc can run against a local stand-in server, to
+// prove offline that it streams, reports usage, maps errors, and stops like the other providers.
+//
+// The stand-in server replays recorded responses, which a provider keeps in its testdata directory. A fixture is a raw
+// HTTP response, as printed by `curl -i`: a status line, headers, a blank line, and the body. Each scenario of the suite
+// replays the fixture of the same name, e.g., testdata/conformance/stream.http, and expects the content described by
+// the Want variables below. Scenarios without a fixture are skipped, as not every API can produce them.
+package providertest
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jlcheng/jcllm/llm"
+)
+
+// The scenarios of the suite, which are also the names of their fixtures.
+const (
+	// ScenarioStream streams WantText in several chunks, followed by WantUsage.
+	ScenarioStream = "stream"
+	// ScenarioEmptyChunks streams WantText and WantUsage, with chunks without content in between.
+	ScenarioEmptyChunks = "empty-chunks"
+	// ScenarioIgnoredLines streams WantText and WantUsage, with the SSE lines which carry no data in between, such as
+	// comments and event names.
+	ScenarioIgnoredLines = "ignored-lines"
+	// ScenarioMalformed streams a chunk of WantText followed by a data line which is not valid JSON.
+	ScenarioMalformed = "malformed"
+	// ScenarioRateLimited fails with status 429 and an error message.
+	ScenarioRateLimited = "rate-limited"
+	// ScenarioUnauthorized fails with status 401 and an error message.
+	ScenarioUnauthorized = "unauthorized"
+	// ScenarioCancel streams the first chunk of WantText, after which the server waits for the client to give up.
+	ScenarioCancel = "cancel"
+	// ScenarioListModels lists WantModels, sorted by name.
+	ScenarioListModels = "list-models"
+)
+
+var (
+	// WantText is the text of the streamed responses.
+	WantText = "The quick brown fox jumps over the lazy dog."
+	// WantUsage is the usage of the streamed responses.
+	WantUsage = llm.Usage{InputTokens: 12, OutputTokens: 10}
+	// WantModels are the names of the listed models, sorted.
+	WantModels = []string{"alpha-model", "beta-model", "gamma-model"}
+)
+
+// timeout bounds how long a scenario waits for the provider, so that a provider which hangs fails instead.
+const timeout = 5 * time.Second
+
+// NewProvider creates the provider under test, which sends its requests to baseURL.
+type NewProvider func(t *testing.T, baseURL string) llm.ProviderIfc
+
+// Run runs every scenario against the provider, with the fixtures of dir.
+func Run(t *testing.T, dir string, newProvider NewProvider) {
+	scenarios := []struct {
+		name string
+		run  func(t *testing.T, provider llm.ProviderIfc)
+	}{
+		{ScenarioStream, testStream},
+		{ScenarioEmptyChunks, testCompleteResponse},
+		{ScenarioIgnoredLines, testCompleteResponse},
+		{ScenarioMalformed, testMalformed},
+		{ScenarioRateLimited, testAPIError(http.StatusTooManyRequests)},
+		{ScenarioUnauthorized, testAPIError(http.StatusUnauthorized)},
+		{ScenarioCancel, testCancel},
+		{ScenarioListModels, testListModels},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			path := filepath.Join(dir, scenario.name+".http")
+			if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+				t.Skipf("no fixture %s", path)
+			}
+			server := NewFixtureServer(t, path, scenario.name == ScenarioCancel)
+			scenario.run(t, newProvider(t, server.URL))
+		})
+	}
+}
+
+// NewFixtureServer starts a server which answers every request with the recorded response of the fixture file. If
+// hold is set, the server keeps the connection open after the body until the client gives up, like a model which is
+// still generating. The server is closed when the test ends.
+func NewFixtureServer(t *testing.T, path string, hold bool) *httptest.Server {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	recorded, err := http.ReadResponse(bufio.NewReader(file), nil)
+	if err != nil {
+		t.Fatalf("cannot read fixture %s: %v", path, err)
+	}
+	body, err := io.ReadAll(recorded.Body)
+	if err != nil {
+		t.Fatalf("cannot read fixture %s: %v", path, err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for name, values := range recorded.Header {
+			w.Header()[name] = values
+		}
+		w.WriteHeader(recorded.StatusCode)
+		_, _ = w.Write(body)
+		if hold {
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func solicit(ctx context.Context, provider llm.ProviderIfc) (llm.ResponseStream, error) {
+	return provider.SolicitResponse(ctx, llm.SolicitResponseInput{
+		ModelName:    "conformance-model",
+		Conversation: llm.Conversation{Entries: []llm.ChatEntry{llm.NewTextEntry(llm.RoleUser, "Type a pangram")}},
+	})
+}
+
+// response is what a provider streamed until the end of the stream or its first error.
+type response struct {
+	texts []string
+	usage llm.Usage
+	err   error
+}
+
+// collect reads the response of the provider. An error of SolicitResponse is reported like an error of the stream, as
+// some providers only send the request when the stream is read.
+func collect(t *testing.T, ctx context.Context, provider llm.ProviderIfc) (llm.ResponseStream, response) {
+	t.Helper()
+	stream, err := solicit(ctx, provider)
+	if err != nil {
+		return stream, response{err: err}
+	}
+	var got response
+	for message, err := range stream.Messages {
+		if err != nil {
+			got.err = err
+			break
+		}
+		if message.Text != "" {
+			got.texts = append(got.texts, message.Text)
+		}
+		got.usage.Add(message.Usage())
+	}
+	return stream, got
+}
+
+func testStream(t *testing.T, provider llm.ProviderIfc) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	stream, got := collect(t, ctx, provider)
+	if got.err != nil {
+		t.Fatalf("error = %v", got.err)
+	}
+	if stream.Role != llm.RoleAssistant {
+		t.Errorf("role = %q; want %q", stream.Role, llm.RoleAssistant)
+	}
+	if len(got.texts) < 2 {
+		t.Errorf("texts = %q; want the text in the chunks it was streamed in", got.texts)
+	}
+	if text := strings.Join(got.texts, ""); text != WantText {
+		t.Errorf("text = %q; want %q", text, WantText)
+	}
+	if got.usage != WantUsage {
+		t.Errorf("usage = %+v; want %+v", got.usage, WantUsage)
+	}
+}
+
+func testCompleteResponse(t *testing.T, provider llm.ProviderIfc) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	_, got := collect(t, ctx, provider)
+	if got.err != nil {
+		t.Fatalf("error = %v", got.err)
+	}
+	if text := strings.Join(got.texts, ""); text != WantText {
+		t.Errorf("text = %q; want %q", text, WantText)
+	}
+	if got.usage != WantUsage {
+		t.Errorf("usage = %+v; want %+v", got.usage, WantUsage)
+	}
+}
+
+func testMalformed(t *testing.T, provider llm.ProviderIfc) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	_, got := collect(t, ctx, provider)
+	if got.err == nil {
+		t.Fatalf("texts = %q; want an error for the malformed line", got.texts)
+	}
+	if text := strings.Join(got.texts, ""); !strings.HasPrefix(WantText, text) || text == "" {
+		t.Errorf("text = %q; want the text before the malformed line", text)
+	}
+}
+
+func testAPIError(statusCode int) func(t *testing.T, provider llm.ProviderIfc) {
+	return func(t *testing.T, provider llm.ProviderIfc) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		_, got := collect(t, ctx, provider)
+		var apiErr *llm.APIError
+		if !errors.As(got.err, &apiErr) {
+			t.Fatalf("error = %v; want an llm.APIError", got.err)
+		}
+		if apiErr.StatusCode != statusCode {
+			t.Errorf("status code = %d; want %d", apiErr.StatusCode, statusCode)
+		}
+		if apiErr.Message == "" {
+			t.Error("message is empty; want the message of the error response")
+		}
+		if len(got.texts) != 0 {
+			t.Errorf("texts = %q; want none", got.texts)
+		}
+	}
+}
+
+func testCancel(t *testing.T, provider llm.ProviderIfc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := solicit(ctx, provider)
+	if err != nil {
+		t.Fatalf("SolicitResponse() error = %v", err)
+	}
+	done := make(chan response, 1)
+	go func() {
+		var got response
+		for message, err := range stream.Messages {
+			if err != nil {
+				got.err = err
+				break
+			}
+			if message.Text != "" {
+				got.texts = append(got.texts, message.Text)
+				cancel()
+			}
+		}
+		done <- got
+	}()
+	select {
+	case got := <-done:
+		if !errors.Is(got.err, context.Canceled) {
+			t.Errorf("error = %v; want %v", got.err, context.Canceled)
+		}
+		if len(got.texts) != 1 {
+			t.Errorf("texts = %q; want the first chunk only", got.texts)
+		}
+	case <-time.After(timeout):
+		t.Fatal("the stream did not stop after the context was cancelled")
+	}
+}
+
+func testListModels(t *testing.T, provider llm.ProviderIfc) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	models, err := provider.ListModels(ctx)
+	if err != nil {
+		t.Fatalf("ListModels() error = %v", err)
+	}
+	var names []string
+	for _, model := range models {
+		names = append(names, model.Name)
+	}
+	if !slices.Equal(names, WantModels) {
+		t.Errorf("models = %q; want %q, sorted by name", names, WantModels)
+	}
+}
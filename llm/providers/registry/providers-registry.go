@@ -3,21 +3,67 @@ package registry
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/jlcheng/jcllm/configuration"
 	"github.com/jlcheng/jcllm/configuration/keys"
 	"github.com/jlcheng/jcllm/llm"
+	"github.com/jlcheng/jcllm/llm/providers/anthropic"
+	"github.com/jlcheng/jcllm/llm/providers/cassette"
 	"github.com/jlcheng/jcllm/llm/providers/googlegenai"
+	"github.com/jlcheng/jcllm/llm/providers/ollama"
 	"github.com/jlcheng/jcllm/llm/providers/openai"
+	"github.com/jlcheng/jcllm/llm/providers/retry"
+	"github.com/jlcheng/jcllm/llm/providers/router"
+	"github.com/jlcheng/jcllm/log"
 )
 
+// NewProvider creates the provider of the given name. Its exchanges are recorded to the cassette of the configuration,
+// if set, unless it replays them.
 func NewProvider(ctx context.Context, configuration configuration.Configuration, name string) (llm.ProviderIfc, error) {
+	provider, err := newProvider(ctx, configuration, name)
+	if err != nil {
+		return nil, err
+	}
+	if configuration.String(keys.OptionCassette) != "" && name != keys.ProviderReplay {
+		return cassette.Record(configuration, provider, name), nil
+	}
+	return provider, nil
+}
+
+func newProvider(ctx context.Context, configuration configuration.Configuration, name string) (llm.ProviderIfc, error) {
+	var provider llm.ProviderIfc
 	switch name {
+	case keys.ProviderAnthropic:
+		provider = anthropic.NewProvider(configuration)
 	case keys.ProviderGemini:
-		return googlegenai.NewProvider(configuration), nil
+		provider = googlegenai.NewProvider(configuration)
+	case keys.ProviderOllama:
+		provider = ollama.NewProvider(configuration)
 	case keys.ProviderOpenAI:
-		return openai.NewProvider(configuration), nil
+		provider = openai.NewProvider(configuration)
+	case keys.ProviderRouter:
+		// The providers of the targets retry on their own
+		routerProvider, err := router.NewProvider(configuration, func(name string) (llm.ProviderIfc, error) {
+			return newProvider(ctx, configuration, name)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return routerProvider, nil
+	case keys.ProviderReplay:
+		player, err := cassette.NewPlayer(configuration)
+		if err != nil {
+			return nil, err
+		}
+		return player, nil
 	default:
 		return nil, fmt.Errorf("unknown provider: %s", name)
 	}
+	policy := retry.DefaultPolicy(configuration.Int(keys.OptionRetryMaxAttempts))
+	logger := log.New(configuration.String(keys.OptionLogFile))
+	policy.OnRetry = func(attempt int, delay time.Duration, err error) {
+		logger.Debugf("%s attempt %d failed, retrying in %v: %v\n", name, attempt, delay, err)
+	}
+	return retry.Wrap(provider, policy), nil
 }
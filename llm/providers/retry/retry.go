@@ -0,0 +1,260 @@
+package retry
+
+import (
+	"context"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/jlcheng/jcllm/llm"
+)
+
+// Policy controls how often and how long a failed request is retried.
+type Policy struct {
+	// MaxAttempts is the number of attempts, including the first one. 1 or less disables retries.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry, which doubles on every following retry.
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between attempts. A request whose provider asks to wait longer is not retried.
+	MaxDelay time.Duration
+	// OnRetry, if set, is called before waiting for the next attempt.
+	OnRetry func(attempt int, delay time.Duration, err error)
+}
+
+// DefaultPolicy returns a policy with the given maximum number of attempts, which waits about 1, 2, 4, ... seconds
+// between them.
+func DefaultPolicy(maxAttempts int) Policy {
+	return Policy{
+		MaxAttempts: maxAttempts,
+		BaseDelay:   time.Second,
+		MaxDelay:    time.Minute,
+	}
+}
+
+// Provider retries the requests of another provider which fail with a transient error, such as a rate limit, an
+// overloaded server, or a reset connection. A response is only retried until its first text or tool call was yielded,
+// since the caller may have shown it already.
+type Provider struct {
+	llm.ProviderIfc
+	policy Policy
+}
+
+// pullingProvider keeps the llm.ModelPuller of the wrapped provider visible to type assertions.
+type pullingProvider struct {
+	*Provider
+	llm.ModelPuller
+}
+
+// embeddingProvider retries the embeddings of the wrapped provider, too.
+type embeddingProvider struct {
+	*Provider
+	embedder llm.Embedder
+}
+
+// pullingEmbeddingProvider is an embeddingProvider which keeps the llm.ModelPuller of the wrapped provider visible as
+// well, for providers such as ollama which implement both.
+type pullingEmbeddingProvider struct {
+	*embeddingProvider
+	llm.ModelPuller
+}
+
+// Wrap returns provider with retries, or provider itself when the policy disables them.
+func Wrap(provider llm.ProviderIfc, policy Policy) llm.ProviderIfc {
+	if policy.MaxAttempts <= 1 {
+		return provider
+	}
+	wrapped := &Provider{ProviderIfc: provider, policy: policy}
+	puller, pulls := provider.(llm.ModelPuller)
+	embedder, embeds := provider.(llm.Embedder)
+	switch {
+	case pulls && embeds:
+		return &pullingEmbeddingProvider{embeddingProvider: &embeddingProvider{Provider: wrapped, embedder: embedder}, ModelPuller: puller}
+	case pulls:
+		return &pullingProvider{Provider: wrapped, ModelPuller: puller}
+	case embeds:
+		return &embeddingProvider{Provider: wrapped, embedder: embedder}
+	}
+	return wrapped
+}
+
+func (p *Provider) ListModels(ctx context.Context) ([]llm.ModelInfo, error) {
+	for attempt := 1; ; attempt++ {
+		models, err := p.ProviderIfc.ListModels(ctx)
+		if err == nil {
+			return models, nil
+		}
+		if waitErr := p.wait(ctx, attempt, err); waitErr != nil {
+			return nil, waitErr
+		}
+	}
+}
+
+func (p *embeddingProvider) Embed(ctx context.Context, texts []string, modelName string) ([][]float32, error) {
+	for attempt := 1; ; attempt++ {
+		vectors, err := p.embedder.Embed(ctx, texts, modelName)
+		if err == nil {
+			return vectors, nil
+		}
+		if waitErr := p.wait(ctx, attempt, err); waitErr != nil {
+			return nil, waitErr
+		}
+	}
+}
+
+func (p *Provider) SolicitResponse(ctx context.Context, input llm.SolicitResponseInput) (llm.ResponseStream, error) {
+	attempt := 1
+	response, err := p.solicit(ctx, input, &attempt)
+	if err != nil {
+		return llm.ResponseStream{}, err
+	}
+	messages := response.Messages
+	response.Messages = func(yield func(llm.Message, error) bool) {
+		// Messages without content, such as usage reports, are held back until the first content. A retried response
+		// reports its usage again.
+		var pending []llm.Message
+		started := false
+		for {
+			var streamErr error
+			for message, err := range messages {
+				if err != nil {
+					streamErr = err
+					break
+				}
+				if !started && message.Text == "" && len(message.ToolCalls) == 0 {
+					pending = append(pending, message)
+					continue
+				}
+				if !started {
+					started = true
+					for _, held := range pending {
+						if !yield(held, nil) {
+							return
+						}
+					}
+				}
+				if !yield(message, nil) {
+					return
+				}
+			}
+			if streamErr == nil {
+				break
+			}
+			if started {
+				yield(llm.Message{}, streamErr)
+				return
+			}
+			if waitErr := p.wait(ctx, attempt, streamErr); waitErr != nil {
+				yield(llm.Message{}, waitErr)
+				return
+			}
+			attempt++
+			pending = nil
+			retried, err := p.solicit(ctx, input, &attempt)
+			if err != nil {
+				yield(llm.Message{}, err)
+				return
+			}
+			messages = retried.Messages
+		}
+		for _, held := range pending {
+			if !yield(held, nil) {
+				return
+			}
+		}
+	}
+	return response, nil
+}
+
+// solicit calls the wrapped provider until it returns a response stream, starting at the given attempt. The attempt is
+// advanced past the retries.
+func (p *Provider) solicit(ctx context.Context, input llm.SolicitResponseInput, attempt *int) (llm.ResponseStream, error) {
+	for ; ; *attempt++ {
+		// Providers may rewrite the entries, e.g., Gemini removes the mentions of the last one
+		attemptInput := input
+		attemptInput.Conversation.Entries = slices.Clone(input.Conversation.Entries)
+		response, err := p.ProviderIfc.SolicitResponse(ctx, attemptInput)
+		if err == nil {
+			return response, nil
+		}
+		if waitErr := p.wait(ctx, *attempt, err); waitErr != nil {
+			return llm.ResponseStream{}, waitErr
+		}
+	}
+}
+
+// wait sleeps before the next attempt. It returns the error to give up with when err is not retryable, the attempts are
+// exhausted, the provider asks to wait longer than the policy allows, or the context is done.
+func (p *Provider) wait(ctx context.Context, attempt int, err error) error {
+	if attempt >= p.policy.MaxAttempts || !Retryable(err) {
+		return err
+	}
+	delay := p.delay(attempt)
+	var apiErr *llm.APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		if apiErr.RetryAfter > p.policy.MaxDelay {
+			return err
+		}
+		delay = apiErr.RetryAfter
+	}
+	if p.policy.OnRetry != nil {
+		p.policy.OnRetry(attempt, delay, err)
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return errors.WrapPrefix(ctx.Err(), "retry cancelled", 0)
+	case <-timer.C:
+		return nil
+	}
+}
+
+// delay is the exponential backoff after the given attempt, with jitter, so that clients which failed together do not
+// retry together.
+func (p *Provider) delay(attempt int) time.Duration {
+	backoff := p.policy.MaxDelay
+	if shift := attempt - 1; shift < 32 {
+		backoff = min(p.policy.BaseDelay<<shift, p.policy.MaxDelay)
+	}
+	if backoff <= 0 {
+		return 0
+	}
+	return backoff/2 + rand.N(backoff/2+1)
+}
+
+// Retryable reports whether err is transient: a rate limit, a timeout or an error of the server, or a dropped
+// connection. Cancellations are never retryable.
+func Retryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var apiErr *llm.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusRequestTimeout || apiErr.StatusCode == http.StatusTooManyRequests ||
+			apiErr.StatusCode >= 500
+	}
+	// Nothing listens on the address, e.g., Ollama is not running, which waiting rarely fixes
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return false
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTemporary || dnsErr.IsTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr)
+}
+
+var _ llm.ProviderIfc = (*Provider)(nil)
@@ -0,0 +1,240 @@
+package retry_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jlcheng/jcllm/configuration/keys"
+	"github.com/jlcheng/jcllm/llm"
+	"github.com/jlcheng/jcllm/llm/providers/openai"
+	"github.com/jlcheng/jcllm/llm/providers/retry"
+	"github.com/knadh/koanf/v2"
+)
+
+// newServer starts an OpenAI-compatible server which answers the n-th request with failures[n], or with a streamed
+// "hello" once the failures are exhausted. It returns the provider for the server and the number of requests.
+func newServer(t *testing.T, failures ...func(w http.ResponseWriter)) (*openai.Provider, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(requests.Add(1)) - 1
+		if n < len(failures) {
+			failures[n](w)
+			return
+		}
+		_, _ = fmt.Fprint(w, `data: {"choices":[{"index":0,"delta":{"role":"assistant","content":"hello"}}]}`+"\n\n")
+		_, _ = fmt.Fprint(w, `data: {"choices":[],"usage":{"prompt_tokens":3,"completion_tokens":1}}`+"\n\n")
+		_, _ = fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(server.Close)
+	config := koanf.New(".")
+	_ = config.Set(keys.OptionHttpTimeout, 5)
+	_ = config.Set(keys.OptionOpenAIApiKey, "test-key")
+	_ = config.Set(keys.OptionOpenAIBaseURL, server.URL+"/v1")
+	return openai.NewProvider(config), &requests
+}
+
+func fail(status int, header ...string) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		for i := 0; i+1 < len(header); i += 2 {
+			w.Header().Set(header[i], header[i+1])
+		}
+		w.WriteHeader(status)
+		_, _ = fmt.Fprintf(w, `{"error":{"message":"injected %d"}}`, status)
+	}
+}
+
+func collect(provider llm.ProviderIfc) (string, llm.Usage, error) {
+	stream, err := provider.SolicitResponse(context.Background(), llm.SolicitResponseInput{
+		ModelName:    "gpt-test",
+		Conversation: llm.Conversation{Entries: []llm.ChatEntry{llm.NewTextEntry(llm.RoleUser, "hi")}},
+	})
+	if err != nil {
+		return "", llm.Usage{}, err
+	}
+	var text strings.Builder
+	var usage llm.Usage
+	for message, err := range stream.Messages {
+		if err != nil {
+			return text.String(), usage, err
+		}
+		text.WriteString(message.Text)
+		usage.Add(message.Usage())
+	}
+	return text.String(), usage, nil
+}
+
+func TestProvider_SolicitResponse(t *testing.T) {
+	tests := []struct {
+		name         string
+		failures     []func(w http.ResponseWriter)
+		wantRequests int32
+		wantStatus   int
+		wantDelay    time.Duration
+	}{
+		{
+			name:         "retries rate limits and server errors",
+			failures:     []func(w http.ResponseWriter){fail(429, "retry-after-ms", "20"), fail(503), fail(529)},
+			wantRequests: 4,
+			wantDelay:    20 * time.Millisecond,
+		},
+		{
+			name:         "gives up after the max attempts",
+			failures:     []func(w http.ResponseWriter){fail(500), fail(502), fail(503), fail(504)},
+			wantRequests: 4,
+			wantStatus:   504,
+		},
+		{
+			name:         "does not retry client errors",
+			failures:     []func(w http.ResponseWriter){fail(400)},
+			wantRequests: 1,
+			wantStatus:   400,
+		},
+		{
+			name:         "does not wait longer than the max delay",
+			failures:     []func(w http.ResponseWriter){fail(429, "Retry-After", "120")},
+			wantRequests: 1,
+			wantStatus:   429,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, requests := newServer(t, tt.failures...)
+			var delays []time.Duration
+			policy := retry.Policy{
+				MaxAttempts: 4,
+				BaseDelay:   time.Millisecond,
+				MaxDelay:    time.Second,
+				OnRetry: func(attempt int, delay time.Duration, err error) {
+					delays = append(delays, delay)
+				},
+			}
+			text, usage, err := collect(retry.Wrap(provider, policy))
+
+			if got := requests.Load(); got != tt.wantRequests {
+				t.Errorf("requests = %d; want %d", got, tt.wantRequests)
+			}
+			if tt.wantStatus != 0 {
+				var apiErr *llm.APIError
+				if !errors.As(err, &apiErr) || apiErr.StatusCode != tt.wantStatus {
+					t.Fatalf("error = %v; want an API error with status %d", err, tt.wantStatus)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			if text != "hello" || usage != (llm.Usage{InputTokens: 3, OutputTokens: 1}) {
+				t.Errorf("response = %q, %+v; want hello once", text, usage)
+			}
+			if len(delays) != int(tt.wantRequests)-1 || delays[0] != tt.wantDelay {
+				t.Errorf("delays = %v; want %d retries, the first after %v", delays, tt.wantRequests-1, tt.wantDelay)
+			}
+		})
+	}
+}
+
+// stubProvider streams the messages of its responses in turn, each ending with its error.
+type stubProvider struct {
+	llm.ProviderIfc
+	responses []stubResponse
+	calls     int
+}
+
+type stubResponse struct {
+	messages []llm.Message
+	err      error
+}
+
+func (p *stubProvider) SolicitResponse(_ context.Context, _ llm.SolicitResponseInput) (llm.ResponseStream, error) {
+	response := p.responses[p.calls]
+	p.calls++
+	return llm.ResponseStream{Messages: func(yield func(llm.Message, error) bool) {
+		for _, message := range response.messages {
+			if !yield(message, nil) {
+				return
+			}
+		}
+		if response.err != nil {
+			yield(llm.Message{}, response.err)
+		}
+	}}, nil
+}
+
+func TestProvider_SolicitResponse_Stream(t *testing.T) {
+	overloaded := &llm.APIError{StatusCode: 529, Message: "overloaded"}
+	policy := retry.Policy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Second}
+
+	// An error before any content is retried, and the usage of the failed attempt is dropped
+	stub := &stubProvider{responses: []stubResponse{
+		{messages: []llm.Message{{InputTokenCount: 7}}, err: overloaded},
+		{messages: []llm.Message{{Text: "hello"}, {InputTokenCount: 3, TokenCount: 1}}},
+	}}
+	text, usage, err := collect(retry.Wrap(stub, policy))
+	if err != nil || text != "hello" || usage != (llm.Usage{InputTokens: 3, OutputTokens: 1}) || stub.calls != 2 {
+		t.Errorf("collect() = %q, %+v, %v after %d calls; want hello after 2 calls", text, usage, err, stub.calls)
+	}
+
+	// An error after content was yielded is never retried
+	stub = &stubProvider{responses: []stubResponse{
+		{messages: []llm.Message{{Text: "hel"}}, err: overloaded},
+		{messages: []llm.Message{{Text: "hello"}}},
+	}}
+	text, _, err = collect(retry.Wrap(stub, policy))
+	if !errors.Is(err, overloaded) || text != "hel" || stub.calls != 1 {
+		t.Errorf("collect() = %q, %v after %d calls; want the partial text and the error after 1 call", text, err, stub.calls)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&llm.APIError{StatusCode: 429}, true},
+		{&llm.APIError{StatusCode: 500}, true},
+		{&llm.APIError{StatusCode: 401}, false},
+		{fmt.Errorf("read: %w", context.Canceled), false},
+		{errors.New("invalid json"), false},
+	}
+	for _, tt := range tests {
+		if got := retry.Retryable(tt.err); got != tt.want {
+			t.Errorf("Retryable(%v) = %v; want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+// pullingEmbedder implements both optional interfaces, as ollama does.
+type pullingEmbedder struct {
+	llm.ProviderIfc
+}
+
+func (pullingEmbedder) PullModel(context.Context, string) (iter.Seq2[llm.PullProgress, error], error) {
+	return nil, nil
+}
+
+func (pullingEmbedder) Embed(context.Context, []string, string) ([][]float32, error) {
+	return [][]float32{{1}}, nil
+}
+
+func TestWrap_OptionalInterfaces(t *testing.T) {
+	wrapped := retry.Wrap(pullingEmbedder{}, retry.DefaultPolicy(3))
+	if _, ok := wrapped.(llm.ModelPuller); !ok {
+		t.Error("Wrap() hides the ModelPuller of the provider")
+	}
+	embedder, ok := wrapped.(llm.Embedder)
+	if !ok {
+		t.Fatal("Wrap() hides the Embedder of the provider")
+	}
+	if vectors, err := embedder.Embed(context.Background(), []string{"hi"}, ""); err != nil || len(vectors) != 1 {
+		t.Errorf("Embed() = %v, %v; want the vectors of the provider", vectors, err)
+	}
+}
@@ -0,0 +1,335 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/go-errors/errors"
+	"github.com/jlcheng/jcllm/configuration"
+	"github.com/jlcheng/jcllm/configuration/keys"
+	"github.com/jlcheng/jcllm/extract"
+	"github.com/jlcheng/jcllm/llm"
+	"github.com/jlcheng/jcllm/llm/providers/retry"
+	"github.com/jlcheng/jcllm/log"
+)
+
+// Target is a model of a provider.
+type Target struct {
+	Provider string
+	Model    string
+}
+
+func (t Target) String() string {
+	return t.Provider + "/" + t.Model
+}
+
+// Route sends the prompts which match all of its conditions to its target. A route without conditions matches every
+// prompt.
+type Route struct {
+	Target
+	// Mention matches prompts which end with the mention, e.g., "cheap" for "... @cheap". The mention is removed before
+	// the prompt is sent.
+	Mention string
+	// MinPromptLength and MaxPromptLength bound the number of characters of the conversation. 0 means no bound.
+	MinPromptLength int
+	MaxPromptLength int
+}
+
+// Provider sends each request to the target of the first matching route, and falls back to the next target of its
+// fallback chain when a target fails because of its quota, its credentials, or its availability.
+type Provider struct {
+	config    configuration.Configuration
+	routes    []Route
+	fallbacks []Target
+	// newProvider creates the provider of a target by name.
+	newProvider func(name string) (llm.ProviderIfc, error)
+	providers   map[string]llm.ProviderIfc
+	mutex       sync.Mutex
+	logger      *log.Logger
+}
+
+// NewProvider creates a router from the `[[router-routes]]` and `[[router-fallbacks]]` tables of the configuration.
+func NewProvider(config configuration.Configuration, newProvider func(name string) (llm.ProviderIfc, error)) (*Provider, error) {
+	p := &Provider{
+		config:      config,
+		newProvider: newProvider,
+		providers:   make(map[string]llm.ProviderIfc),
+		logger:      log.New(config.String(keys.OptionLogFile)),
+	}
+	for _, table := range configuration.Tables(config, keys.OptionRouterRoutes) {
+		route, err := toRoute(table)
+		if err != nil {
+			return nil, errors.WrapPrefix(err, fmt.Sprintf("invalid %s", keys.OptionRouterRoutes), 0)
+		}
+		p.routes = append(p.routes, route)
+	}
+	for _, table := range configuration.Tables(config, keys.OptionRouterFallbacks) {
+		route, err := toRoute(table)
+		if err == nil && (route.Mention != "" || route.MinPromptLength != 0 || route.MaxPromptLength != 0) {
+			err = errors.Errorf("only provider and model are allowed")
+		}
+		if err != nil {
+			return nil, errors.WrapPrefix(err, fmt.Sprintf("invalid %s", keys.OptionRouterFallbacks), 0)
+		}
+		p.fallbacks = append(p.fallbacks, route.Target)
+	}
+	if len(p.routes) == 0 && len(p.fallbacks) == 0 {
+		return nil, errors.Errorf("the %s provider needs [[%s]] or [[%s]] in the configuration file",
+			keys.ProviderRouter, keys.OptionRouterRoutes, keys.OptionRouterFallbacks)
+	}
+	return p, nil
+}
+
+func (p *Provider) ToProviderRole(genericRole string) (providerRole string) {
+	return genericRole
+}
+
+func (p *Provider) ToGenericRole(providerRole string) (genericRole string) {
+	return providerRole
+}
+
+// ListModels lists the targets of the routes and the fallback chain.
+func (p *Provider) ListModels(_ context.Context) ([]llm.ModelInfo, error) {
+	var models []llm.ModelInfo
+	for _, target := range p.targets(p.routes...) {
+		models = append(models, llm.ModelInfo{
+			Name:        target.Model,
+			DisplayName: target.String(),
+			Description: fmt.Sprintf("%s, served by %s", target.Model, target.Provider),
+		})
+	}
+	return models, nil
+}
+
+// SolicitResponse ignores the model name of the input, as the targets name their models. Each target is sent its
+// configured settings, overridden by the overrides of the input. The provider and model which answered are set on the
+// response. A target which fails before the first content of its response falls back to the next one, so this waits
+// for the first content before it returns. Cancel ctx to release a response which is not read to its end.
+func (p *Provider) SolicitResponse(ctx context.Context, input llm.SolicitResponseInput) (llm.ResponseStream, error) {
+	input.Conversation.Entries = slices.Clone(input.Conversation.Entries)
+	targets := p.route(&input)
+	for i, target := range targets {
+		response, err := p.solicit(ctx, target, input)
+		if err == nil {
+			return response, nil
+		}
+		if i == len(targets)-1 || ctx.Err() != nil || !ShouldFallBack(err) {
+			return llm.ResponseStream{}, errors.WrapPrefix(err, target.String()+" failed", 0)
+		}
+		p.logger.Debugf("%s failed, falling back to %s: %v\n", target, targets[i+1], err)
+	}
+	return llm.ResponseStream{}, errors.Errorf("no route matches the prompt, add [[%s]] to the configuration file", keys.OptionRouterFallbacks)
+}
+
+func (p *Provider) solicit(ctx context.Context, target Target, input llm.SolicitResponseInput) (llm.ResponseStream, error) {
+	provider, err := p.provider(target.Provider)
+	if err != nil {
+		return llm.ResponseStream{}, err
+	}
+	settings, err := llm.SettingsFromConfig(p.config, target.Model)
+	if err != nil {
+		return llm.ResponseStream{}, err
+	}
+	input.ModelName = target.Model
+	input.Settings = settings.Merge(input.Overrides)
+	input.Conversation.Entries = slices.Clone(input.Conversation.Entries)
+	response, err := provider.SolicitResponse(ctx, input)
+	if err != nil {
+		return llm.ResponseStream{}, err
+	}
+	if response.Messages, err = peek(ctx, response.Messages); err != nil {
+		return llm.ResponseStream{}, err
+	}
+	response.Provider = target.Provider
+	response.Model = target.Model
+	return response, nil
+}
+
+func (p *Provider) provider(name string) (llm.ProviderIfc, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if provider, ok := p.providers[name]; ok {
+		return provider, nil
+	}
+	if name == keys.ProviderRouter {
+		return nil, errors.Errorf("the %s provider cannot route to itself", keys.ProviderRouter)
+	}
+	provider, err := p.newProvider(name)
+	if err != nil {
+		return nil, err
+	}
+	p.providers[name] = provider
+	return provider, nil
+}
+
+// route returns the targets to try in order: the target of the first matching route, followed by the fallback chain.
+// The mention of a matching route is removed from the input.
+func (p *Provider) route(input *llm.SolicitResponseInput) []Target {
+	entries := input.Conversation.Entries
+	var text string
+	var mentions []string
+	if n := len(entries); n > 0 && entries[n-1].Role == llm.RoleUser && !input.SuppressMentions {
+		text, mentions = extract.MentionsFromEnd(entries[n-1].Text())
+	}
+	length := 0
+	for _, entry := range entries {
+		length += utf8.RuneCountInString(entry.Text())
+	}
+	for _, route := range p.routes {
+		if route.MinPromptLength > 0 && length < route.MinPromptLength ||
+			route.MaxPromptLength > 0 && length > route.MaxPromptLength {
+			continue
+		}
+		if route.Mention == "" {
+			return p.targets(route)
+		}
+		if idx := slices.Index(mentions, route.Mention); idx >= 0 {
+			// The other mentions, such as @ground, are kept for the target
+			text = strings.TrimSpace(text)
+			for _, mention := range slices.Delete(mentions, idx, idx+1) {
+				text += " @" + mention
+			}
+			entries[len(entries)-1].SetText(text)
+			return p.targets(route)
+		}
+	}
+	return p.targets()
+}
+
+// targets lists the targets of the routes followed by the fallback chain, without duplicates.
+func (p *Provider) targets(routes ...Route) []Target {
+	var targets []Target
+	add := func(target Target) {
+		if !slices.Contains(targets, target) {
+			targets = append(targets, target)
+		}
+	}
+	for _, route := range routes {
+		add(route.Target)
+	}
+	for _, target := range p.fallbacks {
+		add(target)
+	}
+	return targets
+}
+
+// peek reads the messages up to the first one with content. It returns the error of the stream if it fails before
+// then, or else a stream of all the messages. Reading ahead runs messages in a goroutine until the stream is read to
+// its end, or until ctx is cancelled when the caller abandons the stream.
+func peek(ctx context.Context, messages iter.Seq2[llm.Message, error]) (iter.Seq2[llm.Message, error], error) {
+	next, stop := iter.Pull2(messages)
+	// next and stop must not run concurrently, which the cancellation of ctx could cause
+	var mutex sync.Mutex
+	pull := func() (llm.Message, error, bool) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return next()
+	}
+	halt := func() {
+		mutex.Lock()
+		defer mutex.Unlock()
+		stop()
+	}
+	var pending []llm.Message
+	for {
+		message, err, ok := pull()
+		if !ok {
+			break
+		}
+		if err != nil {
+			halt()
+			return nil, err
+		}
+		pending = append(pending, message)
+		if message.Text != "" || len(message.ToolCalls) != 0 {
+			break
+		}
+	}
+	stopOnCancel := context.AfterFunc(ctx, halt)
+	return func(yield func(llm.Message, error) bool) {
+		defer halt()
+		defer stopOnCancel()
+		for _, message := range pending {
+			if !yield(message, nil) {
+				return
+			}
+		}
+		for {
+			message, err, ok := pull()
+			if !ok || !yield(message, err) {
+				return
+			}
+		}
+	}, nil
+}
+
+// ShouldFallBack reports whether a target which failed with err should fall back to the next one: the errors which
+// retries did not fix, or which a retry cannot fix, such as an invalid API key or an unknown model.
+func ShouldFallBack(err error) bool {
+	if retry.Retryable(err) {
+		return true
+	}
+	var apiErr *llm.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusUnauthorized, http.StatusPaymentRequired, http.StatusForbidden, http.StatusNotFound:
+			return true
+		}
+		return false
+	}
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	return errors.As(err, &opErr) || errors.As(err, &dnsErr)
+}
+
+func toRoute(table map[string]any) (Route, error) {
+	var route Route
+	for name, value := range table {
+		var err error
+		switch name {
+		case "provider":
+			route.Provider = fmt.Sprint(value)
+		case "model":
+			route.Model = fmt.Sprint(value)
+		case "mention":
+			route.Mention = strings.TrimPrefix(fmt.Sprint(value), "@")
+		case "min-prompt-length":
+			route.MinPromptLength, err = toLength(value)
+		case "max-prompt-length":
+			route.MaxPromptLength, err = toLength(value)
+		default:
+			err = errors.Errorf("unknown key %q, expected provider, model, mention, min-prompt-length, or max-prompt-length", name)
+		}
+		if err != nil {
+			return Route{}, err
+		}
+	}
+	if route.Provider == "" || route.Model == "" {
+		return Route{}, errors.Errorf("every table needs a provider and a model")
+	}
+	return route, nil
+}
+
+// toLength accepts the integers of the configuration file, which are int64.
+func toLength(value any) (int, error) {
+	switch v := value.(type) {
+	case int64:
+		if v >= 0 {
+			return int(v), nil
+		}
+	case int:
+		if v >= 0 {
+			return v, nil
+		}
+	}
+	return 0, errors.Errorf("%v is not a length", value)
+}
+
+var _ llm.ProviderIfc = (*Provider)(nil)
@@ -0,0 +1,276 @@
+package router_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jlcheng/jcllm/configuration/keys"
+	"github.com/jlcheng/jcllm/llm"
+	"github.com/jlcheng/jcllm/llm/providers/router"
+	"github.com/knadh/koanf/parsers/toml"
+	"github.com/knadh/koanf/providers/file"
+	"github.com/knadh/koanf/v2"
+)
+
+const routerConfig = `
+[[router-routes]]
+mention = "smart"
+provider = "anthropic"
+model = "claude"
+
+[[router-routes]]
+min-prompt-length = 100
+provider = "gemini"
+model = "gemini-pro"
+
+[[router-fallbacks]]
+provider = "gemini"
+model = "gemini-flash"
+
+[[router-fallbacks]]
+provider = "openai"
+model = "gpt-mini"
+`
+
+// stubProvider answers with the model name, or fails with the error set for the model.
+type stubProvider struct {
+	llm.ProviderIfc
+	name     string
+	errs     map[string]error
+	requests *[]string
+	prompts  *[]string
+}
+
+func (p *stubProvider) SolicitResponse(_ context.Context, input llm.SolicitResponseInput) (llm.ResponseStream, error) {
+	entries := input.Conversation.Entries
+	*p.requests = append(*p.requests, p.name+"/"+input.ModelName)
+	*p.prompts = append(*p.prompts, entries[len(entries)-1].Text())
+	err := p.errs[input.ModelName]
+	return llm.ResponseStream{Role: llm.RoleAssistant, Messages: func(yield func(llm.Message, error) bool) {
+		if err != nil {
+			yield(llm.Message{}, err)
+			return
+		}
+		yield(llm.Message{Text: input.ModelName}, nil)
+	}}, nil
+}
+
+func newRouter(t *testing.T, errs map[string]error) (*router.Provider, *[]string, *[]string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "jcllm.toml")
+	if err := os.WriteFile(path, []byte(routerConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := koanf.New(".")
+	if err := config.Load(file.Provider(path), toml.Parser()); err != nil {
+		t.Fatal(err)
+	}
+	var requests, prompts []string
+	provider, err := router.NewProvider(config, func(name string) (llm.ProviderIfc, error) {
+		return &stubProvider{name: name, errs: errs, requests: &requests, prompts: &prompts}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provider, &requests, &prompts
+}
+
+func TestProvider_SolicitResponse(t *testing.T) {
+	quota := &llm.APIError{StatusCode: 429, Message: "quota exceeded"}
+	tests := []struct {
+		name         string
+		prompt       string
+		errs         map[string]error
+		wantRequests []string
+		wantPrompt   string
+		wantErr      error
+	}{
+		{
+			name:         "uses the first fallback",
+			prompt:       "hi",
+			wantRequests: []string{"gemini/gemini-flash"},
+			wantPrompt:   "hi",
+		},
+		{
+			name:         "falls back when the quota runs out",
+			prompt:       "hi",
+			errs:         map[string]error{"gemini-flash": quota},
+			wantRequests: []string{"gemini/gemini-flash", "openai/gpt-mini"},
+			wantPrompt:   "hi",
+		},
+		{
+			name:         "falls back on invalid credentials",
+			prompt:       "hi",
+			errs:         map[string]error{"gemini-flash": &llm.APIError{StatusCode: 401}},
+			wantRequests: []string{"gemini/gemini-flash", "openai/gpt-mini"},
+			wantPrompt:   "hi",
+		},
+		{
+			name:         "does not fall back on invalid requests",
+			prompt:       "hi",
+			errs:         map[string]error{"gemini-flash": &llm.APIError{StatusCode: 400}},
+			wantRequests: []string{"gemini/gemini-flash"},
+			wantErr:      &llm.APIError{StatusCode: 400},
+		},
+		{
+			name:         "fails when every target fails",
+			prompt:       "hi",
+			errs:         map[string]error{"gemini-flash": quota, "gpt-mini": quota},
+			wantRequests: []string{"gemini/gemini-flash", "openai/gpt-mini"},
+			wantErr:      quota,
+		},
+		{
+			name:         "routes on a mention, keeping the other mentions",
+			prompt:       "explain monads @smart @ground",
+			wantRequests: []string{"anthropic/claude"},
+			wantPrompt:   "explain monads @ground",
+		},
+		{
+			name:         "routes on the prompt length",
+			prompt:       strings.Repeat("long ", 20),
+			errs:         map[string]error{"gemini-pro": quota},
+			wantRequests: []string{"gemini/gemini-pro", "gemini/gemini-flash"},
+			wantPrompt:   strings.Repeat("long ", 20),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, requests, prompts := newRouter(t, tt.errs)
+			entries := []llm.ChatEntry{llm.NewTextEntry(llm.RoleUser, tt.prompt)}
+			stream, err := provider.SolicitResponse(context.Background(), llm.SolicitResponseInput{
+				ModelName:    "ignored",
+				Conversation: llm.Conversation{Entries: entries},
+			})
+
+			if strings.Join(*requests, ",") != strings.Join(tt.wantRequests, ",") {
+				t.Errorf("requests = %v; want %v", *requests, tt.wantRequests)
+			}
+			if tt.wantErr != nil {
+				var apiErr *llm.APIError
+				if !errors.As(err, &apiErr) || apiErr.StatusCode != tt.wantErr.(*llm.APIError).StatusCode {
+					t.Errorf("error = %v; want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			var text strings.Builder
+			for message, err := range stream.Messages {
+				if err != nil {
+					t.Fatalf("stream error = %v", err)
+				}
+				text.WriteString(message.Text)
+			}
+			last := tt.wantRequests[len(tt.wantRequests)-1]
+			if got := stream.Provider + "/" + stream.Model; got != last || text.String() != stream.Model {
+				t.Errorf("response from %s = %q; want the answer of %s", got, text.String(), last)
+			}
+			if got := (*prompts)[len(*prompts)-1]; got != tt.wantPrompt {
+				t.Errorf("prompt = %q; want %q", got, tt.wantPrompt)
+			}
+			if entries[0].Text() != tt.prompt {
+				t.Errorf("input entry = %q; want it unchanged", entries[0].Text())
+			}
+		})
+	}
+}
+
+func TestNewProvider_Invalid(t *testing.T) {
+	config := koanf.New(".")
+	newProvider := func(name string) (llm.ProviderIfc, error) { return nil, nil }
+	if _, err := router.NewProvider(config, newProvider); err == nil {
+		t.Error("NewProvider() = nil; want an error without routes and fallbacks")
+	}
+	_ = config.Set(keys.OptionRouterFallbacks, []any{map[string]any{"provider": "openai"}})
+	if _, err := router.NewProvider(config, newProvider); err == nil {
+		t.Error("NewProvider() = nil; want an error for a fallback without a model")
+	}
+}
+
+// settingsProvider records the settings of the last request, and answers with the model name.
+type settingsProvider struct {
+	llm.ProviderIfc
+	settings llm.GenerationSettings
+}
+
+func (p *settingsProvider) SolicitResponse(_ context.Context, input llm.SolicitResponseInput) (llm.ResponseStream, error) {
+	p.settings = input.Settings
+	return llm.ResponseStream{Role: llm.RoleAssistant, Messages: func(yield func(llm.Message, error) bool) {
+		yield(llm.Message{Text: input.ModelName}, nil)
+	}}, nil
+}
+
+func TestProvider_SolicitResponse_Settings(t *testing.T) {
+	config := koanf.New(".")
+	_ = config.Set(keys.OptionTemperature, 1.0)
+	_ = config.Set(keys.OptionRouterFallbacks, []any{map[string]any{"provider": "gemini", "model": "gemini-flash"}})
+	_ = config.Set(keys.OptionModelSettings, []any{map[string]any{"model": "gemini-*", "temperature": 0.2, "top-p": 0.5}})
+	target := &settingsProvider{}
+	provider, err := router.NewProvider(config, func(string) (llm.ProviderIfc, error) { return target, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The caller only knows the settings of the model it asked for, the router those of its target
+	_, err = provider.SolicitResponse(context.Background(), llm.SolicitResponseInput{
+		ModelName:    "ignored",
+		Conversation: llm.Conversation{Entries: []llm.ChatEntry{llm.NewTextEntry(llm.RoleUser, "hi")}},
+		Settings:     llm.GenerationSettings{Temperature: ptr(1.0), TopP: ptr(0.9), Seed: ptr(7)},
+		Overrides:    llm.GenerationSettings{TopP: ptr(0.9), Seed: ptr(7)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := llm.GenerationSettings{Temperature: ptr(0.2), TopP: ptr(0.9), Seed: ptr(7)}
+	if got := target.settings; got.String() != want.String() {
+		t.Errorf("settings = %s; want %s", got, want)
+	}
+}
+
+// endlessProvider answers with messages until the stream is stopped, which closes stopped.
+type endlessProvider struct {
+	llm.ProviderIfc
+	stopped chan struct{}
+}
+
+func (p *endlessProvider) SolicitResponse(context.Context, llm.SolicitResponseInput) (llm.ResponseStream, error) {
+	return llm.ResponseStream{Role: llm.RoleAssistant, Messages: func(yield func(llm.Message, error) bool) {
+		defer close(p.stopped)
+		for yield(llm.Message{Text: "more"}, nil) {
+		}
+	}}, nil
+}
+
+func TestProvider_SolicitResponse_Abandoned(t *testing.T) {
+	config := koanf.New(".")
+	_ = config.Set(keys.OptionRouterFallbacks, []any{map[string]any{"provider": "gemini", "model": "gemini-flash"}})
+	target := &endlessProvider{stopped: make(chan struct{})}
+	provider, err := router.NewProvider(config, func(string) (llm.ProviderIfc, error) { return target, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err = provider.SolicitResponse(ctx, llm.SolicitResponseInput{
+		Conversation: llm.Conversation{Entries: []llm.ChatEntry{llm.NewTextEntry(llm.RoleUser, "hi")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	select {
+	case <-target.stopped:
+	case <-time.After(time.Second):
+		t.Error("the response was not stopped after its context was cancelled")
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,245 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/go-errors/errors"
+)
+
+// SchemaError lists the ways a response does not conform to its schema.
+type SchemaError struct {
+	Violations []string
+}
+
+func (e *SchemaError) Error() string {
+	return "response does not match the schema: " + strings.Join(e.Violations, "; ")
+}
+
+// LoadSchema reads a JSON schema from a file.
+func LoadSchema(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "cannot read schema", 0)
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, errors.WrapPrefix(err, fmt.Sprintf("invalid schema %s", path), 0)
+	}
+	return schema, nil
+}
+
+// ValidateResponse checks that text is a JSON document conforming to the schema. It returns a *SchemaError listing the
+// violations otherwise. The common keywords of JSON schema are checked; $ref and conditional keywords are ignored.
+func ValidateResponse(schema map[string]any, text string) error {
+	var value any
+	if err := json.Unmarshal([]byte(text), &value); err != nil {
+		return &SchemaError{Violations: []string{fmt.Sprintf("not valid JSON: %v", err)}}
+	}
+	var violations []string
+	validate(schema, value, "$", &violations)
+	if len(violations) > 0 {
+		return &SchemaError{Violations: violations}
+	}
+	return nil
+}
+
+// validate appends the violations of value, found at path, to violations.
+func validate(schema map[string]any, value any, path string, violations *[]string) {
+	report := func(format string, args ...any) {
+		*violations = append(*violations, path+": "+fmt.Sprintf(format, args...))
+	}
+	if types := schemaTypes(schema["type"]); len(types) > 0 && !slices.ContainsFunc(types, func(name string) bool {
+		return hasType(value, name)
+	}) {
+		report("expected %s, got %s", strings.Join(types, " or "), typeName(value))
+		return
+	}
+	if enum, ok := schema["enum"].([]any); ok && !slices.ContainsFunc(enum, func(elem any) bool {
+		return equalValues(elem, value)
+	}) {
+		report("%s is not one of the allowed values", compact(value))
+	}
+	if constant, ok := schema["const"]; ok && !equalValues(constant, value) {
+		report("expected %s", compact(constant))
+	}
+
+	switch value := value.(type) {
+	case map[string]any:
+		for _, name := range schemaStrings(schema["required"]) {
+			if _, ok := value[name]; !ok {
+				report("missing required property %q", name)
+			}
+		}
+		properties, _ := schema["properties"].(map[string]any)
+		for _, name := range slices.Sorted(maps.Keys(value)) {
+			property := value[name]
+			if propertySchema, ok := properties[name].(map[string]any); ok {
+				validate(propertySchema, property, path+"."+name, violations)
+				continue
+			}
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					report("unexpected property %q", name)
+				}
+			case map[string]any:
+				validate(additional, property, path+"."+name, violations)
+			}
+		}
+	case []any:
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, elem := range value {
+				validate(items, elem, fmt.Sprintf("%s[%d]", path, i), violations)
+			}
+		}
+		if minItems := schemaNumber(schema["minItems"]); minItems != nil && float64(len(value)) < *minItems {
+			report("expected at least %v items, got %d", *minItems, len(value))
+		}
+		if maxItems := schemaNumber(schema["maxItems"]); maxItems != nil && float64(len(value)) > *maxItems {
+			report("expected at most %v items, got %d", *maxItems, len(value))
+		}
+	case string:
+		length := float64(len([]rune(value)))
+		if minLength := schemaNumber(schema["minLength"]); minLength != nil && length < *minLength {
+			report("expected at least %v characters", *minLength)
+		}
+		if maxLength := schemaNumber(schema["maxLength"]); maxLength != nil && length > *maxLength {
+			report("expected at most %v characters", *maxLength)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(value) {
+				report("%q does not match %s", value, pattern)
+			}
+		}
+	case float64:
+		if minimum := schemaNumber(schema["minimum"]); minimum != nil && value < *minimum {
+			report("%v is less than %v", value, *minimum)
+		}
+		if maximum := schemaNumber(schema["maximum"]); maximum != nil && value > *maximum {
+			report("%v is greater than %v", value, *maximum)
+		}
+		if minimum := schemaNumber(schema["exclusiveMinimum"]); minimum != nil && value <= *minimum {
+			report("%v is not greater than %v", value, *minimum)
+		}
+		if maximum := schemaNumber(schema["exclusiveMaximum"]); maximum != nil && value >= *maximum {
+			report("%v is not less than %v", value, *maximum)
+		}
+	}
+
+	for _, subschema := range schemaList(schema["allOf"]) {
+		validate(subschema, value, path, violations)
+	}
+	if anyOf := schemaList(schema["anyOf"]); len(anyOf) > 0 && countMatches(anyOf, value, path) == 0 {
+		report("does not match any of the allowed schemas")
+	}
+	if oneOf := schemaList(schema["oneOf"]); len(oneOf) > 0 && countMatches(oneOf, value, path) != 1 {
+		report("does not match exactly one of the allowed schemas")
+	}
+}
+
+func countMatches(schemas []map[string]any, value any, path string) int {
+	count := 0
+	for _, schema := range schemas {
+		var violations []string
+		validate(schema, value, path, &violations)
+		if len(violations) == 0 {
+			count++
+		}
+	}
+	return count
+}
+
+func hasType(value any, name string) bool {
+	switch name {
+	case "integer":
+		number, ok := value.(float64)
+		return ok && number == math.Trunc(number)
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	default:
+		return typeName(value) == name
+	}
+}
+
+func typeName(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+func equalValues(a any, b any) bool {
+	return compact(a) == compact(b)
+}
+
+func compact(value any) string {
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+// schemaTypes reads the type keyword, which is either a name or a list of names.
+func schemaTypes(value any) []string {
+	if name, ok := value.(string); ok {
+		return []string{name}
+	}
+	return schemaStrings(value)
+}
+
+func schemaStrings(value any) []string {
+	switch value := value.(type) {
+	case []string:
+		return value
+	case []any:
+		names := make([]string, 0, len(value))
+		for _, elem := range value {
+			if name, ok := elem.(string); ok {
+				names = append(names, name)
+			}
+		}
+		return names
+	}
+	return nil
+}
+
+func schemaList(value any) []map[string]any {
+	elems, _ := value.([]any)
+	schemas := make([]map[string]any, 0, len(elems))
+	for _, elem := range elems {
+		if schema, ok := elem.(map[string]any); ok {
+			schemas = append(schemas, schema)
+		}
+	}
+	return schemas
+}
+
+func schemaNumber(value any) *float64 {
+	switch number := value.(type) {
+	case float64:
+		return &number
+	case int:
+		f := float64(number)
+		return &f
+	case int64:
+		f := float64(number)
+		return &f
+	}
+	return nil
+}
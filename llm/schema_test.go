@@ -0,0 +1,68 @@
+package llm_test
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/jlcheng/jcllm/llm"
+)
+
+func TestValidateResponse(t *testing.T) {
+	var schema map[string]any
+	err := json.Unmarshal([]byte(`{
+		"type": "object",
+		"properties": {
+			"level": {"enum": ["info", "warn", "error"]},
+			"count": {"type": "integer", "minimum": 1},
+			"host": {"type": ["string", "null"], "pattern": "^[a-z.]+$"},
+			"tags": {"type": "array", "items": {"type": "string"}, "maxItems": 2}
+		},
+		"required": ["level", "count"],
+		"additionalProperties": false
+	}`), &schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, valid := range []string{
+		`{"level": "warn", "count": 3}`,
+		`{"level": "error", "count": 1, "host": null, "tags": ["db"]}`,
+	} {
+		if err := llm.ValidateResponse(schema, valid); err != nil {
+			t.Errorf("ValidateResponse(%s) error = %v", valid, err)
+		}
+	}
+
+	tests := []struct {
+		response string
+		want     []string
+	}{
+		{`not json`, []string{"not valid JSON: invalid character 'o' in literal null (expecting 'u')"}},
+		{`[]`, []string{"$: expected object, got array"}},
+		{`{"level": "debug", "count": 1.5}`, []string{
+			"$.count: expected integer, got number",
+			`$.level: "debug" is not one of the allowed values`,
+		}},
+		{`{"count": 0, "host": "DB", "tags": ["a", 1, "c"], "extra": true}`, []string{
+			`$: missing required property "level"`,
+			"$.count: 0 is less than 1",
+			`$: unexpected property "extra"`,
+			`$.host: "DB" does not match ^[a-z.]+$`,
+			"$.tags[1]: expected string, got number",
+			"$.tags: expected at most 2 items, got 3",
+		}},
+	}
+	for _, tt := range tests {
+		err := llm.ValidateResponse(schema, tt.response)
+		var schemaErr *llm.SchemaError
+		if !errors.As(err, &schemaErr) {
+			t.Errorf("ValidateResponse(%s) error = %v; want a SchemaError", tt.response, err)
+			continue
+		}
+		if !reflect.DeepEqual(schemaErr.Violations, tt.want) {
+			t.Errorf("ValidateResponse(%s) violations = %q; want %q", tt.response, schemaErr.Violations, tt.want)
+		}
+	}
+}
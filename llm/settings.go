@@ -0,0 +1,221 @@
+package llm
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-errors/errors"
+	"github.com/jlcheng/jcllm/configuration"
+	"github.com/jlcheng/jcllm/configuration/keys"
+)
+
+// SettingNames are the names of the generation settings, as used in the configuration, batch requests, and the REPL.
+var SettingNames = []string{
+	keys.OptionTemperature,
+	keys.OptionTopP,
+	keys.OptionMaxOutputTokens,
+	keys.OptionStopSequences,
+	keys.OptionSeed,
+	keys.OptionReasoningEffort,
+}
+
+// ReasoningEfforts are the valid values of GenerationSettings.ReasoningEffort.
+var ReasoningEfforts = []string{"low", "medium", "high"}
+
+// GenerationSettings tune how a model generates its response. Unset fields leave the choice to the provider. Providers
+// ignore the settings they do not support.
+type GenerationSettings struct {
+	Temperature     *float64
+	TopP            *float64
+	MaxOutputTokens *int
+	StopSequences   []string
+	Seed            *int
+	// ReasoningEffort is one of ReasoningEfforts, or blank.
+	ReasoningEffort string
+}
+
+// Set parses value and assigns it to the setting of the given name. A blank value unsets the setting.
+func (s *GenerationSettings) Set(name string, value string) error {
+	value = strings.TrimSpace(value)
+	switch name {
+	case keys.OptionTemperature:
+		return setFloat(&s.Temperature, name, value, 0, 2)
+	case keys.OptionTopP:
+		return setFloat(&s.TopP, name, value, 0, 1)
+	case keys.OptionMaxOutputTokens:
+		return setInt(&s.MaxOutputTokens, name, value, 1)
+	case keys.OptionSeed:
+		// Providers accept negative seeds
+		return setInt(&s.Seed, name, value, math.MinInt)
+	case keys.OptionStopSequences:
+		s.StopSequences = nil
+		for _, stop := range strings.Split(value, ",") {
+			if stop != "" {
+				s.StopSequences = append(s.StopSequences, stop)
+			}
+		}
+		return nil
+	case keys.OptionReasoningEffort:
+		if value != "" && !slices.Contains(ReasoningEfforts, value) {
+			return errors.Errorf("%s must be one of %s", name, strings.Join(ReasoningEfforts, ", "))
+		}
+		s.ReasoningEffort = value
+		return nil
+	}
+	return errors.Errorf("unknown setting: %s", name)
+}
+
+// SetValue is like Set, but accepts the values found in the configuration or in JSON, such as numbers and lists.
+func (s *GenerationSettings) SetValue(name string, value any) error {
+	switch v := value.(type) {
+	case nil:
+		return s.Set(name, "")
+	case []string:
+		if name == keys.OptionStopSequences {
+			s.StopSequences = slices.Clone(v)
+			return nil
+		}
+	case []any:
+		if name == keys.OptionStopSequences {
+			s.StopSequences = make([]string, 0, len(v))
+			for _, stop := range v {
+				s.StopSequences = append(s.StopSequences, fmt.Sprint(stop))
+			}
+			return nil
+		}
+	case float64:
+		// Avoid the exponent format of %v, which strconv cannot parse as an int
+		return s.Set(name, strconv.FormatFloat(v, 'f', -1, 64))
+	}
+	return s.Set(name, fmt.Sprint(value))
+}
+
+// Merge returns a copy of s, overridden by the settings which are set in other.
+func (s GenerationSettings) Merge(other GenerationSettings) GenerationSettings {
+	if other.Temperature != nil {
+		s.Temperature = other.Temperature
+	}
+	if other.TopP != nil {
+		s.TopP = other.TopP
+	}
+	if other.MaxOutputTokens != nil {
+		s.MaxOutputTokens = other.MaxOutputTokens
+	}
+	if other.StopSequences != nil {
+		s.StopSequences = other.StopSequences
+	}
+	if other.Seed != nil {
+		s.Seed = other.Seed
+	}
+	if other.ReasoningEffort != "" {
+		s.ReasoningEffort = other.ReasoningEffort
+	}
+	return s
+}
+
+// String lists the settings which are set, e.g., "temperature=0.2 seed=42".
+func (s GenerationSettings) String() string {
+	values := make([]string, 0, len(SettingNames))
+	if s.Temperature != nil {
+		values = append(values, fmt.Sprintf("%s=%g", keys.OptionTemperature, *s.Temperature))
+	}
+	if s.TopP != nil {
+		values = append(values, fmt.Sprintf("%s=%g", keys.OptionTopP, *s.TopP))
+	}
+	if s.MaxOutputTokens != nil {
+		values = append(values, fmt.Sprintf("%s=%d", keys.OptionMaxOutputTokens, *s.MaxOutputTokens))
+	}
+	if s.StopSequences != nil {
+		values = append(values, fmt.Sprintf("%s=%q", keys.OptionStopSequences, s.StopSequences))
+	}
+	if s.Seed != nil {
+		values = append(values, fmt.Sprintf("%s=%d", keys.OptionSeed, *s.Seed))
+	}
+	if s.ReasoningEffort != "" {
+		values = append(values, fmt.Sprintf("%s=%s", keys.OptionReasoningEffort, s.ReasoningEffort))
+	}
+	return strings.Join(values, " ")
+}
+
+// SettingsFromConfig reads the generation settings for modelName. The top-level settings apply to every model, and are
+// overridden by the `[[model-settings]]` tables whose model, which may be a glob such as "gemini-*", matches modelName.
+func SettingsFromConfig(config configuration.Configuration, modelName string) (GenerationSettings, error) {
+	var settings GenerationSettings
+	for _, name := range SettingNames {
+		// Flags without a value are loaded as blank strings, which leave the setting unset
+		if value := config.Get(name); value != nil && value != "" {
+			if err := settings.SetValue(name, value); err != nil {
+				return settings, err
+			}
+		}
+	}
+	for _, table := range configuration.Tables(config, keys.OptionModelSettings) {
+		pattern, _ := table["model"].(string)
+		if matched, err := path.Match(pattern, modelName); err != nil || !matched {
+			continue
+		}
+		var modelSettings GenerationSettings
+		for name, value := range table {
+			if name == "model" {
+				continue
+			}
+			if err := modelSettings.SetValue(name, value); err != nil {
+				return settings, errors.WrapPrefix(err, fmt.Sprintf("invalid %s for model %s", keys.OptionModelSettings, pattern), 0)
+			}
+		}
+		settings = settings.Merge(modelSettings)
+	}
+	return settings, nil
+}
+
+// SystemPrompt separates the system entries of the conversation, such as the system message of a client of the
+// server, from the other entries. The system entries replace the configured system prompt, which applies when there
+// are none.
+func SystemPrompt(config configuration.Configuration, conversation Conversation) (string, []ChatEntry) {
+	var prompts []string
+	entries := make([]ChatEntry, 0, len(conversation.Entries))
+	for _, entry := range conversation.Entries {
+		if entry.Role == RoleSystem {
+			prompts = append(prompts, entry.Text())
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if len(prompts) == 0 {
+		return config.String(keys.OptionSystemPrompt), entries
+	}
+	return strings.Join(prompts, "\n\n"), entries
+}
+
+func setFloat(field **float64, name string, value string, minValue float64, maxValue float64) error {
+	if value == "" {
+		*field = nil
+		return nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f < minValue || f > maxValue {
+		return errors.Errorf("%s must be a number between %g and %g", name, minValue, maxValue)
+	}
+	*field = &f
+	return nil
+}
+
+func setInt(field **int, name string, value string, minValue int) error {
+	if value == "" {
+		*field = nil
+		return nil
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return errors.Errorf("%s must be an integer", name)
+	}
+	if i < minValue {
+		return errors.Errorf("%s must be an integer of at least %d", name, minValue)
+	}
+	*field = &i
+	return nil
+}
@@ -0,0 +1,135 @@
+package llm_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jlcheng/jcllm/configuration/keys"
+	"github.com/jlcheng/jcllm/llm"
+	"github.com/knadh/koanf/parsers/toml"
+	"github.com/knadh/koanf/providers/file"
+	"github.com/knadh/koanf/v2"
+)
+
+func TestSettingsFromConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jcllm.toml")
+	content := `
+temperature = 0.7
+seed = 42
+stop-sequences = ["END"]
+
+[[model-settings]]
+model = "gemini-*"
+temperature = 0.2
+max-output-tokens = 512
+
+[[model-settings]]
+model = "o3-mini"
+reasoning-effort = "high"
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := koanf.New(".")
+	if err := config.Load(file.Provider(path), toml.Parser()); err != nil {
+		t.Fatal(err)
+	}
+	// Flags without a value must leave the setting unset
+	_ = config.Set(keys.OptionTopP, "")
+
+	tests := []struct {
+		model string
+		want  string
+	}{
+		{"gemini-2.0-flash", `temperature=0.2 max-output-tokens=512 stop-sequences=["END"] seed=42`},
+		{"o3-mini", `temperature=0.7 stop-sequences=["END"] seed=42 reasoning-effort=high`},
+		{"gpt-4o", `temperature=0.7 stop-sequences=["END"] seed=42`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			settings, err := llm.SettingsFromConfig(config, tt.model)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := settings.String(); got != tt.want {
+				t.Errorf("settings = %s; want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerationSettings_Set(t *testing.T) {
+	var settings llm.GenerationSettings
+	for _, valid := range [][2]string{
+		{keys.OptionTemperature, "1.5"},
+		{keys.OptionTopP, "0.9"},
+		{keys.OptionMaxOutputTokens, "100"},
+		{keys.OptionStopSequences, "a,b"},
+		{keys.OptionSeed, "-7"},
+		{keys.OptionReasoningEffort, "low"},
+	} {
+		if err := settings.Set(valid[0], valid[1]); err != nil {
+			t.Errorf("Set(%s, %s) error = %v", valid[0], valid[1], err)
+		}
+	}
+	if got, want := settings.String(), `temperature=1.5 top-p=0.9 max-output-tokens=100 stop-sequences=["a" "b"] seed=-7 reasoning-effort=low`; got != want {
+		t.Errorf("settings = %s; want %s", got, want)
+	}
+
+	for _, invalid := range [][2]string{
+		{keys.OptionTemperature, "hot"},
+		{keys.OptionTopP, "1.5"},
+		{keys.OptionMaxOutputTokens, "0"},
+		{keys.OptionSeed, "1.5"},
+		{keys.OptionReasoningEffort, "extreme"},
+		{"creativity", "1"},
+	} {
+		if err := settings.Set(invalid[0], invalid[1]); err == nil {
+			t.Errorf("Set(%s, %s) expected an error", invalid[0], invalid[1])
+		}
+	}
+
+	if err := settings.Set(keys.OptionTemperature, ""); err != nil || settings.Temperature != nil {
+		t.Errorf("a blank value should unset the setting, got %v, %v", settings.Temperature, err)
+	}
+}
+
+func TestSystemPrompt(t *testing.T) {
+	config := koanf.New(".")
+	_ = config.Set(keys.OptionSystemPrompt, "Be concise.")
+	tests := []struct {
+		name        string
+		entries     []llm.ChatEntry
+		wantPrompt  string
+		wantEntries int
+	}{
+		{
+			name:        "configured",
+			entries:     []llm.ChatEntry{llm.NewTextEntry(llm.RoleUser, "Hi")},
+			wantPrompt:  "Be concise.",
+			wantEntries: 1,
+		},
+		{
+			name: "replaced by the system entries",
+			entries: []llm.ChatEntry{
+				llm.NewTextEntry(llm.RoleSystem, "Talk like a pirate."),
+				llm.NewTextEntry(llm.RoleSystem, "Answer in French."),
+				llm.NewTextEntry(llm.RoleUser, "Hi"),
+			},
+			wantPrompt:  "Talk like a pirate.\n\nAnswer in French.",
+			wantEntries: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prompt, entries := llm.SystemPrompt(config, llm.Conversation{Entries: tt.entries})
+			if prompt != tt.wantPrompt {
+				t.Errorf("prompt = %q; want %q", prompt, tt.wantPrompt)
+			}
+			if len(entries) != tt.wantEntries || entries[0].Role != llm.RoleUser {
+				t.Errorf("entries = %+v; want the user entry only", entries)
+			}
+		})
+	}
+}
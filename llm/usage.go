@@ -0,0 +1,28 @@
+package llm
+
+// Usage counts the tokens of one or more responses. CachedTokens and ReasoningTokens are included in InputTokens and
+// OutputTokens respectively, as providers bill them.
+type Usage struct {
+	InputTokens     int `json:"input_tokens"`
+	OutputTokens    int `json:"output_tokens"`
+	CachedTokens    int `json:"cached_tokens,omitempty"`
+	ReasoningTokens int `json:"reasoning_tokens,omitempty"`
+}
+
+// Usage returns the tokens reported by a message of a response stream.
+func (m Message) Usage() Usage {
+	return Usage{
+		InputTokens:     m.InputTokenCount,
+		OutputTokens:    m.TokenCount,
+		CachedTokens:    m.CachedTokenCount,
+		ReasoningTokens: m.ReasoningTokenCount,
+	}
+}
+
+// Add adds other to u.
+func (u *Usage) Add(other Usage) {
+	u.InputTokens += other.InputTokens
+	u.OutputTokens += other.OutputTokens
+	u.CachedTokens += other.CachedTokens
+	u.ReasoningTokens += other.ReasoningTokens
+}
@@ -0,0 +1,209 @@
+package markdown
+
+import (
+	"strings"
+
+	"github.com/jlcheng/jcllm/dye"
+)
+
+// language describes the tokens of a programming language, well enough to highlight it.
+type language struct {
+	keywords map[string]bool
+	// lineComments start comments which run to the end of the line.
+	lineComments []string
+	// blockComments is set for languages with /* */ comments.
+	blockComments bool
+	quotes        string
+	// ignoreCase is set for languages whose keywords are case-insensitive.
+	ignoreCase bool
+}
+
+func keywordSet(keywords string) map[string]bool {
+	set := make(map[string]bool)
+	for _, keyword := range strings.Fields(keywords) {
+		set[keyword] = true
+	}
+	return set
+}
+
+var (
+	langGo = &language{
+		keywords: keywordSet(`break case chan const continue default defer else fallthrough for func go goto if import
+			interface map package range return select struct switch type var nil true false iota any error string bool
+			int int8 int16 int32 int64 uint uint8 uint16 uint32 uint64 byte rune float32 float64 append cap len make new
+			panic`),
+		lineComments:  []string{"//"},
+		blockComments: true,
+		quotes:        "\"'`",
+	}
+	langPython = &language{
+		keywords: keywordSet(`and as assert async await break class continue def del elif else except finally for from
+			global if import in is lambda nonlocal not or pass raise return try while with yield None True False self
+			print`),
+		lineComments: []string{"#"},
+		quotes:       "\"'",
+	}
+	langJavaScript = &language{
+		keywords: keywordSet(`async await break case catch class const continue debugger default delete do else export
+			extends finally for from function if import in instanceof interface let new of return static super switch
+			this throw try type typeof var void while yield null undefined true false`),
+		lineComments:  []string{"//"},
+		blockComments: true,
+		quotes:        "\"'`",
+	}
+	langJava = &language{
+		keywords: keywordSet(`abstract boolean break byte case catch char class const continue default do double else
+			enum extends final finally float for if implements import instanceof int interface long new package private
+			protected public return short static super switch this throw throws try var void while null true false`),
+		lineComments:  []string{"//"},
+		blockComments: true,
+		quotes:        "\"'",
+	}
+	langC = &language{
+		keywords: keywordSet(`auto bool break case char class const constexpr continue default define delete do double
+			else enum extern float for if include inline int long namespace new nullptr private public return short signed
+			sizeof static struct switch template this typedef union unsigned using virtual void while NULL true false`),
+		lineComments:  []string{"//"},
+		blockComments: true,
+		quotes:        "\"'",
+	}
+	langRust = &language{
+		keywords: keywordSet(`as async await break const continue crate else enum extern false fn for if impl in let
+			loop match mod move mut pub ref return self Self static struct super trait true type unsafe use where while
+			Some None Ok Err`),
+		lineComments:  []string{"//"},
+		blockComments: true,
+		quotes:        "\"",
+	}
+	langShell = &language{
+		keywords: keywordSet(`if then else elif fi case esac for while until do done in function return export local
+			echo exit set unset source`),
+		lineComments: []string{"#"},
+		quotes:       "\"'",
+	}
+	langSQL = &language{
+		keywords: keywordSet(`select from where and or not insert into values update set delete create table drop
+			alter index join left right inner outer on group by order having limit offset as distinct union all null is
+			in like between case when then else end primary key foreign references default`),
+		lineComments:  []string{"--"},
+		blockComments: true,
+		quotes:        "'\"",
+		ignoreCase:    true,
+	}
+	langJSON = &language{
+		keywords: keywordSet(`true false null`),
+		quotes:   "\"",
+	}
+	langYAML = &language{
+		keywords:     keywordSet(`true false null yes no`),
+		lineComments: []string{"#"},
+		quotes:       "\"'",
+	}
+
+	languages = map[string]*language{
+		"go": langGo, "golang": langGo,
+		"python": langPython, "py": langPython,
+		"javascript": langJavaScript, "js": langJavaScript, "typescript": langJavaScript, "ts": langJavaScript,
+		"jsx": langJavaScript, "tsx": langJavaScript,
+		"java": langJava, "kotlin": langJava, "scala": langJava,
+		"c": langC, "cpp": langC, "c++": langC, "h": langC, "csharp": langC, "cs": langC,
+		"rust": langRust, "rs": langRust,
+		"sh": langShell, "bash": langShell, "shell": langShell, "zsh": langShell, "console": langShell,
+		"sql":  langSQL,
+		"json": langJSON,
+		"yaml": langYAML, "yml": langYAML, "toml": langYAML,
+	}
+)
+
+// highlighter colors the lines of a code block. Block comments may span lines.
+type highlighter struct {
+	lang      *language
+	inComment bool
+}
+
+// newHighlighter creates a highlighter for the info string of a fence, e.g., "go". Unknown languages are not colored.
+func newHighlighter(info string) *highlighter {
+	name, _, _ := strings.Cut(strings.ToLower(info), " ")
+	return &highlighter{lang: languages[name]}
+}
+
+func (h *highlighter) line(line string) string {
+	if h.lang == nil {
+		return line
+	}
+	var out strings.Builder
+	for i := 0; i < len(line); {
+		rest := line[i:]
+		if h.inComment {
+			end := strings.Index(rest, "*/")
+			if end < 0 {
+				out.WriteString(dye.Str(rest).As(dye.RoleComment))
+				break
+			}
+			h.inComment = false
+			out.WriteString(dye.Str(rest[:end+2]).As(dye.RoleComment))
+			i += end + 2
+			continue
+		}
+		if h.lang.blockComments && strings.HasPrefix(rest, "/*") {
+			h.inComment = true
+			out.WriteString(dye.Str("/*").As(dye.RoleComment))
+			i += 2
+			continue
+		}
+		if h.isLineComment(line, i) {
+			out.WriteString(dye.Str(rest).As(dye.RoleComment))
+			break
+		}
+		switch ch := line[i]; {
+		case strings.IndexByte(h.lang.quotes, ch) >= 0:
+			end := i + 1
+			for end < len(line) && line[end] != ch {
+				if line[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			end = min(end+1, len(line))
+			out.WriteString(dye.Str(line[i:end]).As(dye.RoleString))
+			i = end
+		case isWordChar(ch) && ch < 0x80:
+			end := i + 1
+			for end < len(line) && isWordChar(line[end]) && line[end] < 0x80 {
+				end++
+			}
+			word := line[i:end]
+			switch {
+			case '0' <= ch && ch <= '9':
+				out.WriteString(dye.Str(word).As(dye.RoleNumber))
+			case h.isKeyword(word):
+				out.WriteString(dye.Str(word).As(dye.RoleKeyword))
+			default:
+				out.WriteString(word)
+			}
+			i = end
+		default:
+			out.WriteByte(ch)
+			i++
+		}
+	}
+	return out.String()
+}
+
+// isLineComment reports whether a comment starts at line[i]. A # only starts a comment at the beginning of a word,
+// so it is not mistaken for part of a word or a $# variable.
+func (h *highlighter) isLineComment(line string, i int) bool {
+	for _, marker := range h.lang.lineComments {
+		if strings.HasPrefix(line[i:], marker) && (marker != "#" || i == 0 || line[i-1] == ' ' || line[i-1] == '\t') {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *highlighter) isKeyword(word string) bool {
+	if h.lang.ignoreCase {
+		word = strings.ToLower(word)
+	}
+	return h.lang.keywords[word]
+}
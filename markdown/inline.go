@@ -0,0 +1,205 @@
+package markdown
+
+import (
+	"strings"
+
+	"github.com/jlcheng/jcllm/dye"
+)
+
+// maxLinkLength bounds how much text is held back while waiting for the end of a link.
+const maxLinkLength = 500
+
+// style is the formatting of a span of text.
+type style struct {
+	bold      bool
+	italic    bool
+	underline bool
+	code      bool
+	// citation is set for the URLs of links, which are styled by the theme.
+	citation bool
+	// heading is the level of the heading the text belongs to, or 0.
+	heading int
+}
+
+func (s style) render(text string) string {
+	if text == "" || s == (style{}) {
+		return text
+	}
+	c := dye.Str(text)
+	if s.bold {
+		c.Bold()
+	}
+	if s.italic {
+		c.Italic()
+	}
+	if s.underline {
+		c.Underline()
+	}
+	switch {
+	case s.code:
+		return c.As(dye.RoleCode)
+	case s.citation:
+		return c.As(dye.RoleCitation)
+	case s.heading == 1 || s.heading == 2:
+		return c.As(dye.RoleHeading)
+	case s.heading > 2:
+		return c.As(dye.RoleSubheading)
+	}
+	return c.Get()
+}
+
+// inline renders the text of a line: emphasis, code spans, and links. The text may arrive in fragments.
+type inline struct {
+	base   style
+	bold   bool
+	italic bool
+	code   bool
+	// pending is the end of the previous fragment, which may be the beginning of a markup.
+	pending string
+	// last is the last character of the text, which tells whether an underscore is inside a word.
+	last byte
+}
+
+func (in *inline) style() style {
+	s := in.base
+	s.bold = s.bold || in.bold
+	s.italic = s.italic || in.italic
+	s.code = in.code
+	return s
+}
+
+// feed renders a fragment of the line. The end of the fragment is held back if it may be the beginning of a markup,
+// unless end is set, which means the line is complete. Emphasis does not carry over to the next line.
+func (in *inline) feed(text string, end bool) string {
+	text = in.pending + text
+	in.pending = ""
+	var out, span strings.Builder
+	flush := func() {
+		out.WriteString(in.style().render(span.String()))
+		span.Reset()
+	}
+	literal := func(s string) {
+		span.WriteString(s)
+		in.last = s[len(s)-1]
+	}
+	hold := func(s string) bool {
+		if end {
+			return false
+		}
+		in.pending = s
+		return true
+	}
+
+scan:
+	for i := 0; i < len(text); {
+		c := text[i]
+		if in.code {
+			if c == '`' {
+				flush()
+				in.code = false
+			} else {
+				literal(text[i : i+1])
+			}
+			i++
+			continue
+		}
+		switch c {
+		case '\\':
+			if i+1 == len(text) {
+				if hold(text[i:]) {
+					break scan
+				}
+				literal(`\`)
+				i++
+			} else if strings.IndexByte("\\`*_[]()#+-.!|>~", text[i+1]) >= 0 {
+				literal(text[i+1 : i+2])
+				i += 2
+			} else {
+				literal(`\`)
+				i++
+			}
+		case '`':
+			flush()
+			in.code = true
+			in.last = c
+			i++
+		case '*', '_':
+			n := len(text[i:]) - len(strings.TrimLeft(text[i:], text[i:i+1]))
+			if i+n == len(text) && hold(text[i:]) {
+				break scan
+			}
+			var next byte
+			if i+n < len(text) {
+				next = text[i+n]
+			}
+			n = min(n, 3)
+			toggleBold, toggleItalic := n >= 2, n != 2
+			// An opening marker must be followed by text, and underscores inside words are literal, e.g., snake_case
+			opening := (toggleBold && !in.bold) || (toggleItalic && !in.italic)
+			if (opening && (next == 0 || next == ' ')) || (c == '_' && isWordChar(in.last) && isWordChar(next)) {
+				literal(text[i : i+n])
+				i += n
+				continue
+			}
+			flush()
+			in.bold = in.bold != toggleBold
+			in.italic = in.italic != toggleItalic
+			in.last = c
+			i += n
+		case '[':
+			label, url, length, found := parseLink(text[i:])
+			if !found {
+				if mayBeLink(text[i:]) && hold(text[i:]) {
+					break scan
+				}
+				literal("[")
+				i++
+				continue
+			}
+			flush()
+			linkStyle := in.style()
+			linkStyle.underline = true
+			out.WriteString(linkStyle.render(label))
+			if url != label {
+				out.WriteString(style{citation: true}.render(" (" + url + ")"))
+			}
+			in.last = ')'
+			i += length
+		default:
+			literal(text[i : i+1])
+			i++
+		}
+	}
+	flush()
+	if end {
+		*in = inline{base: in.base}
+	}
+	return out.String()
+}
+
+// parseLink parses a link such as [label](url) at the beginning of text, and returns its length.
+func parseLink(text string) (label string, url string, length int, found bool) {
+	closing := strings.Index(text, "](")
+	if closing < 0 || strings.Contains(text[1:closing], "[") {
+		return "", "", 0, false
+	}
+	end := strings.IndexByte(text[closing:], ')')
+	if end < 0 {
+		return "", "", 0, false
+	}
+	end += closing
+	return text[1:closing], text[closing+2 : end], end + 1, true
+}
+
+// mayBeLink reports whether text, which starts with "[" but is not a link, may become one once more text arrives.
+func mayBeLink(text string) bool {
+	if len(text) >= maxLinkLength {
+		return false
+	}
+	closing := strings.IndexByte(text, ']')
+	return closing < 0 || closing+1 == len(text) || text[closing+1] == '('
+}
+
+func isWordChar(c byte) bool {
+	return c >= 0x80 || c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
@@ -0,0 +1,240 @@
+// Package markdown renders markdown for the terminal while it streams in, with the styles of the dye package.
+package markdown
+
+import (
+	"io"
+	"strings"
+
+	"github.com/jlcheng/jcllm/dye"
+)
+
+// kind is the kind of block a line belongs to.
+type kind int
+
+const (
+	// undecided lines need more text before their kind is known, e.g., "#" may start a heading or a hashtag.
+	undecided kind = iota
+	blank
+	paragraph
+	heading
+	listItem
+	quote
+	fence
+	rule
+	tableRow
+)
+
+// block is a classified line.
+type block struct {
+	kind kind
+	// prefix is the rendered marker of the line, such as a bullet.
+	prefix string
+	// content is the text after the marker, which is rendered inline.
+	content string
+	style   style
+}
+
+// Renderer is an io.Writer which renders markdown to another writer. Text may be written in fragments of any size.
+// Paragraphs, headings, lists, and quotes are rendered as the fragments arrive, holding back only the markup which is
+// not complete yet. Code blocks are rendered line by line, and tables once their last row arrives.
+type Renderer struct {
+	w io.Writer
+	// line is the beginning of the current line, held until its kind is known.
+	line strings.Builder
+	// streaming is set once the kind of the current line is known, and the rest of it is rendered by inline.
+	streaming bool
+	inline    inline
+	// code is set inside a fenced code block, whose fence and highlighter are kept.
+	code        bool
+	fence       string
+	highlighter *highlighter
+	// table holds the rows of a table until a line which is not a row arrives.
+	table []string
+	err   error
+}
+
+// NewRenderer creates a Renderer writing to w.
+func NewRenderer(w io.Writer) *Renderer {
+	return &Renderer{w: w}
+}
+
+// Write renders p. It implements io.Writer.
+func (r *Renderer) Write(p []byte) (int, error) {
+	text := string(p)
+	for text != "" {
+		chunk, rest, complete := strings.Cut(text, "\n")
+		r.feed(chunk, complete)
+		text = rest
+	}
+	return len(p), r.err
+}
+
+// Flush renders the text held back, as if the markdown ended there, and resets the renderer for a new document.
+func (r *Renderer) Flush() error {
+	if r.streaming {
+		r.print(r.inline.feed("", true))
+	} else if line := r.line.String(); line != "" {
+		r.renderLine(line, "")
+	}
+	if len(r.table) > 0 {
+		r.print(strings.TrimSuffix(renderTable(r.table), "\n"))
+	}
+	err := r.err
+	*r = Renderer{w: r.w}
+	return err
+}
+
+func (r *Renderer) feed(text string, complete bool) {
+	if r.streaming {
+		r.print(r.inline.feed(text, complete))
+		if complete {
+			r.print("\n")
+			r.streaming = false
+		}
+		return
+	}
+	r.line.WriteString(text)
+	line := r.line.String()
+	if complete {
+		r.line.Reset()
+		r.renderLine(line, "\n")
+		return
+	}
+	if r.code {
+		return
+	}
+	// Paragraphs, headings, lists, and quotes are streamed as soon as their marker is known
+	b := classify(line, false)
+	switch b.kind {
+	case paragraph, heading, listItem, quote:
+		r.flushTable()
+		r.line.Reset()
+		r.streaming = true
+		r.inline = inline{base: b.style}
+		r.print(b.prefix)
+		r.print(r.inline.feed(b.content, false))
+	}
+}
+
+// renderLine renders a complete line, followed by eol.
+func (r *Renderer) renderLine(line string, eol string) {
+	if r.code {
+		if marker := fenceMarker(strings.TrimSpace(line)); marker != "" && strings.HasPrefix(marker, r.fence) && marker == strings.TrimSpace(line) {
+			r.code = false
+			r.print(dye.Str(line).As(dye.RoleBorder) + eol)
+			return
+		}
+		r.print(r.highlighter.line(line) + eol)
+		return
+	}
+	b := classify(line, true)
+	if b.kind == tableRow {
+		r.table = append(r.table, line)
+		return
+	}
+	r.flushTable()
+	switch b.kind {
+	case fence:
+		trimmed := strings.TrimSpace(line)
+		r.code = true
+		r.fence = fenceMarker(trimmed)
+		r.highlighter = newHighlighter(strings.TrimSpace(strings.TrimLeft(trimmed, r.fence[:1])))
+		r.print(dye.Str(line).As(dye.RoleBorder) + eol)
+	case rule:
+		r.print(dye.Str(strings.Repeat("─", 40)).As(dye.RoleBorder) + eol)
+	case blank:
+		r.print(eol)
+	default:
+		r.inline = inline{base: b.style}
+		r.print(b.prefix + r.inline.feed(b.content, true) + eol)
+	}
+}
+
+func (r *Renderer) flushTable() {
+	if len(r.table) == 0 {
+		return
+	}
+	r.print(renderTable(r.table))
+	r.table = nil
+}
+
+func (r *Renderer) print(s string) {
+	if r.err != nil || s == "" {
+		return
+	}
+	_, r.err = io.WriteString(r.w, s)
+}
+
+// classify returns the kind of a line, which is undecided if the line may still turn out to be of another kind. A
+// complete line is never undecided.
+func classify(line string, complete bool) block {
+	content := strings.TrimLeft(line, " \t")
+	indent := line[:len(line)-len(content)]
+	text := block{kind: paragraph, prefix: indent, content: content}
+	if content == "" {
+		if complete {
+			return block{kind: blank}
+		}
+		return block{kind: undecided}
+	}
+	switch c := content[0]; {
+	case c == '`' || c == '~':
+		if strings.HasPrefix(content, strings.Repeat(content[:1], 3)) {
+			return block{kind: fence}
+		}
+		if !complete && strings.Trim(content, content[:1]) == "" {
+			return block{kind: undecided}
+		}
+	case c == '#':
+		level := len(content) - len(strings.TrimLeft(content, "#"))
+		if level == len(content) && !complete {
+			return block{kind: undecided}
+		}
+		if level <= 6 && level < len(content) && content[level] == ' ' {
+			return block{kind: heading, prefix: indent, content: content[level+1:], style: style{heading: level}}
+		}
+	case c == '|':
+		return block{kind: tableRow}
+	case c == '>':
+		if len(content) == 1 && !complete {
+			return block{kind: undecided}
+		}
+		return block{kind: quote, prefix: indent + dye.Str("│").As(dye.RoleBorder) + " ", content: strings.TrimPrefix(content[1:], " "), style: style{italic: true}}
+	case c == '-' || c == '*' || c == '_' || c == '+':
+		// A rule is a line of three or more of the same character, possibly separated by spaces
+		if strings.Trim(content, content[:1]+" \t") == "" {
+			if !complete {
+				return block{kind: undecided}
+			}
+			if c != '+' && strings.Count(content, content[:1]) >= 3 {
+				return block{kind: rule}
+			}
+		}
+		if c != '_' && len(content) >= 2 && content[1] == ' ' {
+			return block{kind: listItem, prefix: indent + dye.Str("•").As(dye.RoleMarker) + " ", content: content[2:]}
+		}
+	case '0' <= c && c <= '9':
+		digits := len(content) - len(strings.TrimLeft(content, "0123456789"))
+		if digits == len(content) || (digits+1 == len(content) && (content[digits] == '.' || content[digits] == ')')) {
+			if !complete {
+				return block{kind: undecided}
+			}
+			break
+		}
+		if (content[digits] == '.' || content[digits] == ')') && content[digits+1] == ' ' {
+			return block{kind: listItem, prefix: indent + dye.Str(content[:digits+1]).As(dye.RoleMarker) + " ", content: content[digits+2:]}
+		}
+	}
+	return text
+}
+
+// fenceMarker returns the leading run of backticks or tildes of a line if it is at least three characters long.
+func fenceMarker(line string) string {
+	for _, c := range []string{"`", "~"} {
+		marker := line[:len(line)-len(strings.TrimLeft(line, c))]
+		if len(marker) >= 3 {
+			return marker
+		}
+	}
+	return ""
+}
@@ -0,0 +1,106 @@
+package markdown_test
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/jlcheng/jcllm/dye"
+	"github.com/jlcheng/jcllm/markdown"
+)
+
+var escapeSequence = regexp.MustCompile("\033\\[[0-9;]*m")
+
+const document = "# Title\n" +
+	"\n" +
+	"Some **bold** and *italic* text with `code`, a snake_case word, and a [link](https://example.com).\n" +
+	"\n" +
+	"- one\n" +
+	"2. two\n" +
+	"> quoted\n" +
+	"\n" +
+	"| name | count |\n" +
+	"|------|------:|\n" +
+	"| a | 10 |\n" +
+	"\n" +
+	"```go\n" +
+	"func main() { // comment\n" +
+	"```\n" +
+	"---\n" +
+	"last **line"
+
+func render(fragments ...string) string {
+	var out strings.Builder
+	r := markdown.NewRenderer(&out)
+	for _, fragment := range fragments {
+		if _, err := r.Write([]byte(fragment)); err != nil {
+			panic(err)
+		}
+	}
+	if err := r.Flush(); err != nil {
+		panic(err)
+	}
+	return out.String()
+}
+
+func TestRenderer(t *testing.T) {
+	dye.SetEnabled(true)
+	got := render(document)
+	for _, want := range []string{
+		"\033[1m\033[35mTitle\033[0m\n",
+		"\033[1mbold\033[0m",
+		"\033[3mitalic\033[0m",
+		"\033[36mcode\033[0m",
+		"a snake_case word",
+		"\033[4mlink\033[0m\033[90m (https://example.com)\033[0m",
+		"\033[33m•\033[0m one\n",
+		"\033[33m2.\033[0m two\n",
+		"\033[90m│\033[0m \033[3mquoted\033[0m\n",
+		"\033[35mfunc\033[0m main() { \033[90m// comment\033[0m\n",
+		"last \033[1mline\033[0m",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("render() = %q; want it to contain %q", got, want)
+		}
+	}
+
+	table := escapeSequence.ReplaceAllString(got, "")
+	for _, want := range []string{
+		"┌──────┬───────┐\n",
+		"│ name │ count │\n",
+		"├──────┼───────┤\n",
+		"│ a    │    10 │\n",
+		"└──────┴───────┘\n",
+	} {
+		if !strings.Contains(table, want) {
+			t.Errorf("render() = %q; want the table to contain %q", table, want)
+		}
+	}
+}
+
+func TestRenderer_Mono(t *testing.T) {
+	dye.SetEnabled(true)
+	dye.SetTheme(dye.Themes["mono"])
+	defer dye.SetTheme(dye.Themes["default"])
+
+	got := render(document)
+	if color := regexp.MustCompile("\033\\[(3|9)[0-9]m").FindString(got); color != "" {
+		t.Errorf("render() = %q; want no colors with the mono theme, found %q", got, color)
+	}
+	if !strings.Contains(got, "\033[1m\033[4mTitle\033[0m\n") {
+		t.Errorf("render() = %q; want the heading styled by the theme", got)
+	}
+}
+
+func TestRenderer_Streaming(t *testing.T) {
+	want := escapeSequence.ReplaceAllString(render(document), "")
+	for size := 1; size <= 8; size++ {
+		var fragments []string
+		for i := 0; i < len(document); i += size {
+			fragments = append(fragments, document[i:min(i+size, len(document))])
+		}
+		if got := escapeSequence.ReplaceAllString(render(fragments...), ""); got != want {
+			t.Errorf("render() in fragments of %d = %q; want %q", size, got, want)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package markdown
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jlcheng/jcllm/dye"
+)
+
+var (
+	escapeSequence = regexp.MustCompile("\033\\[[0-9;]*m")
+	separatorCell  = regexp.MustCompile(`^:?-+:?$`)
+)
+
+// alignment is the alignment of a table column, as set by the colons of the separator row.
+type alignment int
+
+const (
+	alignLeft alignment = iota
+	alignCenter
+	alignRight
+)
+
+// renderTable renders the rows of a table, each ending with a newline, with box-drawing borders. The first row is the
+// header if the second row is a separator such as |---|:-:|.
+func renderTable(rows []string) string {
+	var cells [][]string
+	var aligns []alignment
+	header := len(rows) > 1 && isSeparator(splitRow(rows[1]))
+	for i, row := range rows {
+		fields := splitRow(row)
+		if i == 1 && header {
+			aligns = make([]alignment, len(fields))
+			for j, field := range fields {
+				switch left, right := strings.HasPrefix(field, ":"), strings.HasSuffix(field, ":"); {
+				case left && right:
+					aligns[j] = alignCenter
+				case right:
+					aligns[j] = alignRight
+				}
+			}
+			continue
+		}
+		rendered := make([]string, len(fields))
+		for j, field := range fields {
+			in := inline{base: style{bold: header && i == 0}}
+			rendered[j] = in.feed(field, true)
+		}
+		cells = append(cells, rendered)
+	}
+
+	var widths []int
+	for _, row := range cells {
+		for j, cell := range row {
+			if j == len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[j] = max(widths[j], visibleWidth(cell))
+		}
+	}
+
+	border := func(left, middle, right string) string {
+		parts := make([]string, len(widths))
+		for j, width := range widths {
+			parts[j] = strings.Repeat("─", width+2)
+		}
+		return dye.Str(left+strings.Join(parts, middle)+right).As(dye.RoleBorder) + "\n"
+	}
+	var out strings.Builder
+	out.WriteString(border("┌", "┬", "┐"))
+	for i, row := range cells {
+		out.WriteString(dye.Str("│").As(dye.RoleBorder))
+		for j, width := range widths {
+			cell := ""
+			if j < len(row) {
+				cell = row[j]
+			}
+			align := alignLeft
+			if j < len(aligns) {
+				align = aligns[j]
+			}
+			out.WriteString(" " + pad(cell, width, align) + " " + dye.Str("│").As(dye.RoleBorder))
+		}
+		out.WriteString("\n")
+		if i == 0 && header && len(cells) > 1 {
+			out.WriteString(border("├", "┼", "┤"))
+		}
+	}
+	out.WriteString(border("└", "┴", "┘"))
+	return out.String()
+}
+
+// splitRow returns the trimmed cells of a row, such as "| a | b |".
+func splitRow(row string) []string {
+	row = strings.TrimSpace(row)
+	row = strings.TrimPrefix(row, "|")
+	if strings.HasSuffix(row, "|") && !strings.HasSuffix(row, `\|`) {
+		row = row[:len(row)-1]
+	}
+	var fields []string
+	start := 0
+	for i := 0; i < len(row); i++ {
+		switch row[i] {
+		case '\\':
+			i++
+		case '|':
+			fields = append(fields, strings.TrimSpace(row[start:i]))
+			start = i + 1
+		}
+	}
+	return append(fields, strings.TrimSpace(row[start:]))
+}
+
+func isSeparator(fields []string) bool {
+	for _, field := range fields {
+		if !separatorCell.MatchString(field) {
+			return false
+		}
+	}
+	return true
+}
+
+// visibleWidth returns the number of characters of s which take up space in the terminal.
+func visibleWidth(s string) int {
+	return utf8.RuneCountInString(escapeSequence.ReplaceAllString(s, ""))
+}
+
+func pad(cell string, width int, align alignment) string {
+	padding := width - visibleWidth(cell)
+	switch align {
+	case alignRight:
+		return strings.Repeat(" ", padding) + cell
+	case alignCenter:
+		return strings.Repeat(" ", padding/2) + cell + strings.Repeat(" ", padding-padding/2)
+	}
+	return cell + strings.Repeat(" ", padding)
+}
@@ -0,0 +1,296 @@
+// Package mcp implements a Model Context Protocol client which talks to servers running as subprocesses over stdio.
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-errors/errors"
+)
+
+var ErrServerStopped = errors.New("mcp server stopped")
+
+// ServerConfig describes how to start an MCP server.
+type ServerConfig struct {
+	Name    string
+	Command string
+	Args    []string
+	// Env holds extra environment variables for the server, on top of the environment of jcllm.
+	Env map[string]string
+}
+
+// Client is a connection to a single MCP server subprocess. Messages are newline-delimited JSON-RPC 2.0 objects.
+type Client struct {
+	config ServerConfig
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	// done is closed once the server's stdout is closed, which usually means the process exited.
+	done chan struct{}
+
+	// mu guards the pending calls. It is never held while writing, so that responses are still dispatched while a
+	// write waits for the server to read its stdin.
+	mu      sync.Mutex
+	nextID  int64
+	pending map[int64]chan message
+
+	// writeMu serializes the messages written to stdin.
+	writeMu  sync.Mutex
+	writeErr error
+
+	info InitializeResult
+}
+
+// Start launches the server and performs the initialization handshake.
+func Start(ctx context.Context, config ServerConfig, clientInfo Implementation) (*Client, error) {
+	cmd := exec.Command(config.Command, config.Args...)
+	cmd.Env = os.Environ()
+	for key, value := range config.Env {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", key, value))
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "cannot create stdin pipe", 0)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "cannot create stdout pipe", 0)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, errors.WrapPrefix(err, fmt.Sprintf("cannot start [%s]", config.Command), 0)
+	}
+	client := &Client{
+		config:  config,
+		cmd:     cmd,
+		stdin:   stdin,
+		done:    make(chan struct{}),
+		pending: make(map[int64]chan message),
+	}
+	go client.readLoop(stdout)
+
+	if err := client.call(ctx, "initialize", initializeParams{
+		ProtocolVersion: ProtocolVersion,
+		Capabilities:    map[string]any{},
+		ClientInfo:      clientInfo,
+	}, &client.info); err != nil {
+		client.Close()
+		return nil, errors.WrapPrefix(err, "initialize failed", 0)
+	}
+	if err := client.notify("notifications/initialized"); err != nil {
+		client.Close()
+		return nil, errors.WrapPrefix(err, "initialized notification failed", 0)
+	}
+	return client, nil
+}
+
+// Name returns the name of the server, as configured.
+func (c *Client) Name() string {
+	return c.config.Name
+}
+
+// Info returns what the server reported about itself during initialization.
+func (c *Client) Info() InitializeResult {
+	return c.info
+}
+
+// Running reports whether the server is still connected.
+func (c *Client) Running() bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// Close stops the server. Closing stdin asks the server to exit; the process is killed if it does not exit promptly.
+func (c *Client) Close() {
+	_ = c.stdin.Close()
+	select {
+	case <-c.done:
+	case <-time.After(2 * time.Second):
+	}
+	if c.cmd.Process != nil {
+		_ = c.cmd.Process.Kill()
+	}
+	_ = c.cmd.Wait()
+}
+
+func (c *Client) ListTools(ctx context.Context) ([]Tool, error) {
+	if c.info.Capabilities.Tools == nil {
+		return nil, nil
+	}
+	var tools []Tool
+	cursor := ""
+	for {
+		var result listToolsResult
+		if err := c.call(ctx, "tools/list", cursorParams{Cursor: cursor}, &result); err != nil {
+			return nil, err
+		}
+		tools = append(tools, result.Tools...)
+		if cursor = result.NextCursor; cursor == "" {
+			return tools, nil
+		}
+	}
+}
+
+func (c *Client) CallTool(ctx context.Context, name string, arguments json.RawMessage) (CallToolResult, error) {
+	var result CallToolResult
+	err := c.call(ctx, "tools/call", callToolParams{Name: name, Arguments: arguments}, &result)
+	return result, err
+}
+
+func (c *Client) ListResources(ctx context.Context) ([]Resource, error) {
+	if c.info.Capabilities.Resources == nil {
+		return nil, nil
+	}
+	var resources []Resource
+	cursor := ""
+	for {
+		var result listResourcesResult
+		if err := c.call(ctx, "resources/list", cursorParams{Cursor: cursor}, &result); err != nil {
+			return nil, err
+		}
+		resources = append(resources, result.Resources...)
+		if cursor = result.NextCursor; cursor == "" {
+			return resources, nil
+		}
+	}
+}
+
+func (c *Client) ReadResource(ctx context.Context, uri string) ([]ResourceContents, error) {
+	var result readResourceResult
+	err := c.call(ctx, "resources/read", readResourceParams{URI: uri}, &result)
+	return result.Contents, err
+}
+
+func (c *Client) ListPrompts(ctx context.Context) ([]Prompt, error) {
+	if c.info.Capabilities.Prompts == nil {
+		return nil, nil
+	}
+	var prompts []Prompt
+	cursor := ""
+	for {
+		var result listPromptsResult
+		if err := c.call(ctx, "prompts/list", cursorParams{Cursor: cursor}, &result); err != nil {
+			return nil, err
+		}
+		prompts = append(prompts, result.Prompts...)
+		if cursor = result.NextCursor; cursor == "" {
+			return prompts, nil
+		}
+	}
+}
+
+func (c *Client) GetPrompt(ctx context.Context, name string, arguments map[string]string) (GetPromptResult, error) {
+	var result GetPromptResult
+	err := c.call(ctx, "prompts/get", getPromptParams{Name: name, Arguments: arguments}, &result)
+	return result, err
+}
+
+// call sends a request and decodes the result of the matching response into result.
+func (c *Client) call(ctx context.Context, method string, params any, result any) error {
+	c.mu.Lock()
+	c.nextID++
+	id := c.nextID
+	responseChan := make(chan message, 1)
+	c.pending[id] = responseChan
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	if err := c.write(request{JSONRPC: jsonRPCVersion, ID: &id, Method: method, Params: params}); err != nil {
+		return err
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.done:
+		return ErrServerStopped
+	case msg := <-responseChan:
+		if msg.Error != nil {
+			return msg.Error
+		}
+		if result == nil || len(msg.Result) == 0 {
+			return nil
+		}
+		if err := json.Unmarshal(msg.Result, result); err != nil {
+			return errors.WrapPrefix(err, fmt.Sprintf("cannot decode result of %s", method), 0)
+		}
+		return nil
+	}
+}
+
+func (c *Client) notify(method string) error {
+	return c.write(request{JSONRPC: jsonRPCVersion, Method: method})
+}
+
+func (c *Client) write(msg any) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return errors.WrapPrefix(err, "cannot encode message", 0)
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.writeErr != nil {
+		return c.writeErr
+	}
+	if _, err := c.stdin.Write(append(payload, '\n')); err != nil {
+		c.writeErr = errors.WrapPrefix(err, "cannot write to mcp server", 0)
+		return c.writeErr
+	}
+	return nil
+}
+
+// readLoop dispatches responses to the pending calls. Requests from the server are answered with an error, except for
+// ping, as this client does not offer sampling or roots.
+func (c *Client) readLoop(stdout io.Reader) {
+	defer close(c.done)
+	reader := bufio.NewReader(stdout)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(strings.TrimSpace(string(line))) != 0 {
+			var msg message
+			if json.Unmarshal(line, &msg) == nil {
+				c.dispatch(msg)
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (c *Client) dispatch(msg message) {
+	switch {
+	case msg.hasID() && msg.Method == "ping":
+		_ = c.write(response{JSONRPC: jsonRPCVersion, ID: msg.ID, Result: map[string]any{}})
+	case msg.hasID() && msg.Method != "":
+		_ = c.write(response{JSONRPC: jsonRPCVersion, ID: msg.ID, Error: &RPCError{
+			Code:    errCodeMethodNotFound,
+			Message: fmt.Sprintf("method not supported: %s", msg.Method),
+		}})
+	case msg.hasID():
+		// The requests of the client have numeric IDs, so a response with any other ID answers none of them
+		var id int64
+		if json.Unmarshal(msg.ID, &id) != nil {
+			return
+		}
+		c.mu.Lock()
+		responseChan, ok := c.pending[id]
+		c.mu.Unlock()
+		if ok {
+			responseChan <- msg
+		}
+	}
+}
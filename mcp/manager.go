@@ -0,0 +1,168 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/go-errors/errors"
+	"github.com/jlcheng/jcllm/agent"
+	"github.com/jlcheng/jcllm/configuration"
+	"github.com/jlcheng/jcllm/configuration/keys"
+)
+
+var ErrUnknownServer = errors.New("unknown mcp server")
+
+// ServerConfigs reads the MCP servers configured as [mcp-servers.<name>] tables, e.g.,
+//
+//	[mcp-servers.github]
+//	command = "github-mcp-server"
+//	args = ["stdio"]
+//	env = { GITHUB_TOKEN = "..." }
+func ServerConfigs(config configuration.Configuration) []ServerConfig {
+	names := config.MapKeys(keys.OptionMCPServers)
+	servers := make([]ServerConfig, 0, len(names))
+	for _, name := range names {
+		prefix := fmt.Sprintf("%s.%s.", keys.OptionMCPServers, name)
+		servers = append(servers, ServerConfig{
+			Name:    name,
+			Command: config.String(prefix + "command"),
+			Args:    config.Strings(prefix + "args"),
+			Env:     config.StringMap(prefix + "env"),
+		})
+	}
+	return servers
+}
+
+// ServerStatus describes a configured server.
+type ServerStatus struct {
+	Name    string
+	Command string
+	Running bool
+	Info    InitializeResult
+	// Err is the reason the server is not running, if it failed to start.
+	Err error
+}
+
+// Manager owns the MCP server subprocesses and exposes their capabilities as agent tools.
+type Manager struct {
+	clientInfo Implementation
+	configs    []ServerConfig
+
+	mu      sync.Mutex
+	clients map[string]*Client
+	errs    map[string]error
+}
+
+func NewManager(clientInfo Implementation, configs []ServerConfig) *Manager {
+	return &Manager{
+		clientInfo: clientInfo,
+		configs:    configs,
+		clients:    make(map[string]*Client),
+		errs:       make(map[string]error),
+	}
+}
+
+// StartAll starts every configured server. A server which fails to start does not prevent the others from starting;
+// the combined error lists every failure.
+func (m *Manager) StartAll(ctx context.Context) error {
+	var failures []error
+	for _, config := range m.configs {
+		if err := m.Restart(ctx, config.Name); err != nil {
+			failures = append(failures, err)
+		}
+	}
+	return errors.Join(failures...)
+}
+
+// Restart stops the named server, if it is running, and starts it again.
+func (m *Manager) Restart(ctx context.Context, name string) error {
+	idx := slices.IndexFunc(m.configs, func(config ServerConfig) bool {
+		return config.Name == name
+	})
+	if idx < 0 {
+		return fmt.Errorf("%w: %s", ErrUnknownServer, name)
+	}
+	m.mu.Lock()
+	client := m.clients[name]
+	delete(m.clients, name)
+	m.mu.Unlock()
+	if client != nil {
+		client.Close()
+	}
+
+	client, err := Start(ctx, m.configs[idx], m.clientInfo)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err != nil {
+		m.errs[name] = err
+		return errors.WrapPrefix(err, fmt.Sprintf("cannot start mcp server [%s]", name), 0)
+	}
+	delete(m.errs, name)
+	m.clients[name] = client
+	return nil
+}
+
+// Servers returns the status of every configured server, in configuration order.
+func (m *Manager) Servers() []ServerStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	statuses := make([]ServerStatus, 0, len(m.configs))
+	for _, config := range m.configs {
+		status := ServerStatus{Name: config.Name, Command: config.Command, Err: m.errs[config.Name]}
+		if client, ok := m.clients[config.Name]; ok {
+			status.Running = client.Running()
+			status.Info = client.Info()
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// Client returns the client of a running server.
+func (m *Manager) Client(name string) (*Client, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	client, ok := m.clients[name]
+	return client, ok
+}
+
+// Tools returns the tools, resources and prompts of the named server as agent tools.
+func (m *Manager) Tools(ctx context.Context, name string) ([]agent.Tool, error) {
+	client, ok := m.Client(name)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownServer, name)
+	}
+	return serverTools(ctx, client)
+}
+
+// AllTools returns the tools of every running server. Servers which fail to list their tools are skipped and reported
+// in the combined error.
+func (m *Manager) AllTools(ctx context.Context) ([]agent.Tool, error) {
+	var tools []agent.Tool
+	var failures []error
+	for _, status := range m.Servers() {
+		if !status.Running {
+			continue
+		}
+		serverTools, err := m.Tools(ctx, status.Name)
+		if err != nil {
+			failures = append(failures, errors.WrapPrefix(err, fmt.Sprintf("cannot list tools of mcp server [%s]", status.Name), 0))
+			continue
+		}
+		tools = append(tools, serverTools...)
+	}
+	return tools, errors.Join(failures...)
+}
+
+// Close stops every server.
+func (m *Manager) Close() {
+	m.mu.Lock()
+	clients := m.clients
+	m.clients = make(map[string]*Client)
+	m.mu.Unlock()
+	for _, client := range clients {
+		client.Close()
+	}
+}
@@ -0,0 +1,200 @@
+package mcp_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/jlcheng/jcllm/llm"
+	"github.com/jlcheng/jcllm/mcp"
+)
+
+// envFakeServer makes the test binary act as a tiny MCP server, so the client can be tested against a real subprocess.
+const envFakeServer = "JCLLM_MCP_FAKE_SERVER"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(envFakeServer) == "1" {
+		runFakeServer()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func runFakeServer() {
+	scanner := bufio.NewScanner(os.Stdin)
+	encoder := json.NewEncoder(os.Stdout)
+	// pongs are the IDs of the answers to the pings of the server, as received
+	var pongs []string
+	for scanner.Scan() {
+		var req struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil || req.ID == nil {
+			continue
+		}
+		if req.Method == "" {
+			pongs = append(pongs, string(req.ID))
+			continue
+		}
+		var result any
+		switch req.Method {
+		case "initialize":
+			// Ping the client before answering, to check that server requests are handled whatever their IDs
+			_ = encoder.Encode(map[string]any{"jsonrpc": "2.0", "id": 1000, "method": "ping"})
+			_ = encoder.Encode(map[string]any{"jsonrpc": "2.0", "id": "ping-1", "method": "ping"})
+			result = map[string]any{
+				"protocolVersion": mcp.ProtocolVersion,
+				"capabilities":    map[string]any{"tools": map[string]any{}, "resources": map[string]any{}, "prompts": map[string]any{}},
+				"serverInfo":      map[string]any{"name": "fake", "version": "1.0"},
+			}
+		case "tools/list":
+			result = map[string]any{"tools": []any{map[string]any{
+				"name":        "echo",
+				"description": "Echoes the message",
+				"inputSchema": map[string]any{"type": "object", "properties": map[string]any{"message": map[string]any{"type": "string"}}},
+			}}}
+		case "tools/call":
+			var params struct {
+				Arguments struct {
+					Message string `json:"message"`
+				} `json:"arguments"`
+			}
+			_ = json.Unmarshal(req.Params, &params)
+			text := "echo: " + params.Arguments.Message
+			if params.Arguments.Message == "pongs" {
+				text = strings.Join(pongs, ",")
+			}
+			result = map[string]any{
+				"content": []any{map[string]any{"type": "text", "text": text}},
+				"isError": params.Arguments.Message == "fail",
+			}
+		case "resources/list":
+			result = map[string]any{"resources": []any{map[string]any{"uri": "file:///readme", "name": "readme"}}}
+		case "resources/read":
+			result = map[string]any{"contents": []any{map[string]any{"uri": "file:///readme", "text": "read me"}}}
+		case "prompts/list":
+			result = map[string]any{"prompts": []any{map[string]any{
+				"name":      "review",
+				"arguments": []any{map[string]any{"name": "code", "required": true}},
+			}}}
+		case "prompts/get":
+			var params struct {
+				Arguments map[string]string `json:"arguments"`
+			}
+			_ = json.Unmarshal(req.Params, &params)
+			result = map[string]any{"messages": []any{map[string]any{
+				"role":    "user",
+				"content": map[string]any{"type": "text", "text": "Review " + params.Arguments["code"]},
+			}}}
+		default:
+			_ = encoder.Encode(map[string]any{"jsonrpc": "2.0", "id": req.ID, "error": map[string]any{"code": -32601, "message": "unknown method"}})
+			continue
+		}
+		_ = encoder.Encode(map[string]any{"jsonrpc": "2.0", "id": req.ID, "result": result})
+	}
+}
+
+func newManager(t *testing.T) *mcp.Manager {
+	t.Helper()
+	manager := mcp.NewManager(mcp.Implementation{Name: "jcllm-test", Version: "1"}, []mcp.ServerConfig{
+		{Name: "fake", Command: os.Args[0], Env: map[string]string{envFakeServer: "1"}},
+		{Name: "missing", Command: "/nonexistent/mcp-server"},
+	})
+	t.Cleanup(manager.Close)
+	return manager
+}
+
+func TestManager(t *testing.T) {
+	manager := newManager(t)
+	ctx := context.Background()
+	if err := manager.StartAll(ctx); err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("StartAll() error = %v; want the missing server to fail", err)
+	}
+
+	servers := manager.Servers()
+	if len(servers) != 2 || !servers[0].Running || servers[0].Info.ServerInfo.Name != "fake" {
+		t.Errorf("Servers()[0] = %+v; want the fake server running", servers[0])
+	}
+	if servers[1].Running || servers[1].Err == nil {
+		t.Errorf("Servers()[1] = %+v; want the missing server to report its error", servers[1])
+	}
+
+	tools, err := manager.AllTools(ctx)
+	if err != nil {
+		t.Fatalf("AllTools() error = %v", err)
+	}
+	byName := make(map[string]llm.Tool)
+	for _, tool := range tools {
+		byName[tool.Definition().Name] = tool.Definition()
+	}
+	for _, name := range []string{"fake__echo", "fake__read_resource", "fake__get_prompt"} {
+		if _, ok := byName[name]; !ok {
+			t.Errorf("AllTools() = %v; want %s", byName, name)
+		}
+	}
+
+	calls := []struct {
+		name      string
+		arguments string
+		want      string
+		wantError bool
+	}{
+		{name: "fake__echo", arguments: `{"message":"hi"}`, want: "echo: hi"},
+		{name: "fake__echo", arguments: `{"message":"fail"}`, wantError: true},
+		{name: "fake__echo", arguments: `{"message":"pongs"}`, want: `1000,"ping-1"`},
+		{name: "fake__read_resource", arguments: `{"uri":"file:///readme"}`, want: "read me"},
+		{name: "fake__get_prompt", arguments: `{"name":"review","arguments":{"code":"main.go"}}`, want: "user: Review main.go\n"},
+	}
+	for _, call := range calls {
+		var got string
+		var err error
+		for _, tool := range tools {
+			if tool.Definition().Name == call.name {
+				got, err = tool.Call(ctx, call.arguments)
+			}
+		}
+		if call.wantError {
+			if err == nil {
+				t.Errorf("%s(%s) error = nil; want an error", call.name, call.arguments)
+			}
+			continue
+		}
+		if err != nil || got != call.want {
+			t.Errorf("%s(%s) = %q, %v; want %q", call.name, call.arguments, got, err, call.want)
+		}
+	}
+}
+
+func TestManager_Restart(t *testing.T) {
+	manager := newManager(t)
+	ctx := context.Background()
+	if err := manager.Restart(ctx, "fake"); err != nil {
+		t.Fatalf("Restart() error = %v", err)
+	}
+	before, _ := manager.Client("fake")
+	if err := manager.Restart(ctx, "fake"); err != nil {
+		t.Fatalf("Restart() error = %v", err)
+	}
+	after, _ := manager.Client("fake")
+	if before == after || before.Running() || !after.Running() {
+		t.Errorf("Restart() did not replace the running server")
+	}
+	if err := manager.Restart(ctx, "unknown"); !errors.Is(err, mcp.ErrUnknownServer) {
+		t.Errorf("Restart(unknown) error = %v; want ErrUnknownServer", err)
+	}
+}
+
+func TestToolName(t *testing.T) {
+	if got := mcp.ToolName("my.server", "search issues"); got != "my_server__search_issues" {
+		t.Errorf("ToolName() = %q; want my_server__search_issues", got)
+	}
+	if got := mcp.ToolName("server", strings.Repeat("x", 100)); len(got) != 64 {
+		t.Errorf("len(ToolName()) = %d; want 64", len(got))
+	}
+}
@@ -0,0 +1,203 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/go-errors/errors"
+	"github.com/jlcheng/jcllm/agent"
+	"github.com/jlcheng/jcllm/llm"
+)
+
+// maxToolNameLength is the longest tool name accepted by OpenAI and Gemini.
+const maxToolNameLength = 64
+
+var invalidToolNameChars = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// ToolName returns the name under which a capability of an MCP server is offered to the model. Names are prefixed with
+// the server name, as different servers may offer tools of the same name.
+func ToolName(serverName string, name string) string {
+	toolName := invalidToolNameChars.ReplaceAllString(serverName+"__"+name, "_")
+	if len(toolName) > maxToolNameLength {
+		toolName = toolName[:maxToolNameLength]
+	}
+	return toolName
+}
+
+// serverTools adapts the tools of a server, plus its resources and prompts if it has any, to agent tools.
+func serverTools(ctx context.Context, client *Client) ([]agent.Tool, error) {
+	tools, err := client.ListTools(ctx)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "cannot list tools", 0)
+	}
+	resources, err := client.ListResources(ctx)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "cannot list resources", 0)
+	}
+	prompts, err := client.ListPrompts(ctx)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "cannot list prompts", 0)
+	}
+
+	adapted := make([]agent.Tool, 0, len(tools)+2)
+	for _, tool := range tools {
+		adapted = append(adapted, &toolAdapter{client: client, tool: tool})
+	}
+	if len(resources) != 0 {
+		adapted = append(adapted, &resourceReader{client: client, resources: resources})
+	}
+	if len(prompts) != 0 {
+		adapted = append(adapted, &promptGetter{client: client, prompts: prompts})
+	}
+	return adapted, nil
+}
+
+// toolAdapter offers an MCP tool to the model.
+type toolAdapter struct {
+	client *Client
+	tool   Tool
+}
+
+func (t *toolAdapter) Definition() llm.Tool {
+	parameters := t.tool.InputSchema
+	if parameters == nil {
+		parameters = map[string]any{"type": "object"}
+	}
+	return llm.Tool{
+		Name:        ToolName(t.client.Name(), t.tool.Name),
+		Description: fmt.Sprintf("[MCP server %s] %s", t.client.Name(), t.tool.Description),
+		Parameters:  parameters,
+	}
+}
+
+func (t *toolAdapter) Call(ctx context.Context, arguments string) (string, error) {
+	result, err := t.client.CallTool(ctx, t.tool.Name, json.RawMessage(arguments))
+	if err != nil {
+		return "", err
+	}
+	text := contentText(result.Content)
+	if result.IsError {
+		return "", errors.New(text)
+	}
+	return text, nil
+}
+
+// resourceReader offers the resources of an MCP server to the model as a single tool which takes the resource uri.
+type resourceReader struct {
+	client    *Client
+	resources []Resource
+}
+
+func (r *resourceReader) Definition() llm.Tool {
+	var description strings.Builder
+	fmt.Fprintf(&description, "[MCP server %s] Reads a resource. The available resources are:\n", r.client.Name())
+	for _, resource := range r.resources {
+		fmt.Fprintf(&description, "- %s (%s) %s\n", resource.URI, resource.Name, resource.Description)
+	}
+	return llm.Tool{
+		Name:        ToolName(r.client.Name(), "read_resource"),
+		Description: description.String(),
+		Parameters: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"uri": map[string]any{"type": "string", "description": "The uri of the resource to read."},
+			},
+			"required": []string{"uri"},
+		},
+	}
+}
+
+func (r *resourceReader) Call(ctx context.Context, arguments string) (string, error) {
+	var args readResourceParams
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return "", errors.WrapPrefix(err, "invalid arguments", 0)
+	}
+	contents, err := r.client.ReadResource(ctx, args.URI)
+	if err != nil {
+		return "", err
+	}
+	texts := make([]string, 0, len(contents))
+	for _, content := range contents {
+		texts = append(texts, resourceText(content))
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+// promptGetter offers the prompts of an MCP server to the model as a single tool which takes the prompt name.
+type promptGetter struct {
+	client  *Client
+	prompts []Prompt
+}
+
+func (p *promptGetter) Definition() llm.Tool {
+	var description strings.Builder
+	fmt.Fprintf(&description, "[MCP server %s] Gets a prompt template, filled in with the given arguments. The available prompts are:\n", p.client.Name())
+	for _, prompt := range p.prompts {
+		fmt.Fprintf(&description, "- %s: %s", prompt.Name, prompt.Description)
+		for _, argument := range prompt.Arguments {
+			required := ""
+			if argument.Required {
+				required = ", required"
+			}
+			fmt.Fprintf(&description, " [argument %s%s: %s]", argument.Name, required, argument.Description)
+		}
+		description.WriteRune('\n')
+	}
+	return llm.Tool{
+		Name:        ToolName(p.client.Name(), "get_prompt"),
+		Description: description.String(),
+		Parameters: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"name": map[string]any{"type": "string", "description": "The name of the prompt."},
+				"arguments": map[string]any{
+					"type":                 "object",
+					"description":          "The prompt arguments, as string values keyed by argument name.",
+					"additionalProperties": map[string]any{"type": "string"},
+				},
+			},
+			"required": []string{"name"},
+		},
+	}
+}
+
+func (p *promptGetter) Call(ctx context.Context, arguments string) (string, error) {
+	var args getPromptParams
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return "", errors.WrapPrefix(err, "invalid arguments", 0)
+	}
+	result, err := p.client.GetPrompt(ctx, args.Name, args.Arguments)
+	if err != nil {
+		return "", err
+	}
+	var buf strings.Builder
+	for _, message := range result.Messages {
+		fmt.Fprintf(&buf, "%s: %s\n", message.Role, contentText([]Content{message.Content}))
+	}
+	return buf.String(), nil
+}
+
+func contentText(contents []Content) string {
+	texts := make([]string, 0, len(contents))
+	for _, content := range contents {
+		switch {
+		case content.Resource != nil:
+			texts = append(texts, resourceText(*content.Resource))
+		case content.Type == "text":
+			texts = append(texts, content.Text)
+		default:
+			texts = append(texts, fmt.Sprintf("(%s content type: %s)", content.Type, content.MIMEType))
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+func resourceText(content ResourceContents) string {
+	if content.Blob != "" {
+		return fmt.Sprintf("(binary resource uri: %s type: %s)", content.URI, content.MIMEType)
+	}
+	return content.Text
+}
@@ -0,0 +1,182 @@
+package repl
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-errors/errors"
+
+	"github.com/jlcheng/jcllm/dye"
+	"github.com/jlcheng/jcllm/llm"
+	"github.com/jlcheng/jcllm/session"
+)
+
+// The branches of the conversation form a tree of session.Branch. The conversation of the current branch lives in
+// replCtx.session, and is copied back into replCtx.branches before switching to another branch or saving the session.
+// replCtx.branches is nil until the first fork.
+
+// fork starts a new branch made of the first n entries of the conversation. The current branch keeps all of its
+// entries, so the user can switch back to it with /c branches.
+func (replCtx *ReplContext) fork(n int) {
+	replCtx.syncBranch()
+	replCtx.branches = append(replCtx.branches, session.Branch{
+		Parent:    replCtx.currentBranch,
+		ForkPoint: n,
+		Entries:   slices.Clone(replCtx.session.Entries[:n]),
+	})
+	replCtx.switchBranch(len(replCtx.branches) - 1)
+}
+
+// switchBranch makes the i-th branch the current conversation.
+func (replCtx *ReplContext) switchBranch(i int) {
+	replCtx.syncBranch()
+	replCtx.currentBranch = i
+	replCtx.session.Entries = replCtx.branches[i].Entries
+}
+
+// syncBranch records the current conversation in its branch, creating the root branch if needed.
+func (replCtx *ReplContext) syncBranch() {
+	if len(replCtx.branches) == 0 {
+		replCtx.branches = []session.Branch{{Parent: -1}}
+		replCtx.currentBranch = 0
+	}
+	current := &replCtx.branches[replCtx.currentBranch]
+	current.Entries = replCtx.session.Entries
+	// Undo may have removed entries shared with the parent
+	current.ForkPoint = min(current.ForkPoint, len(current.Entries))
+}
+
+// resetBranches forgets the alternatives of the conversation, when it is replaced.
+func (replCtx *ReplContext) resetBranches() {
+	replCtx.branches = nil
+	replCtx.currentBranch = 0
+}
+
+// lastUserEntry returns the index of the last user entry of the conversation, or -1 if there is none.
+func (replCtx *ReplContext) lastUserEntry() int {
+	for i, entry := range slices.Backward(replCtx.session.Entries) {
+		if entry.Role == llm.RoleUser {
+			return i
+		}
+	}
+	return -1
+}
+
+// NewRetryCmd creates a command which asks the model to answer the last user message again. The previous answer is
+// kept on its own branch.
+func NewRetryCmd(replCtx *ReplContext) CmdIfc {
+	return NewLambdaCmd(func() error {
+		i := replCtx.lastUserEntry()
+		if i < 0 {
+			return errors.Errorf("nothing to retry")
+		}
+		if i < len(replCtx.session.Entries)-1 {
+			replCtx.fork(i + 1)
+			fmt.Println(dye.Strf("[Retrying on branch %d]", replCtx.currentBranch+1).As(dye.RoleStatus))
+		}
+		return replCtx.respond()
+	})
+}
+
+// NewEditCmd creates a command which replaces the last user message with text, and submits it again. When text is
+// blank, the user edits the previous message in place, unless it spans several lines, which a single input line cannot
+// hold. The previous message and its answer are kept on their own branch.
+func NewEditCmd(replCtx *ReplContext, text string) CmdIfc {
+	return NewLambdaCmd(func() error {
+		i := replCtx.lastUserEntry()
+		if i < 0 {
+			return errors.Errorf("no message to edit")
+		}
+		previous := replCtx.session.Entries[i]
+		if text == "" {
+			if strings.Contains(strings.TrimSpace(previous.Text()), "\n") {
+				return errors.Errorf("cannot edit a multi-line message in place, use /c edit <text> to replace it")
+			}
+			replCtx.readline.SetPrompt(fmt.Sprintf("%s ", dye.Str("[Edit]:").As(dye.RolePrompt)))
+			line, err := replCtx.readline.ReadLineWithDefault(strings.TrimSpace(previous.Text()))
+			replCtx.UpdatePrompt()
+			if err != nil {
+				return nil
+			}
+			text = strings.TrimSpace(line)
+		}
+		if text == "" {
+			fmt.Println(dye.Str("[Edit cancelled]").As(dye.RoleStatus))
+			return nil
+		}
+		replCtx.fork(i)
+		entry := llm.NewTextEntry(llm.RoleUser, text)
+		entry.Parts = append(entry.Parts, previous.Attachments()...)
+		replCtx.session.Entries = append(replCtx.session.Entries, entry)
+		fmt.Println(dye.Strf("[Edited on branch %d]", replCtx.currentBranch+1).As(dye.RoleStatus))
+		return replCtx.respond()
+	})
+}
+
+// NewUndoCmd creates a command which removes the last user message and everything after it.
+func NewUndoCmd(replCtx *ReplContext) CmdIfc {
+	return NewLambdaCmd(func() error {
+		i := replCtx.lastUserEntry()
+		if i < 0 {
+			return errors.Errorf("nothing to undo")
+		}
+		removed := len(replCtx.session.Entries) - i
+		replCtx.session.Entries = replCtx.session.Entries[:i]
+		if len(replCtx.branches) > 0 {
+			replCtx.syncBranch()
+		}
+		replCtx.autosave()
+		fmt.Println(dye.Strf("[Removed the last exchange, %d entries]", removed).As(dye.RoleStatus))
+		return nil
+	})
+}
+
+// NewForkCmd creates a command which starts a new branch after the given entry, as numbered by /c history. The next
+// message continues the conversation from there.
+func NewForkCmd(replCtx *ReplContext, args string) CmdIfc {
+	return NewLambdaCmd(func() error {
+		n, err := strconv.Atoi(args)
+		if err != nil || n < 0 || n > len(replCtx.session.Entries) {
+			return errors.Errorf("usage: /c fork <entry>, where entry is from 0 to %d, as numbered by /c history", len(replCtx.session.Entries))
+		}
+		replCtx.fork(n)
+		replCtx.autosave()
+		fmt.Println(dye.Strf("[Branch %d started after entry %d]", replCtx.currentBranch+1, n).As(dye.RoleStatus))
+		return nil
+	})
+}
+
+// NewBranchesCmd creates a command which lists the branches of the conversation, or switches to the given branch.
+func NewBranchesCmd(replCtx *ReplContext, args string) CmdIfc {
+	return NewLambdaCmd(func() error {
+		replCtx.syncBranch()
+		if args != "" {
+			n, err := strconv.Atoi(args)
+			if err != nil || n < 1 || n > len(replCtx.branches) {
+				return errors.Errorf("usage: /c branches [branch], where branch is from 1 to %d", len(replCtx.branches))
+			}
+			replCtx.switchBranch(n - 1)
+			replCtx.autosave()
+			fmt.Println(dye.Strf("[Switched to branch %d with %d entries]", n, len(replCtx.session.Entries)).As(dye.RoleStatus))
+			return nil
+		}
+		for i, b := range replCtx.branches {
+			current := " "
+			if i == replCtx.currentBranch {
+				current = "*"
+			}
+			origin := "original conversation"
+			if b.Parent >= 0 {
+				origin = fmt.Sprintf("from branch %d after entry %d", b.Parent+1, b.ForkPoint)
+			}
+			preview := ""
+			if b.ForkPoint < len(b.Entries) {
+				preview = summarizeEntry(b.Entries[b.ForkPoint])
+			}
+			fmt.Printf("%s %-4d%-36s%-12s%s\n", current, i+1, origin, fmt.Sprintf("%d entries", len(b.Entries)), preview)
+		}
+		return nil
+	})
+}
@@ -5,14 +5,24 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"mime"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/go-errors/errors"
 
+	"github.com/jlcheng/jcllm/agent"
+	"github.com/jlcheng/jcllm/configuration"
 	"github.com/jlcheng/jcllm/configuration/keys"
 	"github.com/jlcheng/jcllm/dye"
 	"github.com/jlcheng/jcllm/llm"
+	"github.com/jlcheng/jcllm/markdown"
+	"github.com/jlcheng/jcllm/session"
+	"github.com/jlcheng/jcllm/usage"
 )
 
 type (
@@ -44,7 +54,24 @@ func NewHelpCmd(_ *ReplContext) CmdIfc {
 		fmt.Printf("  %-20sQuits the program\n", "/quit")
 		fmt.Printf("  %-20sPrints a summary of the chat history\n", "/c history")
 		fmt.Printf("  %-20sClears the chat history\n", "/c clear ")
+		fmt.Printf("  %-20sAsks the model to answer the last message again, keeping the previous answer on a branch\n", "/c retry")
+		fmt.Printf("  %-20sChanges the last message and submits it again, keeping the original on a branch\n", "/c edit [text]")
+		fmt.Printf("  %-20sRemoves the last message and its answer\n", "/c undo")
+		fmt.Printf("  %-20sStarts a new branch after an entry of /c history\n", "/c fork <entry>")
+		fmt.Printf("  %-20sLists the branches of the conversation, or switches to one\n", "/c branches [n]")
 		fmt.Printf("  %-20sSuppresses the @ground feature when using Gemini\n", "/c suppress")
+		fmt.Printf("  %-20sToggles agent mode, which lets the model read files, list directories, and run commands\n", "/c agent")
+		fmt.Printf("  %-20sToggles raw output, which prints responses as markdown instead of rendering them\n", "/c raw")
+		fmt.Printf("  %-20sShows the token usage and cost of this session, by model\n", "/c usage")
+		fmt.Printf("  %-20sSaves the conversation under a name\n", "/c save <name>")
+		fmt.Printf("  %-20sLoads a saved conversation\n", "/c load <name>")
+		fmt.Printf("  %-20sLists the saved conversations\n", "/c sessions")
+		fmt.Printf("  %-20sAttaches an image or a PDF to the next message. Without a path, lists the pending attachments\n", "/c attach [path]")
+		fmt.Printf("  %-20sShows the generation settings, or sets one, e.g., /c set temperature 0.2. Omit the value to restore the configured one\n", "/c set [name value]")
+		fmt.Printf("  %-20sLists the profiles of the configuration file, or switches to one, or to none with -\n", "/c profile [name|-]")
+		fmt.Printf("  %-20sLists the MCP servers\n", "/c mcp list")
+		fmt.Printf("  %-20sLists the tools offered by MCP servers\n", "/c mcp tools [name]")
+		fmt.Printf("  %-20sRestarts an MCP server\n", "/c mcp restart <name>")
 		fmt.Printf("  %-20sChange models\n", "/m <model_name>")
 		fmt.Printf("  %-20sStart with 3 periods (...) to enter multi-line text; End with a single period on its own line\n", "...")
 		return nil
@@ -55,9 +82,9 @@ func NewHelpCmd(_ *ReplContext) CmdIfc {
 func NewPrintErrCmd(replCtx *ReplContext, err error) CmdIfc {
 	return NewLambdaCmd(func() error {
 		if err := replCtx.ResetInput(); err != nil {
-			fmt.Printf("<Error>An error occured when resetting the input buffer: %s</Error>\n", err.Error())
+			fmt.Println(dye.Strf("<Error>An error occured when resetting the input buffer: %s</Error>", err.Error()).As(dye.RoleError))
 		}
-		fmt.Printf("<Error>%s</Error>\n", strings.TrimRight(err.Error(), "\n"))
+		fmt.Println(dye.Strf("<Error>%s</Error>", strings.TrimRight(err.Error(), "\n")).As(dye.RoleError))
 		return nil
 	})
 }
@@ -74,62 +101,191 @@ func NewAppendCmd(replCtx *ReplContext, text string) CmdIfc {
 // NewSubmitCmd creates a command which takes the pending input and submit it to a LLM for processing.
 func NewSubmitCmd(replCtx *ReplContext) CmdIfc {
 	return NewLambdaCmd(func() error {
-		startTime := time.Now()
-		// We want to ensure the suppress command is only applied for one turn of conversation.
-		defer func() { replCtx.solicitResponseArgs[keys.ArgNameSuppress] = keys.False }()
-		session := &replCtx.session
-		session.Entries = append(session.Entries, llm.ChatEntry{
-			Role: llm.RoleUser,
-			Text: replCtx.inputBuffer.String(),
-		})
+		entry := llm.NewTextEntry(llm.RoleUser, replCtx.inputBuffer.String())
+		entry.Parts = append(entry.Parts, replCtx.attachments...)
+		replCtx.session.Entries = append(replCtx.session.Entries, entry)
+		replCtx.attachments = nil
 		// Reset the input states as soon as possible, since there are multiple places where this method might return early
 		if err := replCtx.ResetInput(); err != nil {
 			return errors.WrapPrefix(err, "input reset failed", 0)
 		}
+		return replCtx.respond()
+	})
+}
+
+// respond asks the model to answer the last user entry of the session, and appends the answer to the session.
+//
+// In agent mode, the model may respond with tool calls. The tools are run locally, their results are appended to the
+// session, and the model is asked again until it gives a final answer or the maximum number of steps is reached.
+//
+// Ctrl-C interrupts the turn instead of quitting the REPL. A partial response is kept, marked as truncated.
+func (replCtx *ReplContext) respond() error {
+	// We want to ensure the suppress command is only applied for one turn of conversation.
+	defer func() { replCtx.suppressMentions = false }()
+	ctx, stop := signal.NotifyContext(replCtx.ctx, os.Interrupt)
+	defer stop()
+	session := &replCtx.session
 
-		resp, err := replCtx.provider.SolicitResponse(context.Background(), llm.SolicitResponseInput{
-			ModelName: replCtx.modelName,
-			Conversation: llm.Conversation{
-				Entries: session.Entries,
-			},
-			Args: replCtx.solicitResponseArgs,
-		})
+	maxSteps := replCtx.config.Int(keys.OptionAgentMaxSteps)
+	for step := 1; ; step++ {
+		entry, err := replCtx.solicitResponse(ctx)
 		if err != nil {
 			// We allow users to append mentions at the end of the input, e.g., "What happened today. @ground". This means an input with
 			// only mentions appear blank _after_ preprocessing. Thus, we need to handle blank inputs again here.
 			// Maybe using mentions as a UI element is not a good idea?
-			if errors.Is(err, llm.ErrBlankInput) {
+			if errors.Is(err, llm.ErrBlankInput) && session.Entries[len(session.Entries)-1].Role == llm.RoleUser {
 				session.Entries = session.Entries[:len(session.Entries)-1]
 				return nil
 			}
-			return errors.WrapPrefix(err, "request to llm failed", 0)
+			return err
 		}
-		var responseBuffer strings.Builder
-
-		tokens := 0
-		fmt.Println(dye.Strf("[%s]:", replCtx.modelName).Bold().Yellow())
-		for message, err := range resp.Messages {
+		if entry.Truncated && entry.Text() == "" {
+			// Nothing arrived before the interruption, so the question is withdrawn as if it was never asked
+			if session.Entries[len(session.Entries)-1].Role == llm.RoleUser {
+				session.Entries = session.Entries[:len(session.Entries)-1]
+			}
+			return nil
+		}
+		session.Entries = append(session.Entries, entry)
+		replCtx.autosave()
+		if !replCtx.agentMode || len(entry.ToolCalls) == 0 {
+			replCtx.validateResponse(entry)
+			return nil
+		}
+		for _, call := range entry.ToolCalls {
+			fmt.Println(dye.Strf("[tool] %s %s", call.Name, call.Arguments).As(dye.RoleTool))
+			result, err := replCtx.tools.Call(ctx, call)
 			if err != nil {
-				if errors.Is(err, io.EOF) {
-					break
-				}
-				return errors.WrapPrefix(err, "error read from llm stream", 0)
+				fmt.Println(dye.Strf("[tool] %s failed: %v", call.Name, err).As(dye.RoleError))
+			} else {
+				fmt.Println(dye.Strf("[tool] %s returned %d bytes", call.Name, len(result)).As(dye.RoleTool))
 			}
-			// Print out each token as soon as it arrives
-			fmt.Print(message.Text)
-			responseBuffer.WriteString(message.Text)
-			tokens += message.TokenCount
+			session.Entries = append(session.Entries, agent.ResultEntry(call, result, err))
 		}
-		fmt.Println()
-		elapsedTime := time.Since(startTime)
-		tokensPerSec := float64(tokens) / math.Max(1, elapsedTime.Seconds())
-		fmt.Printf("[%.2f tokens/s, %.2fs, %d tokens]\n", tokensPerSec, elapsedTime.Seconds(), tokens)
-		session.Entries = append(session.Entries, llm.ChatEntry{
-			Role: llm.RoleAssistant,
-			Text: responseBuffer.String(),
-		})
-		return nil
-	})
+		if ctx.Err() != nil {
+			fmt.Println(dye.Str("[Agent interrupted]").As(dye.RoleStatus))
+			return nil
+		}
+		if step >= maxSteps {
+			fmt.Println(dye.Strf("[Agent stopped after %d steps]", step).As(dye.RoleStatus))
+			return nil
+		}
+	}
+}
+
+// autosave saves the session, reporting rather than returning errors, since the conversation can continue without it.
+func (replCtx *ReplContext) autosave() {
+	if err := replCtx.SaveSession(); err != nil {
+		replCtx.logger.Errorf("cannot autosave session: %v", err)
+		fmt.Println(dye.Strf("<Error>cannot autosave session: %s</Error>", err).As(dye.RoleError))
+	}
+}
+
+// validateResponse reports how a complete response does not conform to the schema set by --schema, if any.
+func (replCtx *ReplContext) validateResponse(entry llm.ChatEntry) {
+	if replCtx.responseSchema == nil || entry.Truncated || len(entry.ToolCalls) > 0 {
+		return
+	}
+	var schemaErr *llm.SchemaError
+	if err := llm.ValidateResponse(replCtx.responseSchema, entry.Text()); errors.As(err, &schemaErr) {
+		fmt.Println(dye.Str("[Response does not match the schema]").As(dye.RoleError))
+		for _, violation := range schemaErr.Violations {
+			fmt.Println(dye.Strf("  %s", violation).As(dye.RoleError))
+		}
+	}
+}
+
+// solicitResponse sends the session to the model, streams the response to stdout, and returns the response as a chat
+// entry. The entry is not added to the session. If ctx is cancelled, the response received so far is returned, marked
+// as truncated and without tool calls, which may be incomplete.
+func (replCtx *ReplContext) solicitResponse(ctx context.Context) (llm.ChatEntry, error) {
+	settings, err := llm.SettingsFromConfig(replCtx.config, replCtx.modelName)
+	if err != nil {
+		return llm.ChatEntry{}, err
+	}
+	startTime := time.Now()
+	input := llm.SolicitResponseInput{
+		ModelName: replCtx.modelName,
+		Conversation: llm.Conversation{
+			Entries: replCtx.session.Entries,
+		},
+		Settings:         settings.Merge(replCtx.settings),
+		Overrides:        replCtx.settings,
+		SuppressMentions: replCtx.suppressMentions,
+		ResponseSchema:   replCtx.responseSchema,
+	}
+	if replCtx.agentMode {
+		input.Tools = replCtx.tools.Definitions()
+	}
+	resp, err := replCtx.provider.SolicitResponse(ctx, input)
+	if err != nil {
+		if errors.Is(err, llm.ErrBlankInput) {
+			return llm.ChatEntry{}, err
+		}
+		if ctx.Err() != nil {
+			fmt.Println(dye.Str("[Request cancelled]").As(dye.RoleStatus))
+			return llm.ChatEntry{Role: llm.RoleAssistant, Truncated: true}, nil
+		}
+		return llm.ChatEntry{}, errors.WrapPrefix(err, "request to llm failed", 0)
+	}
+	var responseBuffer strings.Builder
+	var toolCalls []llm.ToolCall
+
+	// Markdown is rendered as it streams in, unless the user asked for raw output
+	var out io.Writer = os.Stdout
+	var renderer *markdown.Renderer
+	if !replCtx.rawOutput {
+		renderer = markdown.NewRenderer(os.Stdout)
+		out = renderer
+	}
+
+	// The router names the model it chose, which is shown and recorded instead of the requested one
+	providerName, modelName := replCtx.config.String(keys.OptionProvider), replCtx.modelName
+	if resp.Model != "" {
+		providerName, modelName = resp.Provider, resp.Model
+	}
+	var tokens llm.Usage
+	fmt.Println(dye.Strf("[%s]:", modelName).As(dye.RoleModel))
+	truncated := false
+	for message, err := range resp.Messages {
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if ctx.Err() != nil {
+				truncated = true
+				break
+			}
+			return llm.ChatEntry{}, errors.WrapPrefix(err, "error read from llm stream", 0)
+		}
+		// Print out each token as soon as it arrives
+		_, _ = io.WriteString(out, message.Text)
+		responseBuffer.WriteString(message.Text)
+		toolCalls = append(toolCalls, message.ToolCalls...)
+		tokens.Add(message.Usage())
+	}
+	if renderer != nil {
+		// Render what was held back, such as the last line of a table
+		_ = renderer.Flush()
+	}
+	fmt.Println()
+	if truncated {
+		fmt.Println(dye.Str("[Response interrupted]").As(dye.RoleStatus))
+		toolCalls = nil
+	}
+	elapsedTime := time.Since(startTime)
+	tokensPerSec := float64(tokens.OutputTokens) / math.Max(1, elapsedTime.Seconds())
+	record, err := replCtx.meter.Record(providerName, modelName, tokens)
+	if err != nil {
+		replCtx.logger.Errorf("cannot record usage: %v", err)
+		fmt.Println(dye.Strf("<Error>cannot record usage: %s</Error>", err).As(dye.RoleError))
+	}
+	replCtx.usageRecords = append(replCtx.usageRecords, record)
+	fmt.Println(dye.Strf("[%.2f tokens/s, %.2fs, %s]", tokensPerSec, elapsedTime.Seconds(), describeUsage(tokens, record.Cost)).As(dye.RoleUsage))
+	entry := llm.NewTextEntry(llm.RoleAssistant, responseBuffer.String())
+	entry.ToolCalls = toolCalls
+	entry.Truncated = truncated
+	return entry, nil
 }
 
 // NewChainCmd creates a command which runs multiple commands in sequence.
@@ -174,7 +330,7 @@ func (cmd *LambdaCmd) Execute() error {
 	return cmd.executeFunction()
 }
 
-// NewSummarizeHistoryCmd creates a command which prints the current conversation.
+// NewSummarizeHistoryCmd creates a command which prints the current conversation. Entries are numbered for /c fork.
 func NewSummarizeHistoryCmd(replCtx *ReplContext) CmdIfc {
 	roleToPrefix := func(entry llm.ChatEntry) string {
 		switch entry.Role {
@@ -182,57 +338,393 @@ func NewSummarizeHistoryCmd(replCtx *ReplContext) CmdIfc {
 			return fmt.Sprintf("%15s", "[User]: ")
 		case llm.RoleAssistant:
 			return fmt.Sprintf("%15s", "[Assistant]: ")
+		case llm.RoleTool:
+			return fmt.Sprintf("%15s", "[Tool]: ")
 		default:
 			return "[Unknown]: "
 		}
 	}
-	summarizeText := func(entry llm.ChatEntry) string {
-		summarized := strings.TrimSpace(entry.Text)
-		summarized = strings.ReplaceAll(summarized, "\n", "¶ ")
-		maxLength := 80
-		suffix := "..."
-		if len(summarized) > maxLength {
-			return summarized[:maxLength-len(suffix)] + suffix
-		}
-		return summarized
-	}
 
 	return NewLambdaCmd(func() error {
 		chatEntries := replCtx.session.Entries
 		fmt.Println("=== Conversation Summary ===")
-		for _, chatEntry := range chatEntries {
-			fmt.Println(roleToPrefix(chatEntry) + " " + summarizeText(chatEntry))
+		for i, chatEntry := range chatEntries {
+			fmt.Printf("%3d %s %s\n", i+1, roleToPrefix(chatEntry), summarizeEntry(chatEntry))
 		}
 		fmt.Println("======= End Summary ========")
 		return nil
 	})
 }
 
+// summarizeEntry returns the content of an entry on a single line of at most 80 characters, plus markers.
+func summarizeEntry(entry llm.ChatEntry) string {
+	summarized := strings.TrimSpace(entry.Text())
+	for _, attachment := range entry.Attachments() {
+		summarized = strings.TrimSpace(fmt.Sprintf("%s [%s]", summarized, attachmentName(attachment)))
+	}
+	for _, call := range entry.ToolCalls {
+		summarized = strings.TrimSpace(fmt.Sprintf("%s (call %s %s)", summarized, call.Name, call.Arguments))
+	}
+	summarized = strings.ReplaceAll(summarized, "\n", "¶ ")
+	maxLength := 80
+	suffix := "..."
+	if len(summarized) > maxLength {
+		summarized = summarized[:maxLength-len(suffix)] + suffix
+	}
+	if entry.Truncated {
+		summarized += " [truncated]"
+	}
+	return summarized
+}
+
 func NewSetModelCmd(replCtx *ReplContext, modelName string) CmdIfc {
 	return NewLambdaCmd(func() error {
 		if err := replCtx.SetModel(modelName); err != nil {
 			return err
 		}
-		fmt.Println(dye.Strf("Model set to: %s", modelName).Bold().Yellow())
+		fmt.Println(dye.Strf("Model set to: %s", modelName).As(dye.RoleStatus))
+		return nil
+	})
+}
+
+// NewProfileCmd creates a command which switches to a profile of the configuration file, or to the base configuration
+// when name is -. It lists the profiles when name is blank.
+func NewProfileCmd(replCtx *ReplContext, name string) CmdIfc {
+	return NewLambdaCmd(func() error {
+		profiles, ok := replCtx.config.(configuration.Profiles)
+		if !ok {
+			return errors.Errorf("the configuration does not support profiles")
+		}
+		if name == "" {
+			if len(profiles.ProfileNames()) == 0 {
+				fmt.Println("No profiles. Add [profiles.<name>] tables to the configuration file.")
+			}
+			for _, profile := range profiles.ProfileNames() {
+				marker := " "
+				if profile == profiles.Profile() {
+					marker = "*"
+				}
+				fmt.Printf("%s %s\n", marker, profile)
+			}
+			return nil
+		}
+		if name == "-" {
+			name = ""
+		}
+		if err := replCtx.SetProfile(name); err != nil {
+			return err
+		}
+		if name == "" {
+			name = "none"
+		}
+		fmt.Println(dye.Strf("Profile set to: %s (%s, %s)", name, replCtx.config.String(keys.OptionProvider), replCtx.modelName).As(dye.RoleStatus))
 		return nil
 	})
 }
 
 func NewSuppressCommand(replCtx *ReplContext) CmdIfc {
 	return NewLambdaCmd(func() error {
-		replCtx.solicitResponseArgs[keys.ArgNameSuppress] = keys.True
-		fmt.Printf("%q\n", replCtx.solicitResponseArgs)
+		replCtx.suppressMentions = true
+		fmt.Println(dye.Str("[Mentions suppressed for the next message]").As(dye.RoleStatus))
+		return nil
+	})
+}
+
+// NewSetCmd creates a command which overrides a generation setting for the rest of the REPL session, or shows the
+// settings when args is blank.
+func NewSetCmd(replCtx *ReplContext, args string) CmdIfc {
+	return NewLambdaCmd(func() error {
+		name, value, _ := strings.Cut(strings.TrimSpace(args), " ")
+		if name != "" {
+			if err := replCtx.settings.Set(name, value); err != nil {
+				return err
+			}
+		}
+		settings, err := llm.SettingsFromConfig(replCtx.config, replCtx.modelName)
+		if err != nil {
+			return err
+		}
+		description := settings.Merge(replCtx.settings).String()
+		if description == "" {
+			description = "provider defaults"
+		}
+		fmt.Println(dye.Strf("Generation settings for %s: %s", replCtx.modelName, description).As(dye.RoleStatus))
+		return nil
+	})
+}
+
+// NewAttachCmd creates a command which queues a file to be sent with the next message, or lists the queued files when
+// path is blank.
+func NewAttachCmd(replCtx *ReplContext, path string) CmdIfc {
+	return NewLambdaCmd(func() error {
+		if path == "" {
+			if len(replCtx.attachments) == 0 {
+				fmt.Println("No pending attachments")
+			}
+			for _, attachment := range replCtx.attachments {
+				fmt.Printf("  %-40s%-20s%d bytes\n", attachment.Name, attachment.MIMEType, len(attachment.Data))
+			}
+			return nil
+		}
+		attachment, err := readAttachment(path)
+		if err != nil {
+			return err
+		}
+		replCtx.attachments = append(replCtx.attachments, attachment)
+		fmt.Println(dye.Strf("[%s (%s) will be sent with the next message]", attachment.Name, attachment.MIMEType).As(dye.RoleStatus))
 		return nil
 	})
 }
 
+// maxAttachmentSize is the largest file accepted by `/c attach`. Providers reject larger inline content anyway.
+const maxAttachmentSize = 20 << 20
+
+// readAttachment reads a file into an inline part. The MIME type is guessed from the file extension, then from the
+// content.
+func readAttachment(path string) (llm.Part, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return llm.Part{}, errors.WrapPrefix(err, "cannot attach file", 0)
+	}
+	if stat.IsDir() {
+		return llm.Part{}, errors.Errorf("cannot attach %s: is a directory", path)
+	}
+	if stat.Size() > maxAttachmentSize {
+		return llm.Part{}, errors.Errorf("cannot attach %s: larger than %d MB", path, maxAttachmentSize>>20)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return llm.Part{}, errors.WrapPrefix(err, "cannot attach file", 0)
+	}
+	mimeType, _, _ := strings.Cut(mime.TypeByExtension(filepath.Ext(path)), ";")
+	if mimeType == "" {
+		mimeType, _, _ = strings.Cut(http.DetectContentType(data), ";")
+	}
+	return llm.InlinePart(mimeType, data, filepath.Base(path)), nil
+}
+
+// attachmentName describes an attachment in the conversation summary.
+func attachmentName(part llm.Part) string {
+	if part.Name != "" {
+		return part.Name
+	}
+	if part.URI != "" {
+		return part.URI
+	}
+	return part.MIMEType
+}
+
 func NewClearConversationCommand(replCtx *ReplContext) CmdIfc {
 	return NewLambdaCmd(func() error {
-		replCtx.session.Entries = replCtx.session.Entries[:0]
-		fmt.Println(dye.Str("[Current conversation cleared]").Bold().Yellow())
+		// Start a new session, so the saved copy of the cleared conversation is kept
+		replCtx.session.Entries = nil
+		replCtx.attachments = nil
+		replCtx.resetBranches()
+		replCtx.sessionName = replCtx.sessions.NewName()
+		fmt.Println(dye.Str("[Current conversation cleared]").As(dye.RoleStatus))
 		if err := replCtx.ResetInput(); err != nil {
 			return err
 		}
 		return nil
 	})
 }
+
+func NewToggleAgentCommand(replCtx *ReplContext) CmdIfc {
+	return NewLambdaCmd(func() error {
+		replCtx.agentMode = !replCtx.agentMode
+		if replCtx.agentMode {
+			fmt.Println(dye.Str("[Agent mode enabled]").As(dye.RoleStatus))
+		} else {
+			fmt.Println(dye.Str("[Agent mode disabled]").As(dye.RoleStatus))
+		}
+		return nil
+	})
+}
+
+// NewUsageCmd creates a command which prints the token usage and cost of the responses since the REPL started, by
+// model.
+func NewUsageCmd(replCtx *ReplContext) CmdIfc {
+	return NewLambdaCmd(func() error {
+		if len(replCtx.usageRecords) == 0 {
+			fmt.Println(dye.Str("[No responses yet]").As(dye.RoleStatus))
+			return nil
+		}
+		var total usage.Total
+		for _, row := range usage.Summarize(replCtx.usageRecords) {
+			fmt.Printf("  %-40s%s\n", row.Provider+"/"+row.Model, describeTotal(row.Total))
+		}
+		for _, record := range replCtx.usageRecords {
+			total.Add(record)
+		}
+		fmt.Println(dye.Strf("[Session total: %s]", describeTotal(total)).As(dye.RoleStatus))
+		return nil
+	})
+}
+
+// describeUsage describes the tokens and cost of a response, e.g., "1200 input tokens (800 cached), 300 output tokens,
+// $0.0042". The cost is left out when the model has no price.
+func describeUsage(tokens llm.Usage, cost *float64) string {
+	description := fmt.Sprintf("%d input tokens", tokens.InputTokens)
+	if tokens.CachedTokens > 0 {
+		description += fmt.Sprintf(" (%d cached)", tokens.CachedTokens)
+	}
+	description += fmt.Sprintf(", %d output tokens", tokens.OutputTokens)
+	if tokens.ReasoningTokens > 0 {
+		description += fmt.Sprintf(" (%d reasoning)", tokens.ReasoningTokens)
+	}
+	if cost != nil {
+		description += fmt.Sprintf(", $%.4f", *cost)
+	}
+	return description
+}
+
+func describeTotal(total usage.Total) string {
+	var cost *float64
+	if total.Unpriced < total.Requests {
+		cost = &total.Cost
+	}
+	description := fmt.Sprintf("%d responses, %s", total.Requests, describeUsage(total.Usage, cost))
+	if total.Unpriced > 0 {
+		description += fmt.Sprintf(", %d without a price", total.Unpriced)
+	}
+	return description
+}
+
+// NewToggleRawOutputCommand creates a command which toggles between rendering the markdown of responses and printing
+// it as is.
+func NewToggleRawOutputCommand(replCtx *ReplContext) CmdIfc {
+	return NewLambdaCmd(func() error {
+		replCtx.rawOutput = !replCtx.rawOutput
+		if replCtx.rawOutput {
+			fmt.Println(dye.Str("[Raw output enabled]").As(dye.RoleStatus))
+		} else {
+			fmt.Println(dye.Str("[Raw output disabled]").As(dye.RoleStatus))
+		}
+		return nil
+	})
+}
+
+// NewMCPCmd creates a command which manages the MCP servers. The subcommands are: list, tools [name], restart <name>.
+func NewMCPCmd(replCtx *ReplContext, args string) CmdIfc {
+	return NewLambdaCmd(func() error {
+		fields := strings.Fields(args)
+		if len(fields) == 0 {
+			fields = []string{"list"}
+		}
+		switch fields[0] {
+		case "list":
+			servers := replCtx.mcp.Servers()
+			if len(servers) == 0 {
+				fmt.Printf("No MCP servers are configured. Add them to the [%s.<name>] tables of .jcllm.toml.\n", keys.OptionMCPServers)
+			}
+			for _, server := range servers {
+				status := "running"
+				if server.Err != nil {
+					status = fmt.Sprintf("failed: %v", server.Err)
+				} else if !server.Running {
+					status = "stopped"
+				}
+				fmt.Printf("  %-20s%-40s%s\n", server.Name, server.Command, status)
+			}
+		case "tools":
+			for _, server := range replCtx.mcp.Servers() {
+				if len(fields) > 1 && fields[1] != server.Name {
+					continue
+				}
+				if !server.Running {
+					continue
+				}
+				ctx, cancel := context.WithTimeout(replCtx.ctx, mcpTimeout)
+				tools, err := replCtx.mcp.Tools(ctx, server.Name)
+				cancel()
+				if err != nil {
+					return errors.WrapPrefix(err, fmt.Sprintf("cannot list tools of [%s]", server.Name), 0)
+				}
+				fmt.Println(dye.Strf("=== %s ===", server.Name).As(dye.RoleStatus))
+				for _, tool := range tools {
+					definition := tool.Definition()
+					fmt.Printf("  %s\n      %s\n", definition.Name, strings.ReplaceAll(strings.TrimSpace(definition.Description), "\n", "\n      "))
+				}
+			}
+			if !replCtx.agentMode {
+				fmt.Println("MCP tools are only offered to the model in agent mode, see /c agent")
+			}
+		case "restart":
+			if len(fields) < 2 {
+				return errors.Errorf("usage: /c mcp restart <name>")
+			}
+			ctx, cancel := context.WithTimeout(replCtx.ctx, mcpTimeout)
+			defer cancel()
+			if err := replCtx.mcp.Restart(ctx, fields[1]); err != nil {
+				return err
+			}
+			if err := replCtx.RefreshMCPTools(); err != nil {
+				return err
+			}
+			fmt.Println(dye.Strf("[MCP server %s restarted]", fields[1]).As(dye.RoleStatus))
+		default:
+			return errors.Errorf("unknown mcp command: %s", fields[0])
+		}
+		return nil
+	})
+}
+
+func NewSaveSessionCmd(replCtx *ReplContext, name string) CmdIfc {
+	return NewLambdaCmd(func() error {
+		if name == "" {
+			return errors.Errorf("usage: /c save <name>")
+		}
+		if name != replCtx.sessionName {
+			// Any other outcome, such as a session which cannot be decoded, means there is something to overwrite
+			_, err := replCtx.sessions.Load(name)
+			exists := !errors.Is(err, session.ErrSessionNotFound) && !errors.Is(err, session.ErrInvalidName)
+			if exists && !replCtx.Confirm(fmt.Sprintf("Overwrite the saved session %s?", name)) {
+				fmt.Println(dye.Str("[Save cancelled]").As(dye.RoleStatus))
+				return nil
+			}
+		}
+		previousName := replCtx.sessionName
+		replCtx.sessionName = name
+		if err := replCtx.SaveSession(); err != nil {
+			replCtx.sessionName = previousName
+			return errors.WrapPrefix(err, "cannot save session", 0)
+		}
+		fmt.Println(dye.Strf("[Session saved as %s]", name).As(dye.RoleStatus))
+		return nil
+	})
+}
+
+func NewLoadSessionCmd(replCtx *ReplContext, name string) CmdIfc {
+	return NewLambdaCmd(func() error {
+		if name == "" {
+			return errors.Errorf("usage: /c load <name>")
+		}
+		saved, err := replCtx.sessions.Load(name)
+		if err != nil {
+			return errors.WrapPrefix(err, "cannot load session", 0)
+		}
+		return replCtx.LoadSession(saved)
+	})
+}
+
+func NewListSessionsCmd(replCtx *ReplContext) CmdIfc {
+	return NewLambdaCmd(func() error {
+		sessions, err := replCtx.sessions.List()
+		if err != nil {
+			return errors.WrapPrefix(err, "cannot list sessions", 0)
+		}
+		if len(sessions) == 0 {
+			fmt.Println("No saved sessions")
+			return nil
+		}
+		for _, saved := range sessions {
+			current := " "
+			if saved.Name == replCtx.sessionName {
+				current = "*"
+			}
+			fmt.Printf("%s %-24s%-20s%-30s%d entries\n", current, saved.Name,
+				saved.UpdatedAt.Format("2006-01-02 15:04"), saved.Model, len(saved.Conversation.Entries))
+		}
+		return nil
+	})
+}
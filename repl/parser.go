@@ -25,14 +25,23 @@ func (c commandParserStruct) Parse(line string) CmdIfc {
 func NewSlashCommandParser(replCtx *ReplContext) CommandParser {
 	return ParseFunc(func(line string) CmdIfc {
 		tuple := strings.SplitN(strings.TrimSpace(line), " ", 2)
-		if tuple[0] != "/c" {
+		if tuple[0] != "/c" || len(tuple) < 2 {
 			return nil
 		}
-		cmdName := tuple[1]
+		cmdName := strings.TrimSpace(tuple[1])
 		commandDefinitions := replCtx.cmdDefinitions.Commands()
 		if command, ok := commandDefinitions[cmdName]; ok {
 			return command
 		}
+		// Commands which take arguments are looked up by their first word, the rest of the line are the arguments
+		nameAndArgs := strings.SplitN(cmdName, " ", 2)
+		if newCommand, ok := replCtx.cmdDefinitions.ArgCommands()[nameAndArgs[0]]; ok {
+			args := ""
+			if len(nameAndArgs) == 2 {
+				args = strings.TrimSpace(nameAndArgs[1])
+			}
+			return newCommand(args)
+		}
 		return nil
 	})
 }
@@ -5,19 +5,30 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"time"
 
 	"github.com/ergochat/readline"
 	"github.com/go-errors/errors"
+	"github.com/jlcheng/jcllm/agent"
 	"github.com/jlcheng/jcllm/configuration"
 	"github.com/jlcheng/jcllm/configuration/keys"
 	"github.com/jlcheng/jcllm/dye"
 	"github.com/jlcheng/jcllm/llm"
+	"github.com/jlcheng/jcllm/llm/providers/registry"
 	"github.com/jlcheng/jcllm/log"
+	"github.com/jlcheng/jcllm/mcp"
+	"github.com/jlcheng/jcllm/session"
+	"github.com/jlcheng/jcllm/usage"
 )
 
 const MultiLinePrefix = "..."
 
+// mcpTimeout bounds how long the REPL waits for MCP servers to start or list their tools.
+const mcpTimeout = 30 * time.Second
+
 type ReplContext struct {
+	// ctx is cancelled when the REPL stops. Each request to the model derives a context from it, which Ctrl-C cancels.
+	ctx                     context.Context
 	config                  configuration.Configuration
 	logger                  *log.Logger
 	stopRepl                bool
@@ -29,21 +40,77 @@ type ReplContext struct {
 	completer               readline.AutoCompleter
 	cmdDefinitions          CommandsProvider
 	isMultiLineInputEnabled bool
-	solicitResponseArgs     map[string]string
+	// settings are the generation settings set with `/c set`, which override the configured ones.
+	settings llm.GenerationSettings
+	// attachments are queued by `/c attach` and sent with the next submission.
+	attachments []llm.Part
+	// responseSchema is the JSON schema set by --schema, which every response must conform to.
+	responseSchema map[string]any
+	// rawOutput prints responses as they arrive, instead of rendering their markdown.
+	rawOutput bool
+	// meter prices the usage of each response and records it in the ledger. usageRecords are those of this REPL.
+	meter        *usage.Meter
+	usageRecords []usage.Record
+	// rules validate the configuration of a profile before the REPL switches to it.
+	rules map[string]configuration.Rule
+	// suppressMentions is set by `/c suppress` for the next submission only.
+	suppressMentions bool
+	agentMode        bool
+	tools            *agent.Registry
+	mcp              *mcp.Manager
+	// mcpToolNames are the names of the MCP tools currently in tools, so they can be replaced when a server restarts.
+	mcpToolNames []string
+	sessions     *session.Store
+	// sessionName is the name under which the conversation is autosaved.
+	sessionName string
+	// branches are the alternative versions of the conversation created by /c retry, /c edit, and /c fork.
+	branches      []session.Branch
+	currentBranch int
 }
 
-func New(config configuration.Configuration, provider llm.ProviderIfc) (*ReplContext, error) {
+func New(ctx context.Context, config configuration.Configuration, rules map[string]configuration.Rule, provider llm.ProviderIfc) (*ReplContext, error) {
 	replCtx := &ReplContext{
-		stopRepl:            false,
-		inputBuffer:         new(strings.Builder),
-		config:              config,
-		provider:            provider,
-		logger:              log.New(config.String(keys.OptionLogFile)),
-		solicitResponseArgs: make(map[string]string),
+		ctx:         ctx,
+		stopRepl:    false,
+		inputBuffer: new(strings.Builder),
+		config:      config,
+		rules:       rules,
+		provider:    provider,
+		logger:      log.New(config.String(keys.OptionLogFile)),
+		agentMode:   config.Bool(keys.OptionAgent),
+		rawOutput:   config.Bool(keys.OptionRaw),
+		sessions:    session.NewStore(config.String(keys.OptionSessionsDir)),
+	}
+	replCtx.sessionName = replCtx.sessions.NewName()
+	if path := config.String(keys.OptionSchema); path != "" {
+		schema, err := llm.LoadSchema(path)
+		if err != nil {
+			return nil, err
+		}
+		replCtx.responseSchema = schema
+	}
+	meter, err := usage.NewMeter(config)
+	if err != nil {
+		return nil, err
 	}
+	replCtx.meter = meter
+	replCtx.tools = agent.NewRegistry(agent.BuiltinTools(replCtx.Confirm)...)
+	replCtx.mcp = mcp.NewManager(mcp.Implementation{Name: "jcllm", Version: "dev"}, mcp.ServerConfigs(config))
 	replCtx.cmdDefinitions = newCmdProviderImpl(replCtx)
 
-	var completer = readline.NewPrefixCompleter(
+	readlineInstance, err := readline.NewFromConfig(&readline.Config{
+		AutoComplete:        replCtx.newCompleter(),
+		FuncFilterInputRune: filterInput,
+	})
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "failed to create readline", 0)
+	}
+	replCtx.readline = readlineInstance
+	return replCtx, nil
+}
+
+func (replCtx *ReplContext) newCompleter() readline.AutoCompleter {
+	return readline.NewPrefixCompleter(
 		// Make this a multi-line input
 		readline.PcItem("..."),
 		// Run commands
@@ -54,15 +121,51 @@ func New(config configuration.Configuration, provider llm.ProviderIfc) (*ReplCon
 		readline.PcItem("/quit"),
 		replCtx.slashModelCompletions(),
 	)
-	readlineInstance, err := readline.NewFromConfig(&readline.Config{
-		AutoComplete:        completer,
-		FuncFilterInputRune: filterInput,
-	})
+}
+
+// SetProfile applies a profile of the configuration file, or no profile if name is blank. The provider, the model,
+// and the prices are replaced by those of the profile. The conversation is kept. The REPL is left unchanged if the
+// profile is invalid.
+func (replCtx *ReplContext) SetProfile(name string) error {
+	profiles, ok := replCtx.config.(configuration.Profiles)
+	if !ok {
+		return errors.Errorf("the configuration does not support profiles")
+	}
+	config, err := profiles.WithProfile(name)
 	if err != nil {
-		return nil, errors.WrapPrefix(err, "failed to create readline", 0)
+		return err
 	}
-	replCtx.readline = readlineInstance
-	return replCtx, nil
+	if problems := configuration.Validate(config, replCtx.rules); len(problems) != 0 {
+		messages := make([]string, len(problems))
+		for i, problem := range problems {
+			messages[i] = problem.String()
+		}
+		return errors.Errorf("invalid configuration: %s", strings.Join(messages, "; "))
+	}
+	modelName := config.String(keys.OptionModel)
+	if _, err := llm.SettingsFromConfig(config, modelName); err != nil {
+		return err
+	}
+	providerName := config.String(keys.OptionProvider)
+	provider, err := registry.NewProvider(replCtx.ctx, config, providerName)
+	if err != nil {
+		return errors.WrapPrefix(err, fmt.Sprintf("cannot instantiate provider [%s]", providerName), 0)
+	}
+	meter, err := usage.NewMeter(config)
+	if err != nil {
+		return err
+	}
+	replCtx.config, replCtx.provider, replCtx.meter, replCtx.modelName = config, provider, meter, modelName
+	replCtx.UpdatePrompt()
+	// The model completions are those of the new provider
+	if replCtx.readline != nil {
+		newConfig := replCtx.readline.GetConfig()
+		newConfig.AutoComplete = replCtx.newCompleter()
+		if err := replCtx.readline.SetConfig(newConfig); err != nil {
+			replCtx.logger.Errorf("autocomplete reset error: %v", err)
+		}
+	}
+	return nil
 }
 
 func (replCtx *ReplContext) SetModel(modelName string) error {
@@ -71,6 +174,18 @@ func (replCtx *ReplContext) SetModel(modelName string) error {
 	return nil
 }
 
+// Confirm asks the user a yes or no question, defaulting to no.
+func (replCtx *ReplContext) Confirm(question string) bool {
+	defer replCtx.UpdatePrompt()
+	replCtx.readline.SetPrompt(fmt.Sprintf("%s ", dye.Strf("%s [y/N]", question).As(dye.RolePrompt)))
+	line, err := replCtx.readline.Readline()
+	if err != nil {
+		return false
+	}
+	answer := strings.ToLower(strings.TrimSpace(line))
+	return answer == "y" || answer == "yes"
+}
+
 func (replCtx *ReplContext) ParseLine() CmdIfc {
 	slashCommandParser := NewSlashCommandParser(replCtx)
 	line, err := replCtx.readline.Readline()
@@ -141,7 +256,99 @@ func (replCtx *ReplContext) ResetInput() error {
 	return nil
 }
 
+// SaveSession saves the conversation, along with its branches, under the current session name.
+func (replCtx *ReplContext) SaveSession() error {
+	if len(replCtx.branches) > 0 {
+		replCtx.syncBranch()
+	}
+	return replCtx.sessions.Save(&session.Session{
+		Name:          replCtx.sessionName,
+		Provider:      replCtx.config.String(keys.OptionProvider),
+		Model:         replCtx.modelName,
+		SystemPrompt:  replCtx.config.String(keys.OptionSystemPrompt),
+		Conversation:  replCtx.session,
+		Branches:      replCtx.branches,
+		CurrentBranch: replCtx.currentBranch,
+	})
+}
+
+// LoadSession replaces the conversation with a saved session and continues saving to it.
+func (replCtx *ReplContext) LoadSession(saved session.Session) error {
+	replCtx.session = saved.Conversation
+	replCtx.resetBranches()
+	if saved.CurrentBranch >= 0 && saved.CurrentBranch < len(saved.Branches) {
+		replCtx.branches, replCtx.currentBranch = saved.Branches, saved.CurrentBranch
+	}
+	replCtx.sessionName = saved.Name
+	if saved.Model != "" {
+		if err := replCtx.SetModel(saved.Model); err != nil {
+			return err
+		}
+	}
+	if provider := replCtx.config.String(keys.OptionProvider); saved.Provider != "" && saved.Provider != provider {
+		fmt.Println(dye.Strf("[Session %s was created with provider %s, continuing with %s]", saved.Name, saved.Provider, provider).As(dye.RoleStatus))
+	}
+	if saved.SystemPrompt != replCtx.config.String(keys.OptionSystemPrompt) {
+		fmt.Println(dye.Strf("[Session %s was created with a different system prompt, continuing with the configured one]", saved.Name).As(dye.RoleStatus))
+	}
+	fmt.Println(dye.Strf("[Loaded session %s with %d entries]", saved.Name, len(saved.Conversation.Entries)).As(dye.RoleStatus))
+	return nil
+}
+
+// Resume loads the most recently updated session. A new session is started if there is none, such as on first use.
+func (replCtx *ReplContext) Resume() error {
+	latest, err := replCtx.sessions.Latest()
+	if errors.Is(err, session.ErrSessionNotFound) {
+		fmt.Println(dye.Str("[No session to resume, starting a new one]").As(dye.RoleStatus))
+		return nil
+	}
+	if err != nil {
+		return errors.WrapPrefix(err, "cannot resume the last session", 0)
+	}
+	if err := replCtx.LoadSession(latest); err != nil {
+		return errors.WrapPrefix(err, "cannot resume the last session", 0)
+	}
+	return nil
+}
+
+// StartMCPServers starts the configured MCP servers and registers their tools. Servers which fail to start are
+// reported, but do not prevent the REPL from starting.
+func (replCtx *ReplContext) StartMCPServers() {
+	servers := replCtx.mcp.Servers()
+	if len(servers) == 0 {
+		return
+	}
+	fmt.Println(dye.Strf("[Starting %d MCP server(s)]", len(servers)).As(dye.RoleStatus))
+	ctx, cancel := context.WithTimeout(replCtx.ctx, mcpTimeout)
+	defer cancel()
+	if err := replCtx.mcp.StartAll(ctx); err != nil {
+		replCtx.logger.Errorf("cannot start mcp servers: %v", err)
+		fmt.Println(dye.Strf("<Error>%s</Error>", err).As(dye.RoleError))
+	}
+	if err := replCtx.RefreshMCPTools(); err != nil {
+		replCtx.logger.Errorf("cannot list mcp tools: %v", err)
+		fmt.Println(dye.Strf("<Error>%s</Error>", err).As(dye.RoleError))
+	}
+}
+
+// RefreshMCPTools replaces the registered MCP tools with the tools of the currently running servers.
+func (replCtx *ReplContext) RefreshMCPTools() error {
+	for _, name := range replCtx.mcpToolNames {
+		replCtx.tools.Unregister(name)
+	}
+	replCtx.mcpToolNames = nil
+	ctx, cancel := context.WithTimeout(replCtx.ctx, mcpTimeout)
+	defer cancel()
+	tools, err := replCtx.mcp.AllTools(ctx)
+	for _, tool := range tools {
+		replCtx.tools.Register(tool)
+		replCtx.mcpToolNames = append(replCtx.mcpToolNames, tool.Definition().Name)
+	}
+	return err
+}
+
 func (replCtx *ReplContext) Close() {
+	replCtx.mcp.Close()
 	if replCtx.readline != nil {
 		if err := replCtx.readline.Close(); err != nil {
 			replCtx.logger.Errorf("failed to close readline: %v", err)
@@ -150,8 +357,9 @@ func (replCtx *ReplContext) Close() {
 	}
 }
 
-func Run(config configuration.Configuration, provider llm.ProviderIfc) error {
-	replCtx, err := New(config, provider)
+// Run starts the REPL. rules validate the configuration of the profiles which the REPL switches to.
+func Run(ctx context.Context, config configuration.Configuration, rules map[string]configuration.Rule, provider llm.ProviderIfc) error {
+	replCtx, err := New(ctx, config, rules, provider)
 	if err != nil {
 		return errors.WrapPrefix(err, "failed to create replCtx", 0)
 	}
@@ -161,8 +369,14 @@ func Run(config configuration.Configuration, provider llm.ProviderIfc) error {
 		return errors.WrapPrefix(err, fmt.Sprintf("failed to set model [%s]", modelName), 0)
 	}
 	replCtx.SetMultiLineInput(false)
+	if config.Bool(keys.OptionResume) {
+		if err := replCtx.Resume(); err != nil {
+			return err
+		}
+	}
+	replCtx.StartMCPServers()
 
-	for !replCtx.stopRepl {
+	for !replCtx.stopRepl && ctx.Err() == nil {
 		cmd := replCtx.ParseLine()
 		if err := cmd.Execute(); err != nil {
 			_ = NewPrintErrCmd(replCtx, err).Execute()
@@ -173,13 +387,17 @@ func Run(config configuration.Configuration, provider llm.ProviderIfc) error {
 }
 
 func (replCtx *ReplContext) UpdatePrompt() {
+	// There is no prompt without a terminal, such as in tests
+	if replCtx.readline == nil {
+		return
+	}
 	if replCtx.isMultiLineInputEnabled {
 		replCtx.readline.SetPrompt("")
 		return
 	}
-	promptPrefix := dye.Str("[To ").Green()
-	modelName := dye.Str(replCtx.modelName).Bold().Yellow()
-	promptSuffix := dye.Str("]:").Green()
+	promptPrefix := dye.Str("[To ").As(dye.RolePrompt)
+	modelName := dye.Str(replCtx.modelName).As(dye.RoleModel)
+	promptSuffix := dye.Str("]:").As(dye.RolePrompt)
 	formattedPrompt := fmt.Sprintf("%s%s%s ", promptPrefix, modelName, promptSuffix)
 	replCtx.readline.SetPrompt(formattedPrompt)
 }
@@ -190,9 +408,30 @@ func (replCtx *ReplContext) SetMultiLineInput(isMultiLineInputEnabled bool) {
 }
 
 func (replCtx *ReplContext) slashCommandCompletions() *readline.PrefixCompleter {
-	cmdMap := newCmdProviderImpl(replCtx).Commands()
+	cmdProvider := newCmdProviderImpl(replCtx)
 	r := make([]*readline.PrefixCompleter, 0)
-	for cmdName := range cmdMap {
+	for cmdName := range cmdProvider.Commands() {
+		r = append(r, readline.PcItem(cmdName))
+	}
+	for cmdName := range cmdProvider.ArgCommands() {
+		if cmdName == "profile" {
+			var profileNames []*readline.PrefixCompleter
+			if profiles, ok := replCtx.config.(configuration.Profiles); ok {
+				for _, name := range profiles.ProfileNames() {
+					profileNames = append(profileNames, readline.PcItem(name))
+				}
+			}
+			r = append(r, readline.PcItem(cmdName, profileNames...))
+			continue
+		}
+		if cmdName == "set" {
+			settingNames := make([]*readline.PrefixCompleter, 0, len(llm.SettingNames))
+			for _, name := range llm.SettingNames {
+				settingNames = append(settingNames, readline.PcItem(name))
+			}
+			r = append(r, readline.PcItem(cmdName, settingNames...))
+			continue
+		}
 		r = append(r, readline.PcItem(cmdName))
 	}
 	return readline.PcItem("/c", r...)
@@ -203,7 +442,7 @@ func (replCtx *ReplContext) slashModelCompletions() *readline.PrefixCompleter {
 	modelsListKey := fmt.Sprintf("%s-%s", providerName, keys.OptionModelsList)
 	models := replCtx.config.Strings(modelsListKey)
 	if len(models) == 0 {
-		fetchedModels, err := replCtx.provider.ListModels(context.Background())
+		fetchedModels, err := replCtx.provider.ListModels(replCtx.ctx)
 		if err != nil {
 			models = []string{"<error>cannot fetch models</error>"}
 		} else {
@@ -224,7 +463,11 @@ func (replCtx *ReplContext) slashModelCompletions() *readline.PrefixCompleter {
 }
 
 type CommandsProvider interface {
+	// Commands returns the commands which take no arguments, keyed by name.
 	Commands() map[string]CmdIfc
+	// ArgCommands returns factories for commands which take arguments, keyed by name. The factory receives the text
+	// following the command name.
+	ArgCommands() map[string]func(args string) CmdIfc
 }
 
 type cmdProviderImpl struct {
@@ -240,6 +483,44 @@ func (impl *cmdProviderImpl) Commands() map[string]CmdIfc {
 		"history":  NewSummarizeHistoryCmd(impl.replCtx),
 		"clear":    NewClearConversationCommand(impl.replCtx),
 		"suppress": NewSuppressCommand(impl.replCtx),
+		"agent":    NewToggleAgentCommand(impl.replCtx),
+		"raw":      NewToggleRawOutputCommand(impl.replCtx),
+		"sessions": NewListSessionsCmd(impl.replCtx),
+		"retry":    NewRetryCmd(impl.replCtx),
+		"usage":    NewUsageCmd(impl.replCtx),
+		"undo":     NewUndoCmd(impl.replCtx),
+	}
+}
+
+func (impl *cmdProviderImpl) ArgCommands() map[string]func(args string) CmdIfc {
+	return map[string]func(args string) CmdIfc{
+		"mcp": func(args string) CmdIfc {
+			return NewMCPCmd(impl.replCtx, args)
+		},
+		"attach": func(args string) CmdIfc {
+			return NewAttachCmd(impl.replCtx, args)
+		},
+		"save": func(args string) CmdIfc {
+			return NewSaveSessionCmd(impl.replCtx, args)
+		},
+		"load": func(args string) CmdIfc {
+			return NewLoadSessionCmd(impl.replCtx, args)
+		},
+		"profile": func(args string) CmdIfc {
+			return NewProfileCmd(impl.replCtx, args)
+		},
+		"set": func(args string) CmdIfc {
+			return NewSetCmd(impl.replCtx, args)
+		},
+		"edit": func(args string) CmdIfc {
+			return NewEditCmd(impl.replCtx, args)
+		},
+		"fork": func(args string) CmdIfc {
+			return NewForkCmd(impl.replCtx, args)
+		},
+		"branches": func(args string) CmdIfc {
+			return NewBranchesCmd(impl.replCtx, args)
+		},
 	}
 }
 
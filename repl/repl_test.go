@@ -0,0 +1,418 @@
+package repl
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ergochat/readline"
+	"github.com/jlcheng/jcllm/agent"
+	"github.com/jlcheng/jcllm/configuration"
+	"github.com/jlcheng/jcllm/configuration/keys"
+	"github.com/jlcheng/jcllm/llm"
+	"github.com/jlcheng/jcllm/session"
+	"github.com/jlcheng/jcllm/usage"
+	"github.com/knadh/koanf/v2"
+)
+
+// scriptedProvider answers with the responses in order, and repeats the last one when they run out.
+type scriptedProvider struct {
+	llm.ProviderIfc
+	responses []llm.Message
+	inputs    []llm.SolicitResponseInput
+}
+
+func (p *scriptedProvider) SolicitResponse(_ context.Context, input llm.SolicitResponseInput) (llm.ResponseStream, error) {
+	p.inputs = append(p.inputs, input)
+	message := p.responses[min(len(p.inputs), len(p.responses))-1]
+	return llm.ResponseStream{Role: llm.RoleAssistant, Messages: func(yield func(llm.Message, error) bool) {
+		yield(message, nil)
+	}}, nil
+}
+
+// echoTool returns its arguments.
+type echoTool struct{}
+
+func (echoTool) Definition() llm.Tool {
+	return llm.Tool{Name: "echo", Parameters: map[string]any{"type": "object"}}
+}
+
+func (echoTool) Call(_ context.Context, arguments string) (string, error) {
+	return arguments, nil
+}
+
+// newTestRepl creates a REPL without a terminal, which saves its sessions to a temporary directory.
+func newTestRepl(t *testing.T, config *koanf.Koanf, provider llm.ProviderIfc) *ReplContext {
+	t.Helper()
+	_ = config.Set(keys.OptionSessionsDir, t.TempDir())
+	replCtx := &ReplContext{
+		ctx:         context.Background(),
+		config:      config,
+		provider:    provider,
+		modelName:   "test-model",
+		inputBuffer: new(strings.Builder),
+		rawOutput:   true,
+		meter:       &usage.Meter{Ledger: usage.NewLedger("")},
+		tools:       agent.NewRegistry(echoTool{}),
+		sessions:    session.NewStore(config.String(keys.OptionSessionsDir)),
+	}
+	replCtx.sessionName = replCtx.sessions.NewName()
+	return replCtx
+}
+
+func TestReplContext_respond_Agent(t *testing.T) {
+	toolCall := func(step int) llm.Message {
+		return llm.Message{ToolCalls: []llm.ToolCall{{ID: fmt.Sprintf("call-%d", step), Name: "echo", Arguments: "{}"}}}
+	}
+	tests := []struct {
+		name      string
+		agentMode bool
+		maxSteps  int
+		responses []llm.Message
+		// wantRequests is the number of requests to the model, and wantEntries the length of the conversation
+		wantRequests int
+		wantEntries  int
+	}{
+		{
+			name:         "answers after a tool call",
+			agentMode:    true,
+			maxSteps:     10,
+			responses:    []llm.Message{toolCall(1), {Text: "done"}},
+			wantRequests: 2,
+			wantEntries:  4,
+		},
+		{
+			name:         "stops at the maximum number of steps",
+			agentMode:    true,
+			maxSteps:     3,
+			responses:    []llm.Message{toolCall(1)},
+			wantRequests: 3,
+			wantEntries:  7,
+		},
+		{
+			name:         "one step",
+			agentMode:    true,
+			maxSteps:     1,
+			responses:    []llm.Message{toolCall(1)},
+			wantRequests: 1,
+			wantEntries:  3,
+		},
+		{
+			name:         "tool calls are not run outside of agent mode",
+			maxSteps:     10,
+			responses:    []llm.Message{toolCall(1)},
+			wantRequests: 1,
+			wantEntries:  2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := koanf.New(".")
+			_ = config.Set(keys.OptionAgentMaxSteps, tt.maxSteps)
+			provider := &scriptedProvider{responses: tt.responses}
+			replCtx := newTestRepl(t, config, provider)
+			replCtx.agentMode = tt.agentMode
+			replCtx.session.Entries = []llm.ChatEntry{llm.NewTextEntry(llm.RoleUser, "Echo something")}
+
+			if err := replCtx.respond(); err != nil {
+				t.Fatalf("respond() error = %v", err)
+			}
+			if len(provider.inputs) != tt.wantRequests {
+				t.Errorf("got %d requests; want %d", len(provider.inputs), tt.wantRequests)
+			}
+			entries := replCtx.session.Entries
+			if len(entries) != tt.wantEntries {
+				t.Fatalf("got %d entries; want %d", len(entries), tt.wantEntries)
+			}
+			if tt.agentMode {
+				if got := entries[2]; got.Role != llm.RoleTool || got.ToolCallID != "call-1" || got.Text() != "{}" {
+					t.Errorf("entry 3 = %+v; want the result of call-1", got)
+				}
+				if got := provider.inputs[0].Tools; len(got) != 1 || got[0].Name != "echo" {
+					t.Errorf("tools = %+v; want the echo tool", got)
+				}
+			} else if len(provider.inputs[0].Tools) != 0 {
+				t.Errorf("tools = %+v; want none outside of agent mode", provider.inputs[0].Tools)
+			}
+		})
+	}
+}
+
+func TestReplContext_Resume(t *testing.T) {
+	replCtx := newTestRepl(t, koanf.New("."), &scriptedProvider{})
+	newName := replCtx.sessionName
+	if err := replCtx.Resume(); err != nil {
+		t.Fatalf("Resume() error = %v; want a new session when there is none to resume", err)
+	}
+	if replCtx.sessionName != newName || len(replCtx.session.Entries) != 0 {
+		t.Errorf("session = %s with %d entries; want the new session", replCtx.sessionName, len(replCtx.session.Entries))
+	}
+
+	replCtx.session.Entries = []llm.ChatEntry{llm.NewTextEntry(llm.RoleUser, "Hello")}
+	if err := replCtx.SaveSession(); err != nil {
+		t.Fatal(err)
+	}
+	resumed := newTestRepl(t, koanf.New("."), &scriptedProvider{})
+	resumed.sessions = replCtx.sessions
+	if err := resumed.Resume(); err != nil {
+		t.Fatalf("Resume() error = %v", err)
+	}
+	if resumed.sessionName != newName || len(resumed.session.Entries) != 1 {
+		t.Errorf("session = %s with %d entries; want %s with 1 entry", resumed.sessionName, len(resumed.session.Entries), newName)
+	}
+}
+
+func TestReplContext_Branches(t *testing.T) {
+	entries := func(texts ...string) []llm.ChatEntry {
+		var result []llm.ChatEntry
+		for _, text := range texts {
+			result = append(result, llm.NewTextEntry(llm.RoleUser, text))
+		}
+		return result
+	}
+	tests := []struct {
+		name string
+		// steps change the conversation, which starts as a, b, c, d
+		steps []func(replCtx *ReplContext)
+		// want are the texts of each branch, and wantCurrent the index of the current one
+		want        []string
+		wantParents []int
+		wantForks   []int
+		wantCurrent int
+	}{
+		{
+			name:        "fork",
+			steps:       []func(*ReplContext){func(r *ReplContext) { r.fork(2) }},
+			want:        []string{"abcd", "ab"},
+			wantParents: []int{-1, 0},
+			wantForks:   []int{0, 2},
+			wantCurrent: 1,
+		},
+		{
+			name: "continue a fork and switch back",
+			steps: []func(*ReplContext){
+				func(r *ReplContext) { r.fork(2) },
+				func(r *ReplContext) { r.session.Entries = append(r.session.Entries, entries("e")...) },
+				func(r *ReplContext) { r.switchBranch(0) },
+			},
+			want:        []string{"abcd", "abe"},
+			wantParents: []int{-1, 0},
+			wantForks:   []int{0, 2},
+			wantCurrent: 0,
+		},
+		{
+			name: "fork a fork",
+			steps: []func(*ReplContext){
+				func(r *ReplContext) { r.fork(3) },
+				func(r *ReplContext) { r.session.Entries = append(r.session.Entries, entries("e")...) },
+				func(r *ReplContext) { r.fork(1) },
+			},
+			want:        []string{"abcd", "abce", "a"},
+			wantParents: []int{-1, 0, 1},
+			wantForks:   []int{0, 3, 1},
+			wantCurrent: 2,
+		},
+		{
+			name: "undo past the fork point",
+			steps: []func(*ReplContext){
+				func(r *ReplContext) { r.fork(3) },
+				func(r *ReplContext) { r.session.Entries = r.session.Entries[:1] },
+				func(r *ReplContext) { r.syncBranch() },
+			},
+			want:        []string{"abcd", "a"},
+			wantParents: []int{-1, 0},
+			wantForks:   []int{0, 1},
+			wantCurrent: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			replCtx := newTestRepl(t, koanf.New("."), &scriptedProvider{})
+			replCtx.session.Entries = entries("a", "b", "c", "d")
+			for _, step := range tt.steps {
+				step(replCtx)
+			}
+			replCtx.syncBranch()
+
+			var got []string
+			var parents, forks []int
+			for _, b := range replCtx.branches {
+				var texts strings.Builder
+				for _, entry := range b.Entries {
+					texts.WriteString(entry.Text())
+				}
+				got = append(got, texts.String())
+				parents = append(parents, b.Parent)
+				forks = append(forks, b.ForkPoint)
+			}
+			if !slices.Equal(got, tt.want) || !slices.Equal(parents, tt.wantParents) || !slices.Equal(forks, tt.wantForks) {
+				t.Errorf("branches = %q, parents %v, fork points %v; want %q, %v, %v", got, parents, forks, tt.want, tt.wantParents, tt.wantForks)
+			}
+			if replCtx.currentBranch != tt.wantCurrent || len(replCtx.session.Entries) != len(tt.want[tt.wantCurrent]) {
+				t.Errorf("current branch = %d with %d entries; want %d", replCtx.currentBranch, len(replCtx.session.Entries), tt.wantCurrent)
+			}
+		})
+	}
+}
+
+func TestReplContext_SaveSession_Branches(t *testing.T) {
+	replCtx := newTestRepl(t, koanf.New("."), &scriptedProvider{})
+	replCtx.session.Entries = []llm.ChatEntry{llm.NewTextEntry(llm.RoleUser, "a"), llm.NewTextEntry(llm.RoleAssistant, "b")}
+	replCtx.fork(1)
+	replCtx.session.Entries = append(replCtx.session.Entries, llm.NewTextEntry(llm.RoleAssistant, "c"))
+	if err := replCtx.SaveSession(); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := replCtx.sessions.Load(replCtx.sessionName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := newTestRepl(t, koanf.New("."), &scriptedProvider{})
+	if err := loaded.LoadSession(saved); err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.branches) != 2 || loaded.currentBranch != 1 || loaded.session.Entries[1].Text() != "c" {
+		t.Fatalf("branches = %+v, current %d; want both branches, on the fork", loaded.branches, loaded.currentBranch)
+	}
+	loaded.switchBranch(0)
+	if len(loaded.session.Entries) != 2 || loaded.session.Entries[1].Text() != "b" {
+		t.Errorf("entries = %+v; want the original conversation", loaded.session.Entries)
+	}
+}
+
+func TestNewEditCmd_MultiLine(t *testing.T) {
+	replCtx := newTestRepl(t, koanf.New("."), &scriptedProvider{})
+	replCtx.session.Entries = []llm.ChatEntry{
+		llm.NewTextEntry(llm.RoleUser, "first line\nsecond line"),
+		llm.NewTextEntry(llm.RoleAssistant, "answer"),
+	}
+	if err := NewEditCmd(replCtx, "").Execute(); err == nil || !strings.Contains(err.Error(), "/c edit <text>") {
+		t.Errorf("/c edit error = %v; want a refusal pointing to /c edit <text>", err)
+	}
+	if len(replCtx.session.Entries) != 2 || len(replCtx.branches) != 0 {
+		t.Errorf("entries = %+v; want the conversation unchanged", replCtx.session.Entries)
+	}
+}
+
+func TestNewSaveSessionCmd(t *testing.T) {
+	tests := []struct {
+		name string
+		// input answers the confirmation, if any is asked
+		input    string
+		saveAs   string
+		wantText string
+	}{
+		{name: "saves under a new name", saveAs: "new", wantText: "mine"},
+		{name: "saves under its own name", saveAs: "current", wantText: "mine"},
+		{name: "keeps another session unless confirmed", input: "n\n", saveAs: "other", wantText: "theirs"},
+		{name: "overwrites another session once confirmed", input: "y\n", saveAs: "other", wantText: "mine"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			replCtx := newTestRepl(t, koanf.New("."), &scriptedProvider{})
+			rl, err := readline.NewFromConfig(&readline.Config{
+				Stdin:          strings.NewReader(tt.input),
+				Stdout:         io.Discard,
+				FuncIsTerminal: func() bool { return false },
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { _ = rl.Close() })
+			replCtx.readline = rl
+			other := session.Session{Name: "other", Conversation: llm.Conversation{Entries: []llm.ChatEntry{llm.NewTextEntry(llm.RoleUser, "theirs")}}}
+			if err := replCtx.sessions.Save(&other); err != nil {
+				t.Fatal(err)
+			}
+			replCtx.sessionName = "current"
+			replCtx.session.Entries = []llm.ChatEntry{llm.NewTextEntry(llm.RoleUser, "draft")}
+			if err := replCtx.SaveSession(); err != nil {
+				t.Fatal(err)
+			}
+			replCtx.session.Entries = []llm.ChatEntry{llm.NewTextEntry(llm.RoleUser, "mine")}
+
+			if err := NewSaveSessionCmd(replCtx, tt.saveAs).Execute(); err != nil {
+				t.Fatalf("/c save %s error = %v", tt.saveAs, err)
+			}
+			saved, err := replCtx.sessions.Load(tt.saveAs)
+			if entries := saved.Conversation.Entries; err != nil || len(entries) != 1 || entries[0].Text() != tt.wantText {
+				t.Errorf("session %s = %+v, %v; want %q", tt.saveAs, entries, err, tt.wantText)
+			}
+		})
+	}
+}
+
+// profileConfig is a configuration whose profiles override the base configuration.
+type profileConfig struct {
+	*koanf.Koanf
+	base     *koanf.Koanf
+	profiles map[string]map[string]any
+	profile  string
+}
+
+func (c *profileConfig) Profile() string { return c.profile }
+
+func (c *profileConfig) ProfileNames() []string {
+	return slices.Sorted(maps.Keys(c.profiles))
+}
+
+func (c *profileConfig) WithProfile(name string) (configuration.Configuration, error) {
+	k := c.base.Copy()
+	if name != "" {
+		profile, ok := c.profiles[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown profile %q", name)
+		}
+		for key, value := range profile {
+			_ = k.Set(key, value)
+		}
+	}
+	return &profileConfig{Koanf: k, base: c.base, profiles: c.profiles, profile: name}, nil
+}
+
+func TestNewProfileCmd(t *testing.T) {
+	base := koanf.New(".")
+	_ = base.Set(keys.OptionProvider, keys.ProviderOpenAI)
+	_ = base.Set(keys.OptionModel, "gpt-4o")
+	_ = base.Set(keys.OptionHttpTimeout, 5)
+	config := &profileConfig{Koanf: base, base: base, profiles: map[string]map[string]any{
+		"work":    {keys.OptionProvider: keys.ProviderAnthropic, keys.OptionModel: "claude"},
+		"broken":  {keys.OptionProvider: keys.ProviderAnthropic, keys.OptionModel: "claude-hot", keys.OptionTemperature: "5"},
+		"unknown": {keys.OptionProvider: "nowhere", keys.OptionModel: "nothing"},
+	}}
+	replCtx := newTestRepl(t, base, &scriptedProvider{})
+	replCtx.config = config
+	replCtx.modelName = "gpt-4o"
+	replCtx.rules = map[string]configuration.Rule{keys.OptionTemperature: {Type: configuration.TypeFloat, Max: configuration.Bound(2)}}
+
+	tests := []struct {
+		name        string
+		profile     string
+		wantErr     bool
+		wantProfile string
+		wantModel   string
+	}{
+		{name: "switches to a profile", profile: "work", wantProfile: "work", wantModel: "claude"},
+		{name: "keeps the profile when the next one is invalid", profile: "broken", wantErr: true, wantProfile: "work", wantModel: "claude"},
+		{name: "keeps the profile when its provider is unknown", profile: "unknown", wantErr: true, wantProfile: "work", wantModel: "claude"},
+		{name: "returns to the base configuration", profile: "-", wantProfile: "", wantModel: "gpt-4o"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewProfileCmd(replCtx, tt.profile).Execute()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("/c profile %s error = %v; want error %v", tt.profile, err, tt.wantErr)
+			}
+			profile := replCtx.config.(configuration.Profiles).Profile()
+			model := replCtx.config.String(keys.OptionModel)
+			if profile != tt.wantProfile || model != tt.wantModel || replCtx.modelName != tt.wantModel {
+				t.Errorf("profile = %q with model %s, %s; want %q with model %s", profile, model, replCtx.modelName, tt.wantProfile, tt.wantModel)
+			}
+		})
+	}
+}
@@ -0,0 +1,498 @@
+// Package server exposes the configured provider over HTTP with the OpenAI chat completions protocol, so tools which
+// only speak that protocol can reach any provider supported by jcllm.
+package server
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/BooleanCat/go-functional/v2/it"
+	"github.com/go-errors/errors"
+	"github.com/jlcheng/jcllm/configuration"
+	"github.com/jlcheng/jcllm/configuration/keys"
+	"github.com/jlcheng/jcllm/llm"
+	"github.com/jlcheng/jcllm/llm/openaimodels"
+	"github.com/jlcheng/jcllm/log"
+	"github.com/jlcheng/jcllm/usage"
+)
+
+const (
+	finishReasonStop      = "stop"
+	finishReasonToolCalls = "tool_calls"
+
+	roleSystem    = "system"
+	roleDeveloper = "developer"
+	roleUser      = "user"
+	roleAssistant = "assistant"
+	roleTool      = "tool"
+
+	// maxRequestBytes bounds the size of a request body, which may hold images and files encoded in base64.
+	maxRequestBytes = 32 << 20
+)
+
+// Server answers OpenAI-compatible requests with a single provider.
+type Server struct {
+	config    configuration.Configuration
+	provider  llm.ProviderIfc
+	meter     *usage.Meter
+	apiKeys   []string
+	logger    *log.Logger
+	accessLog io.Writer
+}
+
+// New creates a Server for the configured provider. Clients must present one of the configured API keys as a bearer
+// token, unless none is configured. Every request is logged to accessLog, and the usage of every completed response
+// is recorded by meter.
+func New(config configuration.Configuration, provider llm.ProviderIfc, meter *usage.Meter, logger *log.Logger, accessLog io.Writer) *Server {
+	var apiKeys []string
+	for _, key := range strings.Split(config.String(keys.OptionServeApiKeys), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			apiKeys = append(apiKeys, key)
+		}
+	}
+	return &Server{
+		config:    config,
+		provider:  provider,
+		meter:     meter,
+		apiKeys:   apiKeys,
+		logger:    logger,
+		accessLog: accessLog,
+	}
+}
+
+// RequiresAPIKey reports whether clients must present an API key.
+func (s *Server) RequiresAPIKey() bool {
+	return len(s.apiKeys) != 0
+}
+
+// Handler returns the http.Handler serving /v1/models and /v1/chat/completions.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/models", s.listModels)
+	mux.HandleFunc("POST /v1/chat/completions", s.chatCompletions)
+	return s.authenticate(mux)
+}
+
+// statusRecorder remembers the status code of a response, for the access log.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		startTime := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			fmt.Fprintf(s.accessLog, "%s %s %s %d %.3fs\n", startTime.Format(time.RFC3339), r.Method, r.URL.Path, recorder.status, time.Since(startTime).Seconds())
+		}()
+		if len(s.apiKeys) != 0 && !s.validKey(r) {
+			writeError(recorder, http.StatusUnauthorized, "invalid_api_key", "Incorrect API key provided")
+			return
+		}
+		next.ServeHTTP(recorder, r)
+	})
+}
+
+func (s *Server) validKey(r *http.Request) bool {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found {
+		return false
+	}
+	for _, key := range s.apiKeys {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(key)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) listModels(w http.ResponseWriter, r *http.Request) {
+	models, err := s.provider.ListModels(r.Context())
+	if err != nil {
+		s.logger.Errorf("cannot list models: %v", err)
+		writeError(w, http.StatusBadGateway, "provider_error", err.Error())
+		return
+	}
+	response := openaimodels.ListModelsResponse{
+		Object: "list",
+		Data: slices.Collect(it.Map(slices.Values(models), func(model llm.ModelInfo) openaimodels.Model {
+			return openaimodels.Model{
+				ID:      model.Name,
+				Object:  "model",
+				OwnedBy: s.config.String(keys.OptionProvider),
+			}
+		})),
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) chatCompletions(w http.ResponseWriter, r *http.Request) {
+	var request openaimodels.CreateChatCompletionRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes)).Decode(&request); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, "invalid_request_error", fmt.Sprintf("request body larger than %d bytes", tooLarge.Limit))
+			return
+		}
+		writeError(w, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+	if len(request.Messages) == 0 {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "messages must not be empty")
+		return
+	}
+	if request.Model == "" {
+		request.Model = s.config.String(keys.OptionModel)
+	}
+	settings, err := llm.SettingsFromConfig(s.config, request.Model)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "invalid_configuration", err.Error())
+		return
+	}
+	requestSettings, err := toSettings(request)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+
+	resp, err := s.provider.SolicitResponse(r.Context(), llm.SolicitResponseInput{
+		ModelName:    request.Model,
+		Conversation: toConversation(request.Messages),
+		Settings:     settings.Merge(requestSettings),
+		Overrides:    requestSettings,
+		// Mentions are a REPL feature, client prompts are passed on verbatim
+		SuppressMentions: true,
+		Tools:            slices.Collect(it.Map(slices.Values(request.Tools), toTool)),
+		ResponseSchema:   toResponseSchema(request.ResponseFormat),
+	})
+	if err != nil {
+		s.logger.Errorf("chat completion failed: %v", err)
+		writeError(w, http.StatusBadGateway, "provider_error", err.Error())
+		return
+	}
+
+	completion := completion{
+		id:       newCompletionID(),
+		created:  time.Now().Unix(),
+		provider: s.config.String(keys.OptionProvider),
+		model:    request.Model,
+	}
+	if resp.Model != "" {
+		completion.provider, completion.model = resp.Provider, resp.Model
+	}
+	if request.Stream != nil && *request.Stream {
+		includeUsage := request.StreamOptions != nil && request.StreamOptions.IncludeUsage != nil && *request.StreamOptions.IncludeUsage
+		s.stream(w, completion, resp, includeUsage)
+		return
+	}
+
+	var text strings.Builder
+	var toolCalls []openaimodels.ToolCall
+	var tokens llm.Usage
+	for message, err := range resp.Messages {
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			s.logger.Errorf("chat completion failed: %v", err)
+			writeError(w, http.StatusBadGateway, "provider_error", err.Error())
+			return
+		}
+		text.WriteString(message.Text)
+		for _, call := range message.ToolCalls {
+			toolCalls = append(toolCalls, toToolCall(call, nil))
+		}
+		tokens.Add(message.Usage())
+	}
+	s.recordUsage(completion, tokens)
+	writeJSON(w, http.StatusOK, openaimodels.ChatCompletionResponse{
+		ID:      completion.id,
+		Object:  "chat.completion",
+		Created: completion.created,
+		Model:   completion.model,
+		Choices: []openaimodels.ChatChoice{{
+			Message: openaimodels.ChatMessage{
+				Role:      roleAssistant,
+				Content:   text.String(),
+				ToolCalls: toolCalls,
+			},
+			FinishReason: finishReason(toolCalls),
+		}},
+		Usage: toChatUsage(tokens),
+	})
+}
+
+// recordUsage records the usage of a completed response. The ledger is bookkeeping, which must not fail the response.
+func (s *Server) recordUsage(completion completion, tokens llm.Usage) {
+	if _, err := s.meter.Record(completion.provider, completion.model, tokens); err != nil {
+		s.logger.Errorf("cannot record usage: %v", err)
+	}
+}
+
+// completion holds the fields shared by every chunk of a response. provider is only recorded in the usage ledger.
+type completion struct {
+	id       string
+	created  int64
+	provider string
+	model    string
+}
+
+func (c completion) chunk(delta openaimodels.ChatDelta, finishReason *string) openaimodels.ChatCompletionChunkResponse {
+	return openaimodels.ChatCompletionChunkResponse{
+		ID:      c.id,
+		Object:  "chat.completion.chunk",
+		Created: c.created,
+		Model:   c.model,
+		Choices: []openaimodels.ChatChunkChoice{{
+			Delta:        delta,
+			FinishReason: finishReason,
+		}},
+	}
+}
+
+// stream writes the response as server-sent events. Errors after the first event can only be reported as an event.
+func (s *Server) stream(w http.ResponseWriter, completion completion, resp llm.ResponseStream, includeUsage bool) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	send := func(event any) {
+		data, _ := json.Marshal(event)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	send(completion.chunk(openaimodels.ChatDelta{Role: roleAssistant}, nil))
+	var toolCalls []openaimodels.ToolCall
+	var tokens llm.Usage
+	for message, err := range resp.Messages {
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			s.logger.Errorf("chat completion stream failed: %v", err)
+			send(openaimodels.APIErrorResponse{Error: openaimodels.APIError{Message: err.Error(), Code: "provider_error"}})
+			return
+		}
+		tokens.Add(message.Usage())
+		delta := openaimodels.ChatDelta{Content: message.Text}
+		for _, call := range message.ToolCalls {
+			index := len(toolCalls)
+			toolCall := toToolCall(call, &index)
+			toolCalls = append(toolCalls, toolCall)
+			delta.ToolCalls = append(delta.ToolCalls, toolCall)
+		}
+		if delta.Content != "" || len(delta.ToolCalls) != 0 {
+			send(completion.chunk(delta, nil))
+		}
+	}
+	s.recordUsage(completion, tokens)
+	reason := finishReason(toolCalls)
+	send(completion.chunk(openaimodels.ChatDelta{}, &reason))
+	if includeUsage {
+		usage := toChatUsage(tokens)
+		usageChunk := completion.chunk(openaimodels.ChatDelta{}, nil)
+		usageChunk.Choices = []openaimodels.ChatChunkChoice{}
+		usageChunk.Usage = &usage
+		send(usageChunk)
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	if flusher != nil {
+		flusher.Flush()
+	}
+}
+
+// toConversation maps OpenAI messages to a conversation. Tool results carry the name of the tool they answer, which
+// the OpenAI protocol only records in the assistant message that made the call.
+func toConversation(messages []openaimodels.Message) llm.Conversation {
+	toolNames := make(map[string]string)
+	entries := make([]llm.ChatEntry, 0, len(messages))
+	for _, message := range messages {
+		entry := llm.ChatEntry{Parts: toParts(message.Content)}
+		switch message.Role {
+		case roleSystem, roleDeveloper:
+			entry.Role = llm.RoleSystem
+		case roleAssistant:
+			entry.Role = llm.RoleAssistant
+			for _, call := range message.ToolCalls {
+				toolNames[call.ID] = call.Function.Name
+				entry.ToolCalls = append(entry.ToolCalls, llm.ToolCall{
+					ID:        call.ID,
+					Name:      call.Function.Name,
+					Arguments: call.Function.Arguments,
+				})
+			}
+		case roleTool:
+			entry.Role = llm.RoleTool
+			entry.ToolCallID = message.ToolCallID
+			entry.ToolName = toolNames[message.ToolCallID]
+		default:
+			entry.Role = llm.RoleUser
+		}
+		entries = append(entries, entry)
+	}
+	return llm.Conversation{Entries: entries}
+}
+
+// toParts maps the content of an OpenAI message to parts. Images and files given as data URIs become inline parts,
+// and other URLs become file parts. Image URLs keep an image MIME type, so that providers send them as images.
+func toParts(content interface{}) []llm.Part {
+	switch content := content.(type) {
+	case string:
+		return []llm.Part{llm.TextPart(content)}
+	case []openaimodels.ContentPart:
+		parts := make([]llm.Part, 0, len(content))
+		for _, part := range content {
+			switch {
+			case part.ImageURL != nil && strings.HasPrefix(part.ImageURL.URL, "data:"):
+				parts = append(parts, toPart(part.ImageURL.URL, "", ""))
+			case part.ImageURL != nil:
+				parts = append(parts, llm.ImageURLPart(part.ImageURL.URL))
+			case part.File != nil && part.File.FileData != "":
+				parts = append(parts, toPart(part.File.FileData, "application/pdf", part.File.Filename))
+			case part.File != nil:
+				parts = append(parts, llm.FilePart("", part.File.FileID))
+			default:
+				parts = append(parts, llm.TextPart(part.Text))
+			}
+		}
+		return parts
+	}
+	return nil
+}
+
+// toPart decodes a data URI into an inline part, and falls back to a file part for anything else.
+func toPart(uri string, mimeType string, name string) llm.Part {
+	header, data, found := strings.Cut(strings.TrimPrefix(uri, "data:"), ",")
+	if !strings.HasPrefix(uri, "data:") || !found || !strings.HasSuffix(header, ";base64") {
+		return llm.FilePart(mimeType, uri)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return llm.FilePart(mimeType, uri)
+	}
+	if header = strings.TrimSuffix(header, ";base64"); header != "" {
+		mimeType = header
+	}
+	return llm.InlinePart(mimeType, decoded, name)
+}
+
+// toResponseSchema returns the JSON schema of a json_schema response format, or nil for any other format.
+func toResponseSchema(format *openaimodels.ResponseFormat) map[string]any {
+	if format == nil || format.JSONSchema == nil {
+		return nil
+	}
+	schema, _ := format.JSONSchema.Schema.(map[string]any)
+	return schema
+}
+
+// toSettings reads the generation settings of a request, which override the configured ones. They are checked like
+// those of the configuration, so that the provider is never sent a value out of range.
+func toSettings(request openaimodels.CreateChatCompletionRequest) (llm.GenerationSettings, error) {
+	settings := llm.GenerationSettings{StopSequences: request.Stop}
+	maxTokens := request.MaxCompletionTokens
+	if maxTokens == nil {
+		maxTokens = request.MaxTokens
+	}
+	values := map[string]any{}
+	if request.Temperature != nil {
+		values[keys.OptionTemperature] = *request.Temperature
+	}
+	if request.TopP != nil {
+		values[keys.OptionTopP] = *request.TopP
+	}
+	if maxTokens != nil {
+		values[keys.OptionMaxOutputTokens] = *maxTokens
+	}
+	if request.Seed != nil {
+		values[keys.OptionSeed] = *request.Seed
+	}
+	if request.ReasoningEffort != nil {
+		values[keys.OptionReasoningEffort] = *request.ReasoningEffort
+	}
+	for _, name := range llm.SettingNames {
+		if value, ok := values[name]; ok {
+			if err := settings.SetValue(name, value); err != nil {
+				return settings, err
+			}
+		}
+	}
+	return settings, nil
+}
+
+func toChatUsage(tokens llm.Usage) openaimodels.ChatUsage {
+	var usage openaimodels.ChatUsage
+	usage.PromptTokens = tokens.InputTokens
+	usage.CompletionTokens = tokens.OutputTokens
+	usage.TotalTokens = tokens.InputTokens + tokens.OutputTokens
+	usage.PromptTokensDetails.CachedTokens = tokens.CachedTokens
+	usage.CompletionTokensDetails.ReasoningTokens = tokens.ReasoningTokens
+	return usage
+}
+
+func toTool(tool openaimodels.Tool) llm.Tool {
+	parameters, _ := tool.Function.Parameters.(map[string]any)
+	return llm.Tool{
+		Name:        tool.Function.Name,
+		Description: tool.Function.Description,
+		Parameters:  parameters,
+	}
+}
+
+func toToolCall(call llm.ToolCall, index *int) openaimodels.ToolCall {
+	return openaimodels.ToolCall{
+		Index: index,
+		ID:    call.ID,
+		Type:  "function",
+		Function: openaimodels.FunctionCall{
+			Name:      call.Name,
+			Arguments: call.Arguments,
+		},
+	}
+}
+
+func finishReason(toolCalls []openaimodels.ToolCall) string {
+	if len(toolCalls) != 0 {
+		return finishReasonToolCalls
+	}
+	return finishReasonStop
+}
+
+func newCompletionID() string {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	return "chatcmpl-" + hex.EncodeToString(b)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, code string, message string) {
+	writeJSON(w, status, openaimodels.APIErrorResponse{Error: openaimodels.APIError{Message: message, Code: code}})
+}
@@ -0,0 +1,387 @@
+package server_test
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jlcheng/jcllm/configuration/keys"
+	"github.com/jlcheng/jcllm/llm"
+	"github.com/jlcheng/jcllm/llm/openaimodels"
+	"github.com/jlcheng/jcllm/llm/providers/openai"
+	"github.com/jlcheng/jcllm/log"
+	"github.com/jlcheng/jcllm/server"
+	"github.com/jlcheng/jcllm/usage"
+	"github.com/knadh/koanf/v2"
+)
+
+// fakeProvider records the last input and answers with fixed messages.
+type fakeProvider struct {
+	input    llm.SolicitResponseInput
+	messages []llm.Message
+}
+
+func (p *fakeProvider) ToProviderRole(role string) string { return role }
+func (p *fakeProvider) ToGenericRole(role string) string  { return role }
+
+func (p *fakeProvider) ListModels(context.Context) ([]llm.ModelInfo, error) {
+	return []llm.ModelInfo{{Name: "gemini-2.0-flash"}, {Name: "gemini-1.5-pro"}}, nil
+}
+
+func (p *fakeProvider) SolicitResponse(_ context.Context, input llm.SolicitResponseInput) (llm.ResponseStream, error) {
+	p.input = input
+	return llm.ResponseStream{
+		Role: llm.RoleAssistant,
+		Messages: func(yield func(llm.Message, error) bool) {
+			for _, message := range p.messages {
+				if !yield(message, nil) {
+					return
+				}
+			}
+		},
+	}, nil
+}
+
+func newTestServer(t *testing.T, provider *fakeProvider, apiKeys string) (*httptest.Server, *usage.Ledger) {
+	config := koanf.New(".")
+	_ = config.Set(keys.OptionProvider, "gemini")
+	_ = config.Set(keys.OptionModel, "gemini-2.0-flash")
+	_ = config.Set(keys.OptionTemperature, "0.5")
+	_ = config.Set(keys.OptionServeApiKeys, apiKeys)
+	_ = config.Set(keys.OptionUsageLedger, filepath.Join(t.TempDir(), "ledger.jsonl"))
+	return newServer(t, config, provider)
+}
+
+// newServer serves provider with config. The usage of the responses is recorded in the returned ledger.
+func newServer(t *testing.T, config *koanf.Koanf, provider llm.ProviderIfc) (*httptest.Server, *usage.Ledger) {
+	t.Helper()
+	meter, err := usage.NewMeter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return httptest.NewServer(server.New(config, provider, meter, log.New(""), io.Discard).Handler()), meter.Ledger
+}
+
+func post(t *testing.T, url string, body string) *http.Response {
+	t.Helper()
+	resp, err := http.Post(url+"/v1/chat/completions", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestChatCompletions(t *testing.T) {
+	provider := &fakeProvider{messages: []llm.Message{
+		{Text: "Hello", InputTokenCount: 5},
+		{Text: " there", TokenCount: 2},
+	}}
+	ts, _ := newTestServer(t, provider, "")
+	defer ts.Close()
+
+	resp := post(t, ts.URL, `{"messages": [
+		{"role": "system", "content": "Be brief"},
+		{"role": "user", "content": "Hi"},
+		{"role": "assistant", "tool_calls": [{"id": "c1", "type": "function", "function": {"name": "get_time", "arguments": "{}"}}]},
+		{"role": "tool", "tool_call_id": "c1", "content": "noon"}
+	]}`)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %d", resp.StatusCode)
+	}
+	var completion openaimodels.ChatCompletionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&completion); err != nil {
+		t.Fatal(err)
+	}
+	if completion.Model != "gemini-2.0-flash" || completion.Choices[0].Message.Content != "Hello there" || completion.Choices[0].FinishReason != "stop" {
+		t.Errorf("unexpected completion: %+v", completion)
+	}
+	if completion.Usage.PromptTokens != 5 || completion.Usage.CompletionTokens != 2 || completion.Usage.TotalTokens != 7 {
+		t.Errorf("unexpected usage: %+v", completion.Usage)
+	}
+
+	entries := provider.input.Conversation.Entries
+	if len(entries) != 4 || entries[0].Role != llm.RoleSystem || entries[1].Role != llm.RoleUser || entries[2].Role != llm.RoleAssistant {
+		t.Fatalf("unexpected conversation: %+v", entries)
+	}
+	if entries[2].ToolCalls[0].Name != "get_time" {
+		t.Errorf("unexpected tool calls: %+v", entries[2].ToolCalls)
+	}
+	if entries[3].Role != llm.RoleTool || entries[3].ToolCallID != "c1" || entries[3].ToolName != "get_time" || entries[3].Text() != "noon" {
+		t.Errorf("unexpected tool result: %+v", entries[3])
+	}
+}
+
+func TestChatCompletionsContentParts(t *testing.T) {
+	provider := &fakeProvider{messages: []llm.Message{{Text: "A cat"}}}
+	ts, _ := newTestServer(t, provider, "")
+	defer ts.Close()
+
+	resp := post(t, ts.URL, `{"messages": [{"role": "user", "content": [
+		{"type": "text", "text": "What is this?"},
+		{"type": "image_url", "image_url": {"url": "data:image/png;base64,cG5n"}},
+		{"type": "image_url", "image_url": {"url": "https://example.com/cat.jpg"}},
+		{"type": "image_url", "image_url": {"url": "https://example.com/render?id=cat"}}
+	]}]}`)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %d", resp.StatusCode)
+	}
+	entries := provider.input.Conversation.Entries
+	if len(entries) != 1 || entries[0].Text() != "What is this?" {
+		t.Fatalf("unexpected conversation: %+v", entries)
+	}
+	want := []llm.Part{
+		llm.InlinePart("image/png", []byte("png"), ""),
+		llm.FilePart("image/jpeg", "https://example.com/cat.jpg"),
+		llm.FilePart(llm.MIMETypeImage, "https://example.com/render?id=cat"),
+	}
+	if got := entries[0].Attachments(); !reflect.DeepEqual(got, want) {
+		t.Errorf("attachments = %+v; want %+v", got, want)
+	}
+}
+
+// TestChatCompletionsImageURL serves the OpenAI provider, which must send a remote image URL on as an image URL.
+func TestChatCompletionsImageURL(t *testing.T) {
+	var captured openaimodels.CreateChatCompletionRequest
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&captured); err != nil {
+			t.Errorf("cannot decode request: %v", err)
+		}
+		_, _ = io.WriteString(w, `data: {"choices":[{"index":0,"delta":{"content":"A cat"},"finish_reason":"stop"}]}`+"\n\ndata: [DONE]\n\n")
+	}))
+	defer upstream.Close()
+	config := koanf.New(".")
+	_ = config.Set(keys.OptionProvider, "openai")
+	_ = config.Set(keys.OptionModel, "gpt-4o")
+	_ = config.Set(keys.OptionHttpTimeout, 5)
+	_ = config.Set(keys.OptionOpenAIApiKey, "test-key")
+	_ = config.Set(keys.OptionOpenAIBaseURL, upstream.URL+"/v1")
+	ts, _ := newServer(t, config, openai.NewProvider(config))
+	defer ts.Close()
+
+	resp := post(t, ts.URL, `{"messages": [{"role": "user", "content": [
+		{"type": "text", "text": "What is this?"},
+		{"type": "image_url", "image_url": {"url": "https://example.com/cat.jpg"}}
+	]}]}`)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %d", resp.StatusCode)
+	}
+	if len(captured.Messages) != 1 {
+		t.Fatalf("unexpected messages: %+v", captured.Messages)
+	}
+	data, _ := json.Marshal(captured.Messages[0].Content)
+	var parts []openaimodels.ContentPart
+	if err := json.Unmarshal(data, &parts); err != nil {
+		t.Fatalf("content = %s; want content parts", data)
+	}
+	if len(parts) != 2 || parts[1].ImageURL == nil || parts[1].ImageURL.URL != "https://example.com/cat.jpg" || parts[1].File != nil {
+		t.Errorf("parts = %s; want the text and the image URL", data)
+	}
+}
+
+func TestChatCompletionsStream(t *testing.T) {
+	provider := &fakeProvider{messages: []llm.Message{
+		{Text: "Checking", InputTokenCount: 5},
+		{ToolCalls: []llm.ToolCall{{ID: "c1", Name: "get_time", Arguments: "{}"}}, TokenCount: 3},
+	}}
+	ts, _ := newTestServer(t, provider, "")
+	defer ts.Close()
+
+	resp := post(t, ts.URL, `{"model": "gemini-1.5-pro", "stream": true, "seed": 7, "stream_options": {"include_usage": true},
+		"messages": [{"role": "user", "content": "What time is it?"}],
+		"tools": [{"type": "function", "function": {"name": "get_time", "parameters": {"type": "object"}}}]}`)
+	defer resp.Body.Close()
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", got)
+	}
+
+	var chunks []openaimodels.ChatCompletionChunkResponse
+	done := false
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, found := strings.CutPrefix(scanner.Text(), "data: ")
+		if !found {
+			continue
+		}
+		if data == "[DONE]" {
+			done = true
+			break
+		}
+		var chunk openaimodels.ChatCompletionChunkResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatal(err)
+		}
+		chunks = append(chunks, chunk)
+	}
+	if !done || len(chunks) != 5 {
+		t.Fatalf("expected 5 chunks and [DONE], got %d chunks: %+v", len(chunks), chunks)
+	}
+	if chunks[0].Choices[0].Delta.Role != "assistant" || chunks[1].Choices[0].Delta.Content != "Checking" {
+		t.Errorf("unexpected first chunks: %+v", chunks[:2])
+	}
+	if call := chunks[2].Choices[0].Delta.ToolCalls[0]; call.Function.Name != "get_time" || call.Index == nil || *call.Index != 0 {
+		t.Errorf("unexpected tool call: %+v", call)
+	}
+	if reason := chunks[3].Choices[0].FinishReason; reason == nil || *reason != "tool_calls" {
+		t.Errorf("unexpected finish reason: %v", reason)
+	}
+	if usage := chunks[4].Usage; usage == nil || usage.TotalTokens != 8 || len(chunks[4].Choices) != 0 {
+		t.Errorf("unexpected usage chunk: %+v", chunks[4])
+	}
+	if settings := provider.input.Settings; *settings.Temperature != 0.5 || *settings.Seed != 7 || !provider.input.SuppressMentions {
+		t.Errorf("unexpected settings: %s", settings)
+	}
+	if provider.input.ModelName != "gemini-1.5-pro" || provider.input.Tools[0].Name != "get_time" || provider.input.Tools[0].Parameters["type"] != "object" {
+		t.Errorf("unexpected input: %+v", provider.input)
+	}
+}
+
+func TestChatCompletionsUsageLedger(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"complete", `{"messages": [{"role": "user", "content": "Hi"}]}`},
+		{"stream", `{"model": "gemini-1.5-pro", "stream": true, "messages": [{"role": "user", "content": "Hi"}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &fakeProvider{messages: []llm.Message{
+				{Text: "Hello", InputTokenCount: 5, CachedTokenCount: 1},
+				{Text: " there", TokenCount: 4, ReasoningTokenCount: 2},
+			}}
+			ts, ledger := newTestServer(t, provider, "")
+			defer ts.Close()
+
+			var request struct{ Model string }
+			_ = json.Unmarshal([]byte(tt.body), &request)
+			resp := post(t, ts.URL, tt.body)
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+
+			records, err := ledger.Read(time.Time{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := llm.Usage{InputTokens: 5, OutputTokens: 4, CachedTokens: 1, ReasoningTokens: 2}
+			model := cmp.Or(request.Model, "gemini-2.0-flash")
+			if len(records) != 1 || records[0].Provider != "gemini" || records[0].Model != model || records[0].Usage != want {
+				t.Errorf("ledger = %+v; want one record of %s with %+v", records, model, want)
+			}
+		})
+	}
+}
+
+func TestModels(t *testing.T) {
+	ts, _ := newTestServer(t, &fakeProvider{}, "")
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/v1/models")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var models openaimodels.ListModelsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&models); err != nil {
+		t.Fatal(err)
+	}
+	if models.Object != "list" || len(models.Data) != 2 || models.Data[0].ID != "gemini-2.0-flash" || models.Data[0].OwnedBy != "gemini" {
+		t.Errorf("unexpected models: %+v", models)
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	ts, _ := newTestServer(t, &fakeProvider{}, "other, secret")
+	defer ts.Close()
+
+	for key, want := range map[string]int{"": http.StatusUnauthorized, "wrong": http.StatusUnauthorized, "secret": http.StatusOK} {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/v1/models", nil)
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("key %q: expected status %d, got %d", key, want, resp.StatusCode)
+		}
+	}
+}
+
+func TestInvalidRequest(t *testing.T) {
+	ts, _ := newTestServer(t, &fakeProvider{}, "")
+	defer ts.Close()
+
+	for _, body := range []string{
+		`not json`,
+		`{"messages": []}`,
+		`{"messages": [{"role": "user", "content": "Hi"}], "temperature": 5}`,
+		`{"messages": [{"role": "user", "content": "Hi"}], "max_tokens": 0}`,
+		`{"messages": [{"role": "user", "content": "Hi"}], "reasoning_effort": "extreme"}`,
+	} {
+		resp := post(t, ts.URL, body)
+		var apiError openaimodels.APIErrorResponse
+		_ = json.NewDecoder(resp.Body).Decode(&apiError)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest || apiError.Error.Message == "" {
+			t.Errorf("body %q: expected a bad request error, got %d %+v", body, resp.StatusCode, apiError)
+		}
+	}
+}
+
+func TestChatCompletionsSettings(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want llm.GenerationSettings
+	}{
+		{"stop string", `"stop": "###"`, llm.GenerationSettings{StopSequences: []string{"###"}}},
+		{"stop array", `"stop": ["###", "END"]`, llm.GenerationSettings{StopSequences: []string{"###", "END"}}},
+		{"max_tokens", `"max_tokens": 50`, llm.GenerationSettings{MaxOutputTokens: ptr(50)}},
+		{"max_completion_tokens first", `"max_tokens": 50, "max_completion_tokens": 60`, llm.GenerationSettings{MaxOutputTokens: ptr(60)}},
+		{"sampling", `"temperature": 1.5, "top_p": 0.9, "seed": -1`, llm.GenerationSettings{Temperature: ptr(1.5), TopP: ptr(0.9), Seed: ptr(-1)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &fakeProvider{messages: []llm.Message{{Text: "Hello"}}}
+			ts, _ := newTestServer(t, provider, "")
+			defer ts.Close()
+
+			resp := post(t, ts.URL, `{"messages": [{"role": "user", "content": "Hi"}], `+tt.body+`}`)
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("unexpected status %d", resp.StatusCode)
+			}
+			if !reflect.DeepEqual(provider.input.Overrides, tt.want) {
+				t.Errorf("unexpected settings: %+v", provider.input.Overrides)
+			}
+		})
+	}
+}
+
+func TestRequestTooLarge(t *testing.T) {
+	ts, _ := newTestServer(t, &fakeProvider{}, "")
+	defer ts.Close()
+
+	content := strings.Repeat("a", 33<<20)
+	resp := post(t, ts.URL, `{"messages": [{"role": "user", "content": "`+content+`"}]}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status %d, got %d", http.StatusRequestEntityTooLarge, resp.StatusCode)
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
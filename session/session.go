@@ -0,0 +1,164 @@
+// Package session persists conversations, so they can be resumed after the REPL exits.
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/jlcheng/jcllm/llm"
+)
+
+const fileExtension = ".json"
+
+var (
+	ErrSessionNotFound = errors.New("session not found")
+	ErrInvalidName     = errors.New("session names may only contain letters, digits, '.', '_' and '-'")
+)
+
+var validName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+// Session is a conversation along with the settings it was held with.
+type Session struct {
+	Name         string           `json:"name"`
+	Provider     string           `json:"provider"`
+	Model        string           `json:"model"`
+	SystemPrompt string           `json:"systemPrompt"`
+	Conversation llm.Conversation `json:"conversation"`
+	// Branches are the versions of the conversation created by retries, edits, and forks, if any. Conversation is the
+	// one of the CurrentBranch.
+	Branches      []Branch  `json:"branches,omitempty"`
+	CurrentBranch int       `json:"currentBranch,omitempty"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+// Branch is a version of the conversation. Branches form a tree: the first ForkPoint entries of a branch are copies
+// of those of its Parent. The root branch has no parent, which is -1.
+type Branch struct {
+	Parent    int             `json:"parent"`
+	ForkPoint int             `json:"forkPoint"`
+	Entries   []llm.ChatEntry `json:"entries"`
+}
+
+// Store saves each session as a json file in a directory.
+type Store struct {
+	dir string
+}
+
+func NewStore(dir string) *Store {
+	return &Store{dir: os.ExpandEnv(dir)}
+}
+
+// NewName returns an unused name for a session which the user has not named, based on the current time. The
+// milliseconds keep sessions started in the same second apart, and a suffix those which were saved in the same
+// millisecond.
+func (s *Store) NewName() string {
+	base := time.Now().Format("20060102-150405.000")
+	name := base
+	for i := 2; ; i++ {
+		if _, err := os.Stat(s.path(name)); errors.Is(err, os.ErrNotExist) {
+			return name
+		}
+		name = fmt.Sprintf("%s-%d", base, i)
+	}
+}
+
+// Save writes the session, replacing any session of the same name. UpdatedAt is set to the current time.
+func (s *Store) Save(session *Session) error {
+	if !validName.MatchString(session.Name) {
+		return fmt.Errorf("%w: %q", ErrInvalidName, session.Name)
+	}
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return errors.WrapPrefix(err, "cannot create sessions directory", 0)
+	}
+	session.UpdatedAt = time.Now()
+	payload, err := json.MarshalIndent(session, "", "  ")
+	if err != nil {
+		return errors.WrapPrefix(err, "cannot encode session", 0)
+	}
+	// Write to a temporary file first, so a crash never leaves a truncated session behind
+	tmp, err := os.CreateTemp(s.dir, session.Name+".*.tmp")
+	if err != nil {
+		return errors.WrapPrefix(err, "cannot create session file", 0)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(payload); err != nil {
+		_ = tmp.Close()
+		return errors.WrapPrefix(err, "cannot write session file", 0)
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.WrapPrefix(err, "cannot write session file", 0)
+	}
+	if err := os.Rename(tmp.Name(), s.path(session.Name)); err != nil {
+		return errors.WrapPrefix(err, "cannot write session file", 0)
+	}
+	return nil
+}
+
+// Load reads the named session.
+func (s *Store) Load(name string) (Session, error) {
+	var session Session
+	if !validName.MatchString(name) {
+		return session, fmt.Errorf("%w: %q", ErrInvalidName, name)
+	}
+	payload, err := os.ReadFile(s.path(name))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return session, fmt.Errorf("%w: %s", ErrSessionNotFound, name)
+		}
+		return session, errors.WrapPrefix(err, "cannot read session file", 0)
+	}
+	if err := json.Unmarshal(payload, &session); err != nil {
+		return session, errors.WrapPrefix(err, fmt.Sprintf("cannot decode session [%s]", name), 0)
+	}
+	session.Name = name
+	return session, nil
+}
+
+// List returns all sessions, most recently updated first. Files which cannot be read are skipped.
+func (s *Store) List() ([]Session, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, errors.WrapPrefix(err, "cannot read sessions directory", 0)
+	}
+	sessions := make([]Session, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), fileExtension) {
+			continue
+		}
+		session, err := s.Load(strings.TrimSuffix(entry.Name(), fileExtension))
+		if err != nil {
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+	slices.SortFunc(sessions, func(a Session, b Session) int {
+		return b.UpdatedAt.Compare(a.UpdatedAt)
+	})
+	return sessions, nil
+}
+
+// Latest returns the most recently updated session.
+func (s *Store) Latest() (Session, error) {
+	sessions, err := s.List()
+	if err != nil {
+		return Session{}, err
+	}
+	if len(sessions) == 0 {
+		return Session{}, ErrSessionNotFound
+	}
+	return sessions[0], nil
+}
+
+func (s *Store) path(name string) string {
+	return filepath.Join(s.dir, name+fileExtension)
+}
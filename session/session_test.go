@@ -0,0 +1,84 @@
+package session_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jlcheng/jcllm/llm"
+	"github.com/jlcheng/jcllm/session"
+)
+
+func TestStore(t *testing.T) {
+	store := session.NewStore(t.TempDir())
+
+	if _, err := store.Latest(); !errors.Is(err, session.ErrSessionNotFound) {
+		t.Errorf("Latest() error = %v; want ErrSessionNotFound for an empty store", err)
+	}
+
+	first := &session.Session{
+		Name:         "first",
+		Provider:     "gemini",
+		Model:        "gemini-2.0-flash",
+		SystemPrompt: "Be concise.",
+		Conversation: llm.Conversation{Entries: []llm.ChatEntry{
+			llm.NewTextEntry(llm.RoleUser, "Hello"),
+			llm.NewTextEntry(llm.RoleAssistant, "Hi!"),
+		}},
+	}
+	if err := store.Save(first); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	second := &session.Session{Name: "second", Provider: "openai", Model: "gpt-4o"}
+	if err := store.Save(second); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	loaded, err := store.Load("first")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !reflect.DeepEqual(loaded.Conversation, first.Conversation) || loaded.Model != first.Model || loaded.SystemPrompt != first.SystemPrompt {
+		t.Errorf("Load() = %+v; want %+v", loaded, first)
+	}
+
+	latest, err := store.Latest()
+	if err != nil || latest.Name != "second" {
+		t.Errorf("Latest() = %q, %v; want second", latest.Name, err)
+	}
+
+	sessions, err := store.List()
+	if err != nil || len(sessions) != 2 || sessions[1].Name != "first" {
+		t.Errorf("List() = %+v, %v; want second, first", sessions, err)
+	}
+}
+
+func TestStore_Errors(t *testing.T) {
+	store := session.NewStore(t.TempDir())
+	if _, err := store.Load("missing"); !errors.Is(err, session.ErrSessionNotFound) {
+		t.Errorf("Load(missing) error = %v; want ErrSessionNotFound", err)
+	}
+	if err := store.Save(&session.Session{Name: "../escape"}); !errors.Is(err, session.ErrInvalidName) {
+		t.Errorf("Save(../escape) error = %v; want ErrInvalidName", err)
+	}
+	if _, err := store.Load("../escape"); !errors.Is(err, session.ErrInvalidName) {
+		t.Errorf("Load(../escape) error = %v; want ErrInvalidName", err)
+	}
+}
+
+func TestStore_NewName(t *testing.T) {
+	store := session.NewStore(t.TempDir())
+	names := make(map[string]bool)
+	for range 3 {
+		name := store.NewName()
+		if names[name] {
+			t.Fatalf("NewName() = %s; want a name which is not in use", name)
+		}
+		names[name] = true
+		if err := store.Save(&session.Session{Name: name}); err != nil {
+			t.Fatalf("Save(%s) error = %v", name, err)
+		}
+	}
+}
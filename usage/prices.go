@@ -0,0 +1,101 @@
+package usage
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+
+	"github.com/go-errors/errors"
+
+	"github.com/jlcheng/jcllm/configuration"
+	"github.com/jlcheng/jcllm/configuration/keys"
+	"github.com/jlcheng/jcllm/llm"
+)
+
+// Price is the price of a model, in dollars per million tokens. Model may be a glob, such as "gemini-1.5-flash*".
+// CachedInput is the price of the input tokens read from the prompt cache, which defaults to Input.
+type Price struct {
+	Model       string
+	Input       float64
+	CachedInput float64
+	Output      float64
+}
+
+// Prices are tried in order, so specific models should come before the globs which also match them.
+type Prices []Price
+
+// Cost returns the cost of usage in dollars, and false if no price matches the model.
+func (prices Prices) Cost(model string, usage llm.Usage) (float64, bool) {
+	for _, price := range prices {
+		if matched, err := path.Match(price.Model, model); err != nil || !matched {
+			continue
+		}
+		cost := float64(usage.InputTokens-usage.CachedTokens)*price.Input +
+			float64(usage.CachedTokens)*price.CachedInput +
+			float64(usage.OutputTokens)*price.Output
+		return cost / 1e6, true
+	}
+	return 0, false
+}
+
+// PricesFromConfig reads the `[[prices]]` tables of the configuration, e.g.:
+//
+//	[[prices]]
+//	model="gpt-4o"
+//	input=2.50
+//	cached-input=1.25
+//	output=10.00
+func PricesFromConfig(config configuration.Configuration) (Prices, error) {
+	var prices Prices
+	for _, table := range configuration.Tables(config, keys.OptionPrices) {
+		price := Price{CachedInput: -1}
+		for name, value := range table {
+			var err error
+			switch name {
+			case "model":
+				price.Model = fmt.Sprint(value)
+			case "input":
+				price.Input, err = toPrice(value)
+			case "cached-input":
+				price.CachedInput, err = toPrice(value)
+			case "output":
+				price.Output, err = toPrice(value)
+			default:
+				err = errors.Errorf("unknown key %q, expected model, input, cached-input, or output", name)
+			}
+			if err != nil {
+				return nil, errors.WrapPrefix(err, fmt.Sprintf("invalid %s for model %v", keys.OptionPrices, table["model"]), 0)
+			}
+		}
+		if price.Model == "" {
+			return nil, errors.Errorf("every table of %s needs a model", keys.OptionPrices)
+		}
+		if price.CachedInput < 0 {
+			price.CachedInput = price.Input
+		}
+		prices = append(prices, price)
+	}
+	return prices, nil
+}
+
+// toPrice accepts the numbers of the configuration file, which are int64 when they have no decimal point.
+func toPrice(value any) (float64, error) {
+	var price float64
+	switch v := value.(type) {
+	case float64:
+		price = v
+	case int64:
+		price = float64(v)
+	case int:
+		price = float64(v)
+	default:
+		var err error
+		if price, err = strconv.ParseFloat(fmt.Sprint(value), 64); err != nil {
+			return 0, errors.Errorf("%v is not a number", value)
+		}
+	}
+	if price < 0 {
+		return 0, errors.Errorf("%v is negative", value)
+	}
+	return price, nil
+}
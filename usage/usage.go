@@ -0,0 +1,175 @@
+// Package usage prices the tokens of responses, and keeps a ledger of them across sessions.
+package usage
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/go-errors/errors"
+
+	"github.com/jlcheng/jcllm/configuration"
+	"github.com/jlcheng/jcllm/configuration/keys"
+	"github.com/jlcheng/jcllm/llm"
+)
+
+type (
+	// Record is the usage of a response, as appended to the ledger. Cost is in dollars, and nil if the model has no
+	// price.
+	Record struct {
+		Time     time.Time `json:"time"`
+		Provider string    `json:"provider"`
+		Model    string    `json:"model"`
+		llm.Usage
+		Cost *float64 `json:"cost,omitempty"`
+	}
+
+	// Total sums records. Unpriced counts the requests whose model has no price, which are missing from Cost.
+	Total struct {
+		Requests int `json:"requests"`
+		llm.Usage
+		Cost     float64 `json:"cost"`
+		Unpriced int     `json:"unpriced,omitempty"`
+	}
+
+	// Row is the total of a day, provider, and model.
+	Row struct {
+		Day      string `json:"day"`
+		Provider string `json:"provider"`
+		Model    string `json:"model"`
+		Total
+	}
+)
+
+// Add adds a record to the total.
+func (t *Total) Add(record Record) {
+	t.Requests++
+	t.Usage.Add(record.Usage)
+	if record.Cost != nil {
+		t.Cost += *record.Cost
+	} else {
+		t.Unpriced++
+	}
+}
+
+// Summarize sums the records by day, provider, and model, sorted in that order. Days are in local time.
+func Summarize(records []Record) []Row {
+	var rows []Row
+	index := make(map[Row]int)
+	for _, record := range records {
+		key := Row{Day: record.Time.Local().Format(time.DateOnly), Provider: record.Provider, Model: record.Model}
+		i, ok := index[key]
+		if !ok {
+			i = len(rows)
+			index[key] = i
+			rows = append(rows, key)
+		}
+		rows[i].Add(record)
+	}
+	slices.SortFunc(rows, func(a, b Row) int {
+		return cmp.Or(cmp.Compare(a.Day, b.Day), cmp.Compare(a.Provider, b.Provider), cmp.Compare(a.Model, b.Model))
+	})
+	return rows
+}
+
+// Ledger is a JSONL file of records. It is safe for concurrent use. A ledger without a path records nothing.
+type Ledger struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewLedger(path string) *Ledger {
+	if path != "" {
+		path = os.ExpandEnv(path)
+	}
+	return &Ledger{path: path}
+}
+
+// Append adds a record at the end of the ledger.
+func (l *Ledger) Append(record Record) error {
+	if l.path == "" {
+		return nil
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return errors.WrapPrefix(err, "cannot encode usage record", 0)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o700); err != nil {
+		return errors.WrapPrefix(err, "cannot create usage ledger directory", 0)
+	}
+	file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return errors.WrapPrefix(err, "cannot open usage ledger", 0)
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		_ = file.Close()
+		return errors.WrapPrefix(err, "cannot write usage ledger", 0)
+	}
+	if err := file.Close(); err != nil {
+		return errors.WrapPrefix(err, "cannot write usage ledger", 0)
+	}
+	return nil
+}
+
+// Read returns the records of the ledger made at or after since. A missing ledger has no records.
+func (l *Ledger) Read(since time.Time) ([]Record, error) {
+	if l.path == "" {
+		return nil, nil
+	}
+	file, err := os.Open(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "cannot open usage ledger", 0)
+	}
+	defer file.Close()
+	var records []Record
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record Record
+		// A crash may leave a truncated last line behind, which is skipped
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue
+		}
+		if !record.Time.Before(since) {
+			records = append(records, record)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.WrapPrefix(err, "cannot read usage ledger", 0)
+	}
+	return records, nil
+}
+
+// Meter prices the usage of responses and records it in the ledger.
+type Meter struct {
+	Prices Prices
+	Ledger *Ledger
+}
+
+// NewMeter creates a meter from the prices and the ledger of the configuration.
+func NewMeter(config configuration.Configuration) (*Meter, error) {
+	prices, err := PricesFromConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return &Meter{Prices: prices, Ledger: NewLedger(config.String(keys.OptionUsageLedger))}, nil
+}
+
+// Record prices the usage of a response and appends it to the ledger. The record is returned even if the ledger
+// cannot be written.
+func (m *Meter) Record(provider string, model string, usage llm.Usage) (Record, error) {
+	record := Record{Time: time.Now(), Provider: provider, Model: model, Usage: usage}
+	if cost, ok := m.Prices.Cost(model, usage); ok {
+		record.Cost = &cost
+	}
+	return record, m.Ledger.Append(record)
+}
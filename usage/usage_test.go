@@ -0,0 +1,94 @@
+package usage_test
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jlcheng/jcllm/configuration/keys"
+	"github.com/jlcheng/jcllm/llm"
+	"github.com/jlcheng/jcllm/usage"
+	"github.com/knadh/koanf/parsers/toml"
+	"github.com/knadh/koanf/providers/file"
+	"github.com/knadh/koanf/v2"
+)
+
+func TestMeter(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "jcllm.toml")
+	content := `
+[[prices]]
+model = "gpt-4o-mini"
+input = 0.15
+output = 0.6
+
+[[prices]]
+model = "gpt-4o*"
+input = 2.5
+cached-input = 1.25
+output = 10
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := koanf.New(".")
+	if err := config.Load(file.Provider(path), toml.Parser()); err != nil {
+		t.Fatal(err)
+	}
+	_ = config.Set(keys.OptionUsageLedger, filepath.Join(dir, "usage", "ledger.jsonl"))
+	meter, err := usage.NewMeter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokens := llm.Usage{InputTokens: 1_000_000, CachedTokens: 400_000, OutputTokens: 100_000, ReasoningTokens: 50_000}
+	tests := []struct {
+		model string
+		want  float64
+	}{
+		// The first matching price wins, so the glob does not apply to gpt-4o-mini
+		{"gpt-4o-mini", 0.15 + 0.06},
+		{"gpt-4o-2024-11-20", 0.6*2.5 + 0.4*1.25 + 0.1*10},
+	}
+	for _, tt := range tests {
+		record, err := meter.Record("openai", tt.model, tokens)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if record.Cost == nil || math.Abs(*record.Cost-tt.want) > 1e-9 {
+			t.Errorf("Record(%s).Cost = %v; want %g", tt.model, record.Cost, tt.want)
+		}
+	}
+	record, err := meter.Record("gemini", "gemini-2.0-flash", llm.Usage{InputTokens: 10, OutputTokens: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Cost != nil {
+		t.Errorf("Record(gemini-2.0-flash).Cost = %g; want nil for a model without a price", *record.Cost)
+	}
+
+	records, err := meter.Ledger.Read(time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || records[0].Model != "gpt-4o-mini" || records[0].ReasoningTokens != 50_000 {
+		t.Fatalf("ledger = %+v; want the 3 records", records)
+	}
+	rows := usage.Summarize(records)
+	if len(rows) != 3 || rows[0].Provider != "gemini" || rows[0].Unpriced != 1 || rows[1].Model != "gpt-4o-2024-11-20" {
+		t.Errorf("Summarize() = %+v; want one row per model, sorted by provider and model", rows)
+	}
+	if records, _ := meter.Ledger.Read(time.Now().Add(time.Hour)); len(records) != 0 {
+		t.Errorf("Read(an hour from now) = %+v; want no records", records)
+	}
+}
+
+func TestPricesFromConfig_Invalid(t *testing.T) {
+	config := koanf.New(".")
+	_ = config.Set(keys.OptionPrices, []any{map[string]any{"model": "gpt-4o", "input": "cheap"}})
+	if _, err := usage.PricesFromConfig(config); err == nil {
+		t.Error("PricesFromConfig() = nil; want an error for a price which is not a number")
+	}
+}